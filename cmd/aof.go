@@ -5,11 +5,12 @@ import (
 	"context"
 	"fmt"
 	"io"
-	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 
 	"github.com/mgtv-tech/redis-GunYu/config"
+	"github.com/mgtv-tech/redis-GunYu/pkg/crypto"
 	"github.com/mgtv-tech/redis-GunYu/pkg/log"
 	"github.com/mgtv-tech/redis-GunYu/pkg/redis/client"
 	"github.com/mgtv-tech/redis-GunYu/pkg/store"
@@ -53,36 +54,44 @@ func (rc *AofCmd) Run() error {
 	return nil
 }
 
-const (
-	headerSize = int64(16)
-)
+// openAofData opens the aof file at path, and seeks to the logical offset start
+func openAofData(path string, start int64) (*store.AofDataReader, error) {
+	left, err := strconv.ParseInt(strings.TrimSuffix(filepath.Base(path), ".aof"), 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	var keyring *crypto.Keyring
+	if keyFile := config.GetFlag().AofCmd.KeyFile; keyFile != "" {
+		keyring, err = crypto.LoadKeyring(keyFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	file, err := store.NewAofDataReader(path, keyring)
+	if err != nil {
+		return nil, err
+	}
+	if start > left {
+		if err = file.SeekTo(start - left); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	return file, nil
+}
 
 func (rc *AofCmd) Cmd() {
 	aofPath := config.GetFlag().AofCmd.Path
 	start := config.GetFlag().AofCmd.Offset
 	size := config.GetFlag().AofCmd.Size
 
-	fi, err := os.Stat(aofPath)
-	util.PanicIfErr(err)
-
-	left, err := strconv.ParseInt(strings.TrimSuffix(fi.Name(), ".aof"), 10, 64)
+	file, err := openAofData(aofPath, start)
 	util.PanicIfErr(err)
-
-	if size <= 0 {
-		size = fi.Size() - headerSize
-	} else if size > fi.Size()-headerSize {
-		size = fi.Size() - headerSize
-	}
-	if start < left {
-		start = left
-	}
-
-	file, err := os.OpenFile(aofPath, os.O_RDONLY, 0777)
-	util.PanicIfErr(err)
-
-	if start > 0 {
-		_, err = file.Seek(start-left+headerSize, 0)
-		util.PanicIfErr(err)
+	defer file.Close()
+	if size <= 0 || size > file.Size() {
+		size = file.Size()
 	}
 
 	decoder := client.NewDecoder(bufio.NewReader(file))
@@ -109,27 +118,11 @@ func (rc *AofCmd) Parse() {
 	start := config.GetFlag().AofCmd.Offset
 	size := config.GetFlag().AofCmd.Size
 
-	fi, err := os.Stat(aofPath)
-	util.PanicIfErr(err)
-
-	left, err := strconv.ParseInt(strings.TrimSuffix(fi.Name(), ".aof"), 10, 64)
+	file, err := openAofData(aofPath, start)
 	util.PanicIfErr(err)
-
-	if size <= 0 {
-		size = fi.Size() - headerSize
-	} else if size > fi.Size()-headerSize {
-		size = fi.Size() - headerSize
-	}
-	if start < left {
-		start = left
-	}
-
-	file, err := os.OpenFile(aofPath, os.O_RDONLY, 0777)
-	util.PanicIfErr(err)
-
-	if start > 0 {
-		_, err = file.Seek(start-left+headerSize, 0)
-		util.PanicIfErr(err)
+	defer file.Close()
+	if size <= 0 || size > file.Size() {
+		size = file.Size()
 	}
 
 	buf := make([]byte, 1024*4)
@@ -0,0 +1,135 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/mgtv-tech/redis-GunYu/config"
+	"github.com/mgtv-tech/redis-GunYu/pkg/log"
+	"github.com/mgtv-tech/redis-GunYu/pkg/redis"
+	"github.com/mgtv-tech/redis-GunYu/pkg/redis/client"
+	"github.com/mgtv-tech/redis-GunYu/pkg/util"
+	"github.com/mgtv-tech/redis-GunYu/syncer"
+)
+
+// DeadLetterCmd prints or re-drives commands of a dead-letter file written by the reply error policy of replay
+type DeadLetterCmd struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func NewDeadLetterCmd() *DeadLetterCmd {
+	ctx, c := context.WithCancel(context.Background())
+	return &DeadLetterCmd{
+		ctx:    ctx,
+		cancel: c,
+	}
+}
+
+func (dc *DeadLetterCmd) Name() string {
+	return "redis.deadletter"
+}
+
+func (dc *DeadLetterCmd) Stop() error {
+	dc.cancel()
+	return nil
+}
+
+func (dc *DeadLetterCmd) Run() error {
+	cfg := config.GetDeadLetterCmdConfig()
+	switch cfg.Action {
+	case "print":
+		util.PanicIfErr(dc.Print(cfg.Path))
+	case "redrive":
+		util.PanicIfErr(dc.Redrive(cfg.Path, cfg.Redis, cfg.Bidirectional))
+	default:
+		panic(fmt.Errorf("unknown action : %s", cfg.Action))
+	}
+	return nil
+}
+
+func (dc *DeadLetterCmd) Print(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return syncer.ReadDeadLetters(file, func(dl *syncer.DeadLetter) error {
+		fmt.Printf("{\"offset\":%d, \"db\":%d, \"error\":%q, \"cmd\":%q, \"args\":%q}\n", dl.Offset, dl.Db, dl.Error, dl.Cmd, dl.Args)
+		return dc.ctx.Err()
+	})
+}
+
+// Redrive executes commands of the dead-letter file in order, commands which fail again are written to path.failed.
+// If bidirectional is true, every command is executed in a transaction beginning with the marker of bidirectional sync.
+func (dc *DeadLetterCmd) Redrive(path string, redisCfg *config.RedisConfig, bidirectional bool) error {
+	if err := redis.FixTopology(redisCfg); err != nil {
+		return err
+	}
+	if bidirectional && !redisCfg.IsStanalone() {
+		return fmt.Errorf("bidirectional requires standalone redis : %v", redisCfg.Addresses)
+	}
+	cli, err := client.NewRedis(*redisCfg)
+	if err != nil {
+		return err
+	}
+	defer cli.Close()
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	failedPath := path + ".failed"
+	succ, fail := 0, 0
+	err = syncer.ReadDeadLetters(file, func(dl *syncer.DeadLetter) error {
+		if err := dc.ctx.Err(); err != nil {
+			return err
+		}
+		batcher := cli.NewBatcher(false)
+		if !redisCfg.IsCluster() {
+			batcher.Put("select", dl.Db)
+		}
+		if bidirectional {
+			batcher.Put("multi")
+			syncer.PutMarker(batcher, syncer.BidirectionalMarkerKey, "deadletter")
+		}
+		args := make([]interface{}, 0, len(dl.Args))
+		for _, arg := range dl.Args {
+			args = append(args, arg)
+		}
+		batcher.Put(dl.Cmd, args...)
+		if bidirectional {
+			batcher.Put("exec")
+		}
+
+		rets, err := batcher.Exec()
+		if err == nil && bidirectional && len(rets) > 0 {
+			// replies of the transaction are replied by exec
+			if txnRets, ok := rets[len(rets)-1].([]interface{}); ok {
+				rets = append(rets[:len(rets)-1], txnRets...)
+			}
+		}
+		if err == nil {
+			for _, ret := range rets {
+				if rerr, ok := ret.(error); ok {
+					err = rerr
+					break
+				}
+			}
+		}
+		if err == nil {
+			succ++
+			return nil
+		}
+		fail++
+		log.Errorf("redrive dead letter error : offset(%d), db(%d), cmd(%s), error(%v)", dl.Offset, dl.Db, dl.Cmd, err)
+		dl.Error = err.Error()
+		return syncer.WriteDeadLetter(failedPath, dl)
+	})
+	log.Infof("redrive dead letters : path(%s), succeeded(%d), failed(%d), failedPath(%s)", path, succ, fail, failedPath)
+	return err
+}
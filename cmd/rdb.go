@@ -115,12 +115,19 @@ func (rc *RdbCmd) Load(rdbPath string, cfg *config.RdbCmdLoad) error {
 	defer piper.Close()
 	buf := bufio.NewReaderSize(piper, readBufSize)
 
-	rdbRd, err := store.NewRdbReaderFromFile(pipew, rdbPath, false)
+	rdbRd, err := store.NewRdbReaderFromFile(pipew, rdbPath, false, nil)
 	if err != nil {
 		return err
 	}
 
-	err = redis.FixVersion(cfg.Redis)
+	if cfg.DryRun {
+		// the target isn't connected
+		if len(cfg.Redis.Version) == 0 {
+			err = errors.New("version of target is unknown")
+		}
+	} else {
+		err = redis.FixVersion(cfg.Redis)
+	}
 	if err != nil {
 		log.Warnf("failed to get version from target redis, instead get version from rdb!")
 		redisVersion, err := rdb.ParseRdbVersion(rdbRd.GetReader())
@@ -131,8 +138,10 @@ func (rc *RdbCmd) Load(rdbPath string, cfg *config.RdbCmdLoad) error {
 		log.Infof("redis rdb version : %s", redisVersion)
 		cfg.Redis.Version = redisVersion
 	}
-	if err = redis.FixTopology(cfg.Redis); err != nil {
-		return err
+	if !cfg.DryRun {
+		if err = redis.FixTopology(cfg.Redis); err != nil {
+			return err
+		}
 	}
 
 	reader := store.NewReader(buf, rdbRd, nil, 0, rdbRd.Size(), "")
@@ -147,6 +156,8 @@ func (rc *RdbCmd) Load(rdbPath string, cfg *config.RdbCmdLoad) error {
 		ReplaceHashTag:             cfg.Replay.ReplaceHashTag,
 		KeyExists:                  cfg.Replay.KeyExists,
 		KeyExistsLog:               cfg.Replay.KeyExistsLog,
+		KeyMerge:                   cfg.Replay.KeyMerge,
+		Scripts:                    cfg.Replay.Scripts,
 		FunctionExists:             cfg.Replay.FunctionExists,
 		MaxProtoBulkLen:            cfg.Replay.MaxProtoBulkLen,
 		TargetDb:                   cfg.Replay.TargetDb,
@@ -160,9 +171,18 @@ func (rc *RdbCmd) Load(rdbPath string, cfg *config.RdbCmdLoad) error {
 		UpdateCheckpointTicker:     cfg.Replay.UpdateCheckpointTicker,
 		Stats:                      cfg.Replay.Stats,
 		Filter:                     cfg.Filter,
+		KeyRename:                  cfg.Replay.KeyRename,
+		Ttl:                        cfg.Ttl,
+		RateLimit:                  &cfg.Replay.RateLimit,
 		SyncDelayTestKey:           "",
 	}
 
+	if cfg.DryRun {
+		output := syncer.NewDryRunOutput(syncer.DryRunOutputConfig{InputName: outputCfg.InputName, Parser: outputCfg})
+		defer output.Close()
+		return output.SendRdb(rc.ctx, reader)
+	}
+
 	output := syncer.NewRedisOutput(outputCfg)
 
 	return output.SendRdb(rc.ctx, reader)
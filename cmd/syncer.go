@@ -106,7 +106,7 @@ func (sc *SyncerCmd) Run() error {
 			//  transaction mode :
 			//  non-transaction mode :
 			// ask :
-			if errors.Is(err, common.ErrAsk) {
+			if errors.Is(err, common.ErrAsk) && config.GetSyncerConfig().Output.IsRedis() {
 				config.GetSyncerConfig().Output.Redis.SetMigrating(true)
 			}
 		}
@@ -132,8 +132,92 @@ func (sc *SyncerCmd) Run() error {
 	return sc.waitCloser.Error()
 }
 
-func (sc *SyncerCmd) syncerConfigs() (cfgs []syncer.SyncerConfig, watchInput bool, watchOutput bool, txnMode bool, err error) {
-	inputRedis := config.GetSyncerConfig().Input.Redis
+// syncerConfigs returns configurations of syncers of input and sources,
+// watchInputs is in the same order as config.SyncConfig.Inputs
+func (sc *SyncerCmd) syncerConfigs() (cfgs []syncer.SyncerConfig, watchInputs []bool, watchOutput bool, txnMode bool, err error) {
+	outputRedis := config.GetSyncerConfig().Output.Redis
+
+	for _, inputCfg := range config.GetSyncerConfig().Inputs() {
+		inCfgs, watchIn, watchOut, inTxnMode, inErr := sc.inputSyncerConfigs(inputCfg)
+		if inErr != nil {
+			err = inErr
+			return
+		}
+		for _, cfg := range inCfgs {
+			cfg.Id = len(cfgs)
+			cfg.Source = inputCfg
+			cfgs = append(cfgs, cfg)
+		}
+		watchInputs = append(watchInputs, watchIn)
+		watchOutput = watchOutput || watchOut
+		txnMode = txnMode || inTxnMode
+	}
+
+	// extra outputs : a cluster is shared by all syncers, standalone addresses are indexed like output
+	for _, extra := range config.GetSyncerConfig().Outputs {
+		extraRedis := extra.Redis
+		if !extra.IsRedis() {
+			for i := 0; i < len(cfgs); i++ {
+				cfgs[i].Outputs = append(cfgs[i].Outputs, config.RedisConfig{})
+			}
+			continue
+		}
+		if extraRedis.IsStanalone() && len(extraRedis.Addresses) != 1 && len(extraRedis.Addresses) != len(cfgs) {
+			err = errors.Join(syncer.ErrQuit, fmt.Errorf("the amount of output redis does not equal syncers : output(%s), %d != %d",
+				extra.Name, len(extraRedis.Addresses), len(cfgs)))
+			sc.logger.Errorf("%v", err)
+			return
+		}
+		for i := 0; i < len(cfgs); i++ {
+			if extraRedis.IsStanalone() && len(extraRedis.Addresses) > 1 {
+				cfgs[i].Outputs = append(cfgs[i].Outputs, extraRedis.Index(i))
+			} else {
+				cfgs[i].Outputs = append(cfgs[i].Outputs, *extraRedis)
+			}
+		}
+	}
+
+	if len(cfgs) > 0 {
+		maxSize := config.GetSyncerConfig().Channel.Storer.MaxSize / int64(len(cfgs))
+		for i := 0; i < len(cfgs); i++ {
+			cfgs[i].Channel.Storer.MaxSize = maxSize
+		}
+		if memory := config.GetSyncerConfig().Channel.Memory; memory.Enabled() {
+			memMaxSize := memory.MaxSize / int64(len(cfgs))
+			for i := 0; i < len(cfgs); i++ {
+				cfgs[i].Channel.Memory.MaxSize = memMaxSize
+			}
+		}
+		if remote := config.GetSyncerConfig().Channel.Storer.Remote; remote.Enabled() {
+			remoteMaxSize := remote.MaxSize / int64(len(cfgs))
+			for i := 0; i < len(cfgs); i++ {
+				cfgs[i].Channel.Storer.Remote.MaxSize = remoteMaxSize
+			}
+		}
+	}
+
+	if outputRedis != nil && outputRedis.IsCluster() && txnMode {
+		migrating, err := checkMigrating(sc.waitCloser.Context(), *outputRedis)
+		if err != nil {
+			sc.logger.Errorf("check migrating : %v", err)
+			migrating = true
+		}
+		if migrating {
+			for i := 0; i < len(cfgs); i++ {
+				cfgs[i].CanTransaction = false
+			}
+			if err == nil {
+				outputRedis.SetMigrating(true)
+			}
+			txnMode = false
+		}
+	}
+	return
+}
+
+// inputSyncerConfigs returns configurations of syncers of an input
+func (sc *SyncerCmd) inputSyncerConfigs(inputCfg *config.InputConfig) (cfgs []syncer.SyncerConfig, watchInput bool, watchOutput bool, txnMode bool, err error) {
+	inputRedis := inputCfg.Redis
 	outputRedis := config.GetSyncerConfig().Output.Redis
 
 	// 1. standalone <-> standalone  ==> multi/exec
@@ -144,11 +228,29 @@ func (sc *SyncerCmd) syncerConfigs() (cfgs []syncer.SyncerConfig, watchInput boo
 	//		4.2 slots arenot matched, update checkpoint periodically
 	// 5. cluster : if cluster
 
-	syncFrom := config.GetSyncerConfig().Input.SyncFrom
-	inputMode := config.GetSyncerConfig().Input.Mode
+	syncFrom := inputCfg.SyncFrom
+	inputMode := inputCfg.Mode
 	enableTransaction := *config.GetSyncerConfig().Output.Replay.ReplayTransaction
 
-	if outputRedis.IsStanalone() {
+	if !config.GetSyncerConfig().Output.IsRedis() {
+		// changes are emitted as events, a syncer per input node
+		if !inputRedis.IsStanalone() && !inputRedis.IsCluster() && !inputRedis.IsSentinel() {
+			err = errors.Join(syncer.ErrQuit, fmt.Errorf("does not support redis type : addr(%s), type(%v)", inputRedis.Address(), inputRedis.Type))
+			sc.logger.Errorf("%v", err)
+			return
+		}
+		inputs := inputRedis.SelNodes(inputRedis.IsCluster() && inputMode != config.InputModeStatic, syncFrom)
+		for i, source := range inputs {
+			source.Type = config.RedisTypeStandalone
+			cfgs = append(cfgs, syncer.SyncerConfig{
+				Id:             i,
+				CanTransaction: false,
+				Input:          source,
+				Channel:        *config.GetSyncerConfig().Channel.Clone(),
+			})
+		}
+		watchInput = inputRedis.IsCluster() || inputRedis.IsSentinel()
+	} else if outputRedis.IsStanalone() {
 		// standalone <-> standalone  ==> multi/exec
 		if inputRedis.IsStanalone() {
 			// @TODO auto sharding
@@ -172,9 +274,9 @@ func (sc *SyncerCmd) syncerConfigs() (cfgs []syncer.SyncerConfig, watchInput boo
 				}
 				cfgs = append(cfgs, scg)
 			}
-		} else if inputRedis.IsCluster() {
+		} else if inputRedis.IsCluster() || inputRedis.IsSentinel() {
 			if len(outputRedis.Addresses) != 1 { // @TODO
-				err = errors.Join(syncer.ErrQuit, fmt.Errorf("input redis is cluster typology, but output redis is not standalone : %v", outputRedis.Addresses))
+				err = errors.Join(syncer.ErrQuit, fmt.Errorf("input redis is %s typology, but output redis is not standalone : %v", inputRedis.Type, outputRedis.Addresses))
 				sc.logger.Errorf("%v", err)
 				return
 			}
@@ -206,9 +308,10 @@ func (sc *SyncerCmd) syncerConfigs() (cfgs []syncer.SyncerConfig, watchInput boo
 			return
 		}
 	} else if outputRedis.IsCluster() {
-		if inputRedis.IsStanalone() { // standalone <-> cluster     ==> multi/exec or update periodically
+		if inputRedis.IsStanalone() || inputRedis.IsSentinel() { // standalone <-> cluster     ==> multi/exec or update periodically
 			inputs := inputRedis.SelNodes(false, syncFrom)
 			for i, source := range inputs {
+				source.Type = config.RedisTypeStandalone
 				cfgs = append(cfgs, syncer.SyncerConfig{
 					Id:             i,
 					CanTransaction: false,
@@ -217,6 +320,8 @@ func (sc *SyncerCmd) syncerConfigs() (cfgs []syncer.SyncerConfig, watchInput boo
 					Channel:        *config.GetSyncerConfig().Channel.Clone(),
 				})
 			}
+			// master of sentinel may be switched
+			watchInput = inputRedis.IsSentinel()
 		} else if inputRedis.IsCluster() { // cluster    <-> cluster     ==> dynamical : multi/exec or update periodically
 			watchInput = true
 			// @TODO for static mode(InputMode), just need to check slots
@@ -298,10 +403,10 @@ func (sc *SyncerCmd) syncerConfigs() (cfgs []syncer.SyncerConfig, watchInput boo
 		watchOutput = true
 	}
 
-	if len(cfgs) > 0 {
-		maxSize := config.GetSyncerConfig().Channel.Storer.MaxSize / int64(len(cfgs))
+	// keys of a rewritten prefix or renamed keys may belong to other slots
+	if inputCfg.KeyPrefix != nil || len(config.GetSyncerConfig().Output.Replay.KeyRename) > 0 {
 		for i := 0; i < len(cfgs); i++ {
-			cfgs[i].Channel.Storer.MaxSize = maxSize
+			cfgs[i].CanTransaction = false
 		}
 	}
 
@@ -329,22 +434,6 @@ func (sc *SyncerCmd) syncerConfigs() (cfgs []syncer.SyncerConfig, watchInput boo
 			txnMode = false
 		}
 	}
-	if outputRedis.IsCluster() && txnMode {
-		migrating, err := checkMigrating(sc.waitCloser.Context(), *outputRedis)
-		if err != nil {
-			sc.logger.Errorf("check migrating : %v", err)
-			migrating = true
-		}
-		if migrating {
-			for i := 0; i < len(cfgs); i++ {
-				cfgs[i].CanTransaction = false
-			}
-			if err == nil {
-				outputRedis.SetMigrating(true)
-			}
-			txnMode = false
-		}
-	}
 	return
 }
 
@@ -362,12 +451,13 @@ func checkMigrating(ctx context.Context, redisCfg config.RedisConfig) (bool, err
 		}
 		conGroup.Go(func(ctx context.Context) error {
 			cli, err := client.NewRedis(config.RedisConfig{
-				Addresses: []string{node.Address},
-				UserName:  redisCfg.UserName,
-				Password:  redisCfg.Password,
-				TlsEnable: redisCfg.TlsEnable,
-				Type:      config.RedisTypeStandalone,
-				Version:   redisCfg.Version,
+				Addresses:  []string{node.Address},
+				UserName:   redisCfg.UserName,
+				Password:   redisCfg.Password,
+				TlsEnable:  redisCfg.TlsEnable,
+				TlsOptions: redisCfg.TlsOptions,
+				Type:       config.RedisTypeStandalone,
+				Version:    redisCfg.Version,
 			})
 			if err != nil {
 				return err
@@ -441,13 +531,18 @@ func (sc *SyncerCmd) run() error {
 	sc.mutex.Unlock()
 
 	// syncer configurations
-	cfgs, watchIn, watchOut, txnMode, err := sc.syncerConfigs()
+	cfgs, watchIns, watchOut, txnMode, err := sc.syncerConfigs()
 	if err != nil {
 		return err
 	}
 
-	if watchIn || watchOut {
-		sc.checkTypology(runWait, watchIn, watchOut, txnMode)
+	for i, inputCfg := range config.GetSyncerConfig().Inputs() {
+		// output is watched with the first input
+		watchIn := watchIns[i]
+		watchOutput := watchOut && i == 0
+		if watchIn || watchOutput {
+			sc.checkTypology(runWait, inputCfg, watchIn, watchOutput, txnMode)
+		}
 	}
 
 	// standalone or cluster mode
@@ -463,7 +558,12 @@ func (sc *SyncerCmd) run() error {
 		cli, err = cluster.NewEtcdCluster(runWait.Context(), *config.GetSyncerConfig().Cluster.MetaEtcd)
 	} else {
 		ttl := int(config.GetSyncerConfig().Cluster.LeaseTimeout / time.Second)
-		cli, err = cluster.NewRedisCluster(runWait.Context(), *config.GetSyncerConfig().Input.Redis, ttl)
+		leaseRedis := *config.GetSyncerConfig().Input.Redis
+		if leaseRedis.IsSentinel() { // sentinels don't store data, use the master
+			leaseRedis = leaseRedis.SelNodes(true, config.SelNodeStrategyMaster)[0]
+			leaseRedis.Type = config.RedisTypeStandalone
+		}
+		cli, err = cluster.NewRedisCluster(runWait.Context(), leaseRedis, ttl)
 	}
 
 	if err != nil {
@@ -744,9 +844,12 @@ func (sc *SyncerCmd) storageSize(ctx context.Context) {
 func (sc *SyncerCmd) gcStaleCheckpoint(ctx context.Context) {
 	sc.logger.Debugf("gc stale checkpoints...")
 
-	// masters and slaves
-	inputs := config.GetSyncerConfig().Input.Redis.SelNodes(true, config.SelNodeStrategyMaster)
-	inputs = append(inputs, config.GetSyncerConfig().Input.Redis.SelNodes(true, config.SelNodeStrategySlave)...)
+	// masters and slaves of input and sources
+	var inputs []config.RedisConfig
+	for _, inputCfg := range config.GetSyncerConfig().Inputs() {
+		inputs = append(inputs, inputCfg.Redis.SelNodes(true, config.SelNodeStrategyMaster)...)
+		inputs = append(inputs, inputCfg.Redis.SelNodes(true, config.SelNodeStrategySlave)...)
+	}
 	runIdMap := make(map[string]struct{}, len(inputs)*2)
 
 	// collect all run IDs
@@ -800,16 +903,21 @@ func (sc *SyncerCmd) gcStaleCheckpoint(ctx context.Context) {
 		}
 	}
 
-	if config.GetSyncerConfig().Output.Redis.Type == config.RedisTypeCluster {
-		cli, err := client.NewRedis(*config.GetSyncerConfig().Output.Redis)
+	outputRedis := config.GetSyncerConfig().Output.Redis
+	if !config.GetSyncerConfig().Output.IsRedis() {
+		// checkpoints of events are kept in the local directory
+		outputRedis = &config.RedisConfig{}
+	}
+	if outputRedis.Type == config.RedisTypeCluster {
+		cli, err := client.NewRedis(*outputRedis)
 		if err != nil {
-			sc.logger.Errorf("new redis error : addr(%s), err(%v)", config.GetSyncerConfig().Output.Redis.Address(), err)
+			sc.logger.Errorf("new redis error : addr(%s), err(%v)", outputRedis.Address(), err)
 			return
 		}
 		gcStaleCp(cli)
 		cli.Close()
-	} else if config.GetSyncerConfig().Output.Redis.Type == config.RedisTypeStandalone {
-		outputs := config.GetSyncerConfig().Output.Redis.SelNodes(true, config.SelNodeStrategyMaster)
+	} else if outputRedis.Type == config.RedisTypeStandalone {
+		outputs := outputRedis.SelNodes(true, config.SelNodeStrategyMaster)
 		for _, out := range outputs {
 			cli, err := client.NewRedis(out)
 			if err != nil {
@@ -870,17 +978,32 @@ func (sc *SyncerCmd) gcStaleCheckpoint(ctx context.Context) {
 //  3. remove shards :
 //     @TODO ensure all data is synced from the removed shard to the output
 //     @TODO corner case : syncer may crash or restart
-func (sc *SyncerCmd) checkTypology(wait usync.WaitCloser,
+func (sc *SyncerCmd) checkTypology(wait usync.WaitCloser, inputCfg *config.InputConfig,
 	watchIn, watchOut, txnMode bool) {
 
-	prevInRedisCfg := config.GetSyncerConfig().Input.Redis.Clone()
-	prevOutRedisCfg := config.GetSyncerConfig().Output.Redis.Clone()
-	allShards := config.GetSyncerConfig().Input.Mode != config.InputModeStatic
-	syncFrom := config.GetSyncerConfig().Input.SyncFrom
+	prevInRedisCfg := inputCfg.Redis.Clone()
+	prevOutRedisCfg := &config.RedisConfig{} // changes are emitted as events
+	if config.GetSyncerConfig().Output.IsRedis() {
+		prevOutRedisCfg = config.GetSyncerConfig().Output.Redis.Clone()
+	}
+	allShards := inputCfg.Mode != config.InputModeStatic
+	syncFrom := inputCfg.SyncFrom
 	interval := config.GetSyncerConfig().Server.CheckRedisTypologyTicker
 
 	sc.logger.Infof("cronjob, check typology of redis cluster : input(%v), output(%v), watch(%v, %v), ticker(%s), txnMode(%v)", prevInRedisCfg.Addresses, prevOutRedisCfg.Addresses, watchIn, watchOut, interval, txnMode)
 
+	// sentinel notifies failover immediately, the ticker is a fallback of missed notifications
+	if watchIn && prevInRedisCfg.IsSentinel() {
+		prevMasters := prevInRedisCfg.SelNodes(true, config.SelNodeStrategyMaster)
+		redis.WatchSentinelSwitchMaster(wait.Context(), prevInRedisCfg, func(master string) {
+			if len(prevMasters) > 0 && prevMasters[0].Address() == master {
+				return
+			}
+			sc.logger.Infof("sentinel switches master : master(%s)", master)
+			wait.Close(syncer.ErrRedisTypologyChanged)
+		})
+	}
+
 	util.CronWithCtx(wait.Context(), interval, func(ctx context.Context) {
 		defer util.RecoverCallback(func(e interface{}) { wait.Close(errors.Join(syncer.ErrRestart, fmt.Errorf("panic : %v", e))) })
 
@@ -1085,22 +1208,34 @@ func (sc *SyncerCmd) diffTypology(ctx context.Context, watchIn bool, watchOut bo
 func (sc *SyncerCmd) fixConfig() (err error) {
 
 	// redis version
-	err = redis.FixVersion(config.GetSyncerConfig().Input.Redis)
-	if err != nil {
-		return
+	for _, inputCfg := range config.GetSyncerConfig().Inputs() {
+		if err = redis.FixVersion(inputCfg.Redis); err != nil {
+			return
+		}
 	}
 
-	err = redis.FixVersion(config.GetSyncerConfig().Output.Redis)
-	if err != nil {
-		return
+	for _, outputCfg := range config.GetSyncerConfig().AllOutputs() {
+		if !outputCfg.IsRedis() {
+			continue
+		}
+		if err = redis.FixVersion(outputCfg.Redis); err != nil {
+			return
+		}
 	}
 
 	// addresses
-	if err = redis.FixTopology(config.GetSyncerConfig().Input.Redis); err != nil {
-		return
+	for _, inputCfg := range config.GetSyncerConfig().Inputs() {
+		if err = redis.FixTopology(inputCfg.Redis); err != nil {
+			return
+		}
 	}
-	if err = redis.FixTopology(config.GetSyncerConfig().Output.Redis); err != nil {
-		return
+	for _, outputCfg := range config.GetSyncerConfig().AllOutputs() {
+		if !outputCfg.IsRedis() {
+			continue
+		}
+		if err = redis.FixTopology(outputCfg.Redis); err != nil {
+			return
+		}
 	}
 
 	// fix concurrency
@@ -7,6 +7,8 @@ import (
 	"net"
 	"net/http"
 	"net/url"
+	"os"
+	"strconv"
 	"strings"
 	"time"
 
@@ -25,6 +27,7 @@ import (
 	"github.com/mgtv-tech/redis-GunYu/pkg/redis/checkpoint"
 	"github.com/mgtv-tech/redis-GunYu/pkg/redis/client"
 	"github.com/mgtv-tech/redis-GunYu/pkg/redis/client/common"
+	"github.com/mgtv-tech/redis-GunYu/pkg/store"
 	usync "github.com/mgtv-tech/redis-GunYu/pkg/sync"
 	"github.com/mgtv-tech/redis-GunYu/pkg/util"
 	"github.com/mgtv-tech/redis-GunYu/syncer"
@@ -169,12 +172,65 @@ func (sc *SyncerCmd) httpHandler(engine *gin.Engine) {
 		sc.gcStaleCheckpoint(sc.getRunWait().Context())
 	})
 
+	storageGroup := engine.Group("/storage/runids")
+	storageGroup.GET("", func(ctx *gin.Context) {
+		infos, err := sc.storeInspector().List()
+		if err != nil {
+			storageError(ctx, err)
+			return
+		}
+		ctx.JSON(http.StatusOK, infos)
+	})
+
+	storageGroup.GET(":runId", func(ctx *gin.Context) {
+		info, err := sc.storeInspector().Get(ctx.Param("runId"))
+		if err != nil {
+			storageError(ctx, err)
+			return
+		}
+		ctx.JSON(http.StatusOK, info)
+	})
+
+	storageGroup.POST(":runId/verify", func(ctx *gin.Context) {
+		left, err := strconv.ParseInt(ctx.DefaultQuery("left", "0"), 10, 64)
+		if err != nil {
+			storageError(ctx, fmt.Errorf("%w : left(%v)", errBadRequest, err))
+			return
+		}
+		right, err := strconv.ParseInt(ctx.DefaultQuery("right", "-1"), 10, 64)
+		if err != nil {
+			storageError(ctx, fmt.Errorf("%w : right(%v)", errBadRequest, err))
+			return
+		}
+		results, err := sc.storeInspector().Verify(ctx.Param("runId"), left, right)
+		if err != nil {
+			storageError(ctx, err)
+			return
+		}
+		ctx.JSON(http.StatusOK, results)
+	})
+
+	storageGroup.DELETE(":runId", func(ctx *gin.Context) {
+		runId := ctx.Param("runId")
+		// a syncer which isn't running has no storer, it resumes from a run id of its input
+		if err := checkInputRunId(runId); err != nil {
+			storageError(ctx, err)
+			return
+		}
+		err := sc.storeInspector().Delete(runId)
+		if err != nil {
+			storageError(ctx, err)
+			return
+		}
+	})
+
 	syncerGroup := engine.Group("/syncer/")
 	type syncerStatus struct {
 		Input       string
 		Role        string
 		Transaction bool
 		State       string
+		DiskPaused  bool // reading from input is paused, free disk space of storer is low
 	}
 	syncerGroup.GET("status", func(ctx *gin.Context) {
 		sys := []syncerStatus{}
@@ -189,6 +245,9 @@ func (sc *SyncerCmd) httpHandler(engine *gin.Engine) {
 			if val.sync.IsLeader() {
 				st.Role = "leader"
 			}
+			if storer := val.sync.Storer(); storer != nil {
+				st.DiskPaused = storer.DiskPaused()
+			}
 			sys = append(sys, st)
 		}
 		sc.mutex.Unlock()
@@ -256,6 +315,82 @@ func (sc *SyncerCmd) httpHandler(engine *gin.Engine) {
 	})
 
 	syncerGroup.POST("fullsync", sc.fullSyncHandler)
+
+	// rate limits of replay, the output query selects an output by name, the main output is selected by default
+	syncerGroup.GET("ratelimit", func(ctx *gin.Context) {
+		ctx.JSON(http.StatusOK, syncer.ReplayLimits())
+	})
+
+	syncerGroup.PUT("ratelimit", func(ctx *gin.Context) {
+		limits := config.ReplayRateLimitConfig{}
+		if err := ctx.ShouldBindJSON(&limits); err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := syncer.SetReplayLimits(ctx.Query("output"), limits); err != nil {
+			code := http.StatusBadRequest
+			if errors.Is(err, syncer.ErrNoReplayLimiter) {
+				code = http.StatusNotFound
+			}
+			ctx.AbortWithStatusJSON(code, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, limits)
+	})
+}
+
+var errBadRequest = errors.New("bad request")
+
+func storageError(ctx *gin.Context, err error) {
+	code := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, errBadRequest), errors.Is(err, store.ErrInvalidRunId):
+		code = http.StatusBadRequest
+	case errors.Is(err, store.ErrRunIdInUse):
+		code = http.StatusConflict
+	case errors.Is(err, os.ErrNotExist):
+		code = http.StatusNotFound
+	}
+	ctx.AbortWithStatusJSON(code, gin.H{"error": err.Error()})
+}
+
+// checkInputRunId returns ErrRunIdInUse if runId is a run id of a node of configured inputs
+func checkInputRunId(runId string) error {
+	for _, inputCfg := range config.GetSyncerConfig().Inputs() {
+		for _, node := range inputCfg.Redis.SelNodes(true, config.SelNodeStrategyMaster) {
+			node.Type = config.RedisTypeStandalone
+			cli, err := client.NewRedis(node)
+			if err != nil {
+				return fmt.Errorf("connect to input : input(%s), error(%w)", node.Address(), err)
+			}
+			id1, id2, err := redis.GetRunIds(cli)
+			cli.Close()
+			if err != nil {
+				return fmt.Errorf("get run ids of input : input(%s), error(%w)", node.Address(), err)
+			}
+			if runId == id1 || runId == id2 {
+				return fmt.Errorf("%w : runId(%s), input(%s)", store.ErrRunIdInUse, runId, node.Address())
+			}
+		}
+	}
+	return nil
+}
+
+// storeInspector inspects storers of running syncers
+func (sc *SyncerCmd) storeInspector() *store.Inspector {
+	storers := []*store.Storer{}
+	sc.mutex.RLock()
+	for _, val := range sc.syncers {
+		if val.sync == nil {
+			continue
+		}
+		if storer := val.sync.Storer(); storer != nil {
+			storers = append(storers, storer)
+		}
+	}
+	sc.mutex.RUnlock()
+	storerCfg := config.GetSyncerConfig().Channel.Storer
+	return store.NewInspector(storerCfg.DirPath, storerCfg.Keyring(), storers)
 }
 
 func (sc *SyncerCmd) parseInputsFromQuery(ctx *gin.Context) []string {
@@ -472,6 +607,9 @@ func (sc *SyncerCmd) takeover(ctx context.Context, inputs []string) error {
 }
 
 func (sc *SyncerCmd) filterOutput(ctx context.Context, inputs []string) ([]config.RedisConfig, error) {
+	if !config.GetSyncerConfig().Output.IsRedis() {
+		return nil, errors.New("output is not redis")
+	}
 	outputCfgs := []config.RedisConfig{}
 	allInputs := sc.allInputs(ctx)
 	if len(allInputs) == len(inputs) {
@@ -588,7 +726,16 @@ func (sc *SyncerCmd) delCheckpoints(ctx context.Context, inputs []string) error
 		return nil
 	}
 
-	if config.GetSyncerConfig().Output.Redis.Type == config.RedisTypeCluster {
+	if config.GetSyncerConfig().Output.DryRun {
+		// checkpoints of a dry run are in memory
+		return nil
+	} else if !config.GetSyncerConfig().Output.IsRedis() {
+		for _, in := range inputs {
+			if err := syncer.DelCdcCheckpoint(config.GetSyncerConfig().Output.Cdc, in); err != nil {
+				return err
+			}
+		}
+	} else if config.GetSyncerConfig().Output.Redis.Type == config.RedisTypeCluster {
 		cli, err := client.NewRedis(*config.GetSyncerConfig().Output.Redis)
 		if err != nil {
 			sc.logger.Errorf("new redis error : addr(%s), err(%v)", config.GetSyncerConfig().Output.Redis.Address(), err)
@@ -628,11 +775,13 @@ func (sc *SyncerCmd) resume(ctx context.Context, inputs []string) error {
 }
 
 func (sc *SyncerCmd) allInputs(ctx context.Context) []string {
-	all := config.GetSyncerConfig().Input.Mode != config.InputModeStatic
-	inputRedis := config.GetSyncerConfig().Input.Redis.SelNodes(all, config.GetSyncerConfig().Input.SyncFrom)
 	addrs := []string{}
-	for _, r := range inputRedis {
-		addrs = append(addrs, r.Addresses...)
+	for _, inputCfg := range config.GetSyncerConfig().Inputs() {
+		all := inputCfg.Mode != config.InputModeStatic
+		inputRedis := inputCfg.Redis.SelNodes(all, inputCfg.SyncFrom)
+		for _, r := range inputRedis {
+			addrs = append(addrs, r.Addresses...)
+		}
 	}
 	return addrs
 }
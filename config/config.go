@@ -1,8 +1,10 @@
 package config
 
 import (
+	"crypto/tls"
 	"fmt"
 	"os"
+	"regexp"
 	"runtime"
 	"sort"
 	"strconv"
@@ -12,17 +14,22 @@ import (
 	"go.uber.org/zap/zapcore"
 	"golang.org/x/exp/slices"
 	"gopkg.in/yaml.v3"
+
+	"github.com/mgtv-tech/redis-GunYu/pkg/crypto"
 )
 
 var (
 	syncCfg *SyncConfig
 	rdbCfg  *RdbCmdConfig
 	logCfg  *LogConfig
+
+	deadLetterCfg *DeadLetterCmdConfig
 )
 
 func init() {
 	syncCfg = &SyncConfig{}
 	rdbCfg = &RdbCmdConfig{}
+	deadLetterCfg = &DeadLetterCmdConfig{}
 }
 
 func GetSyncerConfig() *SyncConfig {
@@ -33,9 +40,15 @@ func GetRdbCmdConfig() *RdbCmdConfig {
 	return rdbCfg
 }
 
+func GetDeadLetterCmdConfig() *DeadLetterCmdConfig {
+	return deadLetterCfg
+}
+
 type SyncConfig struct {
 	Input   *InputConfig
+	Sources []*InputConfig `yaml:"sources"` // extra sources, they are merged into output with input
 	Output  *OutputConfig
+	Outputs []*OutputConfig `yaml:"outputs"` // extra outputs, replicate input to them as well
 	Channel *ChannelConfig
 
 	Cluster *ClusterConfig
@@ -43,6 +56,16 @@ type SyncConfig struct {
 	Server  ServerConfig `yaml:"server"`
 }
 
+// Inputs returns input and sources
+func (c *SyncConfig) Inputs() []*InputConfig {
+	return append([]*InputConfig{c.Input}, c.Sources...)
+}
+
+// AllOutputs returns output and extra outputs
+func (c *SyncConfig) AllOutputs() []*OutputConfig {
+	return append([]*OutputConfig{c.Output}, c.Outputs...)
+}
+
 func (c *SyncConfig) GetLog() *LogConfig {
 	if c == nil {
 		return nil
@@ -68,16 +91,53 @@ func (c *SyncConfig) fix() error {
 		}
 	}
 
-	if c.Output.Redis.Type == RedisTypeCluster {
-		if c.Output.Replay.TargetDb == -1 || c.Output.Replay.TargetDb == 0 {
-			c.Output.Filter.DbBlacklist = []int{}
-		} else {
-			return newConfigError("redis is cluster, but targetdb is not 0")
+	inputNames := map[string]struct{}{c.Input.Name: {}}
+	for _, src := range c.Sources {
+		if src == nil {
+			return newConfigError("sources has a nil source")
 		}
-		for _, db := range c.Output.Replay.TargetDbMap {
-			if db != 0 {
-				return newConfigError("redis is cluster, but targetdb is not 0 : %d", db)
+		if src.Name == "" {
+			return newConfigError("name of sources is empty")
+		}
+		if _, ok := inputNames[src.Name]; ok {
+			return newConfigError("name of sources is duplicated : %s", src.Name)
+		}
+		inputNames[src.Name] = struct{}{}
+		if err := src.fix(); err != nil {
+			return err
+		}
+	}
+	// syncers and their caches are identified by input address
+	inputAddrs := map[string]string{}
+	for _, in := range c.Inputs() {
+		if in.Redis.IsSentinel() { // sentinels may monitor several masters
+			continue
+		}
+		for _, addr := range in.Redis.Addresses {
+			if name, ok := inputAddrs[addr]; ok {
+				return newConfigError("address of sources is duplicated : address(%s), sources(%s, %s)", addr, name, in.Name)
 			}
+			inputAddrs[addr] = in.Name
+		}
+	}
+
+	names := map[string]struct{}{}
+	for _, out := range c.Outputs {
+		if out == nil {
+			return newConfigError("outputs has a nil output")
+		}
+		if out.Name == "" {
+			return newConfigError("name of outputs is empty")
+		}
+		if _, ok := names[out.Name]; ok || out.Name == c.Output.Name {
+			return newConfigError("name of outputs is duplicated : %s", out.Name)
+		}
+		names[out.Name] = struct{}{}
+		if err := out.fix(); err != nil {
+			return err
+		}
+		if out.Replay.Bidirectional {
+			return newConfigError("extra outputs do not support bidirectional : %s", out.Name)
 		}
 	}
 
@@ -153,12 +213,17 @@ func withPrefixTag(prefix, tag string) string {
 }
 
 type InputConfig struct {
+	Name               string `yaml:"name"` // name of source, it's required by sources
 	Redis              *RedisConfig
 	RdbParallel        int `yaml:"rdbParallel"`
 	rdbParallelLimiter chan struct{}
-	Mode               InputMode       `yaml:"mode"`
-	SyncFrom           SelNodeStrategy `yaml:"syncFrom"`
-	SyncDelayTestKey   string          `yaml:"syncDelayTestKey"`
+	Mode               InputMode        `yaml:"mode"`
+	SyncFrom           SelNodeStrategy  `yaml:"syncFrom"`
+	SyncDelayTestKey   string           `yaml:"syncDelayTestKey"`
+	Rump               *InputRumpConfig `yaml:"rump"`
+	Filter             *FilterConfig    `yaml:"filter"`    // filter of this source, it's applied with filter of output
+	KeyPrefix          *KeyPrefixConfig `yaml:"keyPrefix"` // rewrite key prefix of this source
+	KeyExists          string           `yaml:"keyExists"` // overrides output.replay.keyExists for keys of this source
 }
 
 func (ic *InputConfig) fix() error {
@@ -175,25 +240,76 @@ func (ic *InputConfig) fix() error {
 	if ic.SyncFrom == 0 {
 		ic.SyncFrom = SelNodeStrategyPreferSlave
 	}
+	if ic.Rump.Enabled() {
+		ic.Rump.fix()
+	}
+	ic.KeyExists = strings.ToLower(ic.KeyExists)
+	if ic.KeyExists != "" && !slices.Contains([]string{"replace", "ignore", "error", "merge"}, ic.KeyExists) {
+		return newConfigError("invalid keyExists of input : name(%s), keyExists(%s)", ic.Name, ic.KeyExists)
+	}
 	return nil
 }
 
+// KeyPrefixConfig replaces prefix From of keys with To, keys without From are not changed,
+// and an empty From prepends To to all keys
+type KeyPrefixConfig struct {
+	From string `yaml:"from"`
+	To   string `yaml:"to"`
+}
+
 func (ic *InputConfig) RdbLimiter() chan struct{} {
 	return ic.rdbParallelLimiter
 }
 
+// InputRumpConfig syncs data with SCAN and DUMP instead of PSYNC, it's for the sources which forbid SYNC and PSYNC.
+// it's a one-shot migration unless KeyspaceNotify is enabled
+type InputRumpConfig struct {
+	Enable             bool
+	ScanCount          int           `yaml:"scanCount"`          // COUNT of SCAN, default is 100
+	KeysPerSecond      int           `yaml:"keysPerSecond"`      // rate limit of DUMP, 0 is unlimited
+	CheckpointInterval time.Duration `yaml:"checkpointInterval"` // interval of saving SCAN cursor, default is 5 seconds
+	KeyspaceNotify     bool          `yaml:"keyspaceNotify"`     // catch up with keyspace notifications after scanning, notify-keyspace-events of source must contain K and A
+}
+
+func (rc *InputRumpConfig) Enabled() bool {
+	return rc != nil && rc.Enable
+}
+
+func (rc *InputRumpConfig) fix() {
+	if rc.ScanCount <= 0 {
+		rc.ScanCount = 100
+	}
+	if rc.KeysPerSecond < 0 {
+		rc.KeysPerSecond = 0
+	}
+	if rc.CheckpointInterval <= 0 {
+		rc.CheckpointInterval = 5 * time.Second
+	}
+}
+
 type ChannelConfig struct {
 	Storer                  *StorerConfig
+	Memory                  *ChannelMemoryConfig
 	VerifyCrc               bool
 	StaleCheckpointDuration time.Duration `yaml:"staleCheckpointDuration"`
 }
 
 func (cc *ChannelConfig) Clone() *ChannelConfig {
 	storer := *cc.Storer
+	if storer.Remote != nil {
+		remote := *storer.Remote
+		storer.Remote = &remote
+	}
+	var memory *ChannelMemoryConfig
+	if cc.Memory != nil {
+		mem := *cc.Memory
+		memory = &mem
+	}
 	return &ChannelConfig{
 		VerifyCrc:               cc.VerifyCrc,
 		StaleCheckpointDuration: staleCheckpointDuration,
 		Storer:                  &storer,
+		Memory:                  memory,
 	}
 }
 
@@ -207,14 +323,138 @@ func (cc *ChannelConfig) fix() error {
 	if cc.StaleCheckpointDuration < time.Minute*5 {
 		cc.StaleCheckpointDuration = time.Minute * 5
 	}
+	if cc.Memory.Enabled() {
+		cc.Memory.fix()
+	}
 	return cc.Storer.fix()
 }
 
+// ChannelMemoryConfig keeps data in a bounded memory buffer instead of storer, nothing is persisted.
+// once maxSize is reached, the oldest data is evicted, and input falls back to a full sync if its offset is evicted
+type ChannelMemoryConfig struct {
+	Enable  bool
+	MaxSize int64 `yaml:"maxSize"` // default is 1GiB, it must be larger than rdb size
+}
+
+func (mc *ChannelMemoryConfig) Enabled() bool {
+	return mc != nil && mc.Enable
+}
+
+func (mc *ChannelMemoryConfig) fix() {
+	if mc.MaxSize <= 0 {
+		mc.MaxSize = 1024 * 1024 * 1024 // 1 GiB
+	}
+}
+
 type StorerConfig struct {
-	DirPath string      `yaml:"dirPath"`
-	MaxSize int64       `yaml:"maxSize"` // -1 is unlimited, default is 50GiB
-	LogSize int64       `yaml:"logSize"` // default is 100MiB
-	Flush   FlushPolicy `yaml:"flushPolicy"`
+	DirPath    string                  `yaml:"dirPath"`
+	MaxSize    int64                   `yaml:"maxSize"` // -1 is unlimited, default is 50GiB
+	MaxAge     time.Duration           `yaml:"maxAge"`  // 0 is unlimited
+	Retention  string                  `usage:"how maxSize and maxAge are combined, strict : remove files exceeding either limit, loose : remove files exceeding both limits"`
+	LogSize    int64                   `yaml:"logSize"` // default is 100MiB
+	Flush      FlushPolicy             `yaml:"flushPolicy"`
+	Encryption *StorerEncryptionConfig `yaml:"encryption"`
+	Remote     *StorerRemoteConfig     `yaml:"remote"`
+	Scrub      *StorerScrubConfig      `yaml:"scrub"`
+	Disk       *StorerDiskConfig       `yaml:"disk"`
+	keyring    *crypto.Keyring
+}
+
+type StorerEncryptionConfig struct {
+	Enable  bool
+	KeyFile string `yaml:"keyFile" usage:"key file path, one key per line : id:hexKey"`
+}
+
+// StorerScrubConfig re-verifies sealed rdb and aof files in background, corrupted files are quarantined
+type StorerScrubConfig struct {
+	Enable   bool          `yaml:"enable"`
+	Interval time.Duration `yaml:"interval"` // default is 6 hours
+	Rate     int64         `yaml:"rate"`     // reading speed, bytes per second, -1 is unlimited, default is 10MiB
+}
+
+func (sc *StorerScrubConfig) fix() {
+	if sc.Interval <= 0 {
+		sc.Interval = 6 * time.Hour
+	}
+	if sc.Rate == 0 {
+		sc.Rate = 10 * 1024 * 1024
+	}
+}
+
+// StorerDiskConfig pauses reading from input once free disk space is below Pause,
+// files are removed aggressively, and reading is resumed once free disk space is above Resume
+type StorerDiskConfig struct {
+	Enable   bool          `yaml:"enable"`
+	Pause    int64         `yaml:"pause"`    // low watermark of free bytes, default is 1GiB
+	Resume   int64         `yaml:"resume"`   // high watermark of free bytes, default is 2 * pause
+	Interval time.Duration `yaml:"interval"` // default is 1 second
+}
+
+func (dc *StorerDiskConfig) fix() error {
+	if dc.Pause <= 0 {
+		dc.Pause = 1024 * 1024 * 1024 // 1 GiB
+	}
+	if dc.Resume <= 0 {
+		dc.Resume = dc.Pause * 2
+	}
+	if dc.Resume < dc.Pause {
+		return newConfigError("storer disk resume(%d) is less than pause(%d)", dc.Resume, dc.Pause)
+	}
+	if dc.Interval <= 0 {
+		dc.Interval = time.Second
+	}
+	return nil
+}
+
+// StorerRemoteConfig offloads sealed rdb and aof files to remote storage,
+// local files are evicted by storer.maxSize, remote files are evicted by remote.maxSize
+type StorerRemoteConfig struct {
+	Type    string `usage:"remote storage type : s3, empty means disabled"`
+	MaxSize int64  `yaml:"maxSize"` // -1 is unlimited, default is 500GiB
+	S3      S3Config
+}
+
+func (rc *StorerRemoteConfig) Enabled() bool {
+	return rc != nil && rc.Type != ""
+}
+
+func (rc *StorerRemoteConfig) fix() error {
+	if rc.Type != StorerRemoteS3 {
+		return newConfigError("unsupported remote storage : %s", rc.Type)
+	}
+	if rc.MaxSize == 0 {
+		rc.MaxSize = 500 * (1024 * 1024 * 1024) // 500 GiB
+	}
+	return rc.S3.fix()
+}
+
+type S3Config struct {
+	Endpoint  string `usage:"e.g. https://s3.amazonaws.com, http://127.0.0.1:9000"`
+	Region    string
+	Bucket    string
+	AccessKey string `yaml:"accessKey"`
+	SecretKey string `yaml:"secretKey"`
+	Prefix    string
+	Timeout   time.Duration
+}
+
+func (sc *S3Config) fix() error {
+	if sc.Endpoint == "" || sc.Bucket == "" {
+		return newConfigError("s3 endpoint or bucket is empty")
+	}
+	if !strings.HasPrefix(sc.Endpoint, "http://") && !strings.HasPrefix(sc.Endpoint, "https://") {
+		return newConfigError("invalid s3 endpoint : %s", sc.Endpoint)
+	}
+	if sc.Region == "" {
+		sc.Region = "us-east-1"
+	}
+	if sc.Prefix != "" && !strings.HasSuffix(sc.Prefix, "/") {
+		sc.Prefix += "/"
+	}
+	if sc.Timeout == 0 {
+		sc.Timeout = 10 * time.Minute
+	}
+	return nil
 }
 
 func (sc *StorerConfig) fix() error {
@@ -228,6 +468,15 @@ func (sc *StorerConfig) fix() error {
 	if sc.LogSize <= 0 {
 		sc.LogSize = 100 * (1024 * 1024)
 	}
+	if sc.MaxAge < 0 {
+		sc.MaxAge = 0
+	}
+	if sc.Retention == "" {
+		sc.Retention = StorerRetentionStrict
+	}
+	if sc.Retention != StorerRetentionStrict && sc.Retention != StorerRetentionLoose {
+		return newConfigError("unsupported storer retention : %s", sc.Retention)
+	}
 	if sc.Flush.Duration == 0 && !sc.Flush.EveryWrite && sc.Flush.DirtySize == 0 {
 		sc.Flush.Auto = true
 	}
@@ -236,6 +485,32 @@ func (sc *StorerConfig) fix() error {
 		sc.Flush.Duration = time.Millisecond * 100
 	}
 
+	if sc.Encryption != nil && sc.Encryption.Enable {
+		if sc.Encryption.KeyFile == "" {
+			return newConfigError("storer encryption is enabled, but keyFile is empty")
+		}
+		kr, err := crypto.LoadKeyring(sc.Encryption.KeyFile)
+		if err != nil {
+			return newConfigError("load storer key file : %v", err)
+		}
+		sc.keyring = kr
+	}
+
+	if sc.Scrub != nil && sc.Scrub.Enable {
+		sc.Scrub.fix()
+	}
+	if sc.Disk != nil && sc.Disk.Enable {
+		if err := sc.Disk.fix(); err != nil {
+			return err
+		}
+	}
+
+	if sc.Remote.Enabled() {
+		if err := sc.Remote.fix(); err != nil {
+			return err
+		}
+	}
+
 	_, err := os.Stat(sc.DirPath)
 	if os.IsNotExist(err) {
 		return os.MkdirAll(sc.DirPath, os.ModePerm)
@@ -244,6 +519,11 @@ func (sc *StorerConfig) fix() error {
 	return err
 }
 
+// Keyring returns nil if encryption is disabled
+func (sc *StorerConfig) Keyring() *crypto.Keyring {
+	return sc.keyring
+}
+
 func cloneBoolPointer(vp *bool) *bool {
 	if vp == nil {
 		return nil
@@ -253,15 +533,132 @@ func cloneBoolPointer(vp *bool) *bool {
 }
 
 type OutputConfig struct {
+	Name   string `yaml:"name"` // distinguishes extra outputs in logs and metrics
 	Redis  *RedisConfig
+	Cdc    *CdcConfig `yaml:"cdc"`    // emits changes as events instead of replaying them to redis
+	DryRun bool       `yaml:"dryRun"` // counts commands instead of writing them, redis only describes the target
 	Replay ReplayConfig
 	Filter FilterConfig
+	Ttl    *TtlConfig `yaml:"ttl"` // rewrites ttls of keys on replay
+}
+
+// IsRedis returns false if changes are emitted as events or counted by a dry run
+func (of *OutputConfig) IsRedis() bool {
+	return of.Cdc == nil && !of.DryRun
+}
+
+// CdcConfig emits replicated commands as events to files, a webhook, kafka or a resp archive,
+// checkpoints are kept in the local directory
+type CdcConfig struct {
+	Dir         string            `yaml:"dir" usage:"directory of checkpoints and event files"`
+	BatchSize   int               `yaml:"batchSize"`   // events are written in batches, default is 100
+	BatchTicker time.Duration     `yaml:"batchTicker"` // default is 1 second
+	File        *CdcFileConfig    `yaml:"file"`
+	Webhook     *CdcWebhookConfig `yaml:"webhook"`
+	Kafka       *CdcKafkaConfig   `yaml:"kafka"`
+	Archive     *CdcArchiveConfig `yaml:"archive"`
+}
+
+// CdcFileConfig writes events to rotating json lines files
+type CdcFileConfig struct {
+	MaxSize        int64         `yaml:"maxSize"`        // default is 128MiB
+	RotateInterval time.Duration `yaml:"rotateInterval"` // default is 1 hour
+}
+
+// CdcWebhookConfig posts batches of events to url
+type CdcWebhookConfig struct {
+	Url     string            `yaml:"url"`
+	Timeout time.Duration     `yaml:"timeout"` // default is 10 seconds
+	Headers map[string]string `yaml:"headers"`
+}
+
+const (
+	CdcEncodingJson     = "json"
+	CdcEncodingProtobuf = "protobuf"
+)
+
+// CdcKafkaConfig produces events to a kafka topic, messages are keyed by redis key
+type CdcKafkaConfig struct {
+	Brokers  []string      `yaml:"brokers"`
+	Topic    string        `yaml:"topic"`
+	Encoding string        `yaml:"encoding"` // json|protobuf, default is json
+	Timeout  time.Duration `yaml:"timeout"`  // default is 10 seconds
+}
+
+// CdcArchiveConfig writes commands to rotating resp files as a long-term backup
+type CdcArchiveConfig struct {
+	MaxSize        int64         `yaml:"maxSize"`        // default is 128MiB
+	RotateInterval time.Duration `yaml:"rotateInterval"` // default is 1 hour
+	Retention      time.Duration `yaml:"retention"`      // files older than retention are removed, default is 7 days
+}
+
+func (cc *CdcConfig) fix() error {
+	if cc.Dir == "" {
+		return newConfigError("cdc dir is empty")
+	}
+	sinks := 0
+	for _, set := range []bool{cc.File != nil, cc.Webhook != nil, cc.Kafka != nil, cc.Archive != nil} {
+		if set {
+			sinks++
+		}
+	}
+	if sinks != 1 {
+		return newConfigError("cdc requires one of file, webhook, kafka and archive")
+	}
+	if cc.BatchSize <= 0 {
+		cc.BatchSize = 100
+	}
+	if cc.BatchTicker <= 0 {
+		cc.BatchTicker = time.Second
+	}
+	if cc.File != nil {
+		if cc.File.MaxSize <= 0 {
+			cc.File.MaxSize = 128 * 1024 * 1024 // 128 MiB
+		}
+		if cc.File.RotateInterval <= 0 {
+			cc.File.RotateInterval = time.Hour
+		}
+	}
+	if cc.Webhook != nil {
+		if !strings.HasPrefix(cc.Webhook.Url, "http://") && !strings.HasPrefix(cc.Webhook.Url, "https://") {
+			return newConfigError("invalid cdc webhook url : %s", cc.Webhook.Url)
+		}
+		if cc.Webhook.Timeout <= 0 {
+			cc.Webhook.Timeout = 10 * time.Second
+		}
+	}
+	if cc.Kafka != nil {
+		if len(cc.Kafka.Brokers) == 0 || cc.Kafka.Topic == "" {
+			return newConfigError("cdc kafka requires brokers and topic")
+		}
+		if cc.Kafka.Encoding == "" {
+			cc.Kafka.Encoding = CdcEncodingJson
+		}
+		if cc.Kafka.Encoding != CdcEncodingJson && cc.Kafka.Encoding != CdcEncodingProtobuf {
+			return newConfigError("invalid cdc kafka encoding : %s", cc.Kafka.Encoding)
+		}
+		if cc.Kafka.Timeout <= 0 {
+			cc.Kafka.Timeout = 10 * time.Second
+		}
+	}
+	if cc.Archive != nil {
+		if cc.Archive.MaxSize <= 0 {
+			cc.Archive.MaxSize = 128 * 1024 * 1024 // 128 MiB
+		}
+		if cc.Archive.RotateInterval <= 0 {
+			cc.Archive.RotateInterval = time.Hour
+		}
+		if cc.Archive.Retention <= 0 {
+			cc.Archive.Retention = 7 * 24 * time.Hour
+		}
+	}
+	return os.MkdirAll(cc.Dir, os.ModePerm)
 }
 
 type ReplayConfig struct {
 	ResumeFromBreakPoint   *bool         `yaml:"resumeFromBreakPoint" default:"true"`
 	ReplaceHashTag         bool          `yaml:"replaceHashTag"`
-	KeyExists              string        `yaml:"keyExists"` // replace|ignore|error
+	KeyExists              string        `yaml:"keyExists"` // replace|ignore|error|merge
 	KeyExistsLog           bool          `yaml:"keyExistsLog"`
 	FunctionExists         string        `yaml:"functionExists"`
 	MaxProtoBulkLen        int           `yaml:"maxProtoBulkLen"` // proto-max-bulk-len, default value of redis is 512MiB
@@ -278,17 +675,256 @@ type ReplayConfig struct {
 	ReplayTransaction      *bool         `yaml:"replayTransaction" default:"true"`
 	Stats                  OutputStats   `yaml:"stats"`
 	AofPipelineMode        bool          `yaml:"enableAofPipeline"`
+	UnsupportedCmd         string        `yaml:"unsupportedCommand"` // fail|skip|log, commands which are not supported by the target and can't be rewritten
+	Bidirectional          bool          `yaml:"bidirectional"`      // tag written commands and skip tagged commands of the input, for active-active sync
+
+	// keys are renamed after filters are applied
+	KeyRename []KeyRenameConfig `yaml:"keyRename"`
+
+	// limits are shared by syncers of the output, and they can be changed by the api
+	RateLimit ReplayRateLimitConfig `yaml:"rateLimit"`
+
+	// policies of commands rejected by the target, by error classes
+	ReplyError ReplyErrorConfig `yaml:"replyError"`
+
+	// merge semantics of keyExists: merge
+	KeyMerge KeyMergeConfig `yaml:"keyMerge"`
+
+	// lua scripts which are missing on the target
+	Scripts ScriptsConfig `yaml:"scripts"`
+}
+
+// ScriptsConfig tracks bodies of lua scripts of the source, i.e. SCRIPT LOAD and EVAL of the replication stream,
+// and lua fields of the rdb. Scripts of the rdb are loaded to all nodes of the target, and EVALSHA of a tracked script
+// is replayed as EVAL, so it isn't rejected by NOSCRIPT. EVALSHA rejected by NOSCRIPT is retried once its script is loaded.
+type ScriptsConfig struct {
+	Preload    *bool `yaml:"preload"`    // default is true
+	MaxScripts int   `yaml:"maxScripts"` // the oldest script is evicted if there are more scripts, default is 10000
+}
+
+func (sc *ScriptsConfig) fix() error {
+	if sc.Preload == nil {
+		preload := true
+		sc.Preload = &preload
+	}
+	if sc.MaxScripts <= 0 {
+		sc.MaxScripts = 10000
+	}
+	return nil
+}
+
+// KeyMergeConfig merges rdb keys into existing keys of the same type,
+// hashes are merged field by field, sets and zsets are unioned, and lists are appended
+type KeyMergeConfig struct {
+	ZSetScore string `yaml:"zsetScore"` // source|max, score of a member in both zsets, default is source
+	String    string `yaml:"string"`    // source|target, the winner of strings, default is source
+}
+
+const (
+	KeyMergeSource = "source"
+	KeyMergeTarget = "target"
+	KeyMergeMax    = "max"
+)
+
+func (kc *KeyMergeConfig) fix() error {
+	kc.ZSetScore = strings.ToLower(kc.ZSetScore)
+	if kc.ZSetScore == "" {
+		kc.ZSetScore = KeyMergeSource
+	} else if kc.ZSetScore != KeyMergeSource && kc.ZSetScore != KeyMergeMax {
+		return newConfigError("invalid keyMerge.zsetScore : %s", kc.ZSetScore)
+	}
+	kc.String = strings.ToLower(kc.String)
+	if kc.String == "" {
+		kc.String = KeyMergeSource
+	} else if kc.String != KeyMergeSource && kc.String != KeyMergeTarget {
+		return newConfigError("invalid keyMerge.string : %s", kc.String)
+	}
+	return nil
+}
+
+// ReplayRateLimitConfig limits replay traffic to an output with token buckets
+type ReplayRateLimitConfig struct {
+	OpsPerSecond   int64 `yaml:"opsPerSecond" json:"opsPerSecond"`     // commands and rdb entries per second, 0 is unlimited
+	BytesPerSecond int64 `yaml:"bytesPerSecond" json:"bytesPerSecond"` // 0 is unlimited
+	PerShard       bool  `yaml:"perShard" json:"perShard"`             // limits apply to every shard of a cluster instead of the whole output
+}
+
+// Validate returns an error if limits are invalid, limits changed by the api are validated as well
+func (rc *ReplayRateLimitConfig) Validate() error {
+	if rc.OpsPerSecond < 0 || rc.BytesPerSecond < 0 {
+		return newConfigError("rate limits are negative : ops(%d), bytes(%d)", rc.OpsPerSecond, rc.BytesPerSecond)
+	}
+	return nil
+}
+
+// ReplyErrorConfig decides what to do with commands rejected by the target,
+// the class of an error is the first word of it, e.g. WRONGTYPE, OOM, NOSCRIPT, READONLY, CROSSSLOT
+type ReplyErrorConfig struct {
+	Policies      map[string]string `yaml:"policies"`      // class -> stop|skip|retry|deadLetter
+	Default       string            `yaml:"default"`       // policy of other classes, default is skip
+	MaxRetries    int               `yaml:"maxRetries"`    // default is 5, replay stops if retries are exhausted
+	RetryBackoff  time.Duration     `yaml:"retryBackoff"`  // default is 1s, it's doubled every retry, up to 30s
+	DeadLetterDir string            `yaml:"deadLetterDir"` // required by the deadLetter policy
+}
+
+const (
+	ReplyErrorStop       = "stop"
+	ReplyErrorSkip       = "skip"
+	ReplyErrorRetry      = "retry"
+	ReplyErrorDeadLetter = "deadLetter"
+)
+
+func replyErrorPolicy(policy string) (string, bool) {
+	for _, p := range []string{ReplyErrorStop, ReplyErrorSkip, ReplyErrorRetry, ReplyErrorDeadLetter} {
+		if strings.EqualFold(p, policy) {
+			return p, true
+		}
+	}
+	return "", false
+}
+
+func (rc *ReplyErrorConfig) fix() error {
+	policies := make(map[string]string, len(rc.Policies))
+	deadLetter := false
+	for class, policy := range rc.Policies {
+		p, ok := replyErrorPolicy(policy)
+		if !ok {
+			return newConfigError("invalid policy of replyError : class(%s), policy(%s)", class, policy)
+		}
+		policies[strings.ToUpper(class)] = p
+		deadLetter = deadLetter || p == ReplyErrorDeadLetter
+	}
+	rc.Policies = policies
+	if rc.Default == "" {
+		// rejected commands don't stop replay by default, as before policies are introduced
+		rc.Default = ReplyErrorSkip
+	} else if p, ok := replyErrorPolicy(rc.Default); ok {
+		rc.Default = p
+		deadLetter = deadLetter || p == ReplyErrorDeadLetter
+	} else {
+		return newConfigError("invalid default policy of replyError : %s", rc.Default)
+	}
+	if rc.MaxRetries <= 0 {
+		rc.MaxRetries = 5
+	}
+	if rc.RetryBackoff <= 0 {
+		rc.RetryBackoff = time.Second
+	}
+	if deadLetter && rc.DeadLetterDir == "" {
+		return newConfigError("deadLetter policy of replyError requires deadLetterDir")
+	}
+	return nil
+}
+
+// Policy returns the policy of an error class, commands are skipped if no policy is configured
+func (rc *ReplyErrorConfig) Policy(class string) string {
+	if p, ok := rc.Policies[class]; ok {
+		return p
+	}
+	if rc.Default == "" {
+		return ReplyErrorSkip
+	}
+	return rc.Default
+}
+
+const (
+	UnsupportedCmdFail = "fail"
+	UnsupportedCmdSkip = "skip"
+	UnsupportedCmdLog  = "log"
+)
+
+// KeyRenameConfig is a rename rule of keys, rules are tried in order and the first matched one is applied.
+// Prefix replaces the prefix of keys with To, Regex replaces the first match in keys with To,
+// which refers to capture groups by $1 or ${name}
+type KeyRenameConfig struct {
+	Prefix string `yaml:"prefix"`
+	Regex  string `yaml:"regex"`
+	To     string `yaml:"to"`
+}
+
+// TtlConfig rewrites ttls of replayed keys, Max is applied before Jitter
+type TtlConfig struct {
+	DropExpired    bool          `yaml:"dropExpired"`    // rdb keys which are expired or expire within ExpiringWithin are skipped
+	ExpiringWithin time.Duration `yaml:"expiringWithin"` // default is 0
+	Max            time.Duration `yaml:"max"`            // ttls are capped to max, 0 means no limit
+	Jitter         time.Duration `yaml:"jitter"`         // a random duration in [0, jitter) is added to ttls
+	Strip          bool          `yaml:"strip"`          // ttls are removed, keys never expire on target
+	AbsoluteExpire bool          `yaml:"absoluteExpire"` // relative ttls of commands are converted to PEXPIREAT or PXAT when they are sent
+}
+
+func (tc *TtlConfig) fix() error {
+	if tc.ExpiringWithin < 0 || tc.Max < 0 || tc.Jitter < 0 {
+		return newConfigError("ttl durations are negative : %+v", *tc)
+	}
+	if tc.ExpiringWithin > 0 && !tc.DropExpired {
+		return newConfigError("ttl.expiringWithin requires ttl.dropExpired")
+	}
+	if tc.Strip && (tc.Max > 0 || tc.Jitter > 0 || tc.AbsoluteExpire) {
+		return newConfigError("ttl.strip is exclusive with ttl.max, ttl.jitter and ttl.absoluteExpire")
+	}
+	return nil
 }
 
 func (of *OutputConfig) fix() error {
-	if of.Redis == nil {
-		return newConfigError("output.redis is nil")
+	if of.Ttl != nil {
+		if err := of.Ttl.fix(); err != nil {
+			return err
+		}
 	}
-	if err := of.Redis.fix(); err != nil {
+	if of.Cdc != nil {
+		if of.Redis != nil {
+			return newConfigError("output.redis and output.cdc are exclusive")
+		}
+		if of.DryRun {
+			return newConfigError("output.dryRun and output.cdc are exclusive")
+		}
+		if err := of.Cdc.fix(); err != nil {
+			return err
+		}
+		if of.Replay.Bidirectional {
+			return newConfigError("output.cdc does not support bidirectional")
+		}
+		return of.Replay.fix()
+	}
+	if of.DryRun {
+		if of.Replay.Bidirectional {
+			return newConfigError("output.dryRun does not support bidirectional")
+		}
+		if of.Redis == nil {
+			return of.Replay.fix()
+		}
+		if err := of.Redis.fixTarget(); err != nil {
+			return err
+		}
+	} else {
+		if of.Redis == nil {
+			return newConfigError("output.redis is nil")
+		}
+		if err := of.Redis.fix(); err != nil {
+			return err
+		}
+	}
+	if of.Redis.IsSentinel() {
+		return newConfigError("output.redis does not support sentinel type")
+	}
+
+	if err := of.Replay.fix(); err != nil {
 		return err
 	}
 
-	return of.Replay.fix()
+	if of.Redis.Type == RedisTypeCluster {
+		if of.Replay.TargetDb == -1 || of.Replay.TargetDb == 0 {
+			of.Filter.DbBlacklist = []int{}
+		} else {
+			return newConfigError("redis is cluster, but targetdb is not 0")
+		}
+		for _, db := range of.Replay.TargetDbMap {
+			if db != 0 {
+				return newConfigError("redis is cluster, but targetdb is not 0 : %d", db)
+			}
+		}
+	}
+	return nil
 }
 
 func (of *ReplayConfig) fix() error {
@@ -325,9 +961,12 @@ func (of *ReplayConfig) fix() error {
 	}
 
 	of.KeyExists = strings.ToLower(of.KeyExists)
-	if !slices.Contains([]string{"replace", "ignore", "error"}, of.KeyExists) {
+	if !slices.Contains([]string{"replace", "ignore", "error", "merge"}, of.KeyExists) {
 		of.KeyExists = "replace"
 	}
+	if err := of.KeyMerge.fix(); err != nil {
+		return err
+	}
 	if of.MaxProtoBulkLen <= 0 {
 		of.MaxProtoBulkLen = 512 * (1024 * 1024) // redis default value is 512MiB, [1MiB, max_int]
 	}
@@ -354,6 +993,40 @@ func (of *ReplayConfig) fix() error {
 		of.TargetDbMap = make(map[int]int)
 	}
 	of.FunctionExists = strings.ToLower(of.FunctionExists)
+	of.UnsupportedCmd = strings.ToLower(of.UnsupportedCmd)
+	if of.UnsupportedCmd == "" {
+		of.UnsupportedCmd = UnsupportedCmdFail
+	} else if !slices.Contains([]string{UnsupportedCmdFail, UnsupportedCmdSkip, UnsupportedCmdLog}, of.UnsupportedCmd) {
+		return newConfigError("invalid unsupportedCommand : %s", of.UnsupportedCmd)
+	}
+
+	for _, rule := range of.KeyRename {
+		if (rule.Prefix == "") == (rule.Regex == "") {
+			return newConfigError("keyRename requires one of prefix and regex : %v", rule)
+		}
+		if rule.Regex != "" {
+			if _, err := regexp.Compile(rule.Regex); err != nil {
+				return newConfigError("invalid regex of keyRename : regex(%s), error(%v)", rule.Regex, err)
+			}
+		}
+	}
+
+	if err := of.RateLimit.Validate(); err != nil {
+		return err
+	}
+	if err := of.ReplyError.fix(); err != nil {
+		return err
+	}
+	if err := of.Scripts.fix(); err != nil {
+		return err
+	}
+	if of.Bidirectional && !*of.ReplayTransaction {
+		return newConfigError("bidirectional requires replayTransaction")
+	}
+	if of.Bidirectional && len(of.KeyRename) > 0 {
+		// transactions are disabled if keys are renamed
+		return newConfigError("bidirectional does not support keyRename")
+	}
 
 	// [1s, inf]
 	if of.Stats.LogInterval < time.Second {
@@ -480,6 +1153,17 @@ func InitRdbConfig(path string) error {
 	return nil
 }
 
+func InitDeadLetterConfig(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err = yaml.Unmarshal(data, deadLetterCfg); err != nil {
+		return err
+	}
+	return deadLetterCfg.fix()
+}
+
 func GetAddressesFromRedisConfigSlice(rcfg []RedisConfig) []string {
 	addrs := []string{}
 	for _, r := range rcfg {
@@ -491,11 +1175,12 @@ func GetAddressesFromRedisConfigSlice(rcfg []RedisConfig) []string {
 type RedisConfig struct {
 	Addresses       SliceString
 	shards          []*RedisClusterShard
-	UserName        string    `yaml:"userName"`
-	Password        string    `yaml:"password"`
-	TlsEnable       bool      `yaml:"tlsEnable"`
-	Type            RedisType // for new redis client
-	Otype           RedisType // original type
+	UserName        string           `yaml:"userName"`
+	Password        string           `yaml:"password"`
+	TlsEnable       bool             `yaml:"tlsEnable"`
+	TlsOptions      *RedisTlsOptions `yaml:"tlsOptions"`
+	Type            RedisType        // for new redis client
+	Otype           RedisType        // original type
 	Version         string
 	InternalService *string `yaml:"internalService"`
 	ExternalService *string `yaml:"externalService"`
@@ -505,8 +1190,9 @@ type RedisConfig struct {
 	slots           RedisSlots
 	ClusterOptions  *RedisClusterOptions `yaml:"clusterOptions"`
 	isMigrating     bool
-	KeepAlive       int           `yaml:"keepAlive"` // Maximum keep alive connecion in each node
-	AliveTime       time.Duration `yaml:"aliveTime"` // Keep alive timeout
+	KeepAlive       int                   `yaml:"keepAlive"` // Maximum keep alive connecion in each node
+	AliveTime       time.Duration         `yaml:"aliveTime"` // Keep alive timeout
+	Sentinel        *RedisSentinelOptions `yaml:"sentinel"`  // Addresses are sentinels if type is sentinel
 }
 
 func (rc *RedisConfig) Clone() *RedisConfig {
@@ -516,6 +1202,7 @@ func (rc *RedisConfig) Clone() *RedisConfig {
 		UserName:        rc.UserName,
 		Password:        rc.Password,
 		TlsEnable:       rc.TlsEnable,
+		TlsOptions:      rc.TlsOptions.Clone(),
 		Type:            rc.Type,
 		Otype:           rc.Type,
 		Version:         rc.Version,
@@ -529,6 +1216,7 @@ func (rc *RedisConfig) Clone() *RedisConfig {
 		AliveTime:       rc.AliveTime,
 		InternalService: rc.InternalService,
 		ExternalService: rc.ExternalService,
+		Sentinel:        rc.Sentinel.Clone(),
 	}
 
 	copy(cloned.Addresses, rc.Addresses)
@@ -568,6 +1256,78 @@ func (rco *RedisClusterOptions) fix() error {
 	return nil
 }
 
+// RedisTlsOptions : certificates are verified by system roots if CaFile is empty,
+// certificate files are reloaded when they are changed
+type RedisTlsOptions struct {
+	CaFile             string `yaml:"caFile"`
+	CertFile           string `yaml:"certFile"` // client certificate for mutual TLS
+	KeyFile            string `yaml:"keyFile"`
+	ServerName         string `yaml:"serverName"` // host of address by default
+	MinVersion         string `yaml:"minVersion"` // 1.0, 1.1, 1.2, 1.3
+	InsecureSkipVerify bool   `yaml:"insecureSkipVerify"`
+	minVersion         uint16
+}
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+func (rto *RedisTlsOptions) Clone() *RedisTlsOptions {
+	if rto == nil {
+		return nil
+	}
+	t := *rto
+	return &t
+}
+
+func (rto *RedisTlsOptions) fix() error {
+	if rto.MinVersion == "" {
+		rto.MinVersion = "1.2"
+	}
+	ver, ok := tlsVersions[rto.MinVersion]
+	if !ok {
+		return newConfigError("redis.tlsOptions.minVersion is invalid : %s", rto.MinVersion)
+	}
+	rto.minVersion = ver
+	if (rto.CertFile == "") != (rto.KeyFile == "") {
+		return newConfigError("redis.tlsOptions.certFile and keyFile should be configured together")
+	}
+	return nil
+}
+
+// GetMinVersion returns the minimum TLS version, TLS 1.2 by default
+func (rto *RedisTlsOptions) GetMinVersion() uint16 {
+	if rto == nil || rto.minVersion == 0 {
+		return tls.VersionTLS12
+	}
+	return rto.minVersion
+}
+
+// RedisSentinelOptions : master and replicas are discovered through sentinels
+type RedisSentinelOptions struct {
+	MasterName string `yaml:"masterName"`
+	UserName   string `yaml:"userName"` // credentials of sentinels
+	Password   string `yaml:"password"`
+}
+
+func (rso *RedisSentinelOptions) Clone() *RedisSentinelOptions {
+	if rso == nil {
+		return nil
+	}
+	t := *rso
+	return &t
+}
+
+func (rso *RedisSentinelOptions) fix() error {
+	if rso.MasterName == "" {
+		return newConfigError("redis.sentinel.masterName is empty")
+	}
+	return nil
+}
+
 func (rc *RedisConfig) GetClusterOptions() *RedisClusterOptions {
 	return rc.ClusterOptions
 }
@@ -777,6 +1537,19 @@ func (rc *RedisConfig) fix() error {
 		rc.ClusterOptions = &RedisClusterOptions{}
 		rc.ClusterOptions.fix()
 	}
+	if rc.TlsOptions != nil {
+		if err := rc.TlsOptions.fix(); err != nil {
+			return err
+		}
+	}
+	if rc.Type == RedisTypeSentinel {
+		if rc.Sentinel == nil {
+			return newConfigError("redis.sentinel is nil")
+		}
+		if err := rc.Sentinel.fix(); err != nil {
+			return err
+		}
+	}
 	rc.Otype = rc.Type
 	if rc.KeepAlive < 1 {
 		rc.KeepAlive = 32
@@ -787,6 +1560,18 @@ func (rc *RedisConfig) fix() error {
 	return nil
 }
 
+// fixTarget fixes the description of a target which isn't connected, addresses are optional
+func (rc *RedisConfig) fixTarget() error {
+	if len(rc.Addresses) > 0 {
+		return rc.fix()
+	}
+	if rc.Type == RedisTypeUnknown {
+		rc.Type = RedisTypeStandalone
+	}
+	rc.Otype = rc.Type
+	return nil
+}
+
 func (rc *RedisConfig) Address() string {
 	return rc.Addresses[0]
 }
@@ -799,6 +1584,10 @@ func (rc *RedisConfig) IsStanalone() bool {
 	return rc.Type == RedisTypeStandalone
 }
 
+func (rc *RedisConfig) IsSentinel() bool {
+	return rc.Type == RedisTypeSentinel
+}
+
 func (rc *RedisConfig) Index(i int) RedisConfig {
 	addr := rc.Addresses[i]
 	slots := rc.GetSlots(addr)
@@ -807,6 +1596,7 @@ func (rc *RedisConfig) Index(i int) RedisConfig {
 		UserName:    rc.UserName,
 		Password:    rc.Password,
 		TlsEnable:   rc.TlsEnable,
+		TlsOptions:  rc.TlsOptions.Clone(),
 		Type:        rc.Type,
 		Otype:       rc.Type,
 		Version:     rc.Version,
@@ -862,6 +1652,7 @@ func (rc *RedisConfig) SelNodeByAddress(addr string) *RedisConfig {
 		UserName:       rc.UserName,
 		Password:       rc.Password,
 		TlsEnable:      rc.TlsEnable,
+		TlsOptions:     rc.TlsOptions.Clone(),
 		Type:           rc.Type,
 		Otype:          rc.Type,
 		ClusterOptions: rc.ClusterOptions.Clone(),
@@ -884,7 +1675,8 @@ func (rc *RedisConfig) SelNodes(selAllShards bool, sel SelNodeStrategy) []RedisC
 			allShards = append(allShards, sd.Clone())
 		}
 	} else {
-		if selAllShards {
+		// sentinel has only one shard, addresses are sentinels
+		if selAllShards || rc.IsSentinel() {
 			for _, shard := range rc.shards {
 				if node := shard.Get(sel); node != nil {
 					addrs = append(addrs, node.Address)
@@ -934,6 +1726,7 @@ func (rc *RedisConfig) SelNodes(selAllShards bool, sel SelNodeStrategy) []RedisC
 			UserName:        rc.UserName,
 			Password:        rc.Password,
 			TlsEnable:       rc.TlsEnable,
+			TlsOptions:      rc.TlsOptions.Clone(),
 			Type:            rc.Type,
 			Otype:           rc.Type,
 			ClusterOptions:  rc.ClusterOptions.Clone(),
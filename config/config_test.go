@@ -3,8 +3,10 @@ package config
 import (
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
 )
 
 func TestInitConfig(t *testing.T) {
@@ -110,3 +112,351 @@ func TestSelNodes(t *testing.T) {
 	})
 
 }
+
+func TestSourcesConfig(t *testing.T) {
+	newCfg := func(sources string) (*SyncConfig, error) {
+		data := fmt.Sprintf(`
+input:
+  redis:
+    addresses: [127.0.0.1:6379]
+    type: standalone
+sources:
+%s
+channel:
+  storer:
+    dirPath: %s
+output:
+  redis:
+    addresses: [127.0.0.1:6479]
+    type: standalone
+`, sources, t.TempDir())
+		cfg := &SyncConfig{}
+		if err := yaml.Unmarshal([]byte(data), cfg); err != nil {
+			return nil, err
+		}
+		return cfg, cfg.fix()
+	}
+
+	cfg, err := newCfg(`
+  - name: app1
+    redis:
+      addresses: [127.0.0.1:6380]
+      type: standalone
+    keyPrefix:
+      to: "app1:"
+    keyExists: IGNORE`)
+	assert.Nil(t, err)
+	inputs := cfg.Inputs()
+	assert.Len(t, inputs, 2)
+	assert.Equal(t, "app1", inputs[1].Name)
+	assert.Equal(t, "app1:", inputs[1].KeyPrefix.To)
+	assert.Equal(t, "ignore", inputs[1].KeyExists)
+	assert.Equal(t, SelNodeStrategyPreferSlave, inputs[1].SyncFrom)
+
+	// name is required
+	_, err = newCfg(`
+  - redis:
+      addresses: [127.0.0.1:6380]
+      type: standalone`)
+	assert.NotNil(t, err)
+
+	// duplicated name
+	_, err = newCfg(`
+  - name: app1
+    redis:
+      addresses: [127.0.0.1:6380]
+      type: standalone
+  - name: app1
+    redis:
+      addresses: [127.0.0.1:6381]
+      type: standalone`)
+	assert.NotNil(t, err)
+
+	// duplicated address
+	_, err = newCfg(`
+  - name: app1
+    redis:
+      addresses: [127.0.0.1:6379]
+      type: standalone`)
+	assert.NotNil(t, err)
+
+	// invalid keyExists
+	_, err = newCfg(`
+  - name: app1
+    redis:
+      addresses: [127.0.0.1:6380]
+      type: standalone
+    keyExists: overwrite`)
+	assert.NotNil(t, err)
+}
+
+func TestCdcConfig(t *testing.T) {
+	newCfg := func(output string) (*SyncConfig, error) {
+		data := fmt.Sprintf(`
+input:
+  redis:
+    addresses: [127.0.0.1:6379]
+    type: standalone
+channel:
+  storer:
+    dirPath: %s
+output:
+%s
+`, t.TempDir(), output)
+		cfg := &SyncConfig{}
+		if err := yaml.Unmarshal([]byte(data), cfg); err != nil {
+			return nil, err
+		}
+		return cfg, cfg.fix()
+	}
+
+	dir := t.TempDir()
+	cfg, err := newCfg(fmt.Sprintf(`
+  cdc:
+    dir: %s
+    file:
+      maxSize: 1024`, dir))
+	assert.Nil(t, err)
+	assert.False(t, cfg.Output.IsRedis())
+	assert.Equal(t, 100, cfg.Output.Cdc.BatchSize)
+	assert.Equal(t, int64(1024), cfg.Output.Cdc.File.MaxSize)
+	assert.Equal(t, time.Hour, cfg.Output.Cdc.File.RotateInterval)
+
+	cfg, err = newCfg(fmt.Sprintf(`
+  cdc:
+    dir: %s
+    webhook:
+      url: http://127.0.0.1:8080/events`, dir))
+	assert.Nil(t, err)
+	assert.Equal(t, 10*time.Second, cfg.Output.Cdc.Webhook.Timeout)
+
+	// dir is required
+	_, err = newCfg(`
+  cdc:
+    file: {}`)
+	assert.NotNil(t, err)
+
+	// one of file and webhook
+	_, err = newCfg(fmt.Sprintf(`
+  cdc:
+    dir: %s`, dir))
+	assert.NotNil(t, err)
+	_, err = newCfg(fmt.Sprintf(`
+  cdc:
+    dir: %s
+    file: {}
+    webhook:
+      url: http://127.0.0.1:8080/events`, dir))
+	assert.NotNil(t, err)
+
+	// invalid url
+	_, err = newCfg(fmt.Sprintf(`
+  cdc:
+    dir: %s
+    webhook:
+      url: 127.0.0.1:8080`, dir))
+	assert.NotNil(t, err)
+
+	cfg, err = newCfg(fmt.Sprintf(`
+  cdc:
+    dir: %s
+    kafka:
+      brokers: [127.0.0.1:9092]
+      topic: redis`, dir))
+	assert.Nil(t, err)
+	assert.Equal(t, CdcEncodingJson, cfg.Output.Cdc.Kafka.Encoding)
+	assert.Equal(t, 10*time.Second, cfg.Output.Cdc.Kafka.Timeout)
+
+	// kafka requires topic and a valid encoding
+	_, err = newCfg(fmt.Sprintf(`
+  cdc:
+    dir: %s
+    kafka:
+      brokers: [127.0.0.1:9092]`, dir))
+	assert.NotNil(t, err)
+	_, err = newCfg(fmt.Sprintf(`
+  cdc:
+    dir: %s
+    kafka:
+      brokers: [127.0.0.1:9092]
+      topic: redis
+      encoding: avro`, dir))
+	assert.NotNil(t, err)
+
+	cfg, err = newCfg(fmt.Sprintf(`
+  cdc:
+    dir: %s
+    archive:
+      rotateInterval: 10m`, dir))
+	assert.Nil(t, err)
+	assert.Equal(t, 10*time.Minute, cfg.Output.Cdc.Archive.RotateInterval)
+	assert.Equal(t, 7*24*time.Hour, cfg.Output.Cdc.Archive.Retention)
+
+	// redis and cdc are exclusive
+	_, err = newCfg(fmt.Sprintf(`
+  redis:
+    addresses: [127.0.0.1:6479]
+    type: standalone
+  cdc:
+    dir: %s
+    file: {}`, dir))
+	assert.NotNil(t, err)
+}
+
+func TestKeyRenameConfig(t *testing.T) {
+	rc := ReplayConfig{KeyRename: []KeyRenameConfig{{Prefix: "app1:", To: "tenant42:app1:"}, {Regex: `^db2:(.*)$`, To: "$1"}}}
+	assert.Nil(t, rc.fix())
+
+	rc = ReplayConfig{KeyRename: []KeyRenameConfig{{To: "a"}}}
+	assert.NotNil(t, rc.fix())
+	rc = ReplayConfig{KeyRename: []KeyRenameConfig{{Prefix: "a", Regex: "b"}}}
+	assert.NotNil(t, rc.fix())
+	rc = ReplayConfig{KeyRename: []KeyRenameConfig{{Regex: "("}}}
+	assert.NotNil(t, rc.fix())
+}
+
+func TestTtlConfig(t *testing.T) {
+	tc := TtlConfig{DropExpired: true, ExpiringWithin: time.Minute, Max: time.Hour, Jitter: time.Minute, AbsoluteExpire: true}
+	assert.Nil(t, tc.fix())
+	tc = TtlConfig{Strip: true, DropExpired: true}
+	assert.Nil(t, tc.fix())
+
+	tc = TtlConfig{Max: -time.Second}
+	assert.NotNil(t, tc.fix())
+	tc = TtlConfig{ExpiringWithin: time.Second}
+	assert.NotNil(t, tc.fix())
+	tc = TtlConfig{Strip: true, Max: time.Hour}
+	assert.NotNil(t, tc.fix())
+}
+
+func TestUnsupportedCmdConfig(t *testing.T) {
+	rc := ReplayConfig{}
+	assert.Nil(t, rc.fix())
+	assert.Equal(t, UnsupportedCmdFail, rc.UnsupportedCmd)
+	rc = ReplayConfig{UnsupportedCmd: "LOG"}
+	assert.Nil(t, rc.fix())
+	assert.Equal(t, UnsupportedCmdLog, rc.UnsupportedCmd)
+	rc = ReplayConfig{UnsupportedCmd: "drop"}
+	assert.NotNil(t, rc.fix())
+}
+
+func TestBidirectionalConfig(t *testing.T) {
+	rc := ReplayConfig{Bidirectional: true}
+	assert.Nil(t, rc.fix())
+	txn := false
+	rc = ReplayConfig{Bidirectional: true, ReplayTransaction: &txn}
+	assert.NotNil(t, rc.fix())
+	rc = ReplayConfig{Bidirectional: true, KeyRename: []KeyRenameConfig{{Prefix: "a", To: "b"}}}
+	assert.NotNil(t, rc.fix())
+}
+
+func TestReplyErrorConfig(t *testing.T) {
+	rc := ReplyErrorConfig{}
+	assert.Equal(t, ReplyErrorSkip, rc.Policy("OOM"))
+	assert.Nil(t, rc.fix())
+	assert.Equal(t, ReplyErrorSkip, rc.Default)
+	assert.Equal(t, 5, rc.MaxRetries)
+	assert.Equal(t, time.Second, rc.RetryBackoff)
+
+	rc = ReplyErrorConfig{Policies: map[string]string{"wrongtype": "SKIP", "OOM": "retry"}, Default: "deadletter", DeadLetterDir: "/tmp"}
+	assert.Nil(t, rc.fix())
+	assert.Equal(t, ReplyErrorSkip, rc.Policy("WRONGTYPE"))
+	assert.Equal(t, ReplyErrorRetry, rc.Policy("OOM"))
+	assert.Equal(t, ReplyErrorDeadLetter, rc.Policy("NOSCRIPT"))
+
+	rc = ReplyErrorConfig{Policies: map[string]string{"OOM": "ignore"}}
+	assert.NotNil(t, rc.fix())
+	rc = ReplyErrorConfig{Policies: map[string]string{"OOM": "deadLetter"}}
+	assert.NotNil(t, rc.fix())
+}
+
+func TestKeyMergeConfig(t *testing.T) {
+	kc := KeyMergeConfig{}
+	assert.Nil(t, kc.fix())
+	assert.Equal(t, KeyMergeConfig{ZSetScore: KeyMergeSource, String: KeyMergeSource}, kc)
+	kc = KeyMergeConfig{ZSetScore: "MAX", String: "Target"}
+	assert.Nil(t, kc.fix())
+	assert.Equal(t, KeyMergeConfig{ZSetScore: KeyMergeMax, String: KeyMergeTarget}, kc)
+	kc = KeyMergeConfig{ZSetScore: "min"}
+	assert.NotNil(t, kc.fix())
+	kc = KeyMergeConfig{String: "max"}
+	assert.NotNil(t, kc.fix())
+
+	rc := ReplayConfig{KeyExists: "Merge"}
+	assert.Nil(t, rc.fix())
+	assert.Equal(t, "merge", rc.KeyExists)
+}
+
+func TestDryRunConfig(t *testing.T) {
+	of := OutputConfig{DryRun: true}
+	assert.Nil(t, of.fix())
+	assert.False(t, of.IsRedis())
+
+	// redis describes the target without addresses
+	of = OutputConfig{DryRun: true, Redis: &RedisConfig{Type: RedisTypeCluster, Version: "6.0"}}
+	assert.Nil(t, of.fix())
+	assert.True(t, of.Redis.IsCluster())
+	of = OutputConfig{DryRun: true, Redis: &RedisConfig{Type: RedisTypeCluster}, Replay: ReplayConfig{TargetDbMap: map[int]int{0: 1}}}
+	assert.NotNil(t, of.fix())
+
+	of = OutputConfig{DryRun: true, Cdc: &CdcConfig{Dir: t.TempDir(), File: &CdcFileConfig{}}}
+	assert.NotNil(t, of.fix())
+	of = OutputConfig{DryRun: true, Replay: ReplayConfig{Bidirectional: true}}
+	assert.NotNil(t, of.fix())
+
+	rcl := RdbCmdLoad{DryRun: true}
+	assert.Nil(t, rcl.fix())
+	assert.True(t, rcl.Redis.IsStanalone())
+	rcl = RdbCmdLoad{}
+	assert.NotNil(t, rcl.fix())
+}
+
+func TestScriptsConfig(t *testing.T) {
+	sc := ScriptsConfig{}
+	assert.Nil(t, sc.fix())
+	assert.True(t, *sc.Preload)
+	assert.Equal(t, 10000, sc.MaxScripts)
+
+	preload := false
+	sc = ScriptsConfig{Preload: &preload, MaxScripts: 10}
+	assert.Nil(t, sc.fix())
+	assert.False(t, *sc.Preload)
+	assert.Equal(t, 10, sc.MaxScripts)
+}
+
+func TestStorerScrubConfig(t *testing.T) {
+	data := `
+dirPath: /tmp/redis-gunyu
+scrub:
+  enable: true
+  interval: 1h
+  rate: -1
+`
+	sc := &StorerConfig{}
+	assert.Nil(t, yaml.Unmarshal([]byte(data), sc))
+	assert.True(t, sc.Scrub.Enable)
+	assert.Equal(t, time.Hour, sc.Scrub.Interval)
+	assert.Equal(t, int64(-1), sc.Scrub.Rate)
+}
+
+func TestStorerDiskConfig(t *testing.T) {
+	data := `
+dirPath: /tmp/redis-gunyu
+disk:
+  enable: true
+  pause: 1024
+  resume: 4096
+  interval: 5s
+`
+	sc := &StorerConfig{}
+	assert.Nil(t, yaml.Unmarshal([]byte(data), sc))
+	assert.True(t, sc.Disk.Enable)
+	assert.Equal(t, int64(1024), sc.Disk.Pause)
+	assert.Equal(t, int64(4096), sc.Disk.Resume)
+	assert.Equal(t, 5*time.Second, sc.Disk.Interval)
+
+	dc := &StorerDiskConfig{Enable: true, Pause: 1024}
+	assert.Nil(t, dc.fix())
+	assert.Equal(t, int64(2048), dc.Resume)
+	assert.Equal(t, time.Second, dc.Interval)
+}
@@ -53,13 +53,29 @@ type RdbCmdLoad struct {
 	Redis  *RedisConfig
 	Replay ReplayConfig
 	Filter FilterConfig
+	Ttl    *TtlConfig
+	DryRun bool `yaml:"dryRun" usage:"count commands which would be written, redis isn't connected"`
 }
 
 func (rcl *RdbCmdLoad) fix() error {
+	if rcl.DryRun && rcl.Redis == nil {
+		// the target is unknown
+		rcl.Redis = &RedisConfig{}
+	}
 	if rcl.Redis == nil {
 		return newConfigError("no redis configuration")
 	}
-	err := rcl.Redis.fix()
+	if rcl.Ttl != nil {
+		if err := rcl.Ttl.fix(); err != nil {
+			return err
+		}
+	}
+	var err error
+	if rcl.DryRun {
+		err = rcl.Redis.fixTarget()
+	} else {
+		err = rcl.Redis.fix()
+	}
 	if err != nil {
 		return err
 	}
@@ -72,6 +88,30 @@ type RdbCmdPrint struct {
 	Output     string `yaml:"output" usage:"output file path, default is stdout"`
 }
 
+// DeadLetterCmdConfig prints or re-drives entries of a dead-letter file
+type DeadLetterCmdConfig struct {
+	Action        string       `usage:"print/redrive"`
+	Path          string       `yaml:"path" usage:"dead-letter file path"`
+	Redis         *RedisConfig `yaml:"redis"` // target of redrive
+	Bidirectional bool         `yaml:"bidirectional" usage:"tag commands like a bidirectional syncer, so the peer syncer doesn't replicate them back"`
+}
+
+func (dcf *DeadLetterCmdConfig) fix() error {
+	if len(dcf.Path) == 0 {
+		return newConfigError("no dead-letter path")
+	}
+	switch dcf.Action {
+	case "print":
+		return nil
+	case "redrive":
+		if dcf.Redis == nil {
+			return newConfigError("no redis configuration")
+		}
+		return dcf.Redis.fix()
+	}
+	return newConfigError("invalid action : %s", dcf.Action)
+}
+
 type DiffCmdFlags struct {
 	DiffMode string
 	A        string
@@ -80,14 +120,15 @@ type DiffCmdFlags struct {
 }
 
 type AofCmdFlags struct {
-	Action string
-	Path   string
-	Offset int64
-	Size   int64
+	Action  string
+	Path    string
+	Offset  int64
+	Size    int64
+	KeyFile string // key file of an encrypted aof
 }
 
 func LoadFlags() error {
-	flag.StringVar(&flagVar.Cmd, "cmd", "sync", "command name : sync/rdb/diff")
+	flag.StringVar(&flagVar.Cmd, "cmd", "sync", "command name : sync/rdb/diff/aof/deadletter")
 	flag.StringVar(&flagVar.ConfigPath, "conf", "", "config file path")
 
 	flag.StringVar(&flagVar.DiffCmd.DiffMode, "diff.mode", "scan", "scan/rdb")
@@ -99,6 +140,7 @@ func LoadFlags() error {
 	flag.StringVar(&flagVar.AofCmd.Path, "aof.path", "", "aof path")
 	flag.Int64Var(&flagVar.AofCmd.Offset, "aof.offset", 0, "aof offset")
 	flag.Int64Var(&flagVar.AofCmd.Size, "aof.size", -1, "aof size")
+	flag.StringVar(&flagVar.AofCmd.KeyFile, "aof.keyFile", "", "key file of storer encryption, it's required to read an encrypted aof")
 
 	tmpSyncerCfg := SyncConfig{}
 	FlagsParseToStruct("sync", &tmpSyncerCfg)
@@ -106,6 +148,9 @@ func LoadFlags() error {
 	tmpRdbCfg := RdbCmdConfig{}
 	FlagsParseToStruct("rdb", &tmpRdbCfg)
 
+	tmpDeadLetterCfg := DeadLetterCmdConfig{}
+	FlagsParseToStruct("deadletter", &tmpDeadLetterCfg)
+
 	flag.Parse()
 
 	version.Init()
@@ -123,6 +168,12 @@ func LoadFlags() error {
 		if err := rdbCfg.fix(); err != nil {
 			return err
 		}
+	} else if flagVar.Cmd == "deadletter" && len(flagVar.ConfigPath) == 0 {
+		deadLetterCfg = &tmpDeadLetterCfg
+		FlagsSetToStruct(deadLetterCfg)
+		if err := deadLetterCfg.fix(); err != nil {
+			return err
+		}
 	}
 	if logCfg == nil {
 		logCfg = &LogConfig{}
@@ -31,7 +31,11 @@ const (
 	TypeRestore = "restore"
 	TypeDump    = "dump"
 	TypeSync    = "sync"
-	TypeRump    = "rump"
+
+	StorerRemoteS3 = "s3"
+
+	StorerRetentionStrict = "strict"
+	StorerRetentionLoose  = "loose"
 
 	CheckpointKey        = "redis-gunyu-checkpoint"
 	CheckpointKeyHashKey = "redis-gunyu-checkpoint-hash"
@@ -41,6 +41,11 @@ func runCmd() error {
 		cmder = cmd.NewRdbCmd()
 	case "aof":
 		cmder = cmd.NewAofCmd()
+	case "deadletter":
+		if config.GetFlag().ConfigPath != "" {
+			panicIfError(config.InitDeadLetterConfig(config.GetFlag().ConfigPath))
+		}
+		cmder = cmd.NewDeadLetterCmd()
 	default:
 		panicIfError(fmt.Errorf("does not support command(%s)", config.GetFlag().Cmd))
 	}
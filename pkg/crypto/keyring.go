@@ -0,0 +1,195 @@
+package crypto
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrUnknownKey = errors.New("unknown encryption key")
+	ErrNoKey      = errors.New("no encryption key")
+)
+
+// Key is an AES-GCM key identified by a non-zero id
+type Key struct {
+	Id   uint16
+	aead cipher.AEAD
+}
+
+func newKey(id uint16, secret []byte) (*Key, error) {
+	block, err := aes.NewCipher(secret)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Key{Id: id, aead: aead}, nil
+}
+
+func (k *Key) NonceSize() int {
+	return k.aead.NonceSize()
+}
+
+func (k *Key) Overhead() int {
+	return k.aead.NonceSize() + k.aead.Overhead()
+}
+
+// Seal appends nonce and ciphertext of plain to dst
+func (k *Key) Seal(dst, plain, ad []byte) ([]byte, error) {
+	ns := k.aead.NonceSize()
+	dst = append(dst, make([]byte, ns)...)
+	nonce := dst[len(dst)-ns:]
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return k.aead.Seal(dst, nonce, plain, ad), nil
+}
+
+// Open appends the plaintext of sealed(nonce + ciphertext) to dst
+func (k *Key) Open(dst, sealed, ad []byte) ([]byte, error) {
+	ns := k.aead.NonceSize()
+	if len(sealed) < ns {
+		return nil, errors.New("sealed data is too short")
+	}
+	return k.aead.Open(dst, sealed[:ns], sealed[ns:], ad)
+}
+
+// Keyring holds keys loaded from a local key file.
+//
+// key file format, one key per line, blank lines and lines starting with '#' are ignored :
+//
+//	$id:$hexKey
+//
+// id is in [1, 65535], and key is 16, 24 or 32 bytes(AES-128, AES-192, AES-256).
+// the key with the largest id is the active key, which is used to encrypt new files,
+// other keys are only used to decrypt old files, so never remove a key from file
+// until all files encrypted by it have been deleted.
+type Keyring struct {
+	mux     sync.RWMutex
+	path    string
+	modTime time.Time
+	keys    map[uint16]*Key
+	active  uint16
+}
+
+func LoadKeyring(path string) (*Keyring, error) {
+	kr := &Keyring{
+		path: path,
+		keys: make(map[uint16]*Key),
+	}
+	if _, err := kr.Reload(); err != nil {
+		return nil, err
+	}
+	return kr, nil
+}
+
+// Reload reloads key file if it's modified,
+// keys removed from file are still kept in memory
+func (kr *Keyring) Reload() (bool, error) {
+	fi, err := os.Stat(kr.path)
+	if err != nil {
+		return false, err
+	}
+
+	kr.mux.RLock()
+	modTime := kr.modTime
+	kr.mux.RUnlock()
+	if fi.ModTime().Equal(modTime) {
+		return false, nil
+	}
+
+	keys, err := parseKeyFile(kr.path)
+	if err != nil {
+		return false, err
+	}
+	if len(keys) == 0 {
+		return false, fmt.Errorf("%w : file(%s)", ErrNoKey, kr.path)
+	}
+
+	kr.mux.Lock()
+	defer kr.mux.Unlock()
+	for id, k := range keys {
+		kr.keys[id] = k
+		if id > kr.active {
+			kr.active = id
+		}
+	}
+	kr.modTime = fi.ModTime()
+	return true, nil
+}
+
+// Active returns the key for encrypting new files
+func (kr *Keyring) Active() (*Key, error) {
+	kr.mux.RLock()
+	defer kr.mux.RUnlock()
+	k, ok := kr.keys[kr.active]
+	if !ok {
+		return nil, ErrNoKey
+	}
+	return k, nil
+}
+
+func (kr *Keyring) Get(id uint16) (*Key, error) {
+	kr.mux.RLock()
+	defer kr.mux.RUnlock()
+	k, ok := kr.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("%w : id(%d)", ErrUnknownKey, id)
+	}
+	return k, nil
+}
+
+func parseKeyFile(path string) (map[uint16]*Key, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	keys := make(map[uint16]*Key)
+	scanner := bufio.NewScanner(file)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		fields := strings.SplitN(line, ":", 2)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("invalid key file : file(%s), line(%d)", path, lineNo)
+		}
+		id, err := strconv.ParseUint(strings.TrimSpace(fields[0]), 10, 16)
+		if err != nil || id == 0 {
+			return nil, fmt.Errorf("invalid key id : file(%s), line(%d)", path, lineNo)
+		}
+		secret, err := hex.DecodeString(strings.TrimSpace(fields[1]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid key : file(%s), line(%d), error(%w)", path, lineNo, err)
+		}
+		if _, ok := keys[uint16(id)]; ok {
+			return nil, fmt.Errorf("duplicated key id : file(%s), line(%d), id(%d)", path, lineNo, id)
+		}
+		k, err := newKey(uint16(id), secret)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key : file(%s), line(%d), error(%w)", path, lineNo, err)
+		}
+		keys[uint16(id)] = k
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
@@ -0,0 +1,72 @@
+package crypto
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyring(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys")
+	write := func(content string, mt time.Time) {
+		assert.Nil(t, os.WriteFile(path, []byte(content), 0600))
+		assert.Nil(t, os.Chtimes(path, mt, mt))
+	}
+
+	now := time.Now()
+	write("# comment\n\n1:000102030405060708090a0b0c0d0e0f\n", now)
+	kr, err := LoadKeyring(path)
+	assert.Nil(t, err)
+
+	k1, err := kr.Active()
+	assert.Nil(t, err)
+	assert.Equal(t, uint16(1), k1.Id)
+
+	sealed, err := k1.Seal(nil, []byte("hello"), []byte("ad"))
+	assert.Nil(t, err)
+	assert.Equal(t, len("hello")+k1.Overhead(), len(sealed))
+	plain, err := k1.Open(nil, sealed, []byte("ad"))
+	assert.Nil(t, err)
+	assert.Equal(t, "hello", string(plain))
+	_, err = k1.Open(nil, sealed, []byte("xx"))
+	assert.NotNil(t, err)
+
+	t.Run("rotate", func(t *testing.T) {
+		write("2:101112131415161718191a1b1c1d1e1f\n", now.Add(time.Second))
+		reloaded, err := kr.Reload()
+		assert.Nil(t, err)
+		assert.True(t, reloaded)
+
+		k2, err := kr.Active()
+		assert.Nil(t, err)
+		assert.Equal(t, uint16(2), k2.Id)
+
+		// removed key is kept
+		k, err := kr.Get(1)
+		assert.Nil(t, err)
+		plain, err := k.Open(nil, sealed, []byte("ad"))
+		assert.Nil(t, err)
+		assert.Equal(t, "hello", string(plain))
+
+		_, err = kr.Get(3)
+		assert.True(t, errors.Is(err, ErrUnknownKey))
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, content := range []string{
+			"",
+			"0:000102030405060708090a0b0c0d0e0f\n",
+			"1:0001\n",
+			"1:zz\n",
+			"1:000102030405060708090a0b0c0d0e0f\n1:000102030405060708090a0b0c0d0e0f\n",
+		} {
+			write(content, now)
+			_, err := LoadKeyring(path)
+			assert.NotNil(t, err, content)
+		}
+	})
+}
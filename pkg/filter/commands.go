@@ -1,6 +1,12 @@
 package filter
 
-type getkeys_proc func(args []string) []int
+import (
+	"strconv"
+	"strings"
+)
+
+// getkeys_proc returns indexes of keys in args, for commands whose key positions depend on arguments
+type getkeys_proc func(args [][]byte) []int
 type redisKeyPosition struct {
 	first, last, step int
 }
@@ -47,6 +53,11 @@ var commandKeyPositions = map[string]redisKeyPosition{
 	"zremrangebyscore": genericKeyPos,
 	"zremrangebyrank":  genericKeyPos,
 	"zremrangebylex":   genericKeyPos,
+	"zpopmin":          genericKeyPos,
+	"zpopmax":          genericKeyPos,
+	"bzpopmin":         {1, -2, 1},
+	"bzpopmax":         {1, -2, 1},
+	"zrangestore":      {1, 2, 1},
 	"hset":             genericKeyPos,
 	"hsetnx":           genericKeyPos,
 	"hmset":            genericKeyPos,
@@ -80,8 +91,164 @@ var commandKeyPositions = map[string]redisKeyPosition{
 	"restore-asking":   genericKeyPos,
 	"bitop":            {2, -1, 1},
 	"geoadd":           genericKeyPos,
+	"geosearchstore":   {1, 2, 1},
 	"pfadd":            genericKeyPos,
 	"pfmerge":          {1, -1, 1},
-	"del":              {1, 0, 1},
+	"del":              {1, -1, 1},
 	"unlink":           {1, -1, 1},
+	"getdel":           genericKeyPos,
+	"getex":            genericKeyPos,
+	"copy":             {1, 2, 1},
+	"lmove":            {1, 2, 1},
+	"blmove":           {1, 2, 1},
+	"xadd":             genericKeyPos,
+	"xdel":             genericKeyPos,
+	"xtrim":            genericKeyPos,
+	"xsetid":           genericKeyPos,
+	"xack":             genericKeyPos,
+	"xclaim":           genericKeyPos,
+	"xautoclaim":       genericKeyPos,
+}
+
+// commandKeysProcs are only used to locate keys, commands are not split by keys
+var commandKeysProcs = map[string]getkeys_proc{
+	// script numkeys key [key ...] arg [arg ...]
+	"eval":       numKeysAt(1),
+	"evalsha":    numKeysAt(1),
+	"eval_ro":    numKeysAt(1),
+	"evalsha_ro": numKeysAt(1),
+	"fcall":      numKeysAt(1),
+	"fcall_ro":   numKeysAt(1),
+	// destination numkeys key [key ...]
+	"zunionstore": destAndNumKeysAt(1),
+	"zinterstore": destAndNumKeysAt(1),
+	"zdiffstore":  destAndNumKeysAt(1),
+	// numkeys key [key ...]
+	"lmpop": numKeysAt(0),
+	"zmpop": numKeysAt(0),
+	// timeout numkeys key [key ...]
+	"blmpop": numKeysAt(1),
+	"bzmpop": numKeysAt(1),
+	// key ... [STORE destination]
+	"sort":              keyAndStore("store"),
+	"georadius":         keyAndStore("store", "storedist"),
+	"georadiusbymember": keyAndStore("store", "storedist"),
+	// subcommand key ...
+	"xgroup": xgroupKeys,
+}
+
+// keylessCommands have no key, they are not rejected if keys of commands are rewritten
+var keylessCommands = map[string]struct{}{
+	"select":   {},
+	"ping":     {},
+	"multi":    {},
+	"exec":     {},
+	"discard":  {},
+	"flushdb":  {},
+	"flushall": {},
+	"swapdb":   {},
+	"script":   {},
+	"function": {},
+	"publish":  {},
+	"spublish": {},
+}
+
+// numKeysAt returns keys after the argument numkeys
+func numKeysAt(i int) getkeys_proc {
+	return func(args [][]byte) []int {
+		if i >= len(args) {
+			return nil
+		}
+		num, err := strconv.Atoi(string(args[i]))
+		if err != nil || num <= 0 {
+			return nil
+		}
+		var indexes []int
+		for j := i + 1; j <= i+num && j < len(args); j++ {
+			indexes = append(indexes, j)
+		}
+		return indexes
+	}
+}
+
+// destAndNumKeysAt returns the destination key followed by keys after the argument numkeys
+func destAndNumKeysAt(i int) getkeys_proc {
+	return func(args [][]byte) []int {
+		return append([]int{0}, numKeysAt(i)(args)...)
+	}
+}
+
+// keyAndStore returns the first key, and keys after the options
+func keyAndStore(options ...string) getkeys_proc {
+	return func(args [][]byte) []int {
+		indexes := []int{0}
+		for i := 1; i < len(args)-1; i++ {
+			for _, opt := range options {
+				if strings.EqualFold(string(args[i]), opt) {
+					indexes = append(indexes, i+1)
+					i++
+					break
+				}
+			}
+		}
+		return indexes
+	}
+}
+
+// XGROUP CREATE|SETID|DESTROY|CREATECONSUMER|DELCONSUMER key ...
+func xgroupKeys(args [][]byte) []int {
+	if len(args) < 2 || strings.EqualFold(string(args[0]), "help") {
+		return nil
+	}
+	return []int{1}
+}
+
+// keyRange returns indexes of the first and the last keys in n args, last is negative if there is no key
+func keyRange(pos redisKeyPosition, n int) (first int, last int) {
+	// positions count the command name, e.g. -1 is the last argument
+	first = pos.first - 1
+	lastArg := pos.last - 1
+	if pos.last < 0 {
+		lastArg = n + pos.last
+	}
+	if lastArg >= n {
+		lastArg = n - 1
+	}
+	if first > lastArg {
+		return first, -1
+	}
+	return first, first + (lastArg-first)/pos.step*pos.step
+}
+
+// KnownKeys returns true if keys of cmd can be located, or cmd has no key
+func KnownKeys(cmd string) bool {
+	if _, ok := commandKeysProcs[cmd]; ok {
+		return true
+	}
+	if _, ok := commandKeyPositions[cmd]; ok {
+		return true
+	}
+	_, ok := keylessCommands[cmd]
+	return ok
+}
+
+// KeyIndexes returns indexes of keys in args of cmd, cmd is in lower case,
+// it returns nil if cmd is unknown
+func KeyIndexes(cmd string, args [][]byte) []int {
+	if proc, ok := commandKeysProcs[cmd]; ok {
+		if len(args) == 0 {
+			return nil
+		}
+		return proc(args)
+	}
+	cmdPos, ok := commandKeyPositions[cmd]
+	if !ok || len(args) == 0 {
+		return nil
+	}
+	firstkey, lastkey := keyRange(cmdPos, len(args))
+	var indexes []int
+	for i := firstkey; i <= lastkey; i += cmdPos.step {
+		indexes = append(indexes, i)
+	}
+	return indexes
 }
@@ -137,20 +137,16 @@ func (f *RedisKeyFilter) FilterCmdKey(cmd string, args [][]byte) ([][]byte, bool
 	if !ok || len(args) == 0 {
 		return args, false
 	}
-	lastkey := cmdPos.last - 1
+	firstkey, lastkey := keyRange(cmdPos, len(args))
 	keystep := cmdPos.step
 
-	if lastkey < 0 {
-		lastkey = lastkey + len(args)
-	}
-
 	array := make([]int, len(args))
 	number := 0
 	foutKey := false
-	for firstkey := cmdPos.first - 1; firstkey <= lastkey; firstkey += keystep {
-		key := string(args[firstkey])
+	for i := firstkey; i <= lastkey; i += keystep {
+		key := string(args[i])
 		if !f.FilterKey(key) && !f.FilterSlot(key) {
-			array[number] = firstkey
+			array[number] = i
 			number++
 		} else {
 			foutKey = true
@@ -164,17 +160,14 @@ func (f *RedisKeyFilter) FilterCmdKey(cmd string, args [][]byte) ([][]byte, bool
 	}
 
 	pass := true
-	newArgs := make([][]byte, number*cmdPos.step+len(args)-lastkey-cmdPos.step)
+	// arguments before the first key, e.g. the operation of BITOP, are kept
+	newArgs := make([][]byte, 0, firstkey+number*cmdPos.step+len(args)-lastkey-cmdPos.step)
+	newArgs = append(newArgs, args[:firstkey]...)
 	for i := 0; i < number; i++ {
-		for j := 0; j < cmdPos.step; j++ {
-			newArgs[i*cmdPos.step+j] = args[array[i]+j]
-		}
+		newArgs = append(newArgs, args[array[i]:array[i]+cmdPos.step]...)
 	}
-
-	j := 0
-	for i := lastkey + cmdPos.step; i < len(args); i++ {
-		newArgs[number*cmdPos.step+j] = args[i]
-		j = j + 1
+	if lastkey+cmdPos.step < len(args) {
+		newArgs = append(newArgs, args[lastkey+cmdPos.step:]...)
 	}
 
 	return newArgs, !pass
@@ -117,3 +117,128 @@ func TestFilter(t *testing.T) {
 
 	})
 }
+
+func TestKeyIndexes(t *testing.T) {
+	args := func(s ...string) [][]byte {
+		ret := [][]byte{}
+		for _, a := range s {
+			ret = append(ret, []byte(a))
+		}
+		return ret
+	}
+	assert.Equal(t, []int{0}, KeyIndexes("set", args("k", "v")))
+	assert.Equal(t, []int{0, 2}, KeyIndexes("mset", args("k1", "v1", "k2", "v2")))
+	assert.Equal(t, []int{0, 1}, KeyIndexes("rename", args("k1", "k2")))
+	assert.Equal(t, []int{0, 1, 2}, KeyIndexes("del", args("k1", "k2", "k3")))
+	assert.Equal(t, []int{0, 1}, KeyIndexes("smove", args("k1", "k2", "m")))
+	assert.Equal(t, []int{2, 3}, KeyIndexes("eval", args("script", "2", "k1", "k2", "a1")))
+	assert.Nil(t, KeyIndexes("evalsha", args("sha", "0", "a1")))
+	assert.Equal(t, []int{0, 2, 3}, KeyIndexes("zunionstore", args("dst", "2", "k1", "k2", "weights", "1", "2")))
+	assert.Nil(t, KeyIndexes("unknown", args("k")))
+	assert.Nil(t, KeyIndexes("set", nil))
+	assert.Nil(t, KeyIndexes("eval", nil))
+
+	// the last position is negative
+	for _, c := range []struct {
+		cmd     string
+		args    [][]byte
+		indexes []int
+	}{
+		{"del", args("a"), []int{0}},
+		{"unlink", args("a", "b"), []int{0, 1}},
+		{"sinterstore", args("d", "a", "b"), []int{0, 1, 2}},
+		{"sunionstore", args("d", "a", "b"), []int{0, 1, 2}},
+		{"sdiffstore", args("d", "a", "b"), []int{0, 1, 2}},
+		{"pfmerge", args("d", "a", "b"), []int{0, 1, 2}},
+		{"bitop", args("and", "d", "a", "b"), []int{1, 2, 3}},
+		{"bitop", args("and"), nil},
+		{"mset", args("k1", "v1", "k2", "v2"), []int{0, 2}},
+		{"msetnx", args("k1", "v1"), []int{0}},
+		{"blpop", args("a", "b", "0"), []int{0, 1}},
+		{"brpop", args("a", "0"), []int{0}},
+		{"bzpopmin", args("a", "b", "0"), []int{0, 1}},
+		{"bzpopmax", args("a", "0"), []int{0}},
+	} {
+		assert.Equal(t, c.indexes, KeyIndexes(c.cmd, c.args), "%s %s", c.cmd, c.args)
+	}
+
+	// keys depend on arguments
+	for _, c := range []struct {
+		cmd     string
+		args    [][]byte
+		indexes []int
+	}{
+		{"zpopmin", args("a", "1"), []int{0}},
+		{"xack", args("s", "g", "1-0"), []int{0}},
+		{"xclaim", args("s", "g", "c", "0", "1-0"), []int{0}},
+		{"xautoclaim", args("s", "g", "c", "0", "0-0"), []int{0}},
+		{"xgroup", args("CREATE", "s", "g", "$"), []int{1}},
+		{"xgroup", args("help"), nil},
+		{"sort", args("a", "by", "w_*", "STORE", "d"), []int{0, 4}},
+		{"sort", args("a", "limit", "0", "1"), []int{0}},
+		{"zrangestore", args("d", "a", "0", "-1"), []int{0, 1}},
+		{"geosearchstore", args("d", "a", "frommember", "m", "byradius", "1", "km"), []int{0, 1}},
+		{"georadius", args("a", "0", "0", "1", "km", "storedist", "d"), []int{0, 6}},
+		{"lmpop", args("2", "a", "b", "left"), []int{1, 2}},
+		{"blmpop", args("0", "1", "a", "left"), []int{2}},
+		{"zmpop", args("1", "a", "min"), []int{1}},
+		{"bzmpop", args("0", "2", "a", "b", "max"), []int{2, 3}},
+	} {
+		assert.Equal(t, c.indexes, KeyIndexes(c.cmd, c.args), "%s %s", c.cmd, c.args)
+	}
+
+	assert.True(t, KnownKeys("set"))
+	assert.True(t, KnownKeys("evalsha"))
+	assert.True(t, KnownKeys("flushdb"))
+	assert.False(t, KnownKeys("json.set"))
+}
+
+func TestFilterCmdKeyNegativeLast(t *testing.T) {
+	args := func(s ...string) [][]byte {
+		ret := [][]byte{}
+		for _, a := range s {
+			ret = append(ret, []byte(a))
+		}
+		return ret
+	}
+	ft := &RedisKeyFilter{}
+	ft.InsertPrefixKeyBlackList([]string{"tmp"})
+
+	newArgs, reject := ft.FilterCmdKey("unlink", args("a", "tmp1"))
+	assert.False(t, reject)
+	assert.Equal(t, args("a"), newArgs)
+
+	newArgs, reject = ft.FilterCmdKey("unlink", args("tmp1", "tmp2"))
+	assert.True(t, reject)
+	assert.Equal(t, args("tmp1", "tmp2"), newArgs)
+
+	// the operation before keys is kept
+	newArgs, reject = ft.FilterCmdKey("bitop", args("and", "d", "a", "tmp"))
+	assert.False(t, reject)
+	assert.Equal(t, args("and", "d", "a"), newArgs)
+
+	// arguments after keys are kept
+	newArgs, reject = ft.FilterCmdKey("blpop", args("a", "tmp", "0"))
+	assert.False(t, reject)
+	assert.Equal(t, args("a", "0"), newArgs)
+}
+
+func TestKeyRenamer(t *testing.T) {
+	kr := &KeyRenamer{}
+	assert.True(t, kr.Empty())
+	kr.InsertPrefix("app1:", "tenant42:app1:")
+	assert.Nil(t, kr.InsertRegex(`^db2:(\w+):(.*)$`, "$1:${2}"))
+	kr.InsertPrefix("app", "other")
+	assert.NotNil(t, kr.InsertRegex(`(`, ""))
+	assert.False(t, kr.Empty())
+
+	assert.Equal(t, "tenant42:app1:k", string(kr.Rename([]byte("app1:k"))))
+	assert.Equal(t, "user:1:name", string(kr.Rename([]byte("db2:user:1:name"))))
+	// the first matched rule is applied
+	assert.Equal(t, "other2:k", string(kr.Rename([]byte("app2:k"))))
+	assert.Equal(t, "k", string(kr.Rename([]byte("k"))))
+
+	var nilRenamer *KeyRenamer
+	assert.True(t, nilRenamer.Empty())
+	assert.Equal(t, "k", string(nilRenamer.Rename([]byte("k"))))
+}
@@ -0,0 +1,62 @@
+package filter
+
+import (
+	"bytes"
+	"regexp"
+)
+
+// KeyRenamer renames keys by ordered rules, the first matched rule is applied
+type KeyRenamer struct {
+	rules []renameRule
+}
+
+type renameRule struct {
+	prefix []byte
+	regex  *regexp.Regexp
+	to     []byte
+}
+
+// InsertPrefix replaces prefix from of keys with to
+func (kr *KeyRenamer) InsertPrefix(from, to string) {
+	kr.rules = append(kr.rules, renameRule{prefix: []byte(from), to: []byte(to)})
+}
+
+// InsertRegex replaces the first match of expr in keys with to, capture groups are referred by $1 or ${name}
+func (kr *KeyRenamer) InsertRegex(expr, to string) error {
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return err
+	}
+	kr.rules = append(kr.rules, renameRule{regex: re, to: []byte(to)})
+	return nil
+}
+
+func (kr *KeyRenamer) Empty() bool {
+	return kr == nil || len(kr.rules) == 0
+}
+
+// Rename returns a new key if a rule is matched, otherwise returns key
+func (kr *KeyRenamer) Rename(key []byte) []byte {
+	if kr == nil {
+		return key
+	}
+	for _, rule := range kr.rules {
+		if rule.regex == nil {
+			if !bytes.HasPrefix(key, rule.prefix) {
+				continue
+			}
+			newKey := make([]byte, 0, len(rule.to)+len(key)-len(rule.prefix))
+			newKey = append(newKey, rule.to...)
+			return append(newKey, key[len(rule.prefix):]...)
+		}
+		loc := rule.regex.FindSubmatchIndex(key)
+		if loc == nil {
+			continue
+		}
+		newKey := make([]byte, 0, len(key)+len(rule.to))
+		newKey = append(newKey, key[:loc[0]]...)
+		newKey = rule.regex.Expand(newKey, rule.to, key, loc)
+		return append(newKey, key[loc[1]:]...)
+	}
+	return key
+}
@@ -0,0 +1,69 @@
+package rdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/mgtv-tech/redis-GunYu/pkg/digest"
+)
+
+// ParseDump parses the payload of DUMP command into entries, a big value may be split into several entries.
+// payload : type(1B) + value(xB) + rdb version(2B) + crc64(8B)
+func ParseDump(db int, key []byte, payload []byte, options ...RdbParseOption) ([]*BinEntry, error) {
+	if len(payload) < 11 {
+		return nil, fmt.Errorf("invalid dump payload : key(%s), len(%d)", key, len(payload))
+	}
+	footer := payload[len(payload)-10:]
+	version := int64(binary.LittleEndian.Uint16(footer[:2]))
+	if version > RdbVersion {
+		return nil, fmt.Errorf("unsupported dump version : key(%s), version(%d)", key, version)
+	}
+	crc := digest.New()
+	crc.Write(payload[:len(payload)-8])
+	if expect := binary.LittleEndian.Uint64(footer[2:]); expect != crc.Sum64() {
+		return nil, fmt.Errorf("dump checksum validation error : key(%s), expect(%d), actual(%d)", key, expect, crc.Sum64())
+	}
+
+	// type + key + value + EOF, it's an object of rdb file
+	var buf bytes.Buffer
+	buf.Grow(len(payload) + len(key) + 10)
+	buf.WriteByte(payload[0])
+	writeString(&buf, key)
+	buf.Write(payload[1 : len(payload)-10])
+	buf.WriteByte(RdbFlagEOF)
+
+	l := NewLoader(&buf, options...)
+	l.rdbVersion = version
+	l.db = uint32(db)
+	var entries []*BinEntry
+	for {
+		entry, err := l.Next()
+		if err != nil {
+			return nil, fmt.Errorf("parse dump error : key(%s), error(%w)", key, err)
+		}
+		if entry == nil {
+			return entries, nil
+		}
+		entries = append(entries, entry)
+	}
+}
+
+// writeString writes a string with rdb length encoding
+func writeString(buf *bytes.Buffer, s []byte) {
+	n := uint64(len(s))
+	switch {
+	case n < 1<<6:
+		buf.WriteByte(byte(n))
+	case n < 1<<14:
+		buf.WriteByte(byte(n>>8) | rdb14bitLen<<6)
+		buf.WriteByte(byte(n))
+	case n <= 0xffffffff:
+		buf.WriteByte(rdb32bitLen)
+		binary.Write(buf, binary.BigEndian, uint32(n))
+	default:
+		buf.WriteByte(rdb64bitLen)
+		binary.Write(buf, binary.BigEndian, n)
+	}
+	buf.Write(s)
+}
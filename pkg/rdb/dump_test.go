@@ -0,0 +1,28 @@
+package rdb
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDump(t *testing.T) {
+	for _, key := range []string{"k", strings.Repeat("k", 100), strings.Repeat("k", 20000)} {
+		payload := CreateValueDump(RdbTypeString, append([]byte{5}, "hello"...))
+		entries, err := ParseDump(3, []byte(key), payload)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(entries))
+		assert.Equal(t, key, string(entries[0].Key))
+		assert.Equal(t, 3, entries[0].DB)
+		assert.Equal(t, "hello", string(entries[0].Value()))
+	}
+
+	payload := CreateValueDump(RdbTypeString, append([]byte{5}, "hello"...))
+	payload[1] = 4
+	_, err := ParseDump(0, []byte("k"), payload)
+	assert.NotNil(t, err)
+
+	_, err = ParseDump(0, []byte("k"), payload[:10])
+	assert.NotNil(t, err)
+}
@@ -6,6 +6,7 @@ import (
 	"hash"
 	"io"
 	"strconv"
+	"strings"
 
 	"github.com/mgtv-tech/redis-GunYu/config"
 	"github.com/mgtv-tech/redis-GunYu/pkg/digest"
@@ -93,6 +94,27 @@ func (be *BinEntry) FirstBin() bool {
 	return true
 }
 
+// ExecCmd converts the entry to commands with Key of entry, since Key may be renamed after parsing
+func (be *BinEntry) ExecCmd(cb RdbObjExecutor) {
+	parsedKey := be.ObjectParser.Key()
+	if be.Key == nil || bytes.Equal(parsedKey, be.Key) {
+		be.ObjectParser.ExecCmd(cb)
+		return
+	}
+	be.ObjectParser.ExecCmd(func(cmd string, args ...interface{}) error {
+		i := 0
+		if strings.EqualFold(cmd, "xgroup") { // XGROUP CREATE key group id
+			i = 1
+		}
+		if i < len(args) {
+			if key, ok := args[i].([]byte); ok && bytes.Equal(key, parsedKey) {
+				args[i] = be.Key
+			}
+		}
+		return cb(cmd, args...)
+	})
+}
+
 func (be *BinEntry) Value() []byte {
 	if be.ObjectParser != nil {
 		return be.ObjectParser.Value()
@@ -863,3 +863,36 @@ func (ts *functionTestSuite) TestRdb11() {
 		}
 	}
 }
+
+func TestBinEntryExecCmd(t *testing.T) {
+	// a list of two elements, without checksum
+	data := []byte("REDIS0009")
+	data = append(data, RdbFlagSelectDB, 0, RdbTypeList, 3, 'k', 'e', 'y', 2, 1, 'a', 1, 'b', RdbFlagEOF)
+	data = append(data, make([]byte, 8)...)
+
+	l := NewLoader(bytes.NewReader(data))
+	if err := l.Header(); err != nil {
+		t.Fatal(err)
+	}
+	e, err := l.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	collect := func() (cmds []string) {
+		e.ExecCmd(func(cmd string, args ...interface{}) error {
+			cmds = append(cmds, fmt.Sprintf("%s %s", cmd, args))
+			return nil
+		})
+		return
+	}
+	if cmds := collect(); strings.Join(cmds, ",") != "RPUSH [key a],RPUSH [key b]" {
+		t.Fatalf("unexpected commands : %v", cmds)
+	}
+
+	// renamed key
+	e.Key = []byte("new")
+	if cmds := collect(); strings.Join(cmds, ",") != "RPUSH [new a],RPUSH [new b]" {
+		t.Fatalf("unexpected commands : %v", cmds)
+	}
+}
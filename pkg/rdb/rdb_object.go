@@ -208,7 +208,8 @@ func (bp *BaseParser) readBufferBegin(lr *Loader) {
 	if bp.totalEntries-bp.readEntries == 0 {
 		bp.key = r.ReadStringP()
 	} else {
-		bp.key = lr.lastEntry.Key
+		// Key of the last entry may be renamed by consumers
+		bp.key = lr.lastEntry.ObjectParser.Key()
 	}
 }
 
@@ -26,6 +26,8 @@ type RdbReplay struct {
 	KeyExists       string
 	KeyExistsLog    bool
 	ReplaceHashTag  bool
+	MergeMaxScore   bool // merge : zsets keep the max score of members, instead of the source score
+	MergeKeepString bool // merge : existing strings win, instead of source strings
 }
 
 func (rr *RdbReplay) Replay(e *rdb.BinEntry) (err error) {
@@ -56,6 +58,11 @@ func (rr *RdbReplay) Replay(e *rdb.BinEntry) (err error) {
 		restoreCmd = false
 	}
 
+	if rr.KeyExists == "merge" {
+		// RESTORE replaces the whole key, so the entry is decoded to commands
+		return rr.merge(e, ttlms)
+	}
+
 	if !restoreCmd {
 		if e.FirstBin() {
 			exist, err := common.Bool(rr.Client.Do("exists", e.Key))
@@ -82,7 +89,7 @@ func (rr *RdbReplay) Replay(e *rdb.BinEntry) (err error) {
 			}
 		}
 
-		err = restoreBigRdbEntry(rr.Client, e)
+		err = restoreBigRdbEntry(rr.Client, e, nil)
 		if err != nil {
 			return err
 		}
@@ -132,7 +139,7 @@ RESTORE:
 			}
 		} else if strings.Contains(err.Error(), "Bad data format") { // cluster.c:restoreCommand
 			log.Warn(err, " try to restoreBigRdbEntry")
-			if err := restoreBigRdbEntry(rr.Client, e); err != nil {
+			if err := restoreBigRdbEntry(rr.Client, e, nil); err != nil {
 				return err
 			}
 		} else {
@@ -147,14 +154,15 @@ RESTORE:
 
 func restoreOnce(cli client.Redis, e *rdb.BinEntry) (err error) {
 	defer util.Xrecover(&err, ErrRestoreRdb)
-	e.ObjectParser.ExecCmd(func(cmd string, args ...interface{}) error {
+	e.ExecCmd(func(cmd string, args ...interface{}) error {
 		_, err := cli.Do(cmd, args...)
 		return err
 	})
 	return nil
 }
 
-func restoreBigRdbEntry(cli client.Redis, e *rdb.BinEntry) (err error) {
+// restoreBigRdbEntry replays e by commands, rewrite changes commands if it's not nil
+func restoreBigRdbEntry(cli client.Redis, e *rdb.BinEntry, rewrite func(string, []interface{}) (string, []interface{})) (err error) {
 	defer util.Xrecover(&err, ErrRestoreRdb)
 
 	if e.ObjectParser == nil {
@@ -162,7 +170,10 @@ func restoreBigRdbEntry(cli client.Redis, e *rdb.BinEntry) (err error) {
 	}
 
 	count := 0
-	e.ObjectParser.ExecCmd(func(cmd string, args ...interface{}) error {
+	e.ExecCmd(func(cmd string, args ...interface{}) error {
+		if rewrite != nil {
+			cmd, args = rewrite(cmd, args)
+		}
 		err = cli.Send(cmd, args...)
 		if err != nil {
 			return err
@@ -191,3 +202,79 @@ func flushAndCheckReply(cli client.Redis, count int) error {
 	}
 	return nil
 }
+
+// mergeableTypes are replies of TYPE by object types, existing keys of these types are merged
+var mergeableTypes = map[int]string{
+	rdb.RdbObjectString: "string",
+	rdb.RdbObjectList:   "list",
+	rdb.RdbObjectSet:    "set",
+	rdb.RdbObjectZSet:   "zset",
+	rdb.RdbObjectHash:   "hash",
+}
+
+// merge replays e into the existing key of the same type : hashes are merged field by field,
+// sets and zsets are unioned, lists are appended, and strings follow MergeKeepString.
+// Lists aren't idempotent, elements are appended again if the entry is replayed again.
+// An existing key of another type or a stream is replaced.
+// The ttl of e is applied if it has one, otherwise the existing key keeps its ttl.
+func (rr *RdbReplay) merge(e *rdb.BinEntry, ttlms uint64) error {
+	ot := e.ObjectParser.Type()
+	maxScore := ot == rdb.RdbObjectZSet && rr.MergeMaxScore
+	if maxScore && !util.VersionGE(rr.RedisVersion, "6.2", util.VersionMinor) {
+		// ZADD GT
+		return fmt.Errorf("merging max scores requires redis 6.2 or later : key(%s), version(%s)", e.Key, rr.RedisVersion)
+	}
+	if e.FirstBin() {
+		typ, err := common.String(rr.Client.Do("type", e.Key))
+		if err != nil {
+			return fmt.Errorf("type of key error : key(%s), error(%w)", e.Key, err)
+		}
+		if typ != "none" {
+			if name, ok := mergeableTypes[ot]; ok && name == typ {
+				if ot == rdb.RdbObjectString && rr.MergeKeepString {
+					if rr.KeyExistsLog {
+						log.Warnf("output key exist, keep it : %s", e.Key)
+					}
+					return nil
+				}
+				if rr.KeyExistsLog {
+					log.Infof("merge key: %s", e.Key)
+				}
+			} else {
+				if rr.KeyExistsLog {
+					log.Infof("replace key : key(%s), type(%s)", e.Key, typ)
+				}
+				if _, err := common.Int64(rr.Client.Do("del", e.Key)); err != nil {
+					return fmt.Errorf("del exist key error : key(%s), error(%w)", e.Key, err)
+				}
+			}
+		}
+	}
+
+	var rewrite func(string, []interface{}) (string, []interface{})
+	if maxScore {
+		rewrite = mergeMaxScore
+	}
+	if err := restoreBigRdbEntry(rr.Client, e, rewrite); err != nil {
+		return err
+	}
+	if e.ExpireAt != 0 {
+		r, err := common.Int64(rr.Client.Do("pexpire", e.Key, ttlms))
+		if err != nil && r != 1 {
+			return fmt.Errorf("expire key error : key(%s), error(%w)", e.Key, err)
+		}
+	}
+	return nil
+}
+
+// mergeMaxScore rewrites ZADD key score member to ZADD key GT score member,
+// which adds new members, and updates existing members only if the new score is greater
+func mergeMaxScore(cmd string, args []interface{}) (string, []interface{}) {
+	if !strings.EqualFold(cmd, "zadd") || len(args) < 3 {
+		return cmd, args
+	}
+	newArgs := make([]interface{}, 0, len(args)+1)
+	newArgs = append(newArgs, args[0], "GT")
+	newArgs = append(newArgs, args[1:]...)
+	return cmd, newArgs
+}
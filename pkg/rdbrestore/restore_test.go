@@ -0,0 +1,94 @@
+package rdbrestore
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mgtv-tech/redis-GunYu/pkg/rdb"
+	"github.com/mgtv-tech/redis-GunYu/pkg/redis/client"
+)
+
+// fakeRedis replies TYPE with typ, and records other commands
+type fakeRedis struct {
+	client.Redis
+	typ  string
+	cmds [][]interface{}
+	sent int
+}
+
+func (fr *fakeRedis) Do(cmd string, args ...interface{}) (interface{}, error) {
+	if cmd == "type" {
+		return fr.typ, nil
+	}
+	fr.cmds = append(fr.cmds, append([]interface{}{cmd}, args...))
+	return int64(1), nil
+}
+
+func (fr *fakeRedis) Send(cmd string, args ...interface{}) error {
+	fr.cmds = append(fr.cmds, append([]interface{}{cmd}, args...))
+	fr.sent++
+	return nil
+}
+
+func (fr *fakeRedis) Flush() error { return nil }
+
+func (fr *fakeRedis) Receive() (interface{}, error) {
+	fr.sent--
+	return "OK", nil
+}
+
+func dumpEntry(t *testing.T, typ byte, value []byte) *rdb.BinEntry {
+	entries, err := rdb.ParseDump(0, []byte("k"), rdb.CreateValueDump(typ, value))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(entries))
+	return entries[0]
+}
+
+func TestMerge(t *testing.T) {
+	str := func() *rdb.BinEntry { return dumpEntry(t, rdb.RdbTypeString, append([]byte{1}, "v"...)) }
+
+	// existing key of another type is replaced
+	cli := &fakeRedis{typ: "hash"}
+	rr := &RdbReplay{Client: cli, KeyExists: "merge"}
+	assert.Nil(t, rr.Replay(str()))
+	assert.Equal(t, [][]interface{}{{"del", []byte("k")}, {"set", []byte("k"), []byte("v")}}, cli.cmds)
+	assert.Equal(t, 0, cli.sent)
+
+	// existing string is kept
+	cli = &fakeRedis{typ: "string"}
+	rr = &RdbReplay{Client: cli, KeyExists: "merge", MergeKeepString: true}
+	assert.Nil(t, rr.Replay(str()))
+	assert.Empty(t, cli.cmds)
+
+	// source string wins
+	rr.MergeKeepString = false
+	assert.Nil(t, rr.Replay(str()))
+	assert.Equal(t, [][]interface{}{{"set", []byte("k"), []byte("v")}}, cli.cmds)
+
+	// zadd gt requires redis 6.2
+	score := make([]byte, 8)
+	binary.LittleEndian.PutUint64(score, math.Float64bits(1.5))
+	zset := append([]byte{1, 1, 'm'}, score...)
+	cli = &fakeRedis{typ: "zset"}
+	rr = &RdbReplay{Client: cli, KeyExists: "merge", MergeMaxScore: true, RedisVersion: "6.0.9"}
+	assert.NotNil(t, rr.Replay(dumpEntry(t, rdb.RdbTypeZSet2, zset)))
+	assert.Empty(t, cli.cmds)
+
+	rr.RedisVersion = "6.2.0"
+	assert.Nil(t, rr.Replay(dumpEntry(t, rdb.RdbTypeZSet2, zset)))
+	assert.Equal(t, 1, len(cli.cmds))
+	assert.Equal(t, []interface{}{"ZADD", []byte("k"), "GT"}, cli.cmds[0][:3])
+}
+
+func TestMergeMaxScore(t *testing.T) {
+	cmd, args := mergeMaxScore("zadd", []interface{}{[]byte("k"), 1.5, []byte("m")})
+	assert.Equal(t, "zadd", cmd)
+	assert.Equal(t, []interface{}{[]byte("k"), "GT", 1.5, []byte("m")}, args)
+
+	cmd, args = mergeMaxScore("HPEXPIRE", []interface{}{[]byte("k"), []byte("f"), 10})
+	assert.Equal(t, "HPEXPIRE", cmd)
+	assert.Equal(t, []interface{}{[]byte("k"), []byte("f"), 10}, args)
+}
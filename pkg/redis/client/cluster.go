@@ -2,6 +2,7 @@ package client
 
 import (
 	"bufio"
+	"crypto/tls"
 	"time"
 
 	"github.com/mgtv-tech/redis-GunYu/config"
@@ -40,6 +41,11 @@ func NewRedisCluster(cfg config.RedisConfig) (Redis, error) {
 		//ReadTimeout: ,
 		//WriteTimeout: ,
 	}
+	if cfg.TlsEnable {
+		options.TlsConfig = func(address string) (*tls.Config, error) {
+			return common.TlsConfig(cfg.TlsOptions, address)
+		}
+	}
 	if cfg.GetClusterOptions() != nil {
 		options.HandleAskError = cfg.GetClusterOptions().HandleAskErr
 		options.HandleMoveError = cfg.GetClusterOptions().HandleMoveErr
@@ -87,7 +87,8 @@ func (batch *Batch) Put(cmd string, args ...interface{}) error {
 		return batch.joinError(err)
 	}
 	if node == nil {
-		// node is nil means no need to put
+		// node is nil means no need to put, it's replied with OK, so replies are aligned with commands
+		batch.index = append(batch.index, -1)
 		return nil
 	}
 
@@ -139,7 +140,7 @@ func (bat *Batch) Exec() ([]interface{}, error) {
 		return nil, bat.err
 	}
 
-	if bat == nil || bat.batches == nil || len(bat.batches) == 0 {
+	if bat == nil || len(bat.index) == 0 {
 		return []interface{}{}, nil
 	}
 
@@ -153,6 +154,10 @@ func (bat *Batch) Exec() ([]interface{}, error) {
 
 	var replies []interface{}
 	for _, i := range bat.index {
+		if i < 0 {
+			replies = append(replies, okReply)
+			continue
+		}
 		if bat.batches[i].err != nil {
 			return nil, bat.batches[i].err
 		}
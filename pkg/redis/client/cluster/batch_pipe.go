@@ -94,7 +94,8 @@ func (batch *batch2) Put(cmd string, args ...interface{}) error {
 		return batch.joinError(err)
 	}
 	if node == nil {
-		// node is nil means no need to put
+		// node is nil means no need to put, it's replied with OK, so replies are aligned with commands
+		batch.index = append(batch.index, -1)
 		return nil
 	}
 
@@ -202,7 +203,7 @@ func (bat *batch2) doBatch(batch *nodeBatch) {
 }
 
 func (bat *batch2) Receive() ([]interface{}, error) {
-	if bat == nil || bat.batches == nil || len(bat.batches) == 0 {
+	if bat == nil || len(bat.index) == 0 {
 		return []interface{}{}, nil
 	}
 
@@ -220,6 +221,10 @@ func (bat *batch2) Receive() ([]interface{}, error) {
 
 	var replies []interface{}
 	for _, i := range bat.index {
+		if i < 0 {
+			replies = append(replies, okReply)
+			continue
+		}
 		if bat.batches[i].err != nil {
 			return nil, bat.batches[i].err
 		}
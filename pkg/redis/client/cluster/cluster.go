@@ -15,6 +15,7 @@
 package redis
 
 import (
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"strconv"
@@ -44,6 +45,9 @@ type Options struct {
 
 	Password string
 
+	// TlsConfig returns tls configuration of node, connections are plain text if it's nil
+	TlsConfig func(address string) (*tls.Config, error)
+
 	HandleMoveError bool
 	HandleAskError  bool
 	ExternalService *string
@@ -72,6 +76,8 @@ type Cluster struct {
 
 	password string // the whole cluster should only has one password
 
+	tlsConfig func(address string) (*tls.Config, error)
+
 	rwLock sync.RWMutex
 
 	closed  atomic.Bool
@@ -107,6 +113,7 @@ func NewCluster(options *Options) (*Cluster, error) {
 		updateList:      make(chan updateMesg),
 		closeCh:         make(chan struct{}),
 		password:        options.Password,
+		tlsConfig:       options.TlsConfig,
 		handleMoveError: options.HandleMoveError,
 		handleAskError:  options.HandleAskError,
 		logger:          log.WithLogger(config.LogModuleName("[redis cluster] ")),
@@ -128,6 +135,7 @@ func NewCluster(options *Options) (*Cluster, error) {
 			keepAlive:    options.KeepAlive,
 			aliveTime:    options.AliveTime,
 			password:     options.Password,
+			tlsConfig:    options.TlsConfig,
 		}
 
 		err := cluster.update(node)
@@ -622,6 +630,7 @@ func (cluster *Cluster) update(node *redisNode) error {
 				keepAlive:    cluster.keepAlive,
 				aliveTime:    cluster.aliveTime,
 				password:     cluster.password,
+				tlsConfig:    cluster.tlsConfig,
 			}
 		}
 
@@ -18,6 +18,7 @@ package redis
 import (
 	"bufio"
 	"container/list"
+	"crypto/tls"
 	"fmt"
 	"net"
 	"sync"
@@ -46,6 +47,8 @@ type redisNode struct {
 
 	password string
 
+	tlsConfig func(address string) (*tls.Config, error)
+
 	accessTime atomic.Int64
 }
 
@@ -118,7 +121,7 @@ func (node *redisNode) getConn() (*redisConn, error) {
 	if node.conns.Len() <= 0 {
 		node.mutex.Unlock()
 
-		c, err := net.DialTimeout("tcp", node.address, node.connTimeout)
+		c, err := node.dial()
 		if err != nil {
 			return nil, err
 		}
@@ -149,6 +152,17 @@ func (node *redisNode) getConn() (*redisConn, error) {
 	return elem.Value.(*redisConn), nil
 }
 
+func (node *redisNode) dial() (net.Conn, error) {
+	if node.tlsConfig == nil {
+		return net.DialTimeout("tcp", node.address, node.connTimeout)
+	}
+	conf, err := node.tlsConfig(node.address)
+	if err != nil {
+		return nil, err
+	}
+	return tls.DialWithDialer(&net.Dialer{Timeout: node.connTimeout}, "tcp", node.address, conf)
+}
+
 func (node *redisNode) releaseConn(conn *redisConn) {
 	node.mutex.Lock()
 	defer node.mutex.Unlock()
@@ -2,7 +2,7 @@ package common
 
 type CmdBatcher interface {
 	Put(string, ...interface{}) error
-	Exec() ([]interface{}, error)
+	Exec() ([]interface{}, error) // replies of rejected commands are errors
 	Len() int
 	Dispatch() error
 	Receive() ([]interface{}, error)
@@ -0,0 +1,135 @@
+package common
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/mgtv-tech/redis-GunYu/config"
+	"github.com/mgtv-tech/redis-GunYu/pkg/log"
+)
+
+// tlsLoaders caches loaders by options, all connections with the same options share certificates
+var tlsLoaders sync.Map
+
+// TlsConfig returns the tls configuration to dial address,
+// certificate files are reloaded when they are changed, opts may be nil
+func TlsConfig(opts *config.RedisTlsOptions, address string) (*tls.Config, error) {
+	var key config.RedisTlsOptions
+	if opts != nil {
+		key = *opts
+	}
+	ld, _ := tlsLoaders.LoadOrStore(key, &tlsLoader{opts: key})
+	conf, err := ld.(*tlsLoader).load()
+	if err != nil {
+		return nil, err
+	}
+
+	conf = conf.Clone()
+	conf.ServerName = key.ServerName
+	if conf.ServerName == "" {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, fmt.Errorf("invalid address : addr(%s), error(%w)", address, err)
+		}
+		conf.ServerName = host
+	}
+	return conf, nil
+}
+
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+type tlsLoader struct {
+	opts   config.RedisTlsOptions
+	mux    sync.Mutex
+	stamps []fileStamp // ca, cert, key
+	conf   *tls.Config
+}
+
+func (tl *tlsLoader) load() (*tls.Config, error) {
+	tl.mux.Lock()
+	defer tl.mux.Unlock()
+
+	stamps, err := tl.fileStamps()
+	if err == nil && tl.conf != nil && stampsEqual(stamps, tl.stamps) {
+		return tl.conf, nil
+	}
+	var conf *tls.Config
+	if err == nil {
+		conf, err = tl.build()
+	}
+	if err != nil {
+		// files may be being replaced, keep the previous certificates
+		if tl.conf != nil {
+			log.Warnf("reload tls certificates error : ca(%s), cert(%s), error(%v)", tl.opts.CaFile, tl.opts.CertFile, err)
+			return tl.conf, nil
+		}
+		return nil, err
+	}
+	if tl.conf != nil {
+		log.Infof("tls certificates are reloaded : ca(%s), cert(%s)", tl.opts.CaFile, tl.opts.CertFile)
+	}
+	tl.conf = conf
+	tl.stamps = stamps
+	return conf, nil
+}
+
+func (tl *tlsLoader) fileStamps() ([]fileStamp, error) {
+	stamps := make([]fileStamp, 3)
+	for i, path := range []string{tl.opts.CaFile, tl.opts.CertFile, tl.opts.KeyFile} {
+		if path == "" {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		stamps[i] = fileStamp{modTime: info.ModTime(), size: info.Size()}
+	}
+	return stamps, nil
+}
+
+func (tl *tlsLoader) build() (*tls.Config, error) {
+	conf := &tls.Config{
+		MinVersion:         tl.opts.GetMinVersion(),
+		InsecureSkipVerify: tl.opts.InsecureSkipVerify,
+	}
+	if tl.opts.CaFile != "" {
+		pem, err := os.ReadFile(tl.opts.CaFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate in ca file : %s", tl.opts.CaFile)
+		}
+		conf.RootCAs = pool
+	}
+	if tl.opts.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(tl.opts.CertFile, tl.opts.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		conf.Certificates = []tls.Certificate{cert}
+	}
+	return conf, nil
+}
+
+func stampsEqual(a []fileStamp, b []fileStamp) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].modTime.Equal(b[i].modTime) || a[i].size != b[i].size {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,151 @@
+package common
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mgtv-tech/redis-GunYu/config"
+)
+
+type testCert struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPem []byte
+	keyPem  []byte
+}
+
+func newTestCert(t *testing.T, name string, parent *testCert) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	signer, signerKey := tmpl, key
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+		tmpl.KeyUsage = x509.KeyUsageCertSign
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	assert.Nil(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.Nil(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	assert.Nil(t, err)
+	return &testCert{
+		cert:    cert,
+		key:     key,
+		certPem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPem:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}),
+	}
+}
+
+func writeFile(t *testing.T, path string, data []byte, modTime time.Time) {
+	assert.Nil(t, os.WriteFile(path, data, 0600))
+	assert.Nil(t, os.Chtimes(path, modTime, modTime))
+}
+
+// newTlsServer requires client certificates signed by ca
+func newTlsServer(t *testing.T, ca *testCert, server *testCert) string {
+	cert, err := tls.X509KeyPair(server.certPem, server.keyPem)
+	assert.Nil(t, err)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	})
+	assert.Nil(t, err)
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				conn.(*tls.Conn).Handshake()
+				conn.Write([]byte("+OK\r\n"))
+				conn.Close()
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func handshake(opts *config.RedisTlsOptions, addr string) error {
+	conf, err := TlsConfig(opts, addr)
+	if err != nil {
+		return err
+	}
+	conn, err := tls.Dial("tcp", addr, conf)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	// client certificate is verified by server after the handshake of client
+	buf := make([]byte, 5)
+	_, err = conn.Read(buf)
+	return err
+}
+
+func TestTlsConfig(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, "ca", nil)
+	otherCa := newTestCert(t, "other ca", nil)
+	server := newTestCert(t, "server", ca)
+	client := newTestCert(t, "client", ca)
+	addr := newTlsServer(t, ca, server)
+
+	now := time.Now()
+	caFile := filepath.Join(dir, "ca.pem")
+	writeFile(t, caFile, ca.certPem, now)
+	certFile := filepath.Join(dir, "client.pem")
+	writeFile(t, certFile, client.certPem, now)
+	keyFile := filepath.Join(dir, "client.key")
+	writeFile(t, keyFile, client.keyPem, now)
+
+	opts := &config.RedisTlsOptions{CaFile: caFile, CertFile: certFile, KeyFile: keyFile}
+	assert.Nil(t, handshake(opts, addr))
+
+	// server name
+	assert.NotNil(t, handshake(&config.RedisTlsOptions{CaFile: caFile, CertFile: certFile, KeyFile: keyFile, ServerName: "redis.local"}, addr))
+
+	// no client certificate
+	assert.NotNil(t, handshake(&config.RedisTlsOptions{CaFile: caFile}, addr))
+
+	// unknown authority
+	assert.NotNil(t, handshake(&config.RedisTlsOptions{CertFile: certFile, KeyFile: keyFile}, addr))
+	assert.Nil(t, handshake(&config.RedisTlsOptions{CertFile: certFile, KeyFile: keyFile, InsecureSkipVerify: true}, addr))
+
+	// reload ca file
+	writeFile(t, caFile, otherCa.certPem, now.Add(time.Second))
+	assert.NotNil(t, handshake(opts, addr))
+	writeFile(t, caFile, ca.certPem, now.Add(2*time.Second))
+	assert.Nil(t, handshake(opts, addr))
+
+	// invalid file keeps previous certificates
+	writeFile(t, caFile, []byte("invalid"), now.Add(3*time.Second))
+	assert.Nil(t, handshake(opts, addr))
+}
@@ -41,7 +41,12 @@ func NewRedisConn(cfg config.RedisConfig) (*RedisConn, error) {
 	var err error
 	dialer.Timeout = 5 * time.Second
 	if cfg.TlsEnable {
-		r.conn, err = tls.DialWithDialer(&dialer, "tcp", cfg.Address(), &tls.Config{InsecureSkipVerify: true})
+		var tlsConf *tls.Config
+		tlsConf, err = common.TlsConfig(cfg.TlsOptions, cfg.Address())
+		if err != nil {
+			return nil, fmt.Errorf("tls config error. address(%s), err(%w)", cfg.Address(), err)
+		}
+		r.conn, err = tls.DialWithDialer(&dialer, "tcp", cfg.Address(), tlsConf)
 	} else {
 		r.conn, err = dialer.Dial("tcp", cfg.Address())
 	}
@@ -254,6 +259,11 @@ func (tb *batcher) Exec() ([]interface{}, error) {
 				replies = append(replies, nil)
 				continue
 			}
+			if rerr, ok := err.(proto.RedisError); ok {
+				// the command is rejected, the reply of it is the error and following replies are read as well
+				replies = append(replies, rerr)
+				continue
+			}
 			tb.conn.Close()
 			return nil, err
 		}
@@ -299,6 +309,11 @@ func (tb *batcher) Receive() ([]interface{}, error) {
 				replies = append(replies, nil)
 				continue
 			}
+			if rerr, ok := err.(proto.RedisError); ok {
+				// the command is rejected, the reply of it is the error and following replies are read as well
+				replies = append(replies, rerr)
+				continue
+			}
 			tb.conn.Close()
 			return nil, err
 		}
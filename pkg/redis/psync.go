@@ -1,6 +1,8 @@
 package redis
 
 import (
+	"bufio"
+	"bytes"
 	"fmt"
 	"io"
 	"strconv"
@@ -16,8 +18,9 @@ import (
 )
 
 type StandaloneRedis struct {
-	cli    client.Redis
-	logger log.Logger
+	cli     client.Redis
+	logger  log.Logger
+	eofMark []byte // mark of diskless rdb payload
 }
 
 func (sr *StandaloneRedis) Client() client.Redis {
@@ -43,11 +46,16 @@ func NewStandaloneRedis(cfg config.RedisConfig) (*StandaloneRedis, error) {
 	}, nil
 }
 
+// RdbInfo : Size is -1 if rdb is transferred by diskless replication,
+// the payload is terminated by EofMark instead
 type RdbInfo struct {
-	Size int64
-	Err  error
+	Size    int64
+	EofMark []byte
+	Err     error
 }
 
+const rdbEofMarkLen = 40
+
 func (sr *StandaloneRedis) SendPSync(runid string, offset int64) (string, int64, <-chan *RdbInfo, error) {
 
 	if offset >= 0 {
@@ -109,6 +117,19 @@ func (sr *StandaloneRedis) waitRdbDump() <-chan *RdbInfo {
 			return
 		}
 		lengthStr = strings.TrimSpace(lengthStr)
+		// diskless replication : $EOF:<40 bytes mark>\r\n
+		if mark, ok := strings.CutPrefix(lengthStr, "EOF:"); ok {
+			if len(mark) != rdbEofMarkLen {
+				size <- &RdbInfo{Err: fmt.Errorf("invalid rdb eof mark : %s", mark)}
+				return
+			}
+			sr.eofMark = []byte(mark)
+			size <- &RdbInfo{
+				Size:    -1,
+				EofMark: sr.eofMark,
+			}
+			return
+		}
 		length, err := strconv.ParseInt(lengthStr, 10, 64)
 		if err != nil {
 			size <- &RdbInfo{Err: err}
@@ -122,6 +143,61 @@ func (sr *StandaloneRedis) waitRdbDump() <-chan *RdbInfo {
 	return size
 }
 
+// RdbReader returns the reader of rdb payload, it returns io.EOF at the end of a diskless rdb payload
+func (sr *StandaloneRedis) RdbReader() io.Reader {
+	if sr.eofMark == nil {
+		return sr.cli.BufioReader()
+	}
+	return NewEofMarkReader(sr.cli.BufioReader(), sr.eofMark)
+}
+
+// EofMarkReader reads a payload which is terminated by a mark, it returns io.EOF once the mark is read.
+// the mark is never returned, and data after the mark(replication stream) is kept in the underlying reader
+type EofMarkReader struct {
+	r    *bufio.Reader
+	mark []byte
+	eof  bool
+}
+
+func NewEofMarkReader(r *bufio.Reader, mark []byte) *EofMarkReader {
+	return &EofMarkReader{
+		r:    r,
+		mark: mark,
+	}
+}
+
+func (er *EofMarkReader) Read(p []byte) (int, error) {
+	if er.eof {
+		return 0, io.EOF
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	// the mark always follows the payload, so at least len(mark) bytes are readable
+	if _, err := er.r.Peek(len(er.mark)); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return 0, err
+	}
+	buf, _ := er.r.Peek(er.r.Buffered())
+	idx := bytes.Index(buf, er.mark)
+	if idx == 0 {
+		er.eof = true
+		_, err := er.r.Discard(len(er.mark))
+		if err == nil {
+			err = io.EOF
+		}
+		return 0, err
+	}
+	if idx < 0 {
+		idx = len(buf) - len(er.mark) + 1 // the tail may be a prefix of mark
+	}
+	n := copy(p, buf[:idx])
+	_, err := er.r.Discard(n)
+	return n, err
+}
+
 func (sr *StandaloneRedis) SendPSyncListeningPort(port int) error {
 	cmd := client.NewCommand("replconf", "listening-port", port)
 	err := client.Encode(sr.cli.BufioWriter(), cmd, true)
@@ -138,6 +214,23 @@ func (sr *StandaloneRedis) SendPSyncListeningPort(port int) error {
 	return nil
 }
 
+// SendPSyncCapa announces that diskless rdb payload($EOF:<mark>) is supported
+func (sr *StandaloneRedis) SendPSyncCapa() error {
+	cmd := client.NewCommand("replconf", "capa", "eof")
+	err := client.Encode(sr.cli.BufioWriter(), cmd, true)
+	if err != nil {
+		return err
+	}
+	ret, err := sr.cli.ReceiveString()
+	if err != nil {
+		return err
+	}
+	if strings.ToUpper(ret) != "OK" {
+		return fmt.Errorf("repl capa error : response(%s) is not ok", ret)
+	}
+	return nil
+}
+
 func (sr *StandaloneRedis) SendPSyncAck(offset int64) error {
 	cmd := client.NewCommand("replconf", "ack", offset)
 	return client.Encode(sr.cli.BufioWriter(), cmd, true)
@@ -0,0 +1,34 @@
+package redis
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEofMarkReader(t *testing.T) {
+	mark := []byte(strings.Repeat("a1", rdbEofMarkLen/2))
+	payload := bytes.Repeat([]byte("0123456789"), 1000)
+	stream := append(append(append([]byte{}, payload...), mark...), []byte("*1\r\n$4\r\nPING\r\n")...)
+
+	for _, rd := range []io.Reader{bytes.NewReader(stream), iotest.OneByteReader(bytes.NewReader(stream))} {
+		br := bufio.NewReader(rd)
+		data, err := io.ReadAll(NewEofMarkReader(br, mark))
+		assert.Nil(t, err)
+		assert.Equal(t, payload, data)
+
+		// replication stream after the mark is kept
+		rest, err := io.ReadAll(br)
+		assert.Nil(t, err)
+		assert.Equal(t, "*1\r\n$4\r\nPING\r\n", string(rest))
+	}
+
+	// connection is closed before the mark
+	_, err := io.ReadAll(NewEofMarkReader(bufio.NewReader(bytes.NewReader(payload)), mark))
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
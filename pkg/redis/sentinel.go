@@ -0,0 +1,220 @@
+package redis
+
+import (
+	"context"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mgtv-tech/redis-GunYu/config"
+	"github.com/mgtv-tech/redis-GunYu/pkg/errors"
+	"github.com/mgtv-tech/redis-GunYu/pkg/log"
+	"github.com/mgtv-tech/redis-GunYu/pkg/redis/client"
+	"github.com/mgtv-tech/redis-GunYu/pkg/redis/client/common"
+	usync "github.com/mgtv-tech/redis-GunYu/pkg/sync"
+)
+
+const (
+	sentinelSwitchMasterChannel = "+switch-master"
+	sentinelRetryInterval       = 3 * time.Second
+)
+
+// sentinelConfig returns the configuration of a sentinel, addresses of sentinel type are sentinels
+func sentinelConfig(redisCfg *config.RedisConfig, addr string) config.RedisConfig {
+	return config.RedisConfig{
+		Addresses:  []string{addr},
+		UserName:   redisCfg.Sentinel.UserName,
+		Password:   redisCfg.Sentinel.Password,
+		TlsEnable:  redisCfg.TlsEnable,
+		TlsOptions: redisCfg.TlsOptions,
+		Type:       config.RedisTypeStandalone,
+	}
+}
+
+// GetSentinelShard asks sentinels for the master and its replicas, the first available sentinel wins
+func GetSentinelShard(redisCfg *config.RedisConfig) (*config.RedisClusterShard, error) {
+	var err error
+	for _, addr := range redisCfg.Addresses {
+		var shard *config.RedisClusterShard
+		shard, err = getSentinelShard(redisCfg, addr)
+		if err == nil {
+			return shard, nil
+		}
+		log.Warnf("ask sentinel error : sentinel(%s), master(%s), error(%v)", addr, redisCfg.Sentinel.MasterName, err)
+	}
+	return nil, errors.Errorf("no available sentinel : sentinels(%v), master(%s), error(%w)", redisCfg.Addresses, redisCfg.Sentinel.MasterName, err)
+}
+
+func getSentinelShard(redisCfg *config.RedisConfig, addr string) (*config.RedisClusterShard, error) {
+	cli, err := client.NewRedis(sentinelConfig(redisCfg, addr))
+	if err != nil {
+		return nil, err
+	}
+	defer func() { log.LogIfError(cli.Close(), "close sentinel conn") }()
+
+	name := redisCfg.Sentinel.MasterName
+	master, err := common.Strings(cli.Do("sentinel", "get-master-addr-by-name", name))
+	if err != nil {
+		return nil, err
+	}
+	if len(master) != 2 {
+		return nil, errors.Errorf("unknown master : %s", name)
+	}
+
+	// SENTINEL REPLICAS is an alias since 5.0
+	replies, err := common.Values(cli.Do("sentinel", "slaves", name))
+	if err != nil {
+		return nil, err
+	}
+
+	shard := &config.RedisClusterShard{
+		Slots: config.RedisSlots{
+			Ranges: []config.RedisSlotRange{
+				{Left: 0, Right: 16383},
+			},
+		},
+		Master: sentinelNode(redisCfg, master[0], master[1], config.RedisRoleMaster),
+	}
+	for _, reply := range replies {
+		kvs, err := common.Strings(reply, nil)
+		if err != nil {
+			return nil, err
+		}
+		fields := make(map[string]string, len(kvs)/2)
+		for i := 0; i+1 < len(kvs); i += 2 {
+			fields[kvs[i]] = kvs[i+1]
+		}
+		node := sentinelNode(redisCfg, fields["ip"], fields["port"], config.RedisRoleSlave)
+		node.Id = fields["runid"]
+		node.ReplOffset, _ = strconv.ParseInt(fields["slave-repl-offset"], 10, 64)
+		if !sentinelReplicaHealthy(fields) {
+			node.Health = "offline"
+		}
+		shard.Slaves = append(shard.Slaves, node)
+	}
+
+	// keep the order of slaves consistent, see FixTopology
+	sort.Slice(shard.Slaves, func(i, j int) bool {
+		return shard.Slaves[i].Address < shard.Slaves[j].Address
+	})
+	return shard, nil
+}
+
+func sentinelNode(redisCfg *config.RedisConfig, ip string, port string, role config.RedisRole) config.RedisNode {
+	node := config.RedisNode{
+		Ip:       ip,
+		Endpoint: ip,
+		Role:     role,
+		Health:   "online",
+	}
+	node.Port, _ = strconv.Atoi(port)
+	node.Address = net.JoinHostPort(ip, port)
+	if redisCfg.InternalService != nil && redisCfg.ExternalService != nil {
+		node.Address = strings.Replace(node.Address, *redisCfg.InternalService, *redisCfg.ExternalService, 1)
+	}
+	return node
+}
+
+// sentinelReplicaHealthy : replica is not down and links to the master
+func sentinelReplicaHealthy(fields map[string]string) bool {
+	for _, flag := range strings.Split(fields["flags"], ",") {
+		if flag == "s_down" || flag == "o_down" || flag == "disconnected" {
+			return false
+		}
+	}
+	return fields["master-link-status"] == "ok"
+}
+
+// sentinelMasterConfig returns the configuration of the master which is managed by sentinels
+func sentinelMasterConfig(redisCfg *config.RedisConfig) (config.RedisConfig, error) {
+	shard, err := GetSentinelShard(redisCfg)
+	if err != nil {
+		return config.RedisConfig{}, err
+	}
+	return config.RedisConfig{
+		Addresses:  []string{shard.Master.Address},
+		UserName:   redisCfg.UserName,
+		Password:   redisCfg.Password,
+		TlsEnable:  redisCfg.TlsEnable,
+		TlsOptions: redisCfg.TlsOptions,
+		Type:       config.RedisTypeStandalone,
+		Version:    redisCfg.Version,
+	}, nil
+}
+
+// WatchSentinelSwitchMaster subscribes +switch-master of all sentinels until ctx is done,
+// fn is invoked with the address of new master
+func WatchSentinelSwitchMaster(ctx context.Context, redisCfg *config.RedisConfig, fn func(master string)) {
+	name := redisCfg.Sentinel.MasterName
+	for _, addr := range redisCfg.Addresses {
+		cfg := sentinelConfig(redisCfg, addr)
+		usync.SafeGo(func() {
+			for {
+				err := subscribeSwitchMaster(ctx, cfg, name, func(master string) {
+					if redisCfg.InternalService != nil && redisCfg.ExternalService != nil {
+						master = strings.Replace(master, *redisCfg.InternalService, *redisCfg.ExternalService, 1)
+					}
+					fn(master)
+				})
+				if ctx.Err() != nil {
+					return
+				}
+				log.Warnf("subscribe sentinel error : sentinel(%s), master(%s), error(%v)", cfg.Address(), name, err)
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(sentinelRetryInterval):
+				}
+			}
+		}, nil)
+	}
+}
+
+func subscribeSwitchMaster(ctx context.Context, cfg config.RedisConfig, name string, fn func(master string)) error {
+	cli, err := client.NewRedis(cfg)
+	if err != nil {
+		return err
+	}
+	done := make(chan struct{})
+	defer close(done)
+	usync.SafeGo(func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+		}
+		cli.Close()
+	}, nil)
+
+	if err = cli.SendAndFlush("subscribe", sentinelSwitchMasterChannel); err != nil {
+		return err
+	}
+	if _, err = cli.Receive(); err != nil {
+		return err
+	}
+	for {
+		reply, err := common.Values(cli.Receive())
+		if err != nil {
+			return err
+		}
+		// message, channel, payload
+		if len(reply) != 3 {
+			continue
+		}
+		payload, _ := common.String(reply[2], nil)
+		master, ok := parseSwitchMaster(payload, name)
+		if ok {
+			fn(master)
+		}
+	}
+}
+
+// parseSwitchMaster parses <master name> <old ip> <old port> <new ip> <new port>
+func parseSwitchMaster(payload string, name string) (string, bool) {
+	fields := strings.Fields(payload)
+	if len(fields) != 5 || fields[0] != name {
+		return "", false
+	}
+	return net.JoinHostPort(fields[3], fields[4]), true
+}
@@ -0,0 +1,199 @@
+package redis
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mgtv-tech/redis-GunYu/config"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeSentinel speaks the subset of sentinel protocol used by syncer
+type fakeSentinel struct {
+	ln       net.Listener
+	master   []string
+	replicas [][]string
+	subs     chan net.Conn
+}
+
+func newFakeSentinel(t *testing.T, master []string, replicas [][]string) *fakeSentinel {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	fs := &fakeSentinel{
+		ln:       ln,
+		master:   master,
+		replicas: replicas,
+		subs:     make(chan net.Conn, 1),
+	}
+	go fs.serve()
+	t.Cleanup(func() { ln.Close() })
+	return fs
+}
+
+func (fs *fakeSentinel) Addr() string {
+	return fs.ln.Addr().String()
+}
+
+func (fs *fakeSentinel) serve() {
+	for {
+		conn, err := fs.ln.Accept()
+		if err != nil {
+			return
+		}
+		go fs.handle(conn)
+	}
+}
+
+func (fs *fakeSentinel) handle(conn net.Conn) {
+	rd := bufio.NewReader(conn)
+	for {
+		args, err := readCommand(rd)
+		if err != nil {
+			conn.Close()
+			return
+		}
+		switch strings.ToLower(args[0]) {
+		case "ping":
+			conn.Write([]byte("+PONG\r\n"))
+		case "sentinel":
+			if strings.ToLower(args[1]) == "get-master-addr-by-name" {
+				if args[2] != "mymaster" {
+					conn.Write([]byte("*-1\r\n"))
+				} else {
+					conn.Write(respArray(fs.master))
+				}
+			} else {
+				reply := fmt.Sprintf("*%d\r\n", len(fs.replicas))
+				for _, r := range fs.replicas {
+					reply += string(respArray(r))
+				}
+				conn.Write([]byte(reply))
+			}
+		case "subscribe":
+			conn.Write([]byte("*3\r\n$9\r\nsubscribe\r\n" + respBulk(args[1]) + ":1\r\n"))
+			fs.subs <- conn
+		default:
+			conn.Write([]byte("-ERR unknown command\r\n"))
+		}
+	}
+}
+
+func (fs *fakeSentinel) publish(conn net.Conn, channel string, payload string) {
+	conn.Write(respArray([]string{"message", channel, payload}))
+}
+
+func readCommand(rd *bufio.Reader) ([]string, error) {
+	line, err := rd.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		if _, err = rd.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		arg, err := rd.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, strings.TrimSuffix(arg, "\r\n"))
+	}
+	return args, nil
+}
+
+func respBulk(s string) string {
+	return fmt.Sprintf("$%d\r\n%s\r\n", len(s), s)
+}
+
+func respArray(items []string) []byte {
+	reply := fmt.Sprintf("*%d\r\n", len(items))
+	for _, item := range items {
+		reply += respBulk(item)
+	}
+	return []byte(reply)
+}
+
+func deadAddress(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	addr := ln.Addr().String()
+	ln.Close()
+	return addr
+}
+
+func TestSentinelTopology(t *testing.T) {
+	fs := newFakeSentinel(t, []string{"10.0.0.1", "6379"}, [][]string{
+		{"ip", "10.0.0.3", "port", "6379", "runid", "c", "flags", "slave,s_down", "master-link-status", "err", "slave-repl-offset", "10"},
+		{"ip", "10.0.0.2", "port", "6379", "runid", "b", "flags", "slave", "master-link-status", "ok", "slave-repl-offset", "20"},
+	})
+
+	// the first sentinel is down
+	cfg := &config.RedisConfig{
+		Addresses:      []string{deadAddress(t), fs.Addr()},
+		Type:           config.RedisTypeSentinel,
+		Sentinel:       &config.RedisSentinelOptions{MasterName: "mymaster"},
+		ClusterOptions: &config.RedisClusterOptions{},
+	}
+	assert.Nil(t, FixTopology(cfg))
+
+	shards := cfg.GetClusterShards()
+	assert.Equal(t, 1, len(shards))
+	assert.Equal(t, "10.0.0.1:6379", shards[0].Master.Address)
+	assert.Equal(t, 2, len(shards[0].Slaves))
+	assert.Equal(t, "10.0.0.2:6379", shards[0].Slaves[0].Address)
+	assert.True(t, shards[0].Slaves[0].IsHealth())
+	assert.Equal(t, int64(20), shards[0].Slaves[0].ReplOffset)
+	assert.False(t, shards[0].Slaves[1].IsHealth())
+
+	// sync from
+	assert.Equal(t, []string{"10.0.0.1:6379"}, config.GetAddressesFromRedisConfigSlice(cfg.SelNodes(false, config.SelNodeStrategyMaster)))
+	assert.Equal(t, []string{"10.0.0.2:6379"}, config.GetAddressesFromRedisConfigSlice(cfg.SelNodes(false, config.SelNodeStrategyPreferSlave)))
+	assert.Equal(t, []string{"10.0.0.2:6379"}, config.GetAddressesFromRedisConfigSlice(cfg.SelNodes(false, config.SelNodeStrategySlave)))
+
+	// unknown master
+	cfg.Sentinel.MasterName = "unknown"
+	assert.NotNil(t, FixTopology(cfg))
+}
+
+func TestWatchSentinelSwitchMaster(t *testing.T) {
+	fs := newFakeSentinel(t, []string{"10.0.0.1", "6379"}, nil)
+	cfg := &config.RedisConfig{
+		Addresses: []string{fs.Addr()},
+		Type:      config.RedisTypeSentinel,
+		Sentinel:  &config.RedisSentinelOptions{MasterName: "mymaster"},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	masters := make(chan string, 1)
+	WatchSentinelSwitchMaster(ctx, cfg, func(master string) {
+		masters <- master
+	})
+
+	var conn net.Conn
+	select {
+	case conn = <-fs.subs:
+	case <-time.After(5 * time.Second):
+		t.Fatal("sentinel is not subscribed")
+	}
+	fs.publish(conn, "+switch-master", "other 10.0.1.1 6379 10.0.1.2 6379")
+	fs.publish(conn, "+switch-master", "mymaster 10.0.0.1 6379 10.0.0.2 6379")
+
+	select {
+	case master := <-masters:
+		assert.Equal(t, "10.0.0.2:6379", master)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no switch-master notification")
+	}
+}
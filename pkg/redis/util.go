@@ -592,9 +592,18 @@ func FixVersion(redisCfg *config.RedisConfig) error {
 		return nil
 	}
 
-	cli, err := client.NewRedis(*redisCfg)
+	cfg := *redisCfg
+	if redisCfg.IsSentinel() {
+		var err error
+		cfg, err = sentinelMasterConfig(redisCfg)
+		if err != nil {
+			return err
+		}
+	}
+
+	cli, err := client.NewRedis(cfg)
 	if err != nil {
-		log.Errorf("new redis error : addr(%s), error(%v)", redisCfg.Address(), err)
+		log.Errorf("new redis error : addr(%s), error(%v)", cfg.Address(), err)
 		return err
 	}
 
@@ -649,8 +658,11 @@ func FixTopology(redisCfg *config.RedisConfig) error {
 		}
 		redisCfg.SetMigrating(migrating)
 	} else if redisCfg.Type == config.RedisTypeSentinel {
-		// @TODO
-		return errors.Errorf("unknown redis type : %v, %s", redisCfg.Type, redisCfg.Address())
+		shard, err := GetSentinelShard(redisCfg)
+		if err != nil {
+			return err
+		}
+		redisCfg.SetClusterShards([]*config.RedisClusterShard{shard})
 	} else if redisCfg.Type == config.RedisTypeStandalone {
 		shards := []*config.RedisClusterShard{}
 		for _, addr := range redisCfg.Addresses {
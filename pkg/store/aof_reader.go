@@ -13,6 +13,7 @@ import (
 
 	"github.com/mgtv-tech/redis-GunYu/config"
 	"github.com/mgtv-tech/redis-GunYu/pkg/common"
+	"github.com/mgtv-tech/redis-GunYu/pkg/crypto"
 	"github.com/mgtv-tech/redis-GunYu/pkg/digest"
 	"github.com/mgtv-tech/redis-GunYu/pkg/log"
 	usync "github.com/mgtv-tech/redis-GunYu/pkg/sync"
@@ -21,6 +22,7 @@ import (
 type aofStorer interface {
 	hasWriter(left int64) bool
 	lastSeg() int64
+	fetch(dir string, left int64) error // fetch the evicted file from remote tier
 }
 
 type AofRotateReader struct {
@@ -28,6 +30,9 @@ type AofRotateReader struct {
 	mux       sync.RWMutex
 	dir       string
 	file      *os.File
+	src       io.Reader // file or decrypter
+	decrypter *frameReader
+	keyring   *crypto.Keyring
 	right     int64
 	left      int64
 	pos       int64
@@ -41,7 +46,7 @@ type AofRotateReader struct {
 	wait      usync.WaitCloser
 }
 
-func NewAofRotateReader(dir string, offset int64, aof aofStorer, writer io.WriteCloser, verifyCrc bool) (*AofRotateReader, error) {
+func NewAofRotateReader(dir string, offset int64, aof aofStorer, writer io.WriteCloser, verifyCrc bool, keyring *crypto.Keyring) (*AofRotateReader, error) {
 	log.Debugf("NewAofReader : dir(%s), offset(%d)", dir, offset)
 
 	r := &AofRotateReader{
@@ -49,6 +54,7 @@ func NewAofRotateReader(dir string, offset int64, aof aofStorer, writer io.Write
 		dir:       dir,
 		verifyCrc: verifyCrc,
 		aof:       aof,
+		keyring:   keyring,
 		logger:    log.WithLogger(config.LogModuleName("[AofRotateReader] ")),
 	}
 	r.wait = usync.NewWaitCloser(func(err error) {
@@ -118,13 +124,19 @@ func (r *AofRotateReader) Seek(offset int64) error {
 		return fmt.Errorf("offset(%v) - left offset(%v) < 0", offset, r.left)
 	}
 
-	_, err := r.file.Seek(headerSize+dis, 0)
-	if err != nil {
-		return err
+	if r.decrypter != nil {
+		if err := r.decrypter.seek(r.file, headerSize, dis); err != nil {
+			return err
+		}
+	} else {
+		_, err := r.file.Seek(headerSize+dis, 0)
+		if err != nil {
+			return err
+		}
 	}
 	r.pos += dis
 	r.right += dis
-	return err
+	return nil
 }
 
 func (r *AofRotateReader) openFile(offset int64) error {
@@ -142,6 +154,11 @@ func (r *AofRotateReader) openFile(offset int64) error {
 	r.pos = headerSize
 	(*r.observer.Load()).Open(offset)
 
+	if err = r.initSource(); err != nil {
+		r.closeAof()
+		return err
+	}
+
 	if r.verifyCrc {
 		err := r.isCorrupted()
 		if err != nil {
@@ -159,6 +176,28 @@ func (r *AofRotateReader) openFile(offset int64) error {
 	return nil
 }
 
+func (r *AofRotateReader) initSource() error {
+	var header [headerSize]byte
+	n, err := r.file.ReadAt(header[:], 0)
+	if n != headerSize {
+		return errors.Join(common.ErrCorrupted, fmt.Errorf("read header : file(%s), error(%v)", r.filepath, err))
+	}
+
+	r.src = r.file
+	r.decrypter = nil
+	encrypted, keyId := aofHeaderKeyId(header[:])
+	if !encrypted {
+		return nil
+	}
+	key, err := getDecryptKey(r.keyring, keyId, r.filepath)
+	if err != nil {
+		return err
+	}
+	r.decrypter = newFrameReader(r.file, key)
+	r.src = r.decrypter
+	return nil
+}
+
 // returns ErrCorrupted if file is corrupted
 func (r *AofRotateReader) isCorrupted() error {
 
@@ -224,6 +263,14 @@ func (r *AofRotateReader) isCorrupted() error {
 	return nil
 }
 
+// fetchNextFile downloads the next file if it has been evicted, r.mux is released meanwhile
+func (r *AofRotateReader) fetchNextFile() error {
+	right := r.right
+	r.mux.Unlock()
+	defer r.mux.Lock()
+	return r.aof.fetch(r.dir, right)
+}
+
 func (r *AofRotateReader) tryReadNextFile(offset int64) error {
 	filepath := aofFilePath(r.dir, r.right) // @TODO
 	_, err := os.Stat(filepath)
@@ -274,15 +321,17 @@ func (r *AofRotateReader) read(buf []byte) (n int, err error) {
 	r.mux.Lock()
 	defer r.mux.Unlock()
 
-	n, err = r.file.Read(buf)
+	n, err = r.src.Read(buf)
 
 	for err == io.EOF && !r.wait.IsClosed() {
 		// new aof?
 		if r.left != r.aof.lastSeg() {
-			r.tryReadNextFile(r.right)
+			if err := r.fetchNextFile(); err == nil && !r.wait.IsClosed() {
+				r.tryReadNextFile(r.right)
+			}
 		}
 		time.Sleep(time.Millisecond * 10)
-		n, err = r.file.Read(buf)
+		n, err = r.src.Read(buf)
 	}
 	if err != nil {
 		return 0, err
@@ -401,3 +450,72 @@ func (rd *AofReader) Close() (err error) {
 	}
 	return
 }
+
+// AofDataReader reads the logical data of an aof file, an encrypted file is decrypted by keyring
+type AofDataReader struct {
+	file      *os.File
+	src       io.Reader
+	decrypter *frameReader
+	size      int64
+}
+
+func NewAofDataReader(fp string, keyring *crypto.Keyring) (*AofDataReader, error) {
+	file, err := os.OpenFile(fp, os.O_RDONLY, 0777)
+	if err != nil {
+		return nil, err
+	}
+	rd := &AofDataReader{file: file, src: file}
+	if err := rd.init(fp, keyring); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return rd, nil
+}
+
+func (rd *AofDataReader) init(fp string, keyring *crypto.Keyring) error {
+	var header [headerSize]byte
+	n, err := rd.file.ReadAt(header[:], 0)
+	if n != headerSize {
+		return errors.Join(common.ErrCorrupted, fmt.Errorf("read header : file(%s), error(%v)", fp, err))
+	}
+	fi, err := rd.file.Stat()
+	if err != nil {
+		return err
+	}
+	rd.size, err = aofDataSize(fp, fi.Size())
+	if err != nil {
+		return err
+	}
+	if encrypted, keyId := aofHeaderKeyId(header[:]); encrypted {
+		key, err := getDecryptKey(keyring, keyId, fp)
+		if err != nil {
+			return err
+		}
+		rd.decrypter = newFrameReader(rd.file, key)
+		rd.src = rd.decrypter
+	}
+	_, err = rd.file.Seek(headerSize, 0)
+	return err
+}
+
+// Size returns the logical data size
+func (rd *AofDataReader) Size() int64 {
+	return rd.size
+}
+
+// SeekTo moves to the logical offset dis from the beginning of data
+func (rd *AofDataReader) SeekTo(dis int64) error {
+	if rd.decrypter != nil {
+		return rd.decrypter.seek(rd.file, headerSize, dis)
+	}
+	_, err := rd.file.Seek(headerSize+dis, 0)
+	return err
+}
+
+func (rd *AofDataReader) Read(p []byte) (int, error) {
+	return rd.src.Read(p)
+}
+
+func (rd *AofDataReader) Close() error {
+	return rd.file.Close()
+}
@@ -26,7 +26,7 @@ func (ts *aofReaderTestSuite) SetupSuite() {
 	dir, err := os.MkdirTemp("", "test_aof_reader")
 	ts.Nil(err)
 	ts.tempDir = dir
-	ts.storer = NewStorer("1", ts.tempDir, 100*1024, 100000000, config.FlushPolicy{})
+	ts.storer = NewStorer("1", ts.tempDir, 100*1024, 100000000, config.FlushPolicy{}, nil, nil, Retention{})
 }
 
 func (ts *aofReaderTestSuite) TearDownSuite() {
@@ -35,7 +35,7 @@ func (ts *aofReaderTestSuite) TearDownSuite() {
 }
 
 func (ts *aofReaderTestSuite) isCorrupted(offset int64) error {
-	reader, err := NewAofRotateReader(ts.tempDir, offset, ts.storer, nil, true)
+	reader, err := NewAofRotateReader(ts.tempDir, offset, ts.storer, nil, true, nil)
 	if err == nil {
 		reader.closeAof()
 	}
@@ -48,7 +48,7 @@ func (ts *aofReaderTestSuite) TestCorrupted() {
 
 	newAof := func() {
 		ts.storer.dataSet = newDataSet(nil, nil)
-		writer, err := NewAofRotater("1", ts.tempDir, 0, 100000000, config.FlushPolicy{})
+		writer, err := NewAofRotater("1", ts.tempDir, 0, 100000000, config.FlushPolicy{}, nil)
 		ts.Nil(err)
 		ts.Nil(writer.write(data))
 		writer.close()
@@ -13,6 +13,7 @@ import (
 	"time"
 
 	"github.com/mgtv-tech/redis-GunYu/config"
+	"github.com/mgtv-tech/redis-GunYu/pkg/crypto"
 	"github.com/mgtv-tech/redis-GunYu/pkg/digest"
 	"github.com/mgtv-tech/redis-GunYu/pkg/log"
 	"github.com/mgtv-tech/redis-GunYu/pkg/metric"
@@ -62,17 +63,20 @@ func (no *observerProxy) Read(args ...interface{}) {
 // header : 16B [ version(1) + crc(8) + data size(4) + reserved(3) ]
 // data
 // *
+// crc and data size are computed over the data on disk,
+// if file is encrypted, version is 2 and reserved[0:2] is the key id, see encrypt.go
 const headerSize = 16
 
-var fixHeader = [headerSize]byte{1} // version is 1
+var fixHeader = [headerSize]byte{aofVersionPlain}
 
 type AofWriter struct {
 	*AofRotater
 	reader io.Reader
+	gate   *diskGate
 }
 
-func NewAofWriter(id string, dir string, offset int64, reader io.Reader, maxLogSize int64, flushPolicy config.FlushPolicy) (*AofWriter, error) {
-	a, e := NewAofRotater(id, dir, offset, maxLogSize, flushPolicy)
+func NewAofWriter(id string, dir string, offset int64, reader io.Reader, maxLogSize int64, flushPolicy config.FlushPolicy, keyring *crypto.Keyring) (*AofWriter, error) {
+	a, e := NewAofRotater(id, dir, offset, maxLogSize, flushPolicy, keyring)
 	if e != nil {
 		return nil, e
 	}
@@ -118,6 +122,7 @@ func (w *AofWriter) ingest() (err error) {
 		if w.wait.IsClosed() {
 			break
 		}
+		w.gate.wait(w.wait.Context()) // stop reading source, so it's throttled by TCP flow control
 		n, err = w.reader.Read(p)
 		if n > 0 {
 			if err = w.write(p[:n]); err != nil {
@@ -159,15 +164,18 @@ type AofRotater struct {
 	dirtyDataSize atomic.Int64
 	lastFlushTime time.Time
 	flushPolicy   config.FlushPolicy
+	keyring       *crypto.Keyring
+	sealer        *frameSealer
 }
 
-func NewAofRotater(id string, dir string, offset int64, maxLogSize int64, flush config.FlushPolicy) (*AofRotater, error) {
+func NewAofRotater(id string, dir string, offset int64, maxLogSize int64, flush config.FlushPolicy, keyring *crypto.Keyring) (*AofRotater, error) {
 	w := &AofRotater{
 		Id:          id,
 		dir:         dir,
 		maxLogSize:  maxLogSize,
 		logger:      log.WithLogger(config.LogModuleName("[AofRotater] ")),
 		flushPolicy: flush,
+		keyring:     keyring,
 	}
 
 	w.wait = usync.NewWaitCloser(func(error) {
@@ -193,6 +201,19 @@ func (w *AofRotater) getObserver() Observer {
 
 func (w *AofRotater) openFile(offset int64) error {
 
+	// a new key is picked up when rotating files
+	header := fixHeader
+	var sealer *frameSealer
+	if w.keyring != nil {
+		key, err := getEncryptKey(w.keyring)
+		if err != nil {
+			return err
+		}
+		header[0] = aofVersionEncrypted
+		binary.LittleEndian.PutUint16(header[13:], key.Id)
+		sealer = newFrameSealer(key)
+	}
+
 	filepath := aofFilePath(w.dir, offset)
 	file, err := os.OpenFile(filepath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0777)
 	w.logger.Debugf("new aof file : %s, %v", filepath, err)
@@ -205,7 +226,7 @@ func (w *AofRotater) openFile(offset int64) error {
 		os.Remove(filepath)
 	}
 
-	_, err = file.Write(fixHeader[:])
+	_, err = file.Write(header[:])
 	if err != nil {
 		gc()
 		return err
@@ -221,7 +242,8 @@ func (w *AofRotater) openFile(offset int64) error {
 	w.left = offset
 	w.right.Store(offset)
 	w.filesize = headerSize
-	w.header = fixHeader
+	w.header = header
+	w.sealer = sealer
 	w.crc = digest.New()
 	w.aofClosed.Store(false)
 
@@ -246,14 +268,34 @@ func (w *AofRotater) write(buf []byte) error {
 		return io.EOF
 	}
 
-	n, err := w.file.Write(buf)
+	data := buf
+	if w.sealer != nil {
+		frame, err := w.sealer.seal(buf)
+		if err != nil {
+			return err
+		}
+		data = frame
+	}
+
+	n, err := w.file.Write(data)
 	if n > 0 {
 		w.dirtyDataSize.Add(int64(n))
-		w.crc.Write(buf[:n]) // error is always nil
+		w.crc.Write(data[:n]) // error is always nil
 		w.filesize += int64(n)
-		w.right.Add(int64(n))
-		writeDataCounter.Add(float64(n), w.Id)
-		w.getObserver().Write(w.left, int64(n))
+
+		// offset is plaintext based, an encrypted frame is readable only if it's written completely
+		pn := int64(n)
+		if w.sealer != nil {
+			pn = 0
+			if n == len(data) {
+				pn = int64(len(buf))
+			}
+		}
+		if pn > 0 {
+			w.right.Add(pn)
+			writeDataCounter.Add(float64(pn), w.Id)
+			w.getObserver().Write(w.left, pn)
+		}
 	}
 	if err != nil {
 		w.file.Sync()
@@ -338,7 +380,7 @@ func (w *AofRotater) closeAof() error { // ensure close() and write() are in sam
 		_, err = w.file.Write(w.header[:headerSize])
 		err = ret(err)
 		if err == nil {
-			w.getObserver().Close(w.left, w.filesize-headerSize)
+			w.getObserver().Close(w.left, w.right.Load()-w.left)
 		}
 		return err
 	}
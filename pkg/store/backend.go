@@ -0,0 +1,84 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mgtv-tech/redis-GunYu/config"
+)
+
+// Backend is a remote storage for sealed rdb and aof files
+// object name : $runId/$offset_$size.rdb, $runId/$left_$size.aof
+type Backend interface {
+	Put(ctx context.Context, name string, r io.Reader, size int64) error
+	// Get returns an error wrapping os.ErrNotExist if object doesn't exist
+	Get(ctx context.Context, name string) (io.ReadCloser, error)
+	Delete(ctx context.Context, name string) error
+	Copy(ctx context.Context, src string, dst string) error
+	// List returns all objects whose name starts with prefix
+	List(ctx context.Context, prefix string) ([]ObjectInfo, error)
+}
+
+type ObjectInfo struct {
+	Name    string
+	Size    int64
+	ModTime time.Time // upload time, it's later than the modification time of local file
+}
+
+func NewBackend(cfg *config.StorerRemoteConfig) (Backend, error) {
+	switch cfg.Type {
+	case config.StorerRemoteS3:
+		return NewS3Backend(cfg.S3)
+	}
+	return nil, fmt.Errorf("unsupported storer backend : %s", cfg.Type)
+}
+
+func rdbObjectName(runId string, offset, size int64) string {
+	return fmt.Sprintf("%s/%d_%d.rdb", runId, offset, size)
+}
+
+// the size of aof object is the logical data size, rather than the size of file
+func aofObjectName(runId string, left, size int64) string {
+	return fmt.Sprintf("%s/%d_%d.aof", runId, left, size)
+}
+
+type remoteObject struct {
+	name    string
+	rdb     bool
+	offset  int64
+	size    int64
+	modTime time.Time
+}
+
+// parseObjectName parses the name without run id
+func parseObjectName(name string) (remoteObject, bool) {
+	obj := remoteObject{name: name}
+	switch {
+	case strings.HasSuffix(name, ".rdb"):
+		obj.rdb = true
+		name = strings.TrimSuffix(name, ".rdb")
+	case strings.HasSuffix(name, ".aof"):
+		name = strings.TrimSuffix(name, ".aof")
+	default:
+		return obj, false
+	}
+	fd := strings.Split(name, "_")
+	if len(fd) != 2 {
+		return obj, false
+	}
+	offset, err := strconv.ParseInt(fd[0], 10, 64)
+	if err != nil {
+		return obj, false
+	}
+	size, err := strconv.ParseInt(fd[1], 10, 64)
+	if err != nil {
+		return obj, false
+	}
+	obj.offset = offset
+	obj.size = size
+	return obj, true
+}
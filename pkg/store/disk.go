@@ -0,0 +1,173 @@
+package store
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/mgtv-tech/redis-GunYu/config"
+	"github.com/mgtv-tech/redis-GunYu/pkg/metric"
+	usync "github.com/mgtv-tech/redis-GunYu/pkg/sync"
+)
+
+// DiskWatermark pauses writers once free disk space of storer directory is below Pause bytes,
+// files are removed aggressively while writers are paused, and writers are resumed once free space is above Resume bytes
+type DiskWatermark struct {
+	Pause    int64
+	Resume   int64
+	Interval time.Duration
+}
+
+var (
+	diskFreeGauge = metric.NewGaugeVec(metric.GaugeVecOpts{
+		Namespace: config.AppName,
+		Subsystem: "storer",
+		Name:      "disk_free",
+		Labels:    []string{"input"},
+	})
+	diskPausedGauge = metric.NewGaugeVec(metric.GaugeVecOpts{
+		Namespace: config.AppName,
+		Subsystem: "storer",
+		Name:      "disk_paused",
+		Labels:    []string{"input"},
+	})
+	diskPauseCounter = metric.NewCounterVec(metric.CounterVecOpts{
+		Namespace: config.AppName,
+		Subsystem: "storer",
+		Name:      "disk_pause",
+		Labels:    []string{"input"},
+	})
+)
+
+// diskFree returns available bytes of the file system which contains path
+var diskFree = diskFreeSpace
+
+// diskGate blocks writers while it's paused
+type diskGate struct {
+	mux     sync.Mutex
+	resumed chan struct{} // nil if it isn't paused, closed once resumed
+}
+
+func (g *diskGate) pause() bool {
+	g.mux.Lock()
+	defer g.mux.Unlock()
+	if g.resumed != nil {
+		return false
+	}
+	g.resumed = make(chan struct{})
+	return true
+}
+
+func (g *diskGate) resume() bool {
+	g.mux.Lock()
+	defer g.mux.Unlock()
+	if g.resumed == nil {
+		return false
+	}
+	close(g.resumed)
+	g.resumed = nil
+	return true
+}
+
+func (g *diskGate) paused() bool {
+	g.mux.Lock()
+	defer g.mux.Unlock()
+	return g.resumed != nil
+}
+
+// wait blocks until the gate is resumed or ctx is done, a nil gate never blocks
+func (g *diskGate) wait(ctx context.Context) {
+	if g == nil {
+		return
+	}
+	g.mux.Lock()
+	ch := g.resumed
+	g.mux.Unlock()
+	if ch == nil {
+		return
+	}
+	select {
+	case <-ch:
+	case <-ctx.Done():
+	}
+}
+
+// DiskPaused returns true if writers are paused by disk watermark
+func (s *Storer) DiskPaused() bool {
+	return s.gate.paused()
+}
+
+// StartDiskWatch checks free disk space every interval in background
+func (s *Storer) StartDiskWatch(wm DiskWatermark) {
+	if wm.Interval <= 0 {
+		return
+	}
+	usync.SafeGo(func() {
+		ticker := time.NewTicker(wm.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.closer.Context().Done():
+				s.gate.resume()
+				return
+			case <-ticker.C:
+			}
+			s.checkDisk(wm)
+		}
+	}, nil)
+}
+
+func (s *Storer) checkDisk(wm DiskWatermark) {
+	free, err := diskFree(s.baseDir)
+	if err != nil {
+		s.logger.Debugf("disk free space : dir(%s), error(%v)", s.baseDir, err)
+		return
+	}
+	diskFreeGauge.Set(float64(free), s.Id)
+
+	if free < wm.Pause && s.gate.pause() {
+		s.logger.Warnf("pause writers, free disk space is below watermark : free(%d), pause(%d), resume(%d)", free, wm.Pause, wm.Resume)
+		diskPauseCounter.Inc(s.Id)
+		diskPausedGauge.Set(1, s.Id)
+	}
+	if !s.gate.paused() {
+		return
+	}
+
+	if free < wm.Resume {
+		s.gcDisk(wm.Resume - free)
+		if free, err = diskFree(s.baseDir); err != nil {
+			return
+		}
+		diskFreeGauge.Set(float64(free), s.Id)
+	}
+	if free >= wm.Resume && s.gate.resume() {
+		s.logger.Infof("resume writers : free(%d), resume(%d)", free, wm.Resume)
+		diskPausedGauge.Set(0, s.Id)
+	}
+}
+
+// gcDisk removes the oldest files to release need bytes, it ignores retention,
+// referenced files are kept, and with remote tier, only uploaded files are evicted
+func (s *Storer) gcDisk(need int64) {
+	defer s.updateTimeReach()
+
+	if s.tier != nil {
+		s.offload()
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	ds := s.getDataSet()
+	maxSize := ds.localSize() - need
+	if maxSize < 1 {
+		maxSize = 1
+	}
+	s.logger.Infof("gc disk : need(%d), maxSize(%d)", need, maxSize)
+	if s.tier != nil {
+		ds.evictLogs(s.dir, maxSize)
+		return
+	}
+	ds.gcLogs(s.dir, retentionLimit{maxSize: maxSize})
+}
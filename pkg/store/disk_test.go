@@ -0,0 +1,101 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mgtv-tech/redis-GunYu/config"
+	"github.com/stretchr/testify/suite"
+)
+
+func TestDiskSuite(t *testing.T) {
+	suite.Run(t, new(diskTestSuite))
+}
+
+type diskTestSuite struct {
+	suite.Suite
+	tempDir  string
+	dir      string
+	storer   *Storer
+	diskFree func(string) (int64, error)
+}
+
+// aof : 0.aof, 16.aof, 32.aof, 32 bytes per file, disk capacity is 100 bytes
+func (ts *diskTestSuite) SetupTest() {
+	ts.tempDir = ts.T().TempDir()
+	ts.dir = filepath.Join(ts.tempDir, "run1")
+	ts.Nil(os.MkdirAll(ts.dir, 0777))
+
+	writer, err := NewAofRotater("1", ts.dir, 0, 10, config.FlushPolicy{}, nil)
+	ts.Nil(err)
+	for i := 0; i < 3; i++ {
+		ts.Nil(writer.write([]byte("abcdefghijklmnop")))
+	}
+	ts.Nil(writer.close())
+
+	ts.storer = NewStorer("1", ts.tempDir, -1, 10, config.FlushPolicy{}, nil, nil, Retention{})
+	ts.Nil(ts.storer.SetRunId("run1"))
+
+	ts.diskFree = diskFree
+	diskFree = func(path string) (int64, error) {
+		used := int64(0)
+		err := filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
+			if err == nil && !info.IsDir() {
+				used += info.Size()
+			}
+			return err
+		})
+		return 100 - used, err
+	}
+}
+
+func (ts *diskTestSuite) TearDownTest() {
+	diskFree = ts.diskFree
+	ts.storer.Close()
+}
+
+func (ts *diskTestSuite) TestPauseAndResume() {
+	// the newest file is referenced by a reader
+	rd, err := ts.storer.GetReader(40, false)
+	ts.Nil(err)
+	defer rd.Close()
+
+	// paused, files are removed, but free space is still below resume
+	ts.storer.checkDisk(DiskWatermark{Pause: 10, Resume: 80})
+	ts.True(ts.storer.DiskPaused())
+	ts.False(fileExist(aofFilePath(ts.dir, 0)))
+	ts.False(fileExist(aofFilePath(ts.dir, 16)))
+	ts.True(fileExist(aofFilePath(ts.dir, 32)))
+
+	ts.storer.checkDisk(DiskWatermark{Pause: 10, Resume: 50})
+	ts.False(ts.storer.DiskPaused())
+	left, right := ts.storer.GetOffsetRange()
+	ts.Equal(int64(32), left)
+	ts.Equal(int64(48), right)
+}
+
+func (ts *diskTestSuite) TestWriterIsPaused() {
+	ts.storer.gate.pause()
+
+	data := []byte("0123456789")
+	w, err := ts.storer.GetAofWritter(bytes.NewReader(data), 48)
+	ts.Nil(err)
+	w.Start()
+	defer w.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	ts.Nil(w.Wait(ctx))
+	ts.Equal(int64(48), w.Right())
+
+	ts.storer.gate.resume()
+	err = w.Wait(context.Background())
+	ts.True(errors.Is(err, io.EOF))
+	ts.Equal(int64(58), w.Right())
+}
@@ -0,0 +1,13 @@
+//go:build !windows
+
+package store
+
+import "syscall"
+
+func diskFreeSpace(path string) (int64, error) {
+	st := syscall.Statfs_t{}
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, err
+	}
+	return int64(st.Bavail) * int64(st.Bsize), nil
+}
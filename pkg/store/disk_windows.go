@@ -0,0 +1,9 @@
+//go:build windows
+
+package store
+
+import "errors"
+
+func diskFreeSpace(path string) (int64, error) {
+	return 0, errors.New("disk free space isn't supported on windows")
+}
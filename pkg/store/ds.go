@@ -6,6 +6,7 @@ import (
 	"sort"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/mgtv-tech/redis-GunYu/pkg/log"
 )
@@ -18,6 +19,17 @@ type dataSetRdb struct {
 	rwRef   atomic.Int32
 	writer  *RdbWriter
 	readers []*RdbReader
+	remote  atomic.Bool  // uploaded to remote tier
+	evicted atomic.Bool  // local file has been removed, only in remote tier
+	modTime atomic.Int64 // unix nano of the last write
+}
+
+func (r *dataSetRdb) ModTime() time.Time {
+	return time.Unix(0, r.modTime.Load())
+}
+
+func (r *dataSetRdb) touch(t time.Time) {
+	r.modTime.Store(t.UnixNano())
 }
 
 func (r *dataSetRdb) Left() int64 {
@@ -32,6 +44,12 @@ func (r *dataSetRdb) Size() int64 {
 	return r.rdbSize
 }
 
+func (r *dataSetRdb) setSize(size int64) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.rdbSize = size
+}
+
 func (r *dataSetRdb) AddReader(rd *RdbReader) {
 	r.mux.Lock()
 	defer r.mux.Unlock()
@@ -104,6 +122,18 @@ type dataSetAof struct {
 
 	writer  *AofWriter
 	readers []*AofRotateReader
+
+	remote  atomic.Bool  // uploaded to remote tier
+	evicted atomic.Bool  // local file has been removed, only in remote tier
+	modTime atomic.Int64 // unix nano of the last write
+}
+
+func (a *dataSetAof) ModTime() time.Time {
+	return time.Unix(0, a.modTime.Load())
+}
+
+func (a *dataSetAof) touch(t time.Time) {
+	a.modTime.Store(t.UnixNano())
 }
 
 func (a *dataSetAof) Size() int64 {
@@ -418,7 +448,8 @@ func (ds *dataSet) Right() int64 {
 	return int64(-1)
 }
 
-func (ds *dataSet) gcLogs(dir string, maxSize int64) {
+// gcLogs removes the oldest files which exceed the limit, and returns removed files
+func (ds *dataSet) gcLogs(dir string, limit retentionLimit) (gcRdb *dataSetRdb, gcAofs []*dataSetAof) {
 	ds.mux.Lock()
 	defer ds.mux.Unlock()
 
@@ -436,7 +467,7 @@ func (ds *dataSet) gcLogs(dir string, maxSize int64) {
 			log.Warnf("aof rtsize is 0 : aof(%d), size(%d)", ds.aofSegs[aofLast].Left(), ds.aofSegs[aofLast].Size())
 		}
 		size += aofSize
-		if size > maxSize {
+		if limit.exceeded(size, ds.aofSegs[aofLast].ModTime()) {
 			break
 		}
 	}
@@ -446,7 +477,7 @@ func (ds *dataSet) gcLogs(dir string, maxSize int64) {
 	if rdb != nil {
 		size += rdb.rdbSize
 		rdb.mux.Lock()
-		if size > maxSize {
+		if limit.exceeded(size, rdb.ModTime()) {
 			if rdb.rwRef.Load() == 0 {
 				rdbfn := rdbFilePath(dir, rdb.left, rdb.rdbSize)
 				if err := os.RemoveAll(rdbfn); err != nil {
@@ -456,10 +487,11 @@ func (ds *dataSet) gcLogs(dir string, maxSize int64) {
 					size -= rdb.rdbSize
 				}
 				ds.rdb = nil
+				gcRdb = rdb
 			} else {
 				ref0 = false
-				log.Warnf("storage size exceeds limitation, but rdb reference is not zero : size(%d), maxSize(%d), rdb(%d)",
-					size, maxSize, rdb.left)
+				log.Warnf("storage exceeds limitation, but rdb reference is not zero : size(%d), limit(%s), rdb(%d)",
+					size, limit, rdb.left)
 			}
 		}
 		rdb.mux.Unlock()
@@ -473,9 +505,9 @@ func (ds *dataSet) gcLogs(dir string, maxSize int64) {
 			if aof.Ref() > 0 {
 				ref0 = false
 				aof.mux.Unlock()
-				if size > maxSize {
-					log.Warnf("GC Logs, size exceeded limitation, but reference is not zero : size(%d), maxSize(%d), left(%d)",
-						size, maxSize, aof.Left())
+				if limit.exceeded(size, aof.ModTime()) {
+					log.Warnf("GC Logs, storage exceeded limitation, but reference is not zero : size(%d), limit(%s), left(%d)",
+						size, limit, aof.Left())
 				}
 				break
 			} else {
@@ -486,6 +518,7 @@ func (ds *dataSet) gcLogs(dir string, maxSize int64) {
 					log.Infof("GC Logs, remove aof file : file(%s)", aoffn)
 				}
 				size -= aof.rtSize.Load()
+				gcAofs = append(gcAofs, aof)
 				delete(ds.aofMap, ds.aofSegs[z].left)
 				ds.aofSegs = ds.aofSegs[z+1:]
 				aofLast--
@@ -494,5 +527,91 @@ func (ds *dataSet) gcLogs(dir string, maxSize int64) {
 			}
 		}
 	}
+	return
+}
+
+// oldestTime returns the write time of the oldest data, it's a lower bound of the time span of data set.
+// aof files don't record the time of the first write, so the modification time is used
+func (ds *dataSet) oldestTime() (time.Time, bool) {
+	ds.mux.RLock()
+	defer ds.mux.RUnlock()
+	if ds.rdb != nil && (len(ds.aofSegs) == 0 || ds.rdb.left <= ds.aofSegs[0].left) {
+		return ds.rdb.ModTime(), true
+	}
+	if len(ds.aofSegs) != 0 {
+		return ds.aofSegs[0].ModTime(), true
+	}
+	return time.Time{}, false
+}
+
+// localSize returns the size of files which aren't evicted
+func (ds *dataSet) localSize() int64 {
+	ds.mux.RLock()
+	defer ds.mux.RUnlock()
+	size := int64(0)
+	if ds.rdb != nil && !ds.rdb.evicted.Load() {
+		size += ds.rdb.rdbSize
+	}
+	for _, aof := range ds.aofSegs {
+		if !aof.evicted.Load() {
+			size += aof.rtSize.Load()
+		}
+	}
+	return size
+}
+
+// evictLogs removes local files which have been uploaded to remote tier, if local size exceeds maxSize.
+// evicted files are still in dataSet, and are fetched from remote tier on demand
+func (ds *dataSet) evictLogs(dir string, maxSize int64) {
+	ds.mux.Lock()
+	defer ds.mux.Unlock()
+
+	size := int64(0)
 
+	// from newest to oldest
+	for i := len(ds.aofSegs) - 1; i >= 0; i-- {
+		aof := ds.aofSegs[i]
+		if aof.evicted.Load() {
+			continue
+		}
+		aofSize := aof.rtSize.Load()
+		size += aofSize
+		if size <= maxSize {
+			continue
+		}
+		if !aof.remote.Load() || aof.Ref() > 0 {
+			log.Warnf("GC Logs, local size exceeds limitation, but aof isn't uploaded or is referenced : size(%d), maxSize(%d), left(%d), ref(%d)",
+				size, maxSize, aof.left, aof.Ref())
+			continue
+		}
+		aoffn := aofFilePath(dir, aof.left)
+		if err := os.Remove(aoffn); err != nil && !os.IsNotExist(err) {
+			log.Errorf("GC Logs, evict aof file error : file(%s), error(%v)", aoffn, err)
+			continue
+		}
+		log.Infof("GC Logs, evict aof file : file(%s)", aoffn)
+		aof.evicted.Store(true)
+		size -= aofSize
+	}
+
+	rdb := ds.rdb
+	if rdb == nil || rdb.evicted.Load() {
+		return
+	}
+	size += rdb.rdbSize
+	if size <= maxSize {
+		return
+	}
+	if !rdb.remote.Load() || rdb.Ref() > 0 {
+		log.Warnf("GC Logs, local size exceeds limitation, but rdb isn't uploaded or is referenced : size(%d), maxSize(%d), rdb(%d), ref(%d)",
+			size, maxSize, rdb.left, rdb.Ref())
+		return
+	}
+	rdbfn := rdbFilePath(dir, rdb.left, rdb.rdbSize)
+	if err := os.Remove(rdbfn); err != nil && !os.IsNotExist(err) {
+		log.Errorf("GC Logs, evict rdb file error : file(%s), error(%v)", rdbfn, err)
+		return
+	}
+	log.Infof("GC Logs, evict rdb file : file(%s)", rdbfn)
+	rdb.evicted.Store(true)
 }
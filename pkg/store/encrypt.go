@@ -0,0 +1,272 @@
+package store
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/mgtv-tech/redis-GunYu/pkg/common"
+	"github.com/mgtv-tech/redis-GunYu/pkg/crypto"
+	"github.com/mgtv-tech/redis-GunYu/pkg/log"
+)
+
+// encrypted data is a sequence of frames :
+// *  | plain size(4) | nonce(12) | ciphertext(plain size) | tag(16) |
+// *
+// associated data of a frame is the offset of its plaintext in the file,
+// so frames can't be reordered or dropped silently.
+//
+// aof file : header.version is 2, header.reserved[0:2] is the key id
+// rdb file : | magic(8) | key id(2) | frames |
+const (
+	aofVersionPlain     = 1
+	aofVersionEncrypted = 2
+
+	frameHeaderSize   = 4
+	frameOverhead     = 12 + 16 // nonce + tag of AES-GCM
+	maxFramePlainSize = 16 * 1024 * 1024
+
+	rdbEncHeaderSize = 10
+)
+
+var rdbEncMagic = []byte("GUNYUENC")
+
+type frameSealer struct {
+	key *crypto.Key
+	pos int64
+	buf []byte
+}
+
+func newFrameSealer(key *crypto.Key) *frameSealer {
+	return &frameSealer{key: key}
+}
+
+// seal returns a frame of plain, the returned slice is reused by next call
+func (fs *frameSealer) seal(plain []byte) ([]byte, error) {
+	var ad [8]byte
+	binary.LittleEndian.PutUint64(ad[:], uint64(fs.pos))
+	fs.buf = binary.LittleEndian.AppendUint32(fs.buf[:0], uint32(len(plain)))
+	frame, err := fs.key.Seal(fs.buf, plain, ad[:])
+	if err != nil {
+		return nil, err
+	}
+	fs.buf = frame
+	fs.pos += int64(len(plain))
+	return frame, nil
+}
+
+// frameReader decrypts frames from src.
+// it returns io.EOF without dropping buffered data if src has an incomplete frame,
+// so it's able to follow a file which is being written
+type frameReader struct {
+	src     io.Reader
+	key     *crypto.Key
+	pos     int64
+	pending []byte
+	plain   []byte
+	off     int
+}
+
+func newFrameReader(src io.Reader, key *crypto.Key) *frameReader {
+	return &frameReader{src: src, key: key}
+}
+
+func (fr *frameReader) reset() {
+	fr.pos = 0
+	fr.pending = fr.pending[:0]
+	fr.plain = fr.plain[:0]
+	fr.off = 0
+}
+
+func (fr *frameReader) Read(p []byte) (int, error) {
+	for fr.off == len(fr.plain) {
+		if err := fr.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, fr.plain[fr.off:])
+	fr.off += n
+	return n, nil
+}
+
+func (fr *frameReader) fill(size int) error {
+	if cap(fr.pending) < size {
+		grown := make([]byte, len(fr.pending), size)
+		copy(grown, fr.pending)
+		fr.pending = grown
+	}
+	for len(fr.pending) < size {
+		n, err := fr.src.Read(fr.pending[len(fr.pending):size])
+		fr.pending = fr.pending[:len(fr.pending)+n]
+		if len(fr.pending) == size {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return io.EOF
+		}
+	}
+	return nil
+}
+
+func (fr *frameReader) next() error {
+	if err := fr.fill(frameHeaderSize); err != nil {
+		return err
+	}
+	plainSize := binary.LittleEndian.Uint32(fr.pending[:frameHeaderSize])
+	if plainSize > maxFramePlainSize {
+		return errors.Join(common.ErrCorrupted, fmt.Errorf("invalid frame size : offset(%d), size(%d)", fr.pos, plainSize))
+	}
+	frameSize := frameHeaderSize + int(plainSize) + frameOverhead
+	if err := fr.fill(frameSize); err != nil {
+		return err
+	}
+
+	var ad [8]byte
+	binary.LittleEndian.PutUint64(ad[:], uint64(fr.pos))
+	plain, err := fr.key.Open(fr.plain[:0], fr.pending[frameHeaderSize:frameSize], ad[:])
+	if err != nil {
+		return errors.Join(common.ErrCorrupted, fmt.Errorf("decrypt frame : offset(%d), error(%w)", fr.pos, err))
+	}
+	fr.plain = plain
+	fr.off = 0
+	fr.pos += int64(plainSize)
+	fr.pending = fr.pending[:0]
+	return nil
+}
+
+// seek moves fr to the logical offset dis of frames beginning at start of file,
+// frames before the one containing dis are skipped by their headers instead of being decrypted
+func (fr *frameReader) seek(file *os.File, start int64, dis int64) error {
+	fi, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	fileSize := fi.Size()
+
+	var hdr [frameHeaderSize]byte
+	pos := start
+	plainPos := int64(0)
+	for pos+frameHeaderSize <= fileSize {
+		if _, err := file.ReadAt(hdr[:], pos); err != nil {
+			return err
+		}
+		plainSize := int64(binary.LittleEndian.Uint32(hdr[:]))
+		frameSize := frameHeaderSize + plainSize + frameOverhead
+		if plainPos+plainSize > dis || pos+frameSize > fileSize {
+			break
+		}
+		pos += frameSize
+		plainPos += plainSize
+	}
+
+	if _, err := file.Seek(pos, 0); err != nil {
+		return err
+	}
+	fr.reset()
+	fr.pos = plainPos
+	_, err = io.CopyN(io.Discard, fr, dis-plainPos)
+	return err
+}
+
+// encryptedDataSize returns the plaintext size of complete frames after start
+func encryptedDataSize(file *os.File, start int64) (int64, error) {
+	fi, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	fileSize := fi.Size()
+
+	var hdr [frameHeaderSize]byte
+	size := int64(0)
+	pos := start
+	for pos+frameHeaderSize <= fileSize {
+		if _, err := file.ReadAt(hdr[:], pos); err != nil {
+			return 0, err
+		}
+		plainSize := int64(binary.LittleEndian.Uint32(hdr[:]))
+		frameSize := frameHeaderSize + plainSize + frameOverhead
+		if pos+frameSize > fileSize { // incomplete frame
+			break
+		}
+		size += plainSize
+		pos += frameSize
+	}
+	return size, nil
+}
+
+// aofDataSize returns the logical data size of aof file
+func aofDataSize(path string, fileSize int64) (int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	var version [1]byte
+	if _, err := file.ReadAt(version[:], 0); err != nil {
+		return 0, err
+	}
+	if version[0] != aofVersionEncrypted {
+		return fileSize - headerSize, nil
+	}
+	return encryptedDataSize(file, headerSize)
+}
+
+func aofHeaderKeyId(header []byte) (bool, uint16) {
+	if header[0] != aofVersionEncrypted {
+		return false, 0
+	}
+	return true, binary.LittleEndian.Uint16(header[13:15])
+}
+
+func newRdbEncHeader(keyId uint16) []byte {
+	hdr := make([]byte, rdbEncHeaderSize)
+	copy(hdr, rdbEncMagic)
+	binary.LittleEndian.PutUint16(hdr[len(rdbEncMagic):], keyId)
+	return hdr
+}
+
+// readRdbEncHeader checks whether rdb file is encrypted,
+// plain rdb file begins with "REDIS", so the first byte is enough to distinguish them.
+func readRdbEncHeader(file *os.File) (bool, uint16, error) {
+	hdr := make([]byte, rdbEncHeaderSize)
+	n, err := file.ReadAt(hdr, 0)
+	if err != nil && err != io.EOF {
+		return false, 0, err
+	}
+	if n == 0 || hdr[0] != rdbEncMagic[0] {
+		return false, 0, nil
+	}
+	if n < rdbEncHeaderSize || !bytes.Equal(hdr[:len(rdbEncMagic)], rdbEncMagic) {
+		return false, 0, errors.Join(common.ErrCorrupted, fmt.Errorf("invalid rdb header : file(%s)", file.Name()))
+	}
+	return true, binary.LittleEndian.Uint16(hdr[len(rdbEncMagic):]), nil
+}
+
+func getDecryptKey(keyring *crypto.Keyring, keyId uint16, fn string) (*crypto.Key, error) {
+	if keyring == nil {
+		return nil, fmt.Errorf("file is encrypted, but encryption is not configured : file(%s), key(%d)", fn, keyId)
+	}
+	key, err := keyring.Get(keyId)
+	if err != nil {
+		// key file may have been updated
+		keyring.Reload()
+		key, err = keyring.Get(keyId)
+	}
+	return key, err
+}
+
+// getEncryptKey picks up the newest key of key file,
+// keys already loaded are still used if key file is unreadable
+func getEncryptKey(keyring *crypto.Keyring) (*crypto.Key, error) {
+	if _, err := keyring.Reload(); err != nil {
+		log.Warnf("reload key file error : %v", err)
+	}
+	return keyring.Active()
+}
@@ -0,0 +1,230 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mgtv-tech/redis-GunYu/config"
+	"github.com/mgtv-tech/redis-GunYu/pkg/common"
+	"github.com/mgtv-tech/redis-GunYu/pkg/crypto"
+	"github.com/stretchr/testify/suite"
+)
+
+func TestEncryptSuite(t *testing.T) {
+	suite.Run(t, new(encryptTestSuite))
+}
+
+type encryptTestSuite struct {
+	suite.Suite
+	tempDir string
+	keyFile string
+	keyring *crypto.Keyring
+	storer  *Storer
+}
+
+const (
+	testKey1 = "1:000102030405060708090a0b0c0d0e0f\n"
+	testKey2 = "2:101112131415161718191a1b1c1d1e1f101112131415161718191a1b1c1d1e1f\n"
+)
+
+func (ts *encryptTestSuite) SetupTest() {
+	dir, err := os.MkdirTemp("", "test_encrypt")
+	ts.Nil(err)
+	ts.tempDir = dir
+	ts.keyFile = filepath.Join(dir, "keys")
+	ts.Nil(os.WriteFile(ts.keyFile, []byte(testKey1), 0600))
+	ts.keyring, err = crypto.LoadKeyring(ts.keyFile)
+	ts.Nil(err)
+	ts.storer = NewStorer("1", ts.tempDir, 100*1024, 100000000, config.FlushPolicy{}, ts.keyring, nil, Retention{})
+}
+
+func (ts *encryptTestSuite) TearDownTest() {
+	ts.storer.Close()
+	os.RemoveAll(ts.tempDir)
+}
+
+func (ts *encryptTestSuite) readAof(offset int64, size int, keyring *crypto.Keyring) ([]byte, error) {
+	ds := ts.storer.getDataSet()
+	reader, err := NewAofRotateReader(ts.tempDir, ds.IndexAof(offset).Left(), ts.storer, nil, true, keyring)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.closeAof()
+	if err = reader.Seek(offset); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, size)
+	_, err = io.ReadFull(reader.src, buf)
+	return buf, err
+}
+
+func (ts *encryptTestSuite) TestAof() {
+	data := []byte("*3\r\n$3\r\nset\r\n$1\r\na\r\n$1\r\nb\r\n")
+	writer, err := NewAofWriter("1", ts.tempDir, 0, nil, 50, config.FlushPolicy{}, ts.keyring)
+	ts.Nil(err)
+	seg := &dataSetAof{left: 0, size: -1}
+	seg.SetWriter(writer)
+	ts.storer.dataSet = newDataSet(nil, []*dataSetAof{seg})
+	writer.SetObserver(&observerProxy{
+		open:  ts.storer.newAofWOpenObserver(writer, ts.storer.dataSet),
+		close: ts.storer.newAofWCloseObserver(writer, ts.storer.dataSet),
+		write: ts.storer.newAofWriteObserver(),
+	})
+
+	ts.Run("rotate with new key", func() {
+		// the first file has been opened by key 1, next files are opened by key 2
+		ts.Nil(os.WriteFile(ts.keyFile, []byte(testKey1+testKey2), 0600))
+		ts.Nil(os.Chtimes(ts.keyFile, time.Now(), time.Now().Add(time.Second)))
+		ts.Nil(writer.write(data)) // rotated, file is larger than 50 bytes
+		ts.Nil(writer.write(data))
+		writer.close()
+
+		ts.Equal(int64(len(data)*2), writer.right.Load())
+		for i, id := range []uint16{1, 2} {
+			path := aofFilePath(ts.tempDir, int64(i*len(data)))
+			header := make([]byte, headerSize)
+			file, err := os.Open(path)
+			ts.Nil(err)
+			_, err = file.ReadAt(header, 0)
+			ts.Nil(err)
+			file.Close()
+			encrypted, keyId := aofHeaderKeyId(header)
+			ts.True(encrypted)
+			ts.Equal(id, keyId)
+
+			fi, _ := os.Stat(path)
+			size, err := aofDataSize(path, fi.Size())
+			ts.Nil(err)
+			ts.Equal(int64(len(data)), size)
+
+			raw, _ := os.ReadFile(path)
+			ts.False(bytes.Contains(raw, data))
+		}
+	})
+
+	ts.Run("read and seek", func() {
+		buf, err := ts.readAof(0, len(data), ts.keyring)
+		ts.Nil(err)
+		ts.Equal(data, buf)
+
+		buf, err = ts.readAof(int64(len(data))+4, len(data)-4, ts.keyring)
+		ts.Nil(err)
+		ts.Equal(data[4:], buf)
+	})
+
+	ts.Run("data reader", func() {
+		reader, err := NewAofDataReader(aofFilePath(ts.tempDir, int64(len(data))), ts.keyring)
+		ts.Nil(err)
+		defer reader.Close()
+		ts.Equal(int64(len(data)), reader.Size())
+		ts.Nil(reader.SeekTo(4))
+		buf, err := io.ReadAll(reader)
+		ts.Nil(err)
+		ts.Equal(data[4:], buf)
+
+		_, err = NewAofDataReader(aofFilePath(ts.tempDir, 0), nil)
+		ts.NotNil(err)
+	})
+
+	ts.Run("no keyring", func() {
+		_, err := ts.readAof(0, len(data), nil)
+		ts.NotNil(err)
+	})
+
+	ts.Run("tampered", func() {
+		path := aofFilePath(ts.tempDir, 0)
+		raw, err := os.ReadFile(path)
+		ts.Nil(err)
+		raw[len(raw)-1] ^= 0xff
+		ts.Nil(os.WriteFile(path, raw, 0777))
+
+		reader, err := NewAofRotateReader(ts.tempDir, 0, ts.storer, nil, false, ts.keyring)
+		ts.Nil(err)
+		defer reader.closeAof()
+		_, err = io.ReadFull(reader.src, make([]byte, len(data)))
+		ts.True(errors.Is(err, common.ErrCorrupted))
+	})
+}
+
+func (ts *encryptTestSuite) TestRdb() {
+	data, err := hex.DecodeString(`524544495330303130fa0972656469732d76657205372e302e31fa0a72656469732d62697473c040fa056374696d65c233068065fa08757365642d6d656dc2e0241400fa08616f662d62617365c000fe00fb0101fcd8bd197c8c010000000a737472696e745f74746c0a737472696e745f74746cff71376f88c87a56e1`)
+	ts.Nil(err)
+	rdbSize := int64(len(data))
+
+	writer, err := NewRdbWriter("1", bytes.NewReader(data), ts.tempDir, 0, rdbSize, ts.keyring)
+	ts.Nil(err)
+	writer.Start()
+	ts.Nil(writer.Wait(context.Background()))
+
+	path := rdbFilePath(ts.tempDir, 0, rdbSize)
+	raw, err := os.ReadFile(path)
+	ts.Nil(err)
+	ts.True(bytes.HasPrefix(raw, rdbEncMagic))
+	ts.False(bytes.Contains(raw, data[:9]))
+
+	read := func(reader *RdbReader) []byte {
+		buf := bytes.NewBuffer(nil)
+		reader.writer = newNopWriteCloser(buf)
+		reader.Start()
+		ts.Nil(reader.Wait(context.Background()))
+		return buf.Bytes()
+	}
+
+	ts.Run("read", func() {
+		reader, err := NewRdbReader(nil, ts.tempDir, 0, rdbSize, true, ts.keyring)
+		ts.Nil(err)
+		ts.Equal(data, read(reader))
+	})
+
+	ts.Run("read from file", func() {
+		reader, err := NewRdbReaderFromFile(nil, path, true, ts.keyring)
+		ts.Nil(err)
+		ts.Equal(rdbSize, reader.Size())
+		ts.Equal(data, read(reader))
+	})
+
+	ts.Run("no keyring", func() {
+		_, err := NewRdbReader(nil, ts.tempDir, 0, rdbSize, true, nil)
+		ts.NotNil(err)
+	})
+
+	ts.Run("tampered", func() {
+		raw[rdbEncHeaderSize+frameHeaderSize+1] ^= 0xff
+		ts.Nil(os.WriteFile(path, raw, 0777))
+		_, err := NewRdbReader(nil, ts.tempDir, 0, rdbSize, true, ts.keyring)
+		ts.True(errors.Is(err, common.ErrCorrupted))
+	})
+}
+
+func (ts *encryptTestSuite) TestFrameSeek() {
+	key, err := ts.keyring.Active()
+	ts.Nil(err)
+	file, err := os.Create(filepath.Join(ts.tempDir, "frames"))
+	ts.Nil(err)
+	defer file.Close()
+
+	sealer := newFrameSealer(key)
+	plain := []byte("abcdefgh")
+	for _, p := range [][]byte{plain[:3], plain[3:7], plain[7:]} {
+		frame, err := sealer.seal(p)
+		ts.Nil(err)
+		_, err = file.Write(frame)
+		ts.Nil(err)
+	}
+
+	fr := newFrameReader(file, key)
+	for dis := 0; dis <= len(plain); dis++ {
+		ts.Nil(fr.seek(file, 0, int64(dis)))
+		buf, err := io.ReadAll(fr)
+		ts.Nil(err)
+		ts.Equal(plain[dis:], buf)
+	}
+	ts.NotNil(fr.seek(file, 0, int64(len(plain)+1)))
+}
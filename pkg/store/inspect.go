@@ -0,0 +1,322 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mgtv-tech/redis-GunYu/config"
+	"github.com/mgtv-tech/redis-GunYu/pkg/crypto"
+	"github.com/mgtv-tech/redis-GunYu/pkg/log"
+)
+
+var (
+	ErrRunIdInUse   = errors.New("run id is in use")
+	ErrInvalidRunId = errors.New("invalid run id")
+)
+
+type RunIdInfo struct {
+	RunId string
+	Input string // id of storer which is using the run id, empty means the run id is stale
+	Rdb   *RdbInfo
+	Aofs  []AofInfo
+}
+
+type RdbInfo struct {
+	Offset  int64
+	Size    int64
+	Readers int
+	Writers int
+	Remote  bool
+	Evicted bool
+	ModTime time.Time
+}
+
+type AofInfo struct {
+	Left    int64
+	Right   int64
+	Size    int64
+	Readers int
+	Writers int
+	Remote  bool
+	Evicted bool
+	ModTime time.Time
+}
+
+const (
+	VerifyStatusOk        = "ok"
+	VerifyStatusCorrupted = "corrupted"
+	VerifyStatusSkipped   = "skipped"
+)
+
+type VerifyResult struct {
+	File   string
+	Status string
+	Error  string
+}
+
+// Inspector inspects run id directories of storers which share the same base directory
+type Inspector struct {
+	baseDir string
+	keyring *crypto.Keyring
+	storers []*Storer
+	logger  log.Logger
+}
+
+func NewInspector(baseDir string, keyring *crypto.Keyring, storers []*Storer) *Inspector {
+	return &Inspector{
+		baseDir: baseDir,
+		keyring: keyring,
+		storers: storers,
+		logger:  log.WithLogger(config.LogModuleName("[Inspector] ")),
+	}
+}
+
+func (in *Inspector) activeStorer(runId string) *Storer {
+	for _, s := range in.storers {
+		if s.RunId() == runId {
+			return s
+		}
+	}
+	return nil
+}
+
+// List returns all run ids in base directory, sorted by run id
+func (in *Inspector) List() ([]RunIdInfo, error) {
+	entries, err := os.ReadDir(in.baseDir)
+	if err != nil {
+		return nil, err
+	}
+	infos := []RunIdInfo{}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		info, err := in.Get(entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].RunId < infos[j].RunId
+	})
+	return infos, nil
+}
+
+// Get returns the data set of run id, the data set of an active storer is returned if run id is in use
+func (in *Inspector) Get(runId string) (RunIdInfo, error) {
+	if err := checkRunId(runId); err != nil {
+		return RunIdInfo{}, err
+	}
+	if s := in.activeStorer(runId); s != nil {
+		s.mux.RLock()
+		defer s.mux.RUnlock()
+		if s.runId == runId {
+			info := s.getDataSet().inspect()
+			info.RunId = runId
+			info.Input = s.Id
+			return info, nil
+		}
+	}
+	rdb, aofs, err := scanDir(filepath.Join(in.baseDir, runId), in.logger)
+	if err != nil {
+		return RunIdInfo{}, err
+	}
+	info := newDataSet(rdb, aofs).inspect()
+	info.RunId = runId
+	return info, nil
+}
+
+// Verify checks CRC of sealed files which overlap with [left, right], right < 0 means the newest offset.
+// files are referenced during verification, so they are not removed by gc of storer
+func (in *Inspector) Verify(runId string, left, right int64) ([]VerifyResult, error) {
+	if err := checkRunId(runId); err != nil {
+		return nil, err
+	}
+	if s := in.activeStorer(runId); s != nil {
+		s.mux.RLock()
+		active := s.runId == runId
+		dir, ds := s.dir, s.getDataSet()
+		s.mux.RUnlock()
+		if active {
+			return verifyDataSet(dir, ds, left, right, s.keyring), nil
+		}
+	}
+	dir := filepath.Join(in.baseDir, runId)
+	rdb, aofs, err := scanDir(dir, in.logger)
+	if err != nil {
+		return nil, err
+	}
+	return verifyDataSet(dir, newDataSet(rdb, aofs), left, right, in.keyring), nil
+}
+
+// Delete removes the directory and remote files of a stale run id,
+// returns ErrRunIdInUse if a storer is using it
+func (in *Inspector) Delete(runId string) error {
+	if err := checkRunId(runId); err != nil {
+		return err
+	}
+
+	// hold all storers, so they can't switch to this run id during deletion
+	for _, s := range in.storers {
+		s.mux.Lock()
+		defer s.mux.Unlock()
+		if s.runId == runId {
+			return fmt.Errorf("%w : runId(%s), input(%s)", ErrRunIdInUse, runId, s.Id)
+		}
+	}
+
+	dir := filepath.Join(in.baseDir, runId)
+	if _, err := os.Stat(dir); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	in.logger.Infof("remove the directory of run id : path(%s)", dir)
+
+	for _, s := range in.storers {
+		if s.tier != nil {
+			s.delRemoteRunId(runId)
+			break
+		}
+	}
+	return nil
+}
+
+func checkRunId(runId string) error {
+	if runId == "" || runId == "." || runId == ".." || strings.ContainsAny(runId, `/\`) {
+		return fmt.Errorf("%w : %s", ErrInvalidRunId, runId)
+	}
+	return nil
+}
+
+func (ds *dataSet) inspect() RunIdInfo {
+	ds.mux.RLock()
+	defer ds.mux.RUnlock()
+
+	info := RunIdInfo{Aofs: []AofInfo{}}
+	if rdb := ds.rdb; rdb != nil {
+		rdb.mux.RLock()
+		ri := &RdbInfo{
+			Offset:  rdb.left,
+			Size:    rdb.rdbSize,
+			Readers: len(rdb.readers),
+			Remote:  rdb.remote.Load(),
+			Evicted: rdb.evicted.Load(),
+			ModTime: rdb.ModTime(),
+		}
+		if rdb.writer != nil {
+			ri.Writers = 1
+		}
+		rdb.mux.RUnlock()
+		info.Rdb = ri
+	}
+	for _, aof := range ds.aofSegs {
+		aof.mux.RLock()
+		ai := AofInfo{
+			Left:    aof.left,
+			Right:   aof.left + aof.rtSize.Load(),
+			Size:    aof.rtSize.Load(),
+			Readers: len(aof.readers),
+			Remote:  aof.remote.Load(),
+			Evicted: aof.evicted.Load(),
+			ModTime: aof.ModTime(),
+		}
+		if aof.writer != nil {
+			ai.Writers = 1
+		}
+		aof.mux.RUnlock()
+		info.Aofs = append(info.Aofs, ai)
+	}
+	return info
+}
+
+func verifyDataSet(dir string, ds *dataSet, left, right int64, keyring *crypto.Keyring) []VerifyResult {
+	// gc removes files with the lock of data set, and skips referenced files
+	ds.mux.RLock()
+	rdb := ds.rdb
+	aofs := make([]*dataSetAof, len(ds.aofSegs))
+	copy(aofs, ds.aofSegs)
+	if rdb != nil {
+		rdb.rwRef.Add(1)
+		defer rdb.rwRef.Add(-1)
+	}
+	for _, aof := range aofs {
+		aof.rwRef.Add(1)
+		defer aof.rwRef.Add(-1)
+	}
+	ds.mux.RUnlock()
+
+	overlap := func(l, r int64) bool {
+		return r >= left && (right < 0 || l <= right)
+	}
+	results := []VerifyResult{}
+
+	if rdb != nil && overlap(rdb.Left(), rdb.Left()) {
+		path := rdbFilePath(dir, rdb.Left(), rdb.Size())
+		result := VerifyResult{File: path}
+		switch {
+		case rdb.evicted.Load():
+			result.Status = VerifyStatusSkipped
+			result.Error = "evicted"
+		case !fileExist(path): // *.rdb.tmp
+			result.Status = VerifyStatusSkipped
+			result.Error = "writing"
+		default:
+			verifyResult(&result, verifyRdb(dir, rdb, keyring))
+		}
+		results = append(results, result)
+	}
+
+	for _, aof := range aofs {
+		if !overlap(aof.Left(), aof.Right()) {
+			continue
+		}
+		path := aofFilePath(dir, aof.Left())
+		result := VerifyResult{File: path}
+		switch {
+		case aof.evicted.Load():
+			result.Status = VerifyStatusSkipped
+			result.Error = "evicted"
+		case aof.Size() <= 0: // -1 or 0 means the file is writing
+			result.Status = VerifyStatusSkipped
+			result.Error = "writing"
+		default:
+			verifyResult(&result, verifyAof(path))
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+func verifyResult(result *VerifyResult, err error) {
+	if err == nil {
+		result.Status = VerifyStatusOk
+		return
+	}
+	result.Status = VerifyStatusCorrupted
+	result.Error = err.Error()
+}
+
+func verifyRdb(dir string, rdb *dataSetRdb, keyring *crypto.Keyring) error {
+	r, err := NewRdbReader(nil, dir, rdb.Left(), rdb.Size(), true, keyring)
+	if err != nil {
+		return err
+	}
+	return r.closeRdb()
+}
+
+func verifyAof(path string) error {
+	rd, err := NewAofReader(path)
+	if err != nil {
+		return err
+	}
+	defer rd.Close()
+	return rd.Verify()
+}
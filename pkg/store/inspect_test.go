@@ -0,0 +1,105 @@
+package store
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mgtv-tech/redis-GunYu/config"
+	"github.com/stretchr/testify/suite"
+)
+
+func TestInspectorSuite(t *testing.T) {
+	suite.Run(t, new(inspectorTestSuite))
+}
+
+type inspectorTestSuite struct {
+	suite.Suite
+	tempDir   string
+	storer    *Storer
+	inspector *Inspector
+}
+
+// run1 : 0.aof, 16.aof, 32.aof, run2(stale) : 100.aof, 116.aof, 132.aof
+func (ts *inspectorTestSuite) SetupTest() {
+	ts.tempDir = ts.T().TempDir()
+	for runId, offset := range map[string]int64{"run1": 0, "run2": 100} {
+		dir := filepath.Join(ts.tempDir, runId)
+		ts.Nil(os.MkdirAll(dir, 0777))
+		writer, err := NewAofRotater("1", dir, offset, 10, config.FlushPolicy{}, nil)
+		ts.Nil(err)
+		for i := 0; i < 3; i++ {
+			ts.Nil(writer.write([]byte("abcdefghijklmnop")))
+		}
+		ts.Nil(writer.close())
+	}
+	ts.storer = NewStorer("input1", ts.tempDir, -1, 10, config.FlushPolicy{}, nil, nil, Retention{})
+	ts.Nil(ts.storer.SetRunId("run1"))
+	ts.inspector = NewInspector(ts.tempDir, nil, []*Storer{ts.storer})
+}
+
+func (ts *inspectorTestSuite) TearDownTest() {
+	ts.storer.Close()
+}
+
+func (ts *inspectorTestSuite) TestList() {
+	rd, err := ts.storer.GetReader(20, false)
+	ts.Nil(err)
+	defer rd.Close()
+
+	infos, err := ts.inspector.List()
+	ts.Nil(err)
+	ts.Len(infos, 2)
+
+	ts.Equal("run1", infos[0].RunId)
+	ts.Equal("input1", infos[0].Input)
+	ts.Nil(infos[0].Rdb)
+	ts.Len(infos[0].Aofs, 3)
+	ts.Equal(AofInfo{Left: 16, Right: 32, Size: 16, Readers: 1, ModTime: infos[0].Aofs[1].ModTime}, infos[0].Aofs[1])
+
+	ts.Equal("run2", infos[1].RunId)
+	ts.Equal("", infos[1].Input)
+	ts.Len(infos[1].Aofs, 3)
+	ts.Equal(int64(100), infos[1].Aofs[0].Left)
+	ts.Equal(int64(148), infos[1].Aofs[2].Right)
+	ts.Equal(0, infos[1].Aofs[0].Readers)
+
+	_, err = ts.inspector.Get("../run1")
+	ts.True(errors.Is(err, ErrInvalidRunId))
+}
+
+func (ts *inspectorTestSuite) TestVerify() {
+	results, err := ts.inspector.Verify("run1", 20, 40)
+	ts.Nil(err)
+	ts.Len(results, 2)
+	ts.Equal(VerifyStatusOk, results[0].Status)
+	ts.Equal(aofFilePath(filepath.Join(ts.tempDir, "run1"), 16), results[0].File)
+
+	// corrupt the stale run id
+	path := aofFilePath(filepath.Join(ts.tempDir, "run2"), 116)
+	data, err := os.ReadFile(path)
+	ts.Nil(err)
+	data[len(data)-1] = 'x'
+	ts.Nil(os.WriteFile(path, data, 0777))
+
+	results, err = ts.inspector.Verify("run2", 0, -1)
+	ts.Nil(err)
+	ts.Len(results, 3)
+	ts.Equal(VerifyStatusOk, results[0].Status)
+	ts.Equal(VerifyStatusCorrupted, results[1].Status)
+	ts.Contains(results[1].Error, "CRC")
+	ts.Equal(VerifyStatusOk, results[2].Status)
+}
+
+func (ts *inspectorTestSuite) TestDelete() {
+	err := ts.inspector.Delete("run1")
+	ts.True(errors.Is(err, ErrRunIdInUse))
+	ts.True(fileExist(filepath.Join(ts.tempDir, "run1")))
+
+	ts.Nil(ts.inspector.Delete("run2"))
+	ts.False(fileExist(filepath.Join(ts.tempDir, "run2")))
+
+	err = ts.inspector.Delete("run2")
+	ts.True(errors.Is(err, os.ErrNotExist))
+}
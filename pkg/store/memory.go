@@ -0,0 +1,680 @@
+package store
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+
+	"github.com/mgtv-tech/redis-GunYu/config"
+	"github.com/mgtv-tech/redis-GunYu/pkg/io/pipe"
+	"github.com/mgtv-tech/redis-GunYu/pkg/log"
+	"github.com/mgtv-tech/redis-GunYu/pkg/metric"
+	usync "github.com/mgtv-tech/redis-GunYu/pkg/sync"
+)
+
+var (
+	ErrEvicted        = errors.New("data has been evicted")
+	ErrMemoryExceeded = errors.New("exceed memory size")
+)
+
+var (
+	memEvictCounter = metric.NewCounterVec(metric.CounterVecOpts{
+		Namespace: config.AppName,
+		Subsystem: "storer",
+		Name:      "memory_evict",
+		Labels:    []string{"input"},
+	})
+	memUsedGauge = metric.NewGaugeVec(metric.GaugeVecOpts{
+		Namespace: config.AppName,
+		Subsystem: "storer",
+		Name:      "memory_used",
+		Labels:    []string{"input"},
+	})
+)
+
+// MemStorer keeps data in memory instead of files, it has the same offset semantics as Storer.
+// rdb is kept in a buffer, aof is kept in a ring buffer, the total size is bounded by maxSize :
+// once it's exceeded, rdb is evicted first, then the oldest aof data.
+// a reader which is reading evicted aof data fails with ErrEvicted
+type MemStorer struct {
+	Id          string
+	mux         sync.Mutex
+	maxSize     int64
+	runId       string
+	rdb         *memRdb
+	ring        []byte // grows up to maxSize
+	ringBase    int64  // offset of ring[0] before wrapping
+	aofLeft     int64  // [aofLeft, aofRight) is in ring, -1 if there is no aof
+	aofRight    int64
+	aofWriter   *MemAofWriter
+	notify      chan struct{} // closed and renewed once data is written
+	closed      bool
+	readBufSize int
+	logger      log.Logger
+}
+
+type memRdb struct {
+	left int64
+	size int64  // -1 if it's a diskless rdb which is being written
+	data []byte // written data, it's never modified, so readers can read it without lock
+	done bool
+	err  error // rdb is incomplete
+}
+
+func NewMemStorer(id string, maxSize int64) *MemStorer {
+	return &MemStorer{
+		Id:          id,
+		maxSize:     maxSize,
+		aofLeft:     -1,
+		aofRight:    -1,
+		notify:      make(chan struct{}),
+		readBufSize: 1024 * 1024,
+		logger:      log.WithLogger(config.LogModuleName(fmt.Sprintf("[MemStorer(%s)] ", id))),
+	}
+}
+
+// VerifyRunId returns the newest offset if data belongs to one of ids, otherwise returns -1
+func (m *MemStorer) VerifyRunId(ids []string) int64 {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	for _, id := range ids {
+		if id == "" || id == "?" || id != m.runId {
+			continue
+		}
+		if newest := m.right(); newest > 0 {
+			return newest
+		}
+	}
+	return -1
+}
+
+// SetRunId renames run id of data
+func (m *MemStorer) SetRunId(id string) error {
+	if id == "" || id == "?" {
+		return nil
+	}
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	m.runId = id
+	return nil
+}
+
+func (m *MemStorer) DelRunId(id string) error {
+	if id == "" || id == "?" {
+		return nil
+	}
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	if id != m.runId {
+		return nil
+	}
+	m.runId = ""
+	m.reset()
+	return nil
+}
+
+func (m *MemStorer) RunId() string {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	return m.runId
+}
+
+// reset drops all data, writers are closed, readers fail with ErrEvicted
+func (m *MemStorer) reset() {
+	if m.rdb != nil && !m.rdb.done {
+		m.rdb.err = ErrEvicted
+	}
+	m.rdb = nil
+	m.aofWriter = nil
+	m.ring = m.ring[:0]
+	m.aofLeft = -1
+	m.aofRight = -1
+	m.broadcast()
+	memUsedGauge.Set(0, m.Id)
+}
+
+func (m *MemStorer) broadcast() {
+	close(m.notify)
+	m.notify = make(chan struct{})
+}
+
+func (m *MemStorer) Close() error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	m.closed = true
+	m.broadcast()
+	return nil
+}
+
+// WaitOffset blocks until offset is not greater than the newest offset,
+// it returns immediately if run id isn't runId or there is no data
+func (m *MemStorer) WaitOffset(ctx context.Context, runId string, offset int64) error {
+	for {
+		m.mux.Lock()
+		right, notify, closed := m.right(), m.notify, m.closed
+		if closed || m.runId != runId || right < 0 || offset <= right {
+			m.mux.Unlock()
+			return nil
+		}
+		m.mux.Unlock()
+		select {
+		case <-notify:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (m *MemStorer) LatestOffset() int64 {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	return m.right()
+}
+
+func (m *MemStorer) right() int64 {
+	if m.aofLeft >= 0 {
+		return m.aofRight
+	}
+	if m.rdb != nil {
+		return m.rdb.left
+	}
+	return -1
+}
+
+func (m *MemStorer) getRange() (ll int64, rr int64) {
+	if m.rdb == nil && m.aofLeft < 0 {
+		return -1, -1
+	}
+	ll, rr = m.aofLeft, m.aofRight
+	if m.rdb != nil {
+		if m.aofLeft < 0 || m.rdb.left < ll {
+			ll = m.rdb.left
+		}
+		if m.rdb.left > rr {
+			rr = m.rdb.left
+		}
+	}
+	return
+}
+
+func (m *MemStorer) GetOffsetRange() (int64, int64) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	return m.getRange()
+}
+
+func (m *MemStorer) IsValidOffset(offset int64) bool {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	return m.inRange(offset)
+}
+
+func (m *MemStorer) inRange(offset int64) bool {
+	ll, rr := m.getRange()
+	if rr < 0 {
+		return false
+	}
+	// left <= offset <= right
+	if ll <= offset && rr >= offset {
+		return true
+	} else if ll >= offset && m.rdb != nil { // offset <= rdb.left
+		return true
+	}
+	return false
+}
+
+func (m *MemStorer) GetRdb() (int64, int64) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	if m.rdb == nil {
+		return -1, -1
+	}
+	return m.rdb.left, m.rdb.size
+}
+
+func (m *MemStorer) used() int64 {
+	size := int64(0)
+	if m.rdb != nil {
+		if m.rdb.size >= 0 {
+			size += m.rdb.size
+		} else {
+			size += int64(len(m.rdb.data))
+		}
+	}
+	if m.aofLeft >= 0 {
+		size += m.aofRight - m.aofLeft
+	}
+	return size
+}
+
+// evict removes rdb first, then the oldest aof data, until the size is within maxSize
+func (m *MemStorer) evict() {
+	if m.rdb != nil && m.used() > m.maxSize {
+		m.logger.Infof("evict rdb : offset(%d), size(%d)", m.rdb.left, m.rdb.size)
+		memEvictCounter.Add(float64(len(m.rdb.data)), m.Id)
+		m.rdb = nil
+	}
+	if m.aofLeft >= 0 && m.aofRight-m.aofLeft > m.maxSize {
+		left := m.aofRight - m.maxSize
+		memEvictCounter.Add(float64(left-m.aofLeft), m.Id)
+		m.aofLeft = left
+	}
+	memUsedGauge.Set(float64(m.used()), m.Id)
+}
+
+// GetReader returns a reader from offset, aof is preferred to rdb
+func (m *MemStorer) GetReader(offset int64) (*Reader, error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	if !m.inRange(offset) {
+		return nil, os.ErrNotExist
+	}
+
+	piper, pipew := pipe.NewSize(m.readBufSize)
+	rd := &Reader{
+		runId:    m.runId,
+		reader:   bufio.NewReaderSize(piper, m.readBufSize),
+		closedCb: []func() error{piper.Close},
+	}
+	mr := &memReader{
+		storer: m,
+		writer: pipew,
+		pos:    offset,
+	}
+	mr.wait = usync.NewWaitCloser(func(err error) {
+		mr.writer.Close()
+	})
+
+	if m.aofLeft >= 0 && m.aofLeft <= offset && offset <= m.aofRight {
+		mr.aof = true
+		rd.left = offset
+		rd.size = -1
+		rd.logger = log.WithLogger(config.LogModuleName("[Reader(aof)] "))
+	} else {
+		mr.rdb = m.rdb
+		mr.pos = 0
+		rd.left = m.rdb.left
+		rd.size = m.rdb.size
+		rd.logger = log.WithLogger(config.LogModuleName("[Reader(rdb)] "))
+	}
+	rd.mem = mr
+	return rd, nil
+}
+
+// GetRdbWriter drops all data, and returns a writer which ingests rdbSize bytes from r,
+// rdbSize is -1 for a diskless rdb, and the writer ingests data until r returns io.EOF
+func (m *MemStorer) GetRdbWriter(r io.Reader, offset int64, rdbSize int64) (*MemRdbWriter, error) {
+	if rdbSize > m.maxSize {
+		return nil, fmt.Errorf("%w : rdbSize(%d), maxSize(%d)", ErrMemoryExceeded, rdbSize, m.maxSize)
+	}
+
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	m.reset()
+	rdbCap := rdbSize
+	if rdbCap < 0 {
+		rdbCap = 0
+	}
+	m.rdb = &memRdb{
+		left: offset,
+		size: rdbSize,
+		data: make([]byte, 0, rdbCap),
+	}
+	memUsedGauge.Set(float64(m.used()), m.Id)
+
+	w := &MemRdbWriter{
+		storer: m,
+		rdb:    m.rdb,
+		reader: r,
+	}
+	w.wait = usync.NewWaitCloser(func(err error) {
+		m.closeRdb(w.rdb)
+	})
+	return w, nil
+}
+
+// GetAofWritter returns a writer which appends data from offset, the previous aof writer is closed.
+// if offset isn't continuous with the aof in memory, aof in memory is dropped
+func (m *MemStorer) GetAofWritter(r io.Reader, offset int64) (*MemAofWriter, error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	if m.aofLeft < 0 || m.aofRight != offset {
+		m.ring = m.ring[:0]
+		m.ringBase = offset
+		m.aofLeft = offset
+		m.aofRight = offset
+		m.broadcast()
+	}
+
+	w := &MemAofWriter{
+		storer: m,
+		reader: r,
+	}
+	w.right.Store(offset)
+	w.wait = usync.NewWaitCloser(nil)
+	m.aofWriter = w
+	return w, nil
+}
+
+func (m *MemStorer) writeRdb(rdb *memRdb, p []byte) error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	if m.closed || rdb.err != nil {
+		return io.EOF
+	}
+	limit := rdb.size
+	if limit < 0 {
+		limit = m.maxSize
+	}
+	if int64(len(rdb.data)+len(p)) > limit {
+		return fmt.Errorf("%w : rdbSize(%d), written(%d), maxSize(%d)", ErrMemoryExceeded, rdb.size, len(rdb.data)+len(p), m.maxSize)
+	}
+	rdb.data = append(rdb.data, p...)
+	m.broadcast()
+	return nil
+}
+
+// completeRdb sets the size of a diskless rdb
+func (m *MemStorer) completeRdb(rdb *memRdb) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	rdb.size = int64(len(rdb.data))
+	m.broadcast()
+}
+
+func (m *MemStorer) closeRdb(rdb *memRdb) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	if int64(len(rdb.data)) == rdb.size {
+		rdb.done = true
+	} else if rdb.err == nil {
+		rdb.err = fmt.Errorf("incomplete rdb : rdbSize(%d), written(%d)", rdb.size, len(rdb.data))
+		if m.rdb == rdb {
+			m.rdb = nil
+		}
+	}
+	m.broadcast()
+}
+
+func (m *MemStorer) writeAof(w *MemAofWriter, p []byte) error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	if m.closed || m.aofWriter != w {
+		return io.EOF
+	}
+
+	n := int64(len(p))
+	for len(p) > 0 {
+		pos := (m.aofRight - m.ringBase) % m.maxSize
+		var c int
+		if pos == int64(len(m.ring)) { // ring isn't full
+			c = len(p)
+			if int64(c) > m.maxSize-pos {
+				c = int(m.maxSize - pos)
+			}
+			m.ring = append(m.ring, p[:c]...)
+		} else {
+			c = copy(m.ring[pos:], p)
+		}
+		p = p[c:]
+		m.aofRight += int64(c)
+	}
+	w.right.Add(n)
+	m.evict()
+	m.broadcast()
+	return nil
+}
+
+// readAof copies data from pos into p, returns notify channel if there is no new data
+func (m *MemStorer) readAof(pos int64, p []byte) (int, <-chan struct{}, error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	if m.closed {
+		return 0, nil, io.EOF
+	}
+	if m.aofLeft < 0 || pos < m.aofLeft || pos > m.aofRight {
+		return 0, nil, fmt.Errorf("%w : offset(%d), range(%d, %d)", ErrEvicted, pos, m.aofLeft, m.aofRight)
+	}
+	if pos == m.aofRight {
+		return 0, m.notify, nil
+	}
+	idx := (pos - m.ringBase) % m.maxSize
+	end := idx + m.aofRight - pos
+	if end > int64(len(m.ring)) { // wrapped
+		end = int64(len(m.ring))
+	}
+	return copy(p, m.ring[idx:end]), nil, nil
+}
+
+// readRdb returns the written data from pos, returns notify channel if there is no new data,
+// done is true if all data has been read
+func (m *MemStorer) readRdb(rdb *memRdb, pos int64) (data []byte, notify <-chan struct{}, done bool, err error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	if m.closed {
+		return nil, nil, false, io.EOF
+	}
+	if pos < int64(len(rdb.data)) {
+		return rdb.data[pos:], nil, false, nil
+	}
+	if rdb.size >= 0 && pos >= rdb.size {
+		return nil, nil, true, nil
+	}
+	if rdb.err != nil {
+		return nil, nil, false, rdb.err
+	}
+	return nil, m.notify, false, nil
+}
+
+type MemRdbWriter struct {
+	storer *MemStorer
+	rdb    *memRdb
+	reader io.Reader
+	wait   usync.WaitCloser
+}
+
+func (w *MemRdbWriter) Start() {
+	usync.SafeGo(func() {
+		err := w.ingest()
+		w.wait.Close(err)
+	}, func(i interface{}) {
+		w.wait.Close(fmt.Errorf("panic : %v", i))
+	})
+}
+
+func (w *MemRdbWriter) Wait(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return nil
+	case <-w.wait.Context().Done():
+		return w.wait.Error()
+	}
+}
+
+func (w *MemRdbWriter) Close() error {
+	w.wait.Close(nil)
+	return nil
+}
+
+func (w *MemRdbWriter) ingest() (err error) {
+	p := make([]byte, 8192)
+	var n int
+	rdbSize := w.rdb.size // -1 if it's diskless rdb
+	for rdbSize != 0 && !w.wait.IsClosed() {
+		if rdbSize > 0 && int64(len(p)) > rdbSize {
+			p = p[:rdbSize]
+		}
+		n, err = w.reader.Read(p)
+		if n > 0 {
+			if err = w.storer.writeRdb(w.rdb, p[:n]); err != nil {
+				err = fmt.Errorf("rdb writer error : %w", err)
+				break
+			}
+			if rdbSize > 0 {
+				rdbSize -= int64(n)
+			}
+			rdbWriteDataCounter.Add(float64(n), w.storer.Id)
+		}
+		if err != nil {
+			if rdbSize < 0 && errors.Is(err, io.EOF) {
+				w.storer.completeRdb(w.rdb)
+				return nil
+			}
+			err = fmt.Errorf("reader error : %w", err)
+			break
+		}
+	}
+	return err
+}
+
+type MemAofWriter struct {
+	storer *MemStorer
+	reader io.Reader
+	right  atomic.Int64
+	wait   usync.WaitCloser
+}
+
+func (w *MemAofWriter) Start() {
+	usync.SafeGo(func() {
+		err := w.ingest()
+		w.wait.Close(err)
+	}, func(i interface{}) {
+		w.wait.Close(fmt.Errorf("panic : %v", i))
+	})
+}
+
+func (w *MemAofWriter) Wait(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return nil
+	case <-w.wait.Context().Done():
+		return w.wait.Error()
+	}
+}
+
+func (w *MemAofWriter) Close() error {
+	w.wait.Close(nil)
+	return nil
+}
+
+func (w *MemAofWriter) Right() int64 {
+	return w.right.Load()
+}
+
+func (w *MemAofWriter) ingest() (err error) {
+	p := make([]byte, 1024*4)
+	n := 0
+	for !w.wait.IsClosed() {
+		n, err = w.reader.Read(p)
+		if n > 0 {
+			if err = w.storer.writeAof(w, p[:n]); err != nil {
+				err = fmt.Errorf("aof writer error : %w", err)
+				break
+			}
+		}
+		if err != nil {
+			err = fmt.Errorf("reader error : %w", err)
+			break
+		}
+	}
+	return err
+}
+
+// memReader pumps data from MemStorer to writer
+type memReader struct {
+	storer *MemStorer
+	writer io.WriteCloser
+	aof    bool
+	rdb    *memRdb
+	pos    int64 // offset of aof, or position in rdb
+	wait   usync.WaitCloser
+}
+
+func (r *memReader) Start() {
+	usync.SafeGo(func() {
+		var err error
+		if r.aof {
+			err = r.pumpAof()
+		} else {
+			err = r.pumpRdb()
+		}
+		r.wait.Close(err)
+	}, func(i interface{}) {
+		r.wait.Close(fmt.Errorf("panic : %v", i))
+	})
+}
+
+func (r *memReader) Wait(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return nil
+	case <-r.wait.Context().Done():
+		return r.wait.Error()
+	}
+}
+
+func (r *memReader) Close() error {
+	r.wait.Close(nil)
+	return nil
+}
+
+func (r *memReader) waitData(notify <-chan struct{}) {
+	select {
+	case <-notify:
+	case <-r.wait.Context().Done():
+	}
+}
+
+func (r *memReader) pumpAof() error {
+	p := make([]byte, 8192)
+	for !r.wait.IsClosed() {
+		n, notify, err := r.storer.readAof(r.pos, p)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		if notify != nil {
+			r.waitData(notify)
+			continue
+		}
+		if _, err = r.writer.Write(p[:n]); err != nil {
+			return err
+		}
+		r.pos += int64(n)
+	}
+	return nil
+}
+
+func (r *memReader) pumpRdb() error {
+	for !r.wait.IsClosed() {
+		data, notify, done, err := r.storer.readRdb(r.rdb, r.pos)
+		if err != nil {
+			return errors.Join(err, fmt.Errorf("imcomplete rdb replay : read(%d)", r.pos))
+		}
+		if done {
+			return nil
+		}
+		if notify != nil {
+			r.waitData(notify)
+			continue
+		}
+		if len(data) > 8192 {
+			data = data[:8192]
+		}
+		if _, err = r.writer.Write(data); err != nil {
+			return err
+		}
+		r.pos += int64(len(data))
+	}
+	return nil
+}
@@ -0,0 +1,227 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	usync "github.com/mgtv-tech/redis-GunYu/pkg/sync"
+	"github.com/stretchr/testify/suite"
+)
+
+func TestMemStorerSuite(t *testing.T) {
+	suite.Run(t, new(memStorerTestSuite))
+}
+
+type memStorerTestSuite struct {
+	suite.Suite
+	storer *MemStorer
+}
+
+func (ts *memStorerTestSuite) SetupTest() {
+	ts.storer = NewMemStorer("1", 32)
+	ts.Nil(ts.storer.SetRunId("run1"))
+}
+
+func (ts *memStorerTestSuite) TearDownTest() {
+	ts.storer.Close()
+}
+
+func (ts *memStorerTestSuite) writeAof(w *MemAofWriter, data string) {
+	ts.Nil(ts.storer.writeAof(w, []byte(data)))
+}
+
+func (ts *memStorerTestSuite) readN(rd *Reader, n int) string {
+	p := make([]byte, n)
+	_, err := io.ReadFull(rd.IoReader(), p)
+	ts.Nil(err)
+	return string(p)
+}
+
+func (ts *memStorerTestSuite) TestRdbAndAof() {
+	rdbData := []byte("0123456789")
+	rw, err := ts.storer.GetRdbWriter(bytes.NewReader(rdbData), 100, int64(len(rdbData)))
+	ts.Nil(err)
+	rw.Start()
+	ts.Nil(rw.Wait(context.Background()))
+	rw.Close()
+
+	aw, err := ts.storer.GetAofWritter(nil, 100)
+	ts.Nil(err)
+	ts.writeAof(aw, "abcdef")
+	ts.Equal(int64(106), aw.Right())
+
+	left, right := ts.storer.GetOffsetRange()
+	ts.Equal(int64(100), left)
+	ts.Equal(int64(106), right)
+	ts.True(ts.storer.IsValidOffset(50)) // before rdb
+	ts.True(ts.storer.IsValidOffset(106))
+	ts.False(ts.storer.IsValidOffset(107))
+	ts.Equal(int64(106), ts.storer.VerifyRunId([]string{"run2", "run1"}))
+	ts.Equal(int64(-1), ts.storer.VerifyRunId([]string{"run2"}))
+
+	wait := usync.NewWaitCloser(nil)
+	defer wait.Close(nil)
+
+	rd, err := ts.storer.GetReader(50)
+	ts.Nil(err)
+	ts.False(rd.IsAof())
+	ts.Equal(int64(100), rd.Left())
+	ts.Equal(int64(10), rd.Size())
+	rd.Start(wait)
+	ts.Equal("0123456789", ts.readN(rd, 10))
+	rd.Close()
+
+	rd, err = ts.storer.GetReader(102)
+	ts.Nil(err)
+	ts.True(rd.IsAof())
+	ts.Equal(int64(-1), rd.Size())
+	rd.Start(wait)
+	ts.Equal("cdef", ts.readN(rd, 4))
+	ts.writeAof(aw, "gh") // reader waits for new data
+	ts.Equal("gh", ts.readN(rd, 2))
+	rd.Close()
+}
+
+func (ts *memStorerTestSuite) TestEvict() {
+	_, err := ts.storer.GetRdbWriter(nil, 0, 33)
+	ts.True(errors.Is(err, ErrMemoryExceeded))
+
+	rw, err := ts.storer.GetRdbWriter(bytes.NewReader(make([]byte, 20)), 0, 20)
+	ts.Nil(err)
+	rw.Start()
+	ts.Nil(rw.Wait(context.Background()))
+
+	aw, err := ts.storer.GetAofWritter(nil, 0)
+	ts.Nil(err)
+	ts.writeAof(aw, "0123456789")
+	left, _ := ts.storer.GetRdb()
+	ts.Equal(int64(0), left)
+
+	// rdb is evicted first
+	ts.writeAof(aw, "abcdefghij")
+	left, _ = ts.storer.GetRdb()
+	ts.Equal(int64(-1), left)
+	left, right := ts.storer.GetOffsetRange()
+	ts.Equal(int64(0), left)
+	ts.Equal(int64(20), right)
+
+	wait := usync.NewWaitCloser(nil)
+	defer wait.Close(nil)
+	rd, err := ts.storer.GetReader(0)
+	ts.Nil(err)
+
+	// ring wraps, the oldest aof data is evicted
+	ts.writeAof(aw, "ABCDEFGHIJKLMNOPQRST")
+	left, right = ts.storer.GetOffsetRange()
+	ts.Equal(int64(8), left)
+	ts.Equal(int64(40), right)
+	ts.False(ts.storer.IsValidOffset(0))
+	ts.Equal(ts.storer.maxSize, int64(len(ts.storer.ring)))
+
+	rd2, err := ts.storer.GetReader(18)
+	ts.Nil(err)
+	rd2.Start(wait)
+	ts.Equal("ijABCDEFGHIJKLMNOPQRST", ts.readN(rd2, 22))
+	rd2.Close()
+
+	// reader of evicted data fails
+	rd.Start(usync.NewWaitCloser(nil))
+	err = rd.mem.Wait(context.Background())
+	ts.True(errors.Is(err, ErrEvicted))
+	rd.Close()
+
+	_, err = ts.storer.GetReader(0)
+	ts.True(errors.Is(err, os.ErrNotExist))
+}
+
+func (ts *memStorerTestSuite) TestReset() {
+	aw, err := ts.storer.GetAofWritter(nil, 10)
+	ts.Nil(err)
+	ts.writeAof(aw, "0123")
+
+	// discontinuous aof drops old data
+	aw2, err := ts.storer.GetAofWritter(nil, 20)
+	ts.Nil(err)
+	ts.True(errors.Is(ts.storer.writeAof(aw, []byte("x")), io.EOF))
+	ts.writeAof(aw2, "abc")
+	left, right := ts.storer.GetOffsetRange()
+	ts.Equal(int64(20), left)
+	ts.Equal(int64(23), right)
+
+	rd, err := ts.storer.GetReader(20)
+	ts.Nil(err)
+	rd.mem.Start()
+
+	ts.Nil(ts.storer.DelRunId("run1"))
+	ts.Equal("", ts.storer.RunId())
+	ts.False(ts.storer.IsValidOffset(20))
+
+	select {
+	case <-rd.mem.wait.Context().Done():
+	case <-time.After(time.Second):
+		ts.Fail("reader isn't closed")
+	}
+	rd.Close()
+}
+
+func (ts *memStorerTestSuite) TestDisklessRdb() {
+	pr, pw := io.Pipe()
+	rw, err := ts.storer.GetRdbWriter(pr, 100, -1)
+	ts.Nil(err)
+	rw.Start()
+	defer rw.Close()
+
+	wait := usync.NewWaitCloser(nil)
+	defer wait.Close(nil)
+	rd, err := ts.storer.GetReader(100)
+	ts.Nil(err)
+	ts.Equal(int64(-1), rd.Size())
+	rd.Start(wait)
+
+	_, err = pw.Write([]byte("0123456789"))
+	ts.Nil(err)
+	ts.Equal("0123456789", ts.readN(rd, 10))
+	pw.Close()
+	ts.Nil(rw.Wait(context.Background()))
+	ts.Nil(rd.mem.Wait(context.Background()))
+	rd.Close()
+
+	left, size := ts.storer.GetRdb()
+	ts.Equal(int64(100), left)
+	ts.Equal(int64(10), size)
+
+	// diskless rdb is limited by maxSize
+	rw, err = ts.storer.GetRdbWriter(bytes.NewReader(make([]byte, 33)), 0, -1)
+	ts.Nil(err)
+	rw.Start()
+	ts.True(errors.Is(rw.Wait(context.Background()), ErrMemoryExceeded))
+}
+
+func (ts *memStorerTestSuite) TestWaitOffset() {
+	// no data or run id is changed
+	ts.Nil(ts.storer.WaitOffset(context.Background(), "run1", 10))
+	ts.Nil(ts.storer.WaitOffset(context.Background(), "run2", 10))
+
+	aw, err := ts.storer.GetAofWritter(nil, 0)
+	ts.Nil(err)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	ts.ErrorIs(ts.storer.WaitOffset(ctx, "run1", 3), context.DeadlineExceeded)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- ts.storer.WaitOffset(context.Background(), "run1", 3)
+	}()
+	ts.writeAof(aw, "abc")
+	select {
+	case err = <-done:
+		ts.Nil(err)
+	case <-time.After(5 * time.Second):
+		ts.Fail("wait offset is blocked")
+	}
+}
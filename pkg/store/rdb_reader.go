@@ -12,6 +12,7 @@ import (
 	"time"
 
 	"github.com/mgtv-tech/redis-GunYu/pkg/common"
+	"github.com/mgtv-tech/redis-GunYu/pkg/crypto"
 	"github.com/mgtv-tech/redis-GunYu/pkg/digest"
 	usync "github.com/mgtv-tech/redis-GunYu/pkg/sync"
 )
@@ -20,23 +21,26 @@ type RdbReader struct {
 	mux      sync.RWMutex
 	filePath string
 	reader   *os.File
+	src      io.Reader // reader or decrypter
+	decrypt  *frameReader
 	writer   io.WriteCloser
 	offset   int64
-	size     int64
+	size     int64        // -1 if size of a writing rdb is unknown
+	sizer    func() int64 // returns the size once the writing rdb is completed
 	wait     usync.WaitCloser
 	observer atomic.Pointer[Observer]
 }
 
-func NewRdbReaderFromFile(w io.WriteCloser, rdbFilePath string, verifyCrc bool) (*RdbReader, error) {
+func NewRdbReaderFromFile(w io.WriteCloser, rdbFilePath string, verifyCrc bool, keyring *crypto.Keyring) (*RdbReader, error) {
 	fi, err := os.Stat(rdbFilePath)
 	if err != nil {
 		return nil, err
 	}
 
-	return newRdbReader(w, rdbFilePath, 0, fi.Size(), verifyCrc, false)
+	return newRdbReader(w, rdbFilePath, 0, fi.Size(), verifyCrc, false, keyring, true)
 }
 
-func NewRdbReader(w io.WriteCloser, rdbDir string, offset int64, rdbSize int64, verifyCrc bool) (*RdbReader, error) {
+func NewRdbReader(w io.WriteCloser, rdbDir string, offset int64, rdbSize int64, verifyCrc bool, keyring *crypto.Keyring) (*RdbReader, error) {
 	rdbFn := fmt.Sprintf("%s%c%v_%v.rdb", rdbDir, os.PathSeparator, offset, rdbSize)
 
 	writting := false
@@ -48,10 +52,12 @@ func NewRdbReader(w io.WriteCloser, rdbDir string, offset int64, rdbSize int64,
 		writting = true
 	}
 
-	return newRdbReader(w, rdbFn, offset, rdbSize, verifyCrc, writting)
+	return newRdbReader(w, rdbFn, offset, rdbSize, verifyCrc, writting, keyring, false)
 }
 
-func newRdbReader(w io.WriteCloser, rdbFilePath string, offset int64, rdbSize int64, verifyCrc bool, isWritting bool) (*RdbReader, error) {
+// if fileSize is true, rdbSize is the file size, it's corrected to the plaintext size for an encrypted file
+func newRdbReader(w io.WriteCloser, rdbFilePath string, offset int64, rdbSize int64, verifyCrc bool, isWritting bool,
+	keyring *crypto.Keyring, fileSize bool) (*RdbReader, error) {
 
 	r := &RdbReader{
 		filePath: rdbFilePath,
@@ -68,9 +74,15 @@ func newRdbReader(w io.WriteCloser, rdbFilePath string, offset int64, rdbSize in
 		return nil, err
 	}
 	r.reader = file
+	r.src = file
 	var obr Observer = &observerProxy{}
 	r.observer.Store(&obr)
 
+	if err = r.initDecrypter(keyring, fileSize); err != nil {
+		file.Close()
+		return nil, err
+	}
+
 	if !isWritting && verifyCrc {
 		err = r.checkHeader()
 		if err != nil {
@@ -82,6 +94,29 @@ func newRdbReader(w io.WriteCloser, rdbFilePath string, offset int64, rdbSize in
 	return r, nil
 }
 
+func (r *RdbReader) initDecrypter(keyring *crypto.Keyring, fileSize bool) error {
+	encrypted, keyId, err := readRdbEncHeader(r.reader)
+	if err != nil || !encrypted {
+		return err
+	}
+	key, err := getDecryptKey(keyring, keyId, r.filePath)
+	if err != nil {
+		return err
+	}
+	if fileSize {
+		r.size, err = encryptedDataSize(r.reader, rdbEncHeaderSize)
+		if err != nil {
+			return err
+		}
+	}
+	if _, err = r.reader.Seek(rdbEncHeaderSize, 0); err != nil {
+		return err
+	}
+	r.decrypt = newFrameReader(r.reader, key)
+	r.src = r.decrypt
+	return nil
+}
+
 func (r *RdbReader) checkHeader() error {
 	fi, err := os.Stat(r.filePath)
 	if err != nil {
@@ -89,6 +124,9 @@ func (r *RdbReader) checkHeader() error {
 	}
 
 	fileSize := fi.Size()
+	if r.decrypt != nil {
+		fileSize = r.size
+	}
 	dataSize := fileSize - 8 // crc
 	if dataSize <= 0 {
 		return nil
@@ -101,7 +139,7 @@ func (r *RdbReader) checkHeader() error {
 		if dataSize < 4096 {
 			buf = buf[:dataSize]
 		}
-		n, err := r.reader.Read(buf)
+		n, err := r.src.Read(buf)
 		if err != nil {
 			return err
 		}
@@ -116,14 +154,19 @@ func (r *RdbReader) checkHeader() error {
 
 	// read crc
 	buf = buf[:8]
-	_, err = r.reader.Read(buf)
+	_, err = io.ReadFull(r.src, buf)
 	if err != nil {
 		return err
 	}
 	fileCrc := binary.LittleEndian.Uint64(buf)
 
 	// resume
-	_, err = r.reader.Seek(0, 0)
+	if r.decrypt != nil {
+		_, err = r.reader.Seek(rdbEncHeaderSize, 0)
+		r.decrypt.reset()
+	} else {
+		_, err = r.reader.Seek(0, 0)
+	}
 	if err != nil {
 		return err
 	}
@@ -165,36 +208,50 @@ func (r *RdbReader) Close() error {
 func (r *RdbReader) pump() (err error) {
 	p := make([]byte, 8192)
 	var n int
-	rdbSize := r.size
-	for rdbSize != 0 && !r.wait.IsClosed() {
-		if int64(len(p)) > rdbSize {
-			p = p[:rdbSize]
+	pumped := int64(0)
+	for !r.wait.IsClosed() {
+		size := r.dataSize()
+		if size >= 0 && pumped >= size {
+			break
+		}
+		buf := p
+		if size >= 0 && int64(len(buf)) > size-pumped {
+			buf = buf[:size-pumped]
 		}
-		n, err = r.read(p)
-		for err == io.EOF && !r.wait.IsClosed() { // EOF means n is zero
+		n, err = r.read(buf)
+		if err == io.EOF && !r.wait.IsClosed() { // EOF means n is zero, wait for writer
 			time.Sleep(time.Millisecond * 10)
-			n, err = r.read(p)
+			err = nil
+			continue
 		}
 		if n > 0 {
-			if _, err = r.writer.Write(p[:n]); err != nil {
+			if _, err = r.writer.Write(buf[:n]); err != nil {
 				break
 			}
-			rdbSize -= int64(n)
+			pumped += int64(n)
 		}
 		if err != nil {
 			break
 		}
 	}
-	if rdbSize != 0 {
-		return errors.Join(err, fmt.Errorf("imcomplete rdb replay : rdbSize(%d), remains(%d)", r.size, rdbSize))
+	if size := r.dataSize(); size < 0 || pumped != size {
+		return errors.Join(err, fmt.Errorf("imcomplete rdb replay : rdbSize(%d), remains(%d)", size, size-pumped))
 	}
 	return err
 }
 
+// dataSize returns -1 if size is unknown
+func (r *RdbReader) dataSize() int64 {
+	if r.size < 0 && r.sizer != nil {
+		r.size = r.sizer()
+	}
+	return r.size
+}
+
 func (r *RdbReader) read(buf []byte) (n int, err error) {
 	r.mux.Lock()
 	defer r.mux.Unlock()
-	n, err = r.reader.Read(buf)
+	n, err = r.src.Read(buf)
 	return
 }
 
@@ -2,14 +2,17 @@ package store
 
 import (
 	"bytes"
+	"context"
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"testing"
 
 	"github.com/mgtv-tech/redis-GunYu/config"
 	"github.com/mgtv-tech/redis-GunYu/pkg/common"
+	usync "github.com/mgtv-tech/redis-GunYu/pkg/sync"
 	"github.com/stretchr/testify/suite"
 )
 
@@ -28,7 +31,7 @@ func (ts *rdbReaderTestSuite) SetupSuite() {
 	dir, err := os.MkdirTemp("", "test_aof_reader")
 	ts.Nil(err)
 	ts.tempDir = dir
-	ts.storer = NewStorer("1", ts.tempDir, 100*1024, 100000000, config.FlushPolicy{})
+	ts.storer = NewStorer("1", ts.tempDir, 100*1024, 100000000, config.FlushPolicy{}, nil, nil, Retention{})
 	data, err := hex.DecodeString(`524544495330303130fa0972656469732d76657205372e302e31fa0a72656469732d62697473c040fa056374696d65c233068065fa08757365642d6d656dc2e0241400fa08616f662d62617365c000fe00fb0101fcd8bd197c8c010000000a737472696e745f74746c0a737472696e745f74746cff71376f88c87a56e1`)
 	ts.Nil(err)
 	ts.data = []byte(data)
@@ -42,7 +45,7 @@ func (ts *rdbReaderTestSuite) TearDownSuite() {
 func (ts *rdbReaderTestSuite) isCorrupted(offset int64) error {
 	buf := make([]byte, len(ts.data))
 	writer := newNopWriteCloser(bytes.NewBuffer(buf))
-	reader, err := NewRdbReader(writer, ts.tempDir, offset, int64(len(ts.data)), true)
+	reader, err := NewRdbReader(writer, ts.tempDir, offset, int64(len(ts.data)), true, nil)
 	if err == nil {
 		reader.Close()
 	}
@@ -83,3 +86,44 @@ func (ts *rdbReaderTestSuite) TestCorrupted() {
 		ts.Nil(ts.isCorrupted(0))
 	})
 }
+
+func (ts *rdbReaderTestSuite) TestDisklessRdb() {
+	dir := ts.T().TempDir()
+	storer := NewStorer("1", dir, -1, 100000000, config.FlushPolicy{}, nil, nil, Retention{})
+	defer storer.Close()
+	ts.Nil(storer.SetRunId("run1"))
+
+	pr, pw := io.Pipe()
+	writer, err := storer.GetRdbWriter(pr, 100, -1)
+	ts.Nil(err)
+	writer.Start()
+	defer writer.Close()
+
+	_, err = pw.Write(ts.data[:10])
+	ts.Nil(err)
+
+	// reader is created while size of rdb is unknown
+	reader, err := storer.GetReader(100, false)
+	ts.Nil(err)
+	ts.False(reader.IsAof())
+	ts.Equal(int64(-1), reader.Size())
+	wait := usync.NewWaitCloser(nil)
+	defer wait.Close(nil)
+	reader.Start(wait)
+
+	_, err = pw.Write(ts.data[10:])
+	ts.Nil(err)
+	pw.Close()
+	ts.Nil(writer.Wait(context.Background()))
+
+	data := make([]byte, len(ts.data))
+	_, err = io.ReadFull(reader.IoReader(), data)
+	ts.Nil(err)
+	ts.Equal(ts.data, data)
+	reader.Close()
+
+	left, size := storer.GetRdb()
+	ts.Equal(int64(100), left)
+	ts.Equal(int64(len(ts.data)), size)
+	ts.True(fileExist(rdbFilePath(storer.dir, 100, int64(len(ts.data)))))
+}
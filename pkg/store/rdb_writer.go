@@ -12,6 +12,7 @@ import (
 	"sync/atomic"
 
 	"github.com/mgtv-tech/redis-GunYu/config"
+	"github.com/mgtv-tech/redis-GunYu/pkg/crypto"
 	"github.com/mgtv-tech/redis-GunYu/pkg/metric"
 	usync "github.com/mgtv-tech/redis-GunYu/pkg/sync"
 )
@@ -29,6 +30,8 @@ type RdbWriter struct {
 	observer atomic.Pointer[Observer]
 	dir      string
 	wait     usync.WaitCloser
+	sealer   *frameSealer
+	gate     *diskGate
 }
 
 type RdbFile struct {
@@ -74,7 +77,8 @@ func ParseRdbFile(name string, includeTmpRdb bool) *RdbFile {
 }
 
 // rdb name : sourceDir/$runId/$rdbDir/$offset_size.rdb
-func NewRdbWriter(id string, r io.Reader, rdbDir string, offset int64, rdbSize int64) (*RdbWriter, error) {
+// if keyring is not nil, rdb data is encrypted by the active key
+func NewRdbWriter(id string, r io.Reader, rdbDir string, offset int64, rdbSize int64, keyring *crypto.Keyring) (*RdbWriter, error) {
 	s := &RdbWriter{
 		id:      id,
 		rdbSize: rdbSize,
@@ -93,6 +97,18 @@ func NewRdbWriter(id string, r io.Reader, rdbDir string, offset int64, rdbSize i
 	if err != nil {
 		return nil, err
 	}
+	if keyring != nil {
+		key, err := getEncryptKey(keyring)
+		if err == nil {
+			_, err = fd.Write(newRdbEncHeader(key.Id))
+		}
+		if err != nil {
+			fd.Close()
+			os.Remove(fn)
+			return nil, err
+		}
+		s.sealer = newFrameSealer(key)
+	}
 	s.writer = fd
 	s.offset = offset
 	s.fn = fn
@@ -126,12 +142,16 @@ func (r *RdbWriter) Close() error {
 	return nil
 }
 
+// if rdbSize is -1(diskless replication), it ingests data until reader returns io.EOF,
+// and rdbSize is known after that
 func (s *RdbWriter) ingest() (err error) {
 	p := make([]byte, 8192)
 	var n int
 	rdbSize := s.rdbSize
+	pumped := int64(0)
 	for rdbSize != 0 && !s.wait.IsClosed() {
-		if int64(len(p)) > rdbSize {
+		s.gate.wait(s.wait.Context())
+		if rdbSize > 0 && int64(len(p)) > rdbSize {
 			p = p[:rdbSize]
 		}
 		n, err = s.reader.Read(p)
@@ -140,13 +160,23 @@ func (s *RdbWriter) ingest() (err error) {
 				err = fmt.Errorf("rdb writer : file(%s), error(%w)", s.fn, err)
 				break
 			}
-			rdbSize -= int64(n)
+			if rdbSize > 0 {
+				rdbSize -= int64(n)
+			}
+			pumped += int64(n)
 		}
 		if err != nil {
+			if rdbSize < 0 && errors.Is(err, io.EOF) {
+				s.mux.Lock()
+				s.rdbSize = pumped
+				s.mux.Unlock()
+				s.pumped.Store(pumped)
+				return nil
+			}
 			err = fmt.Errorf("reader error : %w", err)
 			break
 		}
-		s.pumped.Store(s.rdbSize - rdbSize)
+		s.pumped.Store(pumped)
 	}
 
 	return err
@@ -173,6 +203,19 @@ func (s *RdbWriter) write(buf []byte) error {
 		return io.EOF
 	}
 
+	if s.sealer != nil {
+		frame, err := s.sealer.seal(buf)
+		if err != nil {
+			return err
+		}
+		if _, err = s.writer.Write(frame); err != nil {
+			return err
+		}
+		s.offset += int64(len(buf))
+		rdbWriteDataCounter.Add(float64(len(buf)), s.id)
+		return nil
+	}
+
 	n, err := s.writer.Write(buf)
 	if n > 0 {
 		s.offset += int64(n)
@@ -202,7 +245,7 @@ func (s *RdbWriter) closeRdb() (err error) {
 		return errors.Join(err, os.Remove(s.fn)) // remove *.rdb.tmp file
 	} else {
 		(*obr).Close(s.left, s.rdbSize, false)
-		dfn := strings.TrimSuffix(s.fn, ".tmp")
+		dfn := rdbFilePath(s.dir, s.left, s.rdbSize)  // size of diskless rdb is known now
 		return errors.Join(err, os.Rename(s.fn, dfn)) // *.rdb.tmp -> *.rdb
 	}
 }
@@ -3,6 +3,7 @@ package store
 import (
 	"bufio"
 	"fmt"
+	"io"
 
 	"github.com/mgtv-tech/redis-GunYu/config"
 	"github.com/mgtv-tech/redis-GunYu/pkg/log"
@@ -12,6 +13,7 @@ import (
 type Reader struct {
 	rdb      *RdbReader
 	aof      *AofRotateReader
+	mem      *memReader
 	reader   *bufio.Reader
 	size     int64
 	runId    string
@@ -34,6 +36,18 @@ func NewReader(reader *bufio.Reader, rdb *RdbReader, aof *AofRotateReader,
 	}
 }
 
+// NewStreamReader returns a reader of a rdb stream which isn't kept in channel,
+// e.g. a snapshot transferred to a single output, size is -1 if it's unknown
+func NewStreamReader(r io.Reader, runId string, left int64, size int64) *Reader {
+	return &Reader{
+		reader: bufio.NewReader(r),
+		left:   left,
+		size:   size,
+		runId:  runId,
+		logger: log.WithLogger(config.LogModuleName("[Reader(stream)] ")),
+	}
+}
+
 func (r *Reader) Start(wait usync.WaitCloser) {
 	wait.WgAdd(1)
 	usync.SafeGo(func() {
@@ -47,6 +61,10 @@ func (r *Reader) Start(wait usync.WaitCloser) {
 			r.rdb.Start()
 			err = r.rdb.Wait(wait.Context())
 			r.rdb.Close()
+		} else if r.mem != nil {
+			r.mem.Start()
+			err = r.mem.Wait(wait.Context())
+			r.mem.Close()
 		}
 		if err != nil {
 			r.logger.Errorf("Run error : %v", err)
@@ -67,7 +85,7 @@ func (r *Reader) RunId() string {
 }
 
 // Size : returns data size
-// -1 means an endless reader
+// -1 means an endless reader, or size of a writing diskless rdb is unknown
 func (r *Reader) Size() int64 {
 	return r.size
 }
@@ -77,7 +95,7 @@ func (r *Reader) IoReader() *bufio.Reader {
 }
 
 func (r *Reader) IsAof() bool {
-	return r.aof != nil
+	return r.aof != nil || (r.mem != nil && r.mem.aof)
 }
 
 func (r *Reader) Close() {
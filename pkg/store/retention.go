@@ -0,0 +1,81 @@
+package store
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/mgtv-tech/redis-GunYu/config"
+	"github.com/mgtv-tech/redis-GunYu/pkg/metric"
+)
+
+// Retention limits the time span of storer, files are removed from oldest to newest.
+// maxSize of storer(or remote tier) is combined with MaxAge :
+// if Loose is false, files are removed if either limit is exceeded,
+// otherwise, files are removed only if both limits are exceeded
+type Retention struct {
+	MaxAge time.Duration // 0 is unlimited
+	Loose  bool
+}
+
+var (
+	timeReachGauge = metric.NewGaugeVec(metric.GaugeVecOpts{
+		Namespace: config.AppName,
+		Subsystem: "storer",
+		Name:      "time_reach",
+		Labels:    []string{"input"},
+	})
+)
+
+type retentionLimit struct {
+	maxSize  int64     // <= 0 is unlimited
+	deadline time.Time // files modified before deadline are expired, zero is unlimited
+	loose    bool
+}
+
+func (r Retention) limit(maxSize int64, now time.Time) retentionLimit {
+	limit := retentionLimit{
+		maxSize: maxSize,
+		loose:   r.Loose,
+	}
+	if r.MaxAge > 0 {
+		limit.deadline = now.Add(-r.MaxAge)
+	}
+	return limit
+}
+
+func (l retentionLimit) enabled() bool {
+	return l.maxSize > 0 || !l.deadline.IsZero()
+}
+
+// exceeded checks whether files are beyond the limit,
+// size is the total size from the newest file to this file, modTime is the modification time of this file
+func (l retentionLimit) exceeded(size int64, modTime time.Time) bool {
+	sizeOn, ageOn := l.maxSize > 0, !l.deadline.IsZero()
+	bySize := sizeOn && size > l.maxSize
+	byAge := ageOn && modTime.Before(l.deadline)
+	if l.loose && sizeOn && ageOn {
+		return bySize && byAge
+	}
+	return bySize || byAge
+}
+
+func (l retentionLimit) String() string {
+	return fmt.Sprintf("maxSize(%d), deadline(%s), loose(%v)", l.maxSize, l.deadline.Format(time.RFC3339), l.loose)
+}
+
+// TimeReach returns how far back in time the storer reaches, it's a lower bound
+func (s *Storer) TimeReach() time.Duration {
+	oldest, ok := s.getDataSet().oldestTime()
+	if !ok {
+		return 0
+	}
+	reach := time.Since(oldest)
+	if reach < 0 {
+		return 0
+	}
+	return reach
+}
+
+func (s *Storer) updateTimeReach() {
+	timeReachGauge.Set(s.TimeReach().Seconds(), s.Id)
+}
@@ -0,0 +1,203 @@
+package store
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mgtv-tech/redis-GunYu/config"
+)
+
+// fakeS3 is an in-process S3 server, it supports put, get, delete, copy and list(v2) with path style URL
+type fakeS3 struct {
+	mux      sync.Mutex
+	bucket   string
+	objects  map[string][]byte
+	modTimes map[string]time.Time
+	pageSize int
+}
+
+func newFakeS3(bucket string) (*fakeS3, *httptest.Server) {
+	fs := &fakeS3{bucket: bucket, objects: make(map[string][]byte), modTimes: make(map[string]time.Time), pageSize: 2}
+	return fs, httptest.NewServer(fs)
+}
+
+func (fs *fakeS3) names() []string {
+	fs.mux.Lock()
+	defer fs.mux.Unlock()
+	names := []string{}
+	for k := range fs.objects {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (fs *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), s3Algorithm+" Credential=ak/") ||
+		r.Header.Get("x-amz-date") == "" {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	bucket, key, _ := strings.Cut(path, "/")
+	if bucket != fs.bucket {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	fs.mux.Lock()
+	defer fs.mux.Unlock()
+
+	switch {
+	case r.Method == http.MethodGet && key == "":
+		fs.list(w, r)
+	case r.Method == http.MethodGet:
+		data, ok := fs.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(data)
+	case r.Method == http.MethodPut && r.Header.Get("x-amz-copy-source") != "":
+		src := strings.TrimPrefix(r.Header.Get("x-amz-copy-source"), "/"+fs.bucket+"/")
+		data, ok := fs.objects[src]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fs.objects[key] = data
+		fs.modTimes[key] = time.Now().UTC()
+	case r.Method == http.MethodPut:
+		data, err := io.ReadAll(r.Body)
+		if err != nil || int64(len(data)) != r.ContentLength {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		fs.objects[key] = data
+		fs.modTimes[key] = time.Now().UTC()
+	case r.Method == http.MethodDelete:
+		delete(fs.objects, key)
+		delete(fs.modTimes, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (fs *fakeS3) list(w http.ResponseWriter, r *http.Request) {
+	prefix := r.URL.Query().Get("prefix")
+	keys := []string{}
+	for k := range fs.objects {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	start, _ := strconv.Atoi(r.URL.Query().Get("continuation-token"))
+	result := s3ListResult{}
+	end := start + fs.pageSize
+	if end < len(keys) {
+		result.IsTruncated = true
+		result.NextContinuationToken = strconv.Itoa(end)
+	} else {
+		end = len(keys)
+	}
+	for _, k := range keys[start:end] {
+		result.Contents = append(result.Contents, struct {
+			Key          string    `xml:"Key"`
+			Size         int64     `xml:"Size"`
+			LastModified time.Time `xml:"LastModified"`
+		}{Key: k, Size: int64(len(fs.objects[k])), LastModified: fs.modTimes[k]})
+	}
+	xml.NewEncoder(w).Encode(result)
+}
+
+func newTestS3Backend(t *testing.T, url string, prefix string) *S3Backend {
+	cfg := config.S3Config{Endpoint: url, Bucket: "bucket", AccessKey: "ak", SecretKey: "sk", Region: "us-east-1", Prefix: prefix}
+	backend, err := NewS3Backend(cfg)
+	assert.Nil(t, err)
+	return backend
+}
+
+func TestS3Backend(t *testing.T) {
+	fs, server := newFakeS3("bucket")
+	defer server.Close()
+	backend := newTestS3Backend(t, server.URL, "gunyu/")
+	ctx := context.Background()
+
+	for i := 0; i < 5; i++ {
+		data := fmt.Sprintf("data%d", i)
+		assert.Nil(t, backend.Put(ctx, fmt.Sprintf("run/%d_%d.aof", i, len(data)), strings.NewReader(data), int64(len(data))))
+	}
+	assert.Nil(t, backend.Put(ctx, "other/0_1.aof", strings.NewReader("x"), 1))
+	assert.Equal(t, "gunyu/run/0_5.aof", fs.names()[1])
+
+	t.Run("list", func(t *testing.T) {
+		objs, err := backend.List(ctx, "run/")
+		assert.Nil(t, err)
+		assert.Len(t, objs, 5)
+		assert.Equal(t, "run/4_5.aof", objs[4].Name)
+		assert.Equal(t, int64(5), objs[4].Size)
+		assert.WithinDuration(t, time.Now(), objs[4].ModTime, time.Minute)
+	})
+
+	t.Run("get", func(t *testing.T) {
+		body, err := backend.Get(ctx, "run/1_5.aof")
+		assert.Nil(t, err)
+		data, _ := io.ReadAll(body)
+		body.Close()
+		assert.Equal(t, "data1", string(data))
+
+		_, err = backend.Get(ctx, "run/9_5.aof")
+		assert.True(t, errors.Is(err, os.ErrNotExist))
+	})
+
+	t.Run("copy and delete", func(t *testing.T) {
+		assert.Nil(t, backend.Copy(ctx, "run/1_5.aof", "run2/1_5.aof"))
+		assert.Nil(t, backend.Delete(ctx, "run/1_5.aof"))
+		objs, err := backend.List(ctx, "run2/")
+		assert.Nil(t, err)
+		assert.Len(t, objs, 1)
+		objs, err = backend.List(ctx, "run/")
+		assert.Nil(t, err)
+		assert.Len(t, objs, 4)
+	})
+
+	t.Run("forbidden", func(t *testing.T) {
+		backend := newTestS3Backend(t, server.URL, "")
+		backend.cfg.AccessKey = "other"
+		_, err := backend.List(ctx, "")
+		assert.NotNil(t, err)
+	})
+}
+
+func TestS3Sign(t *testing.T) {
+	backend := newTestS3Backend(t, "http://127.0.0.1:9000", "")
+	req, err := backend.newRequest(context.Background(), http.MethodGet, "a b/c.aof", nil, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "/bucket/a%20b/c.aof", req.URL.EscapedPath())
+
+	now, _ := time.Parse("20060102T150405Z", "20240101T000000Z")
+	backend.sign(req, now)
+	auth := req.Header.Get("Authorization")
+	assert.True(t, strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=ak/20240101/us-east-1/s3/aws4_request, SignedHeaders=host;x-amz-content-sha256;x-amz-date, Signature="))
+
+	// same request, same signature
+	req2, _ := backend.newRequest(context.Background(), http.MethodGet, "a b/c.aof", nil, nil)
+	backend.sign(req2, now)
+	assert.Equal(t, auth, req2.Header.Get("Authorization"))
+}
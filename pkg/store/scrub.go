@@ -0,0 +1,285 @@
+package store
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/mgtv-tech/redis-GunYu/config"
+	"github.com/mgtv-tech/redis-GunYu/pkg/common"
+	"github.com/mgtv-tech/redis-GunYu/pkg/digest"
+	"github.com/mgtv-tech/redis-GunYu/pkg/log"
+	"github.com/mgtv-tech/redis-GunYu/pkg/metric"
+	usync "github.com/mgtv-tech/redis-GunYu/pkg/sync"
+)
+
+// quarantined files are renamed to $file.quarantine, they are ignored by storer
+const quarantineSuffix = ".quarantine"
+
+var (
+	scrubFileCounter = metric.NewCounterVec(metric.CounterVecOpts{
+		Namespace: config.AppName,
+		Subsystem: "storer",
+		Name:      "scrub_file",
+		Labels:    []string{"input", "result"},
+	})
+	scrubQuarantineCounter = metric.NewCounterVec(metric.CounterVecOpts{
+		Namespace: config.AppName,
+		Subsystem: "storer",
+		Name:      "scrub_quarantine",
+		Labels:    []string{"input"},
+	})
+)
+
+// StartScrub re-verifies sealed rdb and aof files every interval in background,
+// rate limits reading speed(bytes per second), rate <= 0 is unlimited.
+// corrupted files are quarantined, data set is truncated at them, so offsets before them become invalid
+func (s *Storer) StartScrub(interval time.Duration, rate int64) {
+	if interval <= 0 {
+		return
+	}
+	usync.SafeGo(func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.closer.Context().Done():
+				return
+			case <-ticker.C:
+			}
+			s.scrub(s.closer.Context(), rate)
+		}
+	}, nil)
+}
+
+func (s *Storer) scrub(ctx context.Context, rate int64) {
+	s.mux.RLock()
+	runId := s.runId
+	dir := s.dir
+	ds := s.getDataSet()
+	s.mux.RUnlock()
+	if runId == "" {
+		return
+	}
+
+	ds.mux.RLock()
+	rdb := ds.rdb
+	aofs := make([]*dataSetAof, len(ds.aofSegs))
+	copy(aofs, ds.aofSegs)
+	ds.mux.RUnlock()
+
+	// files are verified without lock, a file removed by gc is skipped
+	if rdb != nil && !rdb.evicted.Load() {
+		path := rdbFilePath(dir, rdb.Left(), rdb.Size())
+		if fileExist(path) { // *.rdb.tmp is writing
+			err := s.scrubRdb(ctx, dir, rdb, rate)
+			if s.scrubResult(ctx, path, err) {
+				s.quarantine(ds, rdb, nil)
+			}
+		}
+	}
+
+	for _, aof := range aofs {
+		if aof.Size() <= 0 || aof.evicted.Load() { // writing or evicted
+			continue
+		}
+		path := aofFilePath(dir, aof.Left())
+		err := scrubAof(ctx, path, rate)
+		if s.scrubResult(ctx, path, err) {
+			s.quarantine(ds, nil, aof)
+		}
+	}
+}
+
+// scrubResult returns true if file is corrupted
+func (s *Storer) scrubResult(ctx context.Context, path string, err error) bool {
+	if err == nil {
+		scrubFileCounter.Inc(s.Id, VerifyStatusOk)
+		return false
+	}
+	if ctx.Err() != nil || errors.Is(err, os.ErrNotExist) {
+		return false
+	}
+	if !errors.Is(err, common.ErrCorrupted) && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		s.logger.Errorf("scrub file : file(%s), error(%v)", path, err)
+		return false
+	}
+	scrubFileCounter.Inc(s.Id, VerifyStatusCorrupted)
+	s.logger.Errorf("scrub file, file is corrupted : file(%s), error(%v)", path, err)
+	return true
+}
+
+func (s *Storer) quarantine(ds *dataSet, rdb *dataSetRdb, aof *dataSetAof) {
+	s.mux.Lock()
+	if s.getDataSet() != ds {
+		s.mux.Unlock()
+		return
+	}
+	runId := s.runId
+	gcRdb, gcAofs, ok := ds.quarantine(s.dir, rdb, aof)
+	s.mux.Unlock()
+
+	if !ok {
+		return
+	}
+	scrubQuarantineCounter.Inc(s.Id)
+	if s.tier != nil {
+		s.deleteRemote(runId, gcRdb, gcAofs)
+	}
+}
+
+// quarantine renames the corrupted file, and removes files which can't be read continuously,
+// returns false if the file doesn't exist in data set or removed files are referenced
+func (ds *dataSet) quarantine(dir string, rdb *dataSetRdb, aof *dataSetAof) (gcRdb *dataSetRdb, gcAofs []*dataSetAof, ok bool) {
+	ds.mux.Lock()
+	defer ds.mux.Unlock()
+
+	var bad string
+	if rdb != nil {
+		if ds.rdb != rdb {
+			return
+		}
+		gcRdb = rdb
+		bad = rdbFilePath(dir, rdb.left, rdb.rdbSize)
+	} else {
+		idx := -1
+		for i, a := range ds.aofSegs {
+			if a == aof {
+				idx = i
+				break
+			}
+		}
+		if idx == -1 {
+			return
+		}
+		gcAofs = append(gcAofs, ds.aofSegs[:idx+1]...)
+		// rdb is followed by aof
+		if ds.rdb != nil && ds.rdb.left < aof.Right() {
+			gcRdb = ds.rdb
+		}
+		bad = aofFilePath(dir, aof.left)
+	}
+
+	if gcRdb != nil && gcRdb.Ref() > 0 {
+		log.Warnf("quarantine file, but rdb is referenced : file(%s), rdb(%d)", bad, gcRdb.left)
+		return nil, nil, false
+	}
+	for _, a := range gcAofs {
+		if a.Ref() > 0 {
+			log.Warnf("quarantine file, but aof is referenced : file(%s), aof(%d)", bad, a.left)
+			return nil, nil, false
+		}
+	}
+
+	if err := os.Rename(bad, bad+quarantineSuffix); err != nil {
+		log.Errorf("quarantine file error : file(%s), error(%v)", bad, err)
+		return nil, nil, false
+	}
+	log.Warnf("quarantine file : file(%s)", bad)
+
+	if gcRdb != nil {
+		if rdb == nil && !gcRdb.evicted.Load() {
+			removeFile(rdbFilePath(dir, gcRdb.left, gcRdb.rdbSize))
+		}
+		ds.rdb = nil
+	}
+	for _, a := range gcAofs {
+		if a != aof && !a.evicted.Load() {
+			removeFile(aofFilePath(dir, a.left))
+		}
+		delete(ds.aofMap, a.left)
+	}
+	ds.aofSegs = ds.aofSegs[len(gcAofs):]
+	return gcRdb, gcAofs, true
+}
+
+func removeFile(path string) {
+	if err := os.Remove(path); err != nil {
+		log.Errorf("remove file error : file(%s), error(%v)", path, err)
+	} else {
+		log.Infof("remove file : file(%s)", path)
+	}
+}
+
+func (s *Storer) scrubRdb(ctx context.Context, dir string, rdb *dataSetRdb, rate int64) error {
+	r, err := NewRdbReader(nil, dir, rdb.Left(), rdb.Size(), false, s.keyring)
+	if err != nil {
+		return err
+	}
+	r.src = newThrottledReader(ctx, r.src, rate)
+	err = r.checkHeader()
+	return errors.Join(err, r.closeRdb())
+}
+
+// scrubAof checks the size and CRC of a sealed aof file
+func scrubAof(ctx context.Context, path string, rate int64) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	header := [headerSize]byte{}
+	if _, err = io.ReadFull(file, header[:]); err != nil {
+		return errors.Join(common.ErrCorrupted, fmt.Errorf("read header : file(%s), error(%w)", path, err))
+	}
+	expCrc := binary.LittleEndian.Uint64(header[1:9])
+	expSize := binary.LittleEndian.Uint32(header[9:13])
+
+	fi, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if int64(expSize) != fi.Size()-headerSize {
+		return errors.Join(common.ErrCorrupted, fmt.Errorf("failed check size : file(%s), fileSize(%d), size(%d)", path, expSize, fi.Size()-headerSize))
+	}
+
+	crc := digest.New()
+	if _, err = io.Copy(crc, newThrottledReader(ctx, file, rate)); err != nil {
+		return err
+	}
+	actCrc := crc.Sum64()
+	if actCrc != expCrc {
+		return errors.Join(common.ErrCorrupted, fmt.Errorf("failed check CRC : file(%s), fileCrc(%d), crc(%d)", path, expCrc, actCrc))
+	}
+	return nil
+}
+
+// throttledReader limits reading speed to rate bytes per second
+type throttledReader struct {
+	ctx   context.Context
+	r     io.Reader
+	rate  int64
+	start time.Time
+	total int64
+}
+
+func newThrottledReader(ctx context.Context, r io.Reader, rate int64) io.Reader {
+	return &throttledReader{ctx: ctx, r: r, rate: rate, start: time.Now()}
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	if err := t.ctx.Err(); err != nil {
+		return 0, err
+	}
+	if t.rate > 0 && int64(len(p)) > t.rate {
+		p = p[:t.rate]
+	}
+	n, err := t.r.Read(p)
+	t.total += int64(n)
+	if t.rate > 0 {
+		expected := time.Duration(float64(t.total) / float64(t.rate) * float64(time.Second))
+		if wait := expected - time.Since(t.start); wait > 0 {
+			select {
+			case <-t.ctx.Done():
+				return n, t.ctx.Err()
+			case <-time.After(wait):
+			}
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,130 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mgtv-tech/redis-GunYu/config"
+	"github.com/mgtv-tech/redis-GunYu/pkg/digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+func TestScrubSuite(t *testing.T) {
+	suite.Run(t, new(scrubTestSuite))
+}
+
+type scrubTestSuite struct {
+	suite.Suite
+	tempDir string
+	dir     string
+	storer  *Storer
+}
+
+// rdb : 0_20.rdb, aof : 0.aof, 16.aof, 32.aof
+func (ts *scrubTestSuite) SetupTest() {
+	ts.tempDir = ts.T().TempDir()
+	ts.dir = filepath.Join(ts.tempDir, "run1")
+	ts.Nil(os.MkdirAll(ts.dir, 0777))
+
+	data := []byte("0123456789ab")
+	crc := digest.New()
+	crc.Write(data)
+	data = binary.LittleEndian.AppendUint64(data, crc.Sum64())
+	ts.Nil(os.WriteFile(rdbFilePath(ts.dir, 0, int64(len(data))), data, 0777))
+
+	writer, err := NewAofRotater("1", ts.dir, 0, 10, config.FlushPolicy{}, nil)
+	ts.Nil(err)
+	for i := 0; i < 3; i++ {
+		ts.Nil(writer.write([]byte("abcdefghijklmnop")))
+	}
+	ts.Nil(writer.close())
+
+	ts.storer = NewStorer("1", ts.tempDir, -1, 10, config.FlushPolicy{}, nil, nil, Retention{})
+	ts.Nil(ts.storer.SetRunId("run1"))
+}
+
+func (ts *scrubTestSuite) TearDownTest() {
+	ts.storer.Close()
+}
+
+func (ts *scrubTestSuite) corrupt(path string) {
+	data, err := os.ReadFile(path)
+	ts.Nil(err)
+	data[len(data)-1]++
+	ts.Nil(os.WriteFile(path, data, 0777))
+}
+
+func (ts *scrubTestSuite) TestHealthy() {
+	ts.storer.scrub(context.Background(), -1)
+	left, right := ts.storer.GetOffsetRange()
+	ts.Equal(int64(0), left)
+	ts.Equal(int64(48), right)
+	ts.NotNil(ts.storer.getDataSet().GetRdb())
+}
+
+func (ts *scrubTestSuite) TestQuarantineAof() {
+	path := aofFilePath(ts.dir, 16)
+	ts.corrupt(path)
+
+	// postponed if a reader is reading the data before corrupted file
+	rd, err := ts.storer.GetReader(0, false)
+	ts.Nil(err)
+	ts.storer.scrub(context.Background(), -1)
+	ts.True(fileExist(path))
+	ts.True(ts.storer.IsValidOffset(0))
+	rd.aof.Close()
+	rd.Close()
+
+	ts.storer.scrub(context.Background(), -1)
+	ts.False(fileExist(path))
+	ts.True(fileExist(path + quarantineSuffix))
+	ts.False(fileExist(aofFilePath(ts.dir, 0)))
+	ts.False(fileExist(rdbFilePath(ts.dir, 0, 20)))
+	ts.Nil(ts.storer.getDataSet().GetRdb())
+	ts.False(ts.storer.IsValidOffset(16))
+	left, right := ts.storer.GetOffsetRange()
+	ts.Equal(int64(32), left)
+	ts.Equal(int64(48), right)
+
+	// quarantined file is ignored after restart
+	storer := NewStorer("1", ts.tempDir, -1, 10, config.FlushPolicy{}, nil, nil, Retention{})
+	defer storer.Close()
+	ts.Nil(storer.SetRunId("run1"))
+	left, right = storer.GetOffsetRange()
+	ts.Equal(int64(32), left)
+	ts.Equal(int64(48), right)
+}
+
+func (ts *scrubTestSuite) TestQuarantineRdb() {
+	path := rdbFilePath(ts.dir, 0, 20)
+	ts.corrupt(path)
+
+	ts.storer.scrub(context.Background(), -1)
+	ts.True(fileExist(path + quarantineSuffix))
+	ts.Nil(ts.storer.getDataSet().GetRdb())
+	left, right := ts.storer.GetOffsetRange()
+	ts.Equal(int64(0), left)
+	ts.Equal(int64(48), right)
+}
+
+func TestThrottledReader(t *testing.T) {
+	start := time.Now()
+	r := newThrottledReader(context.Background(), bytes.NewReader(make([]byte, 300)), 1000)
+	n, err := io.Copy(io.Discard, r)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(300), n)
+	assert.True(t, time.Since(start) >= 250*time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r = newThrottledReader(ctx, bytes.NewReader(make([]byte, 300)), 1000)
+	_, err = io.Copy(io.Discard, r)
+	assert.ErrorIs(t, err, context.Canceled)
+}
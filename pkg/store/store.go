@@ -2,6 +2,7 @@ package store
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"io"
 	"os"
@@ -12,6 +13,7 @@ import (
 	"time"
 
 	"github.com/mgtv-tech/redis-GunYu/config"
+	"github.com/mgtv-tech/redis-GunYu/pkg/crypto"
 	"github.com/mgtv-tech/redis-GunYu/pkg/io/pipe"
 	"github.com/mgtv-tech/redis-GunYu/pkg/log"
 	usync "github.com/mgtv-tech/redis-GunYu/pkg/sync"
@@ -23,6 +25,7 @@ type Storer struct {
 	baseDir     string       // storage directory
 	dir         string       // baseDir + runId
 	maxSize     int64
+	retention   Retention
 	logSize     int64
 	runId       string
 	dataSetMux  sync.RWMutex
@@ -31,19 +34,29 @@ type Storer struct {
 	closer      usync.WaitCloser
 	logger      log.Logger
 	flush       config.FlushPolicy
+	keyring     *crypto.Keyring // nil if encryption is disabled
+	tier        *RemoteTier     // nil if remote tier is disabled
+	fetchMux    sync.Mutex
+	gate        diskGate // writers are paused if free disk space is low
+	notifyMux   sync.Mutex
+	notify      chan struct{} // closed and renewed once data is written
 }
 
-func NewStorer(id string, baseDir string, maxSize, logSize int64, flush config.FlushPolicy) *Storer {
+func NewStorer(id string, baseDir string, maxSize, logSize int64, flush config.FlushPolicy, keyring *crypto.Keyring, tier *RemoteTier, retention Retention) *Storer {
 	ss := &Storer{
 		Id:          id,
 		baseDir:     baseDir,
 		maxSize:     maxSize,
+		retention:   retention,
 		logSize:     logSize,
 		readBufSize: 1024 * 1024,
 		closer:      usync.NewWaitCloser(nil),
 		logger:      log.WithLogger(config.LogModuleName(fmt.Sprintf("[Storer(%s)] ", id))),
 		dataSet:     newDataSet(nil, nil),
 		flush:       flush,
+		keyring:     keyring,
+		tier:        tier,
+		notify:      make(chan struct{}),
 	}
 
 	usync.SafeGo(func() {
@@ -53,6 +66,40 @@ func NewStorer(id string, baseDir string, maxSize, logSize int64, flush config.F
 	return ss
 }
 
+func (s *Storer) broadcast() {
+	s.notifyMux.Lock()
+	defer s.notifyMux.Unlock()
+	close(s.notify)
+	s.notify = make(chan struct{})
+}
+
+func (s *Storer) getNotify() <-chan struct{} {
+	s.notifyMux.Lock()
+	defer s.notifyMux.Unlock()
+	return s.notify
+}
+
+// WaitOffset blocks until offset is not greater than the newest offset,
+// it returns immediately if run id isn't runId or there is no data
+func (s *Storer) WaitOffset(ctx context.Context, runId string, offset int64) error {
+	for {
+		notify := s.getNotify()
+		if s.RunId() != runId {
+			return nil
+		}
+		if right := s.LatestOffset(); right < 0 || offset <= right {
+			return nil
+		}
+		select {
+		case <-notify:
+		case <-s.closer.Done():
+			return s.closer.Error()
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
 func (s *Storer) getDataSet() *dataSet {
 	s.dataSetMux.RLock()
 	defer s.dataSetMux.RUnlock()
@@ -71,7 +118,9 @@ func (s *Storer) VerifyRunId(ids []string) (offset int64, err error) {
 				return
 			}
 			err = nil
-			continue
+			if !s.existRemote(id) {
+				continue
+			}
 		}
 		err = s.SetRunId(id)
 		if err != nil {
@@ -115,6 +164,7 @@ func (s *Storer) newRunId(id string) error {
 		s.dataSet = rdbAof
 		s.dataSetMux.Unlock()
 	}
+	s.broadcast()
 
 	return nil
 }
@@ -131,6 +181,7 @@ func (s *Storer) SetRunId(new string) error {
 	if err != nil {
 		return err
 	}
+	s.renameRemote(old, new)
 	return s.newRunId(new)
 }
 
@@ -158,10 +209,12 @@ func (s *Storer) DelRunId(id string) error {
 	if err != nil {
 		return err
 	}
+	s.delRemoteRunId(id)
 
 	s.dir = ""
 	s.runId = ""
 	s.resetDataSet()
+	s.broadcast()
 
 	return nil
 }
@@ -174,6 +227,16 @@ func (s *Storer) resetDataSet() {
 	ra := s.dataSet
 	if ra != nil {
 		ra.Close()
+		if s.tier != nil && s.runId != "" {
+			// remote files of old data set are useless
+			ra.mux.RLock()
+			rdb, aofs := ra.rdb, append([]*dataSetAof{}, ra.aofSegs...)
+			ra.mux.RUnlock()
+			runId := s.runId
+			usync.SafeGo(func() {
+				s.deleteRemote(runId, rdb, aofs)
+			}, nil)
+		}
 	}
 
 	filepath.Walk(s.dir, func(path string, info os.FileInfo, err error) error {
@@ -244,6 +307,50 @@ func (s *Storer) GetRdb() (int64, int64) {
 // for a rdb writer, Reader returns io.EOF when data has been drained
 // for a aof writer, it's endless unless encounter an error
 func (s *Storer) GetReader(offset int64, verifyCrc bool) (*Reader, error) {
+	// an evicted file is downloaded without locks of storer,
+	// it's referenced until the reader is created, so it isn't removed meanwhile
+	fetch, unref := s.fetchForReader(offset)
+	defer unref()
+	if err := fetch(); err != nil {
+		return nil, err
+	}
+	return s.getReader(offset, verifyCrc)
+}
+
+// fetchForReader returns a download of the file containing offset if it has been evicted
+func (s *Storer) fetchForReader(offset int64) (fetch func() error, unref func()) {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+
+	s.dataSetMux.Lock()
+	defer s.dataSetMux.Unlock()
+
+	fetch, unref = func() error { return nil }, func() {}
+	if s.tier == nil {
+		return
+	}
+	ds := s.dataSet
+	if !ds.InRange(offset) {
+		return
+	}
+	dir := s.dir
+	if aof := ds.IndexAof(offset); aof != nil {
+		if aof.evicted.Load() {
+			aof.rwRef.Add(1)
+			fetch = func() error { return s.fetchAof(dir, aof) }
+			unref = func() { aof.rwRef.Add(-1) }
+		}
+		return
+	}
+	if rdb := ds.GetRdb(); rdb != nil && offset <= rdb.Left() && rdb.evicted.Load() {
+		rdb.rwRef.Add(1)
+		fetch = func() error { return s.fetchRdb(dir, rdb) }
+		unref = func() { rdb.rwRef.Add(-1) }
+	}
+	return
+}
+
+func (s *Storer) getReader(offset int64, verifyCrc bool) (*Reader, error) {
 	s.mux.RLock()
 	defer s.mux.RUnlock()
 
@@ -267,10 +374,11 @@ func (s *Storer) GetReader(offset int64, verifyCrc bool) (*Reader, error) {
 		if rdb != nil {
 			left := rdb.Left()
 			if offset <= left {
-				rr, err := NewRdbReader(pipew, s.dir, left, rdb.Size(), verifyCrc)
+				rr, err := NewRdbReader(pipew, s.dir, left, rdb.Size(), verifyCrc, s.keyring)
 				if err != nil {
 					return nil, err
 				}
+				rr.sizer = rdb.Size
 				rd.rdb = rr
 				rd.reader = reader
 				rd.closedCb = append(rd.closedCb, piper.Close)
@@ -287,7 +395,7 @@ func (s *Storer) GetReader(offset int64, verifyCrc bool) (*Reader, error) {
 		return nil, os.ErrNotExist
 	}
 
-	rr, err := NewAofRotateReader(s.dir, aof.Left(), s, pipew, verifyCrc)
+	rr, err := NewAofRotateReader(s.dir, aof.Left(), s, pipew, verifyCrc, s.keyring)
 	if err != nil {
 		return nil, err
 	}
@@ -346,16 +454,18 @@ func (s *Storer) GetRdbWriter(r io.Reader, offset int64, rdbSize int64) (*RdbWri
 
 	s.resetDataSet()
 
-	w, err := NewRdbWriter(s.Id, r, s.dir, offset, rdbSize)
+	w, err := NewRdbWriter(s.Id, r, s.dir, offset, rdbSize, s.keyring)
 	if err != nil {
 		return nil, err
 	}
+	w.gate = &s.gate
 
 	s.dataSetMux.Lock()
 	rdb := &dataSetRdb{
 		left:    offset,
 		rdbSize: rdbSize,
 	}
+	rdb.touch(time.Now())
 	s.dataSet = newDataSet(rdb, nil)
 	rdb.AddWriter(w)
 	s.dataSetMux.Unlock()
@@ -364,12 +474,17 @@ func (s *Storer) GetRdbWriter(r io.Reader, offset int64, rdbSize int64) (*RdbWri
 		close: s.newRdbWCloseObserver(w, rdb),
 	}
 	w.SetObserver(obr)
+	s.broadcast()
 
 	return w, nil
 }
 
 func (s *Storer) newRdbWCloseObserver(w *RdbWriter, rdb *dataSetRdb) func(args ...interface{}) {
 	return func(args ...interface{}) {
+		if size := args[1].(int64); size >= 0 {
+			rdb.setSize(size) // size of diskless rdb
+		}
+		rdb.touch(time.Now())
 		rdb.DelWriter(w)
 	}
 }
@@ -382,14 +497,16 @@ func (s *Storer) GetAofWritter(r io.Reader, offset int64) (*AofWriter, error) {
 	ds := s.getDataSet()
 	ds.CloseAofWriter()
 
-	w, err := NewAofWriter(s.Id, s.dir, offset, r, s.logSize, s.flush)
+	w, err := NewAofWriter(s.Id, s.dir, offset, r, s.logSize, s.flush, s.keyring)
 	if err != nil {
 		return nil, err
 	}
+	w.gate = &s.gate
 
 	aofSeg := &dataSetAof{
 		left: offset,
 	}
+	aofSeg.touch(time.Now())
 	s.dataSetMux.Lock()
 	s.dataSet.AppendAof(aofSeg)
 	s.dataSetMux.Unlock()
@@ -402,6 +519,7 @@ func (s *Storer) GetAofWritter(r io.Reader, offset int64) (*AofWriter, error) {
 		write: s.newAofWriteObserver(),
 	}
 	w.SetObserver(proxy)
+	s.broadcast()
 
 	return w, nil
 }
@@ -418,9 +536,11 @@ func (s *Storer) newAofWriteObserver() func(args ...interface{}) {
 		aof := ds.FindAof(left)
 		if aof != nil {
 			aof.incrSize(size)
+			aof.touch(time.Now())
 		} else {
 			s.logger.Warnf("aof doesnot exist : aof(%d)", left)
 		}
+		s.broadcast()
 	}
 }
 
@@ -433,6 +553,7 @@ func (s *Storer) newAofWOpenObserver(w *AofWriter, ds *dataSet) func(args ...int
 			left: left,
 			size: -1,
 		}
+		aof.touch(time.Now())
 		aof.SetWriter(w)
 		ds.AppendAof(aof)
 	}
@@ -459,7 +580,48 @@ func (s *Storer) newAofWCloseObserver(w *AofWriter, ds *dataSet) func(args ...in
 }
 
 func (s *Storer) initDataSet() *dataSet {
-	dir := s.dir
+	rdb, aofSegs, err := scanDir(s.dir, s.logger)
+	if err != nil {
+		s.logger.Errorf("%v", err)
+		return nil
+	}
+
+	if s.tier != nil {
+		rdb, aofSegs = s.mergeRemote(s.runId, rdb, aofSegs)
+	}
+
+	ds := newDataSet(rdb, aofSegs)
+	dRdb, dAofs := ds.TruncateGap()
+	if s.tier != nil {
+		s.deleteRemote(s.runId, dRdb, dAofs)
+	}
+	if dRdb != nil && !dRdb.evicted.Load() {
+		opath := rdbFilePath(s.dir, dRdb.Left(), dRdb.Size())
+		err := os.Remove(opath)
+		if err != nil {
+			s.logger.Errorf("remove rdb file : rdb(%s), error(%v)", opath, err)
+		} else {
+			s.logger.Infof("remove rdb file : rdb(%s)", opath)
+		}
+	}
+	for _, a := range dAofs {
+		if a.evicted.Load() {
+			continue
+		}
+		opath := aofFilePath(s.dir, a.Left())
+		err := os.Remove(opath)
+		if err != nil {
+			s.logger.Errorf("remove aof file : aof(%s), error(%v)", opath, err)
+		} else {
+			s.logger.Infof("remove aof file : aof(%s)", opath)
+		}
+	}
+
+	return ds
+}
+
+// scanDir loads rdb and aof files of $baseDir/$runId
+func scanDir(dir string, logger log.Logger) (*dataSetRdb, []*dataSetAof, error) {
 	// template variable needn't mutex
 	aofSegs := []*dataSetAof{}
 	var rdb *dataSetRdb
@@ -472,13 +634,19 @@ func (s *Storer) initDataSet() *dataSet {
 				fn := strings.TrimSuffix(info.Name(), ".aof")
 				ofs, err := strconv.ParseInt(fn, 10, 64)
 				if err != nil {
-					s.logger.Errorf("wrong aof file : name(%s)", info.Name())
+					logger.Errorf("wrong aof file : name(%s)", info.Name())
+					return nil
+				}
+				size, err := aofDataSize(path, info.Size())
+				if err != nil {
+					logger.Errorf("read aof file : name(%s), error(%v)", info.Name(), err)
 					return nil
 				}
 				a := &dataSetAof{
 					left: ofs,
-					size: info.Size() - headerSize,
+					size: size,
 				}
+				a.touch(info.ModTime())
 				if a.size > 0 { // size must greater than zero
 					a.rtSize.Store(a.size)
 					aofSegs = append(aofSegs, a)
@@ -490,38 +658,13 @@ func (s *Storer) initDataSet() *dataSet {
 						left:    rf.offset,
 						rdbSize: rf.size,
 					}
+					rdb.touch(info.ModTime())
 				}
 			}
 		}
 		return nil
 	})
-	if err != nil {
-		s.logger.Errorf("%v", err)
-		return nil
-	}
-
-	ds := newDataSet(rdb, aofSegs)
-	dRdb, dAofs := ds.TruncateGap()
-	if dRdb != nil {
-		opath := rdbFilePath(s.dir, dRdb.Left(), dRdb.Size())
-		err := os.Remove(opath)
-		if err != nil {
-			s.logger.Errorf("remove rdb file : rdb(%s), error(%v)", opath, err)
-		} else {
-			s.logger.Infof("remove rdb file : rdb(%s)", opath)
-		}
-	}
-	for _, a := range dAofs {
-		opath := aofFilePath(s.dir, a.Left())
-		err := os.Remove(opath)
-		if err != nil {
-			s.logger.Errorf("remove aof file : aof(%s), error(%v)", opath, err)
-		} else {
-			s.logger.Infof("remove aof file : aof(%s)", opath)
-		}
-	}
-
-	return ds
+	return rdb, aofSegs, err
 }
 
 func (s *Storer) gcLogJob() {
@@ -538,7 +681,10 @@ func (s *Storer) gcLogJob() {
 }
 
 func (s *Storer) gcLog() {
-	if s.maxSize <= 0 {
+	defer s.updateTimeReach()
+
+	if s.tier != nil {
+		s.gcTiers()
 		return
 	}
 
@@ -566,8 +712,13 @@ func (s *Storer) gcLog() {
 // }
 
 func (s *Storer) gcDataSet() {
+	limit := s.retention.limit(s.maxSize, time.Now())
+	if !limit.enabled() {
+		return
+	}
+
 	s.mux.Lock()
 	defer s.mux.Unlock()
 
-	s.getDataSet().gcLogs(s.dir, s.maxSize)
+	s.getDataSet().gcLogs(s.dir, limit)
 }
@@ -1,8 +1,12 @@
 package store
 
 import (
+	"context"
+	"io"
 	"testing"
+	"time"
 
+	"github.com/mgtv-tech/redis-GunYu/config"
 	"github.com/mgtv-tech/redis-GunYu/pkg/log"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
@@ -108,4 +112,97 @@ func TestGcLog(t *testing.T) {
 		assert.Equal(t, int64(3), storer.dataSet.aofSegs[0].left)
 	})
 
+	// [0, 2] ([2,3]...[9,10]), modification time of [x, x+1] is now-(10-x)h
+	makeAgedStorer := func(max int64, retention Retention) *Storer {
+		storer := makeStorer(max, 10)
+		now := time.Now()
+		storer.retention = retention
+		storer.dataSet.rdb.touch(now.Add(-10 * time.Hour))
+		for _, aof := range storer.dataSet.aofSegs {
+			aof.touch(now.Add(-time.Duration(10-aof.left) * time.Hour))
+		}
+		return storer
+	}
+
+	t.Run("max age", func(t *testing.T) {
+		storer := makeAgedStorer(-1, Retention{MaxAge: 4*time.Hour + time.Minute})
+		storer.gcDataSet()
+		assert.Nil(t, storer.dataSet.rdb)
+		assert.Equal(t, int64(6), storer.dataSet.aofSegs[0].left)
+	})
+
+	t.Run("strict", func(t *testing.T) {
+		storer := makeAgedStorer(3, Retention{MaxAge: 4*time.Hour + time.Minute})
+		storer.gcDataSet()
+		assert.Equal(t, int64(7), storer.dataSet.aofSegs[0].left)
+
+		storer = makeAgedStorer(6, Retention{MaxAge: 4*time.Hour + time.Minute})
+		storer.gcDataSet()
+		assert.Equal(t, int64(6), storer.dataSet.aofSegs[0].left)
+	})
+
+	t.Run("loose", func(t *testing.T) {
+		storer := makeAgedStorer(3, Retention{MaxAge: 4*time.Hour + time.Minute, Loose: true})
+		storer.gcDataSet()
+		assert.Equal(t, int64(6), storer.dataSet.aofSegs[0].left)
+
+		storer = makeAgedStorer(6, Retention{MaxAge: 4*time.Hour + time.Minute, Loose: true})
+		storer.gcDataSet()
+		assert.Equal(t, int64(4), storer.dataSet.aofSegs[0].left)
+		assert.InDelta(t, (6 * time.Hour).Seconds(), storer.TimeReach().Seconds(), 1)
+	})
+}
+
+func TestTimeReach(t *testing.T) {
+	storer := &Storer{dataSet: newDataSet(nil, nil)}
+	assert.Equal(t, time.Duration(0), storer.TimeReach())
+
+	storer.dataSet = testMakeDataSet(0, 10)
+	storer.dataSet.rdb.touch(time.Now().Add(-time.Hour))
+	assert.InDelta(t, time.Hour.Seconds(), storer.TimeReach().Seconds(), 1)
+
+	storer.dataSet.rdb = nil
+	storer.dataSet.aofSegs[0].touch(time.Now().Add(-time.Minute))
+	assert.InDelta(t, time.Minute.Seconds(), storer.TimeReach().Seconds(), 1)
+}
+
+func TestWaitOffset(t *testing.T) {
+	storer := NewStorer("1", t.TempDir(), -1, 100, config.FlushPolicy{}, nil, nil, Retention{})
+	defer storer.Close()
+	assert.Nil(t, storer.SetRunId("run1"))
+
+	// no data or run id is changed
+	assert.Nil(t, storer.WaitOffset(context.Background(), "run1", 10))
+	assert.Nil(t, storer.WaitOffset(context.Background(), "run2", 10))
+
+	r, w := io.Pipe()
+	defer w.Close()
+	aw, err := storer.GetAofWritter(r, 0)
+	assert.Nil(t, err)
+	aw.Start()
+	defer aw.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, storer.WaitOffset(ctx, "run1", 5), context.DeadlineExceeded)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- storer.WaitOffset(context.Background(), "run1", 5)
+	}()
+	_, err = w.Write([]byte("abc"))
+	assert.Nil(t, err)
+	select {
+	case <-done:
+		t.Fatal("offset isn't written")
+	case <-time.After(50 * time.Millisecond):
+	}
+	_, err = w.Write([]byte("de"))
+	assert.Nil(t, err)
+	select {
+	case err = <-done:
+		assert.Nil(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("wait offset is blocked")
+	}
 }
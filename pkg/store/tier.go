@@ -0,0 +1,354 @@
+package store
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mgtv-tech/redis-GunYu/config"
+	"github.com/mgtv-tech/redis-GunYu/pkg/metric"
+	usync "github.com/mgtv-tech/redis-GunYu/pkg/sync"
+)
+
+// RemoteTier offloads sealed rdb and aof files to backend.
+// local files are evicted if local size exceeds storer.maxSize and they have been uploaded,
+// evicted files are fetched from backend on demand.
+// files are removed from both tiers if they exceed MaxSize and retention of storer
+type RemoteTier struct {
+	Backend Backend
+	MaxSize int64 // -1 is unlimited
+}
+
+var (
+	remoteUploadCounter = metric.NewCounterVec(metric.CounterVecOpts{
+		Namespace: config.AppName,
+		Subsystem: "storer",
+		Name:      "remote_upload",
+		Labels:    []string{"input"},
+	})
+	remoteFetchCounter = metric.NewCounterVec(metric.CounterVecOpts{
+		Namespace: config.AppName,
+		Subsystem: "storer",
+		Name:      "remote_fetch",
+		Labels:    []string{"input"},
+	})
+)
+
+func (s *Storer) gcTiers() {
+	s.offload()
+
+	s.mux.Lock()
+	runId := s.runId
+	ds := s.getDataSet()
+	var gcRdb *dataSetRdb
+	var gcAofs []*dataSetAof
+	if limit := s.retention.limit(s.tier.MaxSize, time.Now()); limit.enabled() {
+		gcRdb, gcAofs = ds.gcLogs(s.dir, limit)
+	}
+	if s.maxSize > 0 {
+		ds.evictLogs(s.dir, s.maxSize)
+	}
+	s.mux.Unlock()
+
+	s.deleteRemote(runId, gcRdb, gcAofs)
+}
+
+// offload uploads sealed files which haven't been uploaded
+func (s *Storer) offload() {
+	s.mux.RLock()
+	runId := s.runId
+	dir := s.dir
+	ds := s.getDataSet()
+	s.mux.RUnlock()
+	if runId == "" {
+		return
+	}
+
+	if rdb := ds.GetRdb(); rdb != nil && !rdb.remote.Load() && !rdb.evicted.Load() {
+		path := rdbFilePath(dir, rdb.Left(), rdb.Size())
+		if fileExist(path) { // rdb file is renamed from *.rdb.tmp when it is completed
+			name := rdbObjectName(runId, rdb.Left(), rdb.Size())
+			if s.upload(name, path) {
+				if s.getDataSet() == ds && ds.GetRdb() == rdb {
+					rdb.remote.Store(true)
+				} else {
+					s.deleteObjects([]string{name})
+				}
+			}
+		}
+	}
+
+	ds.mux.RLock()
+	aofs := make([]*dataSetAof, len(ds.aofSegs))
+	copy(aofs, ds.aofSegs)
+	ds.mux.RUnlock()
+
+	for _, aof := range aofs {
+		size := aof.Size()
+		if size <= 0 || aof.remote.Load() || aof.evicted.Load() { // writing
+			continue
+		}
+		name := aofObjectName(runId, aof.Left(), size)
+		if !s.upload(name, aofFilePath(dir, aof.Left())) {
+			break
+		}
+		if s.getDataSet() == ds && ds.FindAof(aof.Left()) == aof {
+			aof.remote.Store(true)
+		} else {
+			s.deleteObjects([]string{name})
+		}
+	}
+}
+
+func (s *Storer) upload(name string, path string) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		s.logger.Errorf("upload file : file(%s), error(%v)", path, err)
+		return false
+	}
+	defer file.Close()
+	fi, err := file.Stat()
+	if err == nil {
+		err = s.tier.Backend.Put(s.closer.Context(), name, file, fi.Size())
+	}
+	if err != nil {
+		s.logger.Errorf("upload file : file(%s), object(%s), error(%v)", path, name, err)
+		return false
+	}
+	remoteUploadCounter.Add(float64(fi.Size()), s.Id)
+	s.logger.Infof("upload file : file(%s), object(%s), size(%d)", path, name, fi.Size())
+	return true
+}
+
+// fetch downloads aof file if it has been evicted, dir is $baseDir/$runId
+func (s *Storer) fetch(dir string, left int64) error {
+	if s.tier == nil || fileExist(aofFilePath(dir, left)) {
+		return nil
+	}
+	return s.fetchAof(dir, s.getDataSet().FindAof(left))
+}
+
+func (s *Storer) fetchAof(dir string, aof *dataSetAof) error {
+	if s.tier == nil || aof == nil || !aof.evicted.Load() {
+		return nil
+	}
+	err := s.download(aofObjectName(filepath.Base(dir), aof.Left(), aof.Size()), aofFilePath(dir, aof.Left()), aof.ModTime())
+	if err == nil {
+		aof.evicted.Store(false)
+	}
+	return err
+}
+
+func (s *Storer) fetchRdb(dir string, rdb *dataSetRdb) error {
+	if s.tier == nil || !rdb.evicted.Load() {
+		return nil
+	}
+	err := s.download(rdbObjectName(filepath.Base(dir), rdb.Left(), rdb.Size()), rdbFilePath(dir, rdb.Left(), rdb.Size()), rdb.ModTime())
+	if err == nil {
+		rdb.evicted.Store(false)
+	}
+	return err
+}
+
+// download fetches object to path, and restores the modification time for retention
+func (s *Storer) download(name string, path string, modTime time.Time) error {
+	s.fetchMux.Lock()
+	defer s.fetchMux.Unlock()
+
+	if fileExist(path) {
+		return nil
+	}
+
+	body, err := s.tier.Backend.Get(s.closer.Context(), name)
+	if err != nil {
+		s.logger.Errorf("fetch file : object(%s), error(%v)", name, err)
+		return err
+	}
+	defer body.Close()
+
+	tmp := path + ".fetch"
+	file, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0777)
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(file, body)
+	err = errors.Join(err, file.Sync(), file.Close())
+	if err == nil {
+		err = os.Chtimes(tmp, modTime, modTime)
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		s.logger.Errorf("fetch file : object(%s), file(%s), error(%v)", name, path, err)
+		return err
+	}
+	remoteFetchCounter.Add(float64(n), s.Id)
+	s.logger.Infof("fetch file : object(%s), file(%s), size(%d)", name, path, n)
+	return nil
+}
+
+func (s *Storer) deleteRemote(runId string, rdb *dataSetRdb, aofs []*dataSetAof) {
+	names := []string{}
+	if rdb != nil && rdb.remote.Load() {
+		names = append(names, rdbObjectName(runId, rdb.Left(), rdb.Size()))
+	}
+	for _, aof := range aofs {
+		if aof.remote.Load() {
+			names = append(names, aofObjectName(runId, aof.Left(), aof.Size()))
+		}
+	}
+	s.deleteObjects(names)
+}
+
+func (s *Storer) deleteObjects(names []string) {
+	for _, name := range names {
+		if err := s.tier.Backend.Delete(s.closer.Context(), name); err != nil {
+			s.logger.Errorf("delete object : object(%s), error(%v)", name, err)
+		} else {
+			s.logger.Infof("delete object : object(%s)", name)
+		}
+	}
+}
+
+func (s *Storer) listRemote(runId string) ([]remoteObject, error) {
+	objs, err := s.tier.Backend.List(s.closer.Context(), runId+"/")
+	if err != nil {
+		return nil, err
+	}
+	ros := []remoteObject{}
+	for _, obj := range objs {
+		ro, ok := parseObjectName(strings.TrimPrefix(obj.Name, runId+"/"))
+		if !ok {
+			continue
+		}
+		ro.name = obj.Name
+		ro.modTime = obj.ModTime
+		ros = append(ros, ro)
+	}
+	return ros, nil
+}
+
+func (s *Storer) existRemote(runId string) bool {
+	if s.tier == nil {
+		return false
+	}
+	ros, err := s.listRemote(runId)
+	if err != nil {
+		s.logger.Errorf("list remote files : runId(%s), error(%v)", runId, err)
+		return false
+	}
+	return len(ros) > 0
+}
+
+// mergeRemote adds files which are only in remote tier,
+// rdb and aofs are local files
+func (s *Storer) mergeRemote(runId string, rdb *dataSetRdb, aofs []*dataSetAof) (*dataSetRdb, []*dataSetAof) {
+	ros, err := s.listRemote(runId)
+	if err != nil {
+		s.logger.Errorf("list remote files : runId(%s), error(%v)", runId, err)
+		return rdb, aofs
+	}
+
+	locals := make(map[int64]*dataSetAof)
+	for _, a := range aofs {
+		locals[a.left] = a
+	}
+	stale := []string{}
+	var rdbObj *remoteObject
+
+	for i, ro := range ros {
+		if ro.rdb {
+			if rdb != nil {
+				if rdb.left == ro.offset && rdb.rdbSize == ro.size {
+					rdb.remote.Store(true)
+				} else {
+					stale = append(stale, ro.name)
+				}
+				continue
+			}
+			if rdbObj == nil || rdbObj.offset < ro.offset {
+				if rdbObj != nil {
+					stale = append(stale, rdbObj.name)
+				}
+				rdbObj = &ros[i]
+			} else {
+				stale = append(stale, ro.name)
+			}
+			continue
+		}
+
+		if a, ok := locals[ro.offset]; ok {
+			if a.size == ro.size {
+				a.remote.Store(true)
+			} else {
+				stale = append(stale, ro.name)
+			}
+			continue
+		}
+		a := &dataSetAof{
+			left: ro.offset,
+			size: ro.size,
+		}
+		a.rtSize.Store(ro.size)
+		a.touch(ro.modTime)
+		a.remote.Store(true)
+		a.evicted.Store(true)
+		aofs = append(aofs, a)
+	}
+
+	if rdbObj != nil {
+		rdb = &dataSetRdb{
+			left:    rdbObj.offset,
+			rdbSize: rdbObj.size,
+		}
+		rdb.touch(rdbObj.modTime)
+		rdb.remote.Store(true)
+		rdb.evicted.Store(true)
+	}
+
+	s.deleteObjects(stale)
+	return rdb, aofs
+}
+
+// renameRemote moves remote files of old run id to new run id
+func (s *Storer) renameRemote(old string, new string) {
+	if s.tier == nil {
+		return
+	}
+	ros, err := s.listRemote(old)
+	if err != nil {
+		s.logger.Errorf("list remote files : runId(%s), error(%v)", old, err)
+		return
+	}
+	for _, ro := range ros {
+		dst := new + strings.TrimPrefix(ro.name, old)
+		if err := s.tier.Backend.Copy(s.closer.Context(), ro.name, dst); err != nil {
+			s.logger.Errorf("copy object : src(%s), dst(%s), error(%v)", ro.name, dst, err)
+			continue
+		}
+		s.deleteObjects([]string{ro.name})
+	}
+}
+
+func (s *Storer) delRemoteRunId(runId string) {
+	if s.tier == nil {
+		return
+	}
+	usync.SafeGo(func() {
+		ros, err := s.listRemote(runId)
+		if err != nil {
+			s.logger.Errorf("list remote files : runId(%s), error(%v)", runId, err)
+			return
+		}
+		names := make([]string, 0, len(ros))
+		for _, ro := range ros {
+			names = append(names, ro.name)
+		}
+		s.deleteObjects(names)
+	}, nil)
+}
@@ -0,0 +1,190 @@
+package store
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mgtv-tech/redis-GunYu/config"
+	usync "github.com/mgtv-tech/redis-GunYu/pkg/sync"
+	"github.com/stretchr/testify/suite"
+)
+
+func TestTierSuite(t *testing.T) {
+	suite.Run(t, new(tierTestSuite))
+}
+
+type tierTestSuite struct {
+	suite.Suite
+	tempDir string
+	fs      *fakeS3
+	closeFs func()
+	tier    *RemoteTier
+}
+
+const (
+	tierRunId    = "run1"
+	tierSegment  = "abcdefghijklmnop"
+	tierSegments = 3
+)
+
+func (ts *tierTestSuite) SetupTest() {
+	ts.tempDir = ts.T().TempDir()
+	fs, server := newFakeS3("bucket")
+	ts.fs = fs
+	ts.closeFs = server.Close
+	ts.tier = &RemoteTier{
+		Backend: newTestS3Backend(ts.T(), server.URL, ""),
+		MaxSize: 1000,
+	}
+
+	// 3 sealed aof files : 0.aof, 16.aof, 32.aof
+	dir := filepath.Join(ts.tempDir, tierRunId)
+	ts.Nil(os.MkdirAll(dir, 0777))
+	writer, err := NewAofRotater("1", dir, 0, 10, config.FlushPolicy{}, nil)
+	ts.Nil(err)
+	for i := 0; i < tierSegments; i++ {
+		ts.Nil(writer.write([]byte(tierSegment)))
+	}
+	ts.Nil(writer.close())
+}
+
+func (ts *tierTestSuite) TearDownTest() {
+	ts.closeFs()
+}
+
+func (ts *tierTestSuite) newStorer(maxSize int64) *Storer {
+	storer := NewStorer("1", ts.tempDir, maxSize, 10, config.FlushPolicy{}, nil, ts.tier, Retention{})
+	ts.Nil(storer.SetRunId(tierRunId))
+	return storer
+}
+
+func (ts *tierTestSuite) localAof(left int64) bool {
+	return fileExist(aofFilePath(filepath.Join(ts.tempDir, tierRunId), left))
+}
+
+func (ts *tierTestSuite) TestOffloadAndFetch() {
+	storer := ts.newStorer(20)
+	defer storer.Close()
+
+	storer.gcLog()
+	ts.Equal([]string{"run1/0_16.aof", "run1/16_16.aof", "run1/32_16.aof"}, ts.fs.names())
+	ts.False(ts.localAof(0))
+	ts.False(ts.localAof(16))
+	ts.True(ts.localAof(32))
+
+	left, right := storer.GetOffsetRange()
+	ts.Equal(int64(0), left)
+	ts.Equal(int64(48), right)
+
+	// evicted files are fetched by reader
+	rd, err := storer.GetReader(8, false)
+	ts.Nil(err)
+	wait := usync.NewWaitCloser(nil)
+	rd.Start(wait)
+	buf := make([]byte, 40)
+	_, err = io.ReadFull(rd.IoReader(), buf)
+	ts.Nil(err)
+	ts.Equal(tierSegment[8:]+tierSegment+tierSegment, string(buf))
+	wait.Close(nil)
+	rd.Close()
+	ts.True(ts.localAof(0))
+	ts.True(ts.localAof(16))
+}
+
+// blockedBackend blocks downloads until unblock is closed
+type blockedBackend struct {
+	Backend
+	getting chan struct{}
+	unblock chan struct{}
+}
+
+func (bb *blockedBackend) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	bb.getting <- struct{}{}
+	<-bb.unblock
+	return bb.Backend.Get(ctx, name)
+}
+
+func (ts *tierTestSuite) TestFetchWithoutLock() {
+	bb := &blockedBackend{Backend: ts.tier.Backend, getting: make(chan struct{}), unblock: make(chan struct{})}
+	ts.tier.Backend = bb
+	storer := ts.newStorer(20)
+	defer storer.Close()
+	storer.gcLog()
+	ts.False(ts.localAof(0))
+
+	errCh := make(chan error, 1)
+	go func() {
+		rd, err := storer.GetReader(8, false)
+		if err == nil {
+			rd.Close()
+		}
+		errCh <- err
+	}()
+	<-bb.getting
+
+	// storer isn't locked while downloading, and the file isn't removed by gc
+	ts.True(storer.mux.TryLock())
+	storer.mux.Unlock()
+	ts.True(storer.dataSetMux.TryLock())
+	storer.dataSetMux.Unlock()
+	storer.gcLog()
+	left, _ := storer.GetOffsetRange()
+	ts.Equal(int64(0), left)
+
+	close(bb.unblock)
+	ts.Nil(<-errCh)
+	ts.True(ts.localAof(0))
+}
+
+func (ts *tierTestSuite) TestRecover() {
+	storer := ts.newStorer(20)
+	storer.gcLog()
+	storer.Close()
+
+	// local files are lost
+	ts.Nil(os.RemoveAll(ts.tempDir))
+
+	storer = NewStorer("1", ts.tempDir, 20, 10, config.FlushPolicy{}, nil, ts.tier, Retention{})
+	defer storer.Close()
+	offset, err := storer.VerifyRunId([]string{tierRunId})
+	ts.Nil(err)
+	ts.Equal(int64(48), offset)
+	left, _ := storer.GetOffsetRange()
+	ts.Equal(int64(0), left)
+
+	rd, err := storer.GetReader(0, false)
+	ts.Nil(err)
+	rd.Close()
+	ts.True(ts.localAof(0))
+}
+
+func (ts *tierTestSuite) TestRemoteGc() {
+	ts.tier.MaxSize = 40
+	storer := ts.newStorer(20)
+	defer storer.Close()
+
+	storer.gcLog()
+	ts.Equal([]string{"run1/16_16.aof", "run1/32_16.aof"}, ts.fs.names())
+	left, right := storer.GetOffsetRange()
+	ts.Equal(int64(16), left)
+	ts.Equal(int64(48), right)
+	ts.False(ts.localAof(0))
+}
+
+func (ts *tierTestSuite) TestRenameAndDelete() {
+	storer := ts.newStorer(20)
+	defer storer.Close()
+	storer.gcLog()
+
+	ts.Nil(storer.SetRunId("run2"))
+	ts.Equal([]string{"run2/0_16.aof", "run2/16_16.aof", "run2/32_16.aof"}, ts.fs.names())
+
+	ts.Nil(storer.DelRunId("run2"))
+	ts.Eventually(func() bool {
+		return len(ts.fs.names()) == 0
+	}, time.Second, 10*time.Millisecond)
+}
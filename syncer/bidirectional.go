@@ -0,0 +1,132 @@
+package syncer
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/mgtv-tech/redis-GunYu/config"
+	"github.com/mgtv-tech/redis-GunYu/pkg/rdb"
+	"github.com/mgtv-tech/redis-GunYu/pkg/rdbrestore"
+	"github.com/mgtv-tech/redis-GunYu/pkg/redis/client/common"
+	"github.com/mgtv-tech/redis-GunYu/pkg/util"
+)
+
+// In bidirectional mode, every transaction written by the syncer begins with a marker command,
+// which sets the marker key. The peer syncer replicates the output to the input of this syncer,
+// so transactions beginning with the marker are skipped to avoid echoing writes forever.
+// The marker key has the prefix of checkpoints, so it's filtered out like checkpoints.
+// For a cluster, the marker key is in slots of the shard like checkpoints, so it's written in transactions of the shard.
+const (
+	BidirectionalMarkerKey = config.CheckpointKey + "-bidirectional"
+	bidirectionalMarkerTtl = time.Hour
+)
+
+// bidirectionalMarkerKey returns the marker key of an output, it's empty if no key is in slots of the cluster
+func bidirectionalMarkerKey(redisCfg config.RedisConfig) string {
+	if redisCfg.IsCluster() {
+		return choseKeyInSlots(BidirectionalMarkerKey, redisCfg.GetAllSlots())
+	}
+	return BidirectionalMarkerKey
+}
+
+// isBidirectionalMarker returns true if the command is a marker command, marker keys of shards share the prefix
+func isBidirectionalMarker(cmd string, args [][]byte) bool {
+	return cmd == "set" && len(args) > 0 && bytes.HasPrefix(args[0], []byte(BidirectionalMarkerKey))
+}
+
+// PutMarker puts the marker command after multi, so the peer syncer skips the transaction
+func PutMarker(batcher common.CmdBatcher, key string, runId string) {
+	batcher.Put("set", key, runId, "PX", bidirectionalMarkerTtl.Milliseconds())
+}
+
+// peerFilter skips transactions written by the peer syncer, a nil filter skips nothing
+type peerFilter struct {
+	afterMulti bool // the previous command is multi
+	skipping   bool // in a transaction of the peer
+}
+
+func (ro *RedisOutput) newPeerFilter() *peerFilter {
+	if !ro.cfg.Bidirectional {
+		return nil
+	}
+	return &peerFilter{}
+}
+
+// Skip returns true if the command is written by the peer,
+// multi and exec of the transaction are kept, so the transaction is replayed as an empty one,
+// and select is kept to track the db of following commands
+func (pf *peerFilter) Skip(cmd string, args [][]byte) bool {
+	if pf == nil {
+		return false
+	}
+	if pf.skipping {
+		switch cmd {
+		case "exec":
+			pf.skipping = false
+			return false
+		case "select":
+			return false
+		}
+		return true
+	}
+	if pf.afterMulti && isBidirectionalMarker(cmd, args) {
+		pf.afterMulti = false
+		pf.skipping = true
+		return true
+	}
+	pf.afterMulti = cmd == "multi"
+	return false
+}
+
+// replayTagged replays e in a transaction beginning with the marker,
+// the existing key is replaced since the last writer wins
+func (rr *rdbReplayer) replayTagged(e *rdb.BinEntry) (err error) {
+	defer util.Xrecover(&err, rdbrestore.ErrRestoreRdb)
+
+	if rr.replay.ReplaceHashTag {
+		e.Key = bytes.Replace(e.Key, []byte("{"), []byte(""), 1)
+		e.Key = bytes.Replace(e.Key, []byte("}"), []byte(""), 1)
+	}
+	ot := e.ObjectParser.Type()
+	isKey := ot != rdb.RdbObjectFunction && ot != rdb.RdbObjectAux
+
+	batcher := rr.cli.NewBatcher(false)
+	batcher.Put("multi")
+	PutMarker(batcher, rr.ro.cfg.MarkerKey, rr.ro.cfg.RunId)
+
+	if isKey && rr.replay.EnableRestore && e.CanRestore() && !e.ObjectParser.IsSplited() &&
+		e.ObjectParser.ValueDumpSize() <= rr.replay.MaxProtoBulkLen {
+		batcher.Put("restore", e.Key, 0, e.DumpValue(), "REPLACE")
+	} else {
+		if isKey && e.FirstBin() {
+			batcher.Put("del", e.Key)
+		}
+		e.ExecCmd(func(cmd string, args ...interface{}) error {
+			return batcher.Put(cmd, args...)
+		})
+	}
+	if isKey && e.ExpireAt != 0 {
+		batcher.Put("pexpireat", e.Key, e.ExpireAt)
+	}
+	batcher.Put("exec")
+
+	rets, err := batcher.Exec()
+	if err != nil {
+		return err
+	}
+	return rr.ro.checkReplies(rets)
+}
+
+// delTagged deletes key in a transaction beginning with the marker
+func (rr *rdbReplayer) delTagged(key []byte) error {
+	batcher := rr.cli.NewBatcher(false)
+	batcher.Put("multi")
+	PutMarker(batcher, rr.ro.cfg.MarkerKey, rr.ro.cfg.RunId)
+	batcher.Put("del", key)
+	batcher.Put("exec")
+	rets, err := batcher.Exec()
+	if err != nil {
+		return err
+	}
+	return rr.ro.checkReplies(rets)
+}
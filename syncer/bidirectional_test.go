@@ -0,0 +1,80 @@
+package syncer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mgtv-tech/redis-GunYu/config"
+	"github.com/mgtv-tech/redis-GunYu/pkg/redis"
+)
+
+func TestBidirectionalMarker(t *testing.T) {
+	assert.True(t, isBidirectionalMarker("set", splitArgs(BidirectionalMarkerKey+" id PXAT 10")))
+	assert.False(t, isBidirectionalMarker("del", splitArgs(BidirectionalMarkerKey)))
+	assert.True(t, isBidirectionalMarker("set", splitArgs(BidirectionalMarkerKey+"-a v"))) // marker of a shard
+	assert.False(t, isBidirectionalMarker("set", splitArgs(config.CheckpointKey+" v")))
+	assert.False(t, isBidirectionalMarker("set", splitArgs("k v")))
+}
+
+func TestPeerFilter(t *testing.T) {
+	ro := &RedisOutput{}
+	assert.Nil(t, ro.newPeerFilter())
+	var pf *peerFilter
+	assert.False(t, pf.Skip("set", splitArgs(BidirectionalMarkerKey+" id")))
+
+	ro.cfg.Bidirectional = true
+	pf = ro.newPeerFilter()
+	cmds := []struct {
+		cmd  string
+		args string
+		skip bool
+	}{
+		{"set", "k v", false},
+		{"set", BidirectionalMarkerKey + " id", false}, // not in a transaction
+		{"multi", "", false},
+		{"set", BidirectionalMarkerKey + " id PXAT 10", true},
+		{"set", "k v", true},
+		{"select", "1", false},
+		{"del", "k", true},
+		{"exec", "", false},
+		{"set", "k v", false},
+		{"multi", "", false},
+		{"set", "k v", false},
+		{"set", BidirectionalMarkerKey + " id", false},
+		{"exec", "", false},
+	}
+	for i, c := range cmds {
+		assert.Equal(t, c.skip, pf.Skip(c.cmd, splitArgs(c.args)), i)
+	}
+}
+
+func TestBidirectionalMarkerKey(t *testing.T) {
+	assert.Equal(t, BidirectionalMarkerKey, bidirectionalMarkerKey(config.RedisConfig{Type: config.RedisTypeStandalone}))
+
+	// every shard of a cluster has its own marker key in its slots
+	shardKey := func(left, right int) string {
+		redisCfg := config.RedisConfig{Type: config.RedisTypeCluster, ClusterOptions: &config.RedisClusterOptions{}}
+		redisCfg.SetClusterShards([]*config.RedisClusterShard{
+			{Master: config.RedisNode{Address: "a"}, Slots: config.RedisSlots{Ranges: []config.RedisSlotRange{{Left: left, Right: right}}}},
+		})
+		key := bidirectionalMarkerKey(redisCfg)
+		slot := int(redis.KeyToSlot(key))
+		assert.True(t, slot >= left && slot <= right, key)
+		assert.True(t, strings.HasPrefix(key, BidirectionalMarkerKey+"-"), key)
+		return key
+	}
+	key1, key2 := shardKey(0, 8191), shardKey(8192, 16383)
+	assert.NotEqual(t, key1, key2)
+
+	ro := &RedisOutput{}
+	ro.cfg.Bidirectional = true
+	for _, key := range []string{key1, key2} {
+		pf := ro.newPeerFilter()
+		assert.False(t, pf.Skip("multi", nil))
+		assert.True(t, pf.Skip("set", splitArgs(key+" id PX 3600000")))
+		assert.True(t, pf.Skip("set", splitArgs("k v")))
+		assert.False(t, pf.Skip("exec", nil))
+	}
+}
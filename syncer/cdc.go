@@ -0,0 +1,733 @@
+package syncer
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/exp/slices"
+
+	"github.com/mgtv-tech/redis-GunYu/config"
+	"github.com/mgtv-tech/redis-GunYu/pkg/filter"
+	"github.com/mgtv-tech/redis-GunYu/pkg/log"
+	"github.com/mgtv-tech/redis-GunYu/pkg/metric"
+	"github.com/mgtv-tech/redis-GunYu/pkg/rdb"
+	"github.com/mgtv-tech/redis-GunYu/pkg/store"
+	usync "github.com/mgtv-tech/redis-GunYu/pkg/sync"
+	"github.com/mgtv-tech/redis-GunYu/pkg/util"
+)
+
+var (
+	cdcEventCounter = metric.NewCounterVec(metric.CounterVecOpts{
+		Namespace: config.AppName,
+		Subsystem: "output",
+		Name:      "cdc_event",
+		Labels:    []string{"input"},
+	})
+)
+
+const (
+	cdcCheckpointFile = "checkpoint.json"
+	cdcEventFileExt   = ".jsonl"
+	cdcPartSuffix     = ".part" // events are being written to the file
+	// commands of rdb entries are converted for the latest redis
+	cdcRedisVersion = "7.4"
+)
+
+// CdcEvent is a replicated command, events converted from rdb entries are snapshot events
+type CdcEvent struct {
+	Source   string   `json:"source"` // address of input
+	RunId    string   `json:"runId"`
+	Offset   int64    `json:"offset"`
+	Db       int      `json:"db"`
+	Command  string   `json:"command"`
+	Keys     []string `json:"keys,omitempty"`
+	Args     []string `json:"args"`
+	Base64   bool     `json:"base64,omitempty"` // keys and args are encoded by base64 if one of them is not utf-8
+	Snapshot bool     `json:"snapshot,omitempty"`
+}
+
+// rawArgs returns keys and arguments without base64 encoding
+func (ev *CdcEvent) rawArgs() (keys [][]byte, args [][]byte, err error) {
+	decode := func(strs []string) ([][]byte, error) {
+		out := make([][]byte, 0, len(strs))
+		for _, str := range strs {
+			if !ev.Base64 {
+				out = append(out, []byte(str))
+				continue
+			}
+			b, err := base64.StdEncoding.DecodeString(str)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, b)
+		}
+		return out, nil
+	}
+	if keys, err = decode(ev.Keys); err != nil {
+		return
+	}
+	args, err = decode(ev.Args)
+	return
+}
+
+type CdcOutputConfig struct {
+	InputName string
+	Source    string
+	Dir       string // checkpoint and event files of this output
+	Cdc       config.CdcConfig
+	// Parser filters, rewrites and parses commands, it never connects to redis
+	Parser RedisOutputConfig
+}
+
+// CdcOutput emits replicated commands as events instead of replaying them,
+// events are written at least once, since events after the checkpoint are emitted again after restarting
+type CdcOutput struct {
+	cfg    CdcOutputConfig
+	logger log.Logger
+	parser *RedisOutput
+
+	sinkMux sync.Mutex
+	sink    cdcSink
+
+	cpGuard         sync.RWMutex
+	checkpointInMem cdcCheckpoint
+
+	ttlDropped []byte // big key skipped by the ttl policy
+}
+
+type cdcCheckpoint struct {
+	RunId   string `json:"runId"`
+	Offset  int64  `json:"offset"`
+	Db      int    `json:"db"`
+	Version string `json:"version"`
+	Mtime   int64  `json:"mtime"`
+}
+
+type cdcSink interface {
+	// Write returns nil if events are persisted, it may be invoked with no events
+	Write(ctx context.Context, events []CdcEvent) error
+	Close() error
+}
+
+// cdcSnapshotSink is implemented by sinks which discard an incomplete snapshot
+type cdcSnapshotSink interface {
+	BeginSnapshot() error
+	EndSnapshot() error
+}
+
+// CdcDir returns the directory of checkpoint and event files of a syncer,
+// inputName is the address of input, or address/name for a named output
+func CdcDir(cfg *config.CdcConfig, inputName string) string {
+	return filepath.Join(cfg.Dir, strings.NewReplacer(":", "_", "/", "_").Replace(inputName))
+}
+
+// DelCdcCheckpoint deletes the checkpoint, input is synced from scratch
+func DelCdcCheckpoint(cfg *config.CdcConfig, inputName string) error {
+	err := os.Remove(filepath.Join(CdcDir(cfg, inputName), cdcCheckpointFile))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func NewCdcOutput(cfg CdcOutputConfig) (*CdcOutput, error) {
+	co := &CdcOutput{
+		cfg:    cfg,
+		logger: log.WithLogger(config.LogModuleName(fmt.Sprintf("[CdcOutput(%s)] ", cfg.InputName))),
+		parser: NewRedisOutput(cfg.Parser),
+	}
+	if err := os.MkdirAll(cfg.Dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	switch {
+	case cfg.Cdc.File != nil:
+		sink, err := newCdcFileSink(cfg.Dir, *cfg.Cdc.File)
+		if err != nil {
+			return nil, err
+		}
+		co.sink = sink
+	case cfg.Cdc.Webhook != nil:
+		co.sink = newCdcWebhookSink(*cfg.Cdc.Webhook)
+	case cfg.Cdc.Archive != nil:
+		sink, err := newCdcArchiveSink(cfg.Dir, *cfg.Cdc.Archive)
+		if err != nil {
+			return nil, err
+		}
+		co.sink = sink
+	default:
+		co.sink = newCdcKafkaSink(*cfg.Cdc.Kafka, cfg.Cdc.BatchSize)
+	}
+	return co, nil
+}
+
+func (co *CdcOutput) Close() {
+	co.sinkMux.Lock()
+	defer co.sinkMux.Unlock()
+	log.LogIfError(co.sink.Close(), "close cdc sink")
+}
+
+func (co *CdcOutput) write(ctx context.Context, events []CdcEvent) error {
+	co.sinkMux.Lock()
+	defer co.sinkMux.Unlock()
+	err := co.sink.Write(ctx, events)
+	if err != nil {
+		co.logger.Errorf("write events error : events(%d), error(%v)", len(events), err)
+		return err
+	}
+	if len(events) > 0 {
+		cdcEventCounter.Add(float64(len(events)), co.cfg.InputName)
+	}
+	return nil
+}
+
+func (co *CdcOutput) snapshot(begin bool) error {
+	co.sinkMux.Lock()
+	defer co.sinkMux.Unlock()
+	ss, ok := co.sink.(cdcSnapshotSink)
+	if !ok {
+		return nil
+	}
+	if begin {
+		return ss.BeginSnapshot()
+	}
+	return ss.EndSnapshot()
+}
+
+func (co *CdcOutput) checkpointPath() string {
+	return filepath.Join(co.cfg.Dir, cdcCheckpointFile)
+}
+
+// loadCheckpoint returns nil if there is no checkpoint
+func (co *CdcOutput) loadCheckpoint() (*cdcCheckpoint, error) {
+	if !co.cfg.Parser.EnableResumeFromBreakPoint {
+		co.cpGuard.RLock()
+		defer co.cpGuard.RUnlock()
+		if co.checkpointInMem.RunId == "" {
+			return nil, nil
+		}
+		cp := co.checkpointInMem
+		return &cp, nil
+	}
+
+	data, err := os.ReadFile(co.checkpointPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	cp := &cdcCheckpoint{}
+	if err = json.Unmarshal(data, cp); err != nil {
+		return nil, fmt.Errorf("parse checkpoint error : path(%s), error(%w)", co.checkpointPath(), err)
+	}
+	return cp, nil
+}
+
+func (co *CdcOutput) saveCheckpoint(cp cdcCheckpoint) error {
+	cp.Version = config.Version
+	cp.Mtime = time.Now().UnixNano()
+	if !co.cfg.Parser.EnableResumeFromBreakPoint {
+		co.cpGuard.Lock()
+		co.checkpointInMem = cp
+		co.cpGuard.Unlock()
+		return nil
+	}
+
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	path := co.checkpointPath()
+	tmp := path + ".tmp"
+	err = func() error {
+		f, err := os.Create(tmp)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if _, err = f.Write(data); err != nil {
+			return err
+		}
+		return f.Sync()
+	}()
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		co.logger.Errorf("set checkpoint error : checkpoint(%v), error(%v)", cp, err)
+	}
+	return err
+}
+
+func (co *CdcOutput) StartPoint(ctx context.Context, runIds []string) (sp StartPoint, err error) {
+	cp, err := co.loadCheckpoint()
+	if err != nil {
+		return sp, err
+	}
+	if cp == nil || !slices.Contains(runIds, cp.RunId) {
+		sp.Initialize()
+		return sp, nil
+	}
+	co.parser.startDbId = cp.Db
+	return StartPoint{
+		DbId:   cp.Db,
+		RunId:  cp.RunId,
+		Offset: cp.Offset,
+	}, nil
+}
+
+// SetRunId moves the checkpoint to run id
+func (co *CdcOutput) SetRunId(ctx context.Context, id string) error {
+	cp, err := co.loadCheckpoint()
+	if err != nil {
+		return err
+	}
+	if cp == nil || cp.RunId == id {
+		return nil
+	}
+	co.logger.Infof("update checkpoint : runId(%s,%s)", id, cp.RunId)
+	cp.RunId = id
+	return co.saveCheckpoint(*cp)
+}
+
+func (co *CdcOutput) Send(ctx context.Context, reader *store.Reader) error {
+	var err error
+	if reader.IsAof() {
+		err = co.sendAof(ctx, reader)
+	} else {
+		err = co.sendRdb(ctx, reader)
+	}
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			err = errors.Join(err, ErrRestart)
+			co.logger.Infof("send done : runId(%s), offset(%d), size(%d)", reader.RunId(), reader.Left(), reader.Size())
+		} else {
+			co.logger.Errorf("send done : runId(%s), offset(%d), size(%d), error(%v)", reader.RunId(), reader.Left(), reader.Size(), err)
+		}
+	}
+	return err
+}
+
+func (co *CdcOutput) newEvent(runId string, offset int64, db int, cmd string, args [][]byte, snapshot bool) CdcEvent {
+	ev := CdcEvent{
+		Source:   co.cfg.Source,
+		RunId:    runId,
+		Offset:   offset,
+		Db:       db,
+		Command:  cmd,
+		Args:     make([]string, 0, len(args)),
+		Snapshot: snapshot,
+	}
+	for _, arg := range args {
+		if !utf8.Valid(arg) {
+			ev.Base64 = true
+			break
+		}
+	}
+	encode := func(b []byte) string {
+		if ev.Base64 {
+			return base64.StdEncoding.EncodeToString(b)
+		}
+		return string(b)
+	}
+	for _, i := range filter.KeyIndexes(cmd, args) {
+		ev.Keys = append(ev.Keys, encode(args[i]))
+	}
+	for _, arg := range args {
+		ev.Args = append(ev.Args, encode(arg))
+	}
+	return ev
+}
+
+func (co *CdcOutput) sendAof(ctx context.Context, reader *store.Reader) error {
+	runId := reader.RunId()
+	co.logger.Infof("send aof : runId(%s), offset(%d), size(%d)", runId, reader.Left(), reader.Size())
+	co.parser.stats(ctx)
+
+	sendBuf := make(chan cmdExecution, co.cfg.Cdc.BatchSize*10)
+	replayQuit := usync.NewWaitCloserFromContext(ctx, nil)
+	usync.SafeGo(func() {
+		err := co.parser.parseAofCommand(replayQuit, reader.IoReader(), reader.Left(), sendBuf)
+		if err != nil {
+			replayQuit.Close(err)
+		}
+	}, func(i interface{}) { replayQuit.Close(fmt.Errorf("panic: %v", i)) })
+
+	err := co.emitCmds(replayQuit, runId, sendBuf)
+	replayQuit.Close(err)
+	return replayQuit.Error()
+}
+
+// emitCmds writes events in batches, and saves the checkpoint after events are written
+func (co *CdcOutput) emitCmds(replayQuit usync.WaitCloser, runId string, sendBuf chan cmdExecution) error {
+	ticker := time.NewTicker(co.cfg.Cdc.BatchTicker)
+	defer ticker.Stop()
+
+	db := 0
+	offset := int64(-1) // offset of the last command, including filtered commands
+	events := make([]CdcEvent, 0, co.cfg.Cdc.BatchSize)
+	flush := func() error {
+		if err := co.write(replayQuit.Context(), events); err != nil {
+			return err
+		}
+		co.parser.sendCounterAdd(uint(len(events)))
+		events = events[:0]
+		if offset < 0 {
+			return nil
+		}
+		err := co.saveCheckpoint(cdcCheckpoint{RunId: runId, Offset: offset, Db: db})
+		offset = -1
+		return err
+	}
+
+	for {
+		select {
+		case <-replayQuit.Done():
+			// events which are not written will be emitted again from the checkpoint
+			return nil
+		case <-ticker.C:
+			if err := flush(); err != nil {
+				return err
+			}
+		case exec := <-sendBuf:
+			offset = exec.Offset
+			switch exec.Cmd {
+			case "ping":
+			case "select":
+				db = exec.Db
+			default:
+				co.parser.absoluteTtl(&exec)
+				args := make([][]byte, 0, len(exec.Args))
+				for _, arg := range exec.Args {
+					args = append(args, arg.([]byte))
+				}
+				events = append(events, co.newEvent(runId, exec.Offset, db, exec.Cmd, args, false))
+				if len(events) >= co.cfg.Cdc.BatchSize {
+					if err := flush(); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+}
+
+func (co *CdcOutput) sendRdb(ctx context.Context, reader *store.Reader) error {
+	runId, offset := reader.RunId(), reader.Left()
+	co.logger.Infof("send rdb : runId(%s), offset(%d), size(%d)", runId, offset, reader.Size())
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	if err := co.snapshot(true); err != nil {
+		return err
+	}
+	var readBytes atomic.Int64
+	pipe := rdb.ParseRdb(reader.IoReader(), &readBytes, config.RdbPipeSize,
+		rdb.WithTargetRedisVersion(cdcRedisVersion), rdb.WithFunctionExists(co.cfg.Parser.FunctionExists))
+	ticker := time.NewTicker(co.cfg.Cdc.BatchTicker)
+	defer ticker.Stop()
+
+	events := make([]CdcEvent, 0, co.cfg.Cdc.BatchSize)
+	flush := func() error {
+		if err := co.write(ctx, events); err != nil {
+			return err
+		}
+		co.parser.rdbSendCounterAdd(uint(len(events)))
+		events = events[:0]
+		return nil
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			if err := flush(); err != nil {
+				return err
+			}
+		case e, ok := <-pipe:
+			if !ok {
+				return errors.Join(ErrCorrupted, errors.New("rdb is incomplete"))
+			}
+			if e.Err != nil {
+				return e.Err
+			}
+			if e.Done {
+				if err := flush(); err != nil {
+					return err
+				}
+				if err := co.snapshot(false); err != nil {
+					return err
+				}
+				co.parser.startDbId = 0
+				co.logger.Infof("send rdb done : runId(%s), offset(%d), read(%d)", runId, offset, readBytes.Load())
+				return co.saveCheckpoint(cdcCheckpoint{RunId: runId, Offset: offset})
+			}
+			evs, err := co.rdbEvents(runId, offset, e)
+			if err != nil {
+				return err
+			}
+			events = append(events, evs...)
+			if len(events) >= co.cfg.Cdc.BatchSize {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+// rdbEvents converts an rdb entry to snapshot events
+func (co *CdcOutput) rdbEvents(runId string, offset int64, e *rdb.BinEntry) (events []CdcEvent, err error) {
+	ot := e.ObjectParser.Type()
+	if ot == rdb.RdbObjectAux {
+		return nil, nil
+	}
+	db := int(e.DB)
+	if ot != rdb.RdbObjectFunction {
+		if co.parser.filterDb(db) || co.parser.filterKey(util.BytesToString(e.Key)) || co.parser.rewriteRdbTtl(e, &co.ttlDropped) {
+			co.parser.rdbFilterCounterAdd(1)
+			return nil, nil
+		}
+		db, _ = co.parser.selectDB(-1, db)
+		e.Key = co.parser.rewriteKey(e.Key)
+	}
+
+	// members of an entry are merged into a full value event, a big key is emitted in events of bins
+	var cmds []cdcCommand
+	defer util.Xrecover(&err, ErrCorrupted)
+	e.ExecCmd(func(cmd string, args ...interface{}) error {
+		cmd = strings.ToLower(cmd)
+		bargs := make([][]byte, 0, len(args))
+		for _, arg := range args {
+			switch v := arg.(type) {
+			case []byte:
+				bargs = append(bargs, v)
+			case string:
+				bargs = append(bargs, []byte(v))
+			default:
+				bargs = append(bargs, []byte(fmt.Sprint(v)))
+			}
+		}
+		if n := len(cmds); n > 0 && cmds[n-1].mergeable(cmd, bargs) {
+			cmds[n-1].args = append(cmds[n-1].args, bargs[1:]...)
+			return nil
+		}
+		cmds = append(cmds, cdcCommand{cmd: cmd, args: bargs})
+		return nil
+	})
+	for _, c := range cmds {
+		events = append(events, co.newEvent(runId, offset, db, c.cmd, c.args, true))
+	}
+	if e.ExpireAt != 0 && e.FirstBin() && ot != rdb.RdbObjectFunction {
+		events = append(events, co.newEvent(runId, offset, db, "pexpireat",
+			[][]byte{e.Key, []byte(fmt.Sprint(e.ExpireAt))}, true))
+	}
+	return events, nil
+}
+
+type cdcCommand struct {
+	cmd  string
+	args [][]byte
+}
+
+// mergeable returns true if members of cmd can be appended to c, the first argument is the key
+func (c *cdcCommand) mergeable(cmd string, args [][]byte) bool {
+	switch cmd {
+	case "hset", "rpush", "sadd", "zadd":
+		return c.cmd == cmd && len(args) > 1 && len(c.args) > 0 && bytes.Equal(c.args[0], args[0])
+	}
+	return false
+}
+
+// cdcFileSink writes events to json lines files, a file is rotated by size and time,
+// the file being written has a .part suffix
+type cdcFileSink struct {
+	dir      string
+	cfg      config.CdcFileConfig
+	file     *os.File
+	size     int64
+	openTime time.Time
+}
+
+func newCdcFileSink(dir string, cfg config.CdcFileConfig) (*cdcFileSink, error) {
+	// files of last run are not closed
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), cdcEventFileExt+cdcPartSuffix) {
+			if err = recoverCdcPart(filepath.Join(dir, entry.Name())); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return &cdcFileSink{dir: dir, cfg: cfg}, nil
+}
+
+// recoverCdcPart removes the incomplete last line and closes the file
+func recoverCdcPart(path string) error {
+	size, err := cdcCompleteSize(path)
+	if err != nil {
+		return err
+	}
+	if size == 0 {
+		return os.Remove(path)
+	}
+	if err = os.Truncate(path, size); err != nil {
+		return err
+	}
+	log.Infof("recover cdc event file : path(%s), size(%d)", path, size)
+	return os.Rename(path, strings.TrimSuffix(path, cdcPartSuffix))
+}
+
+// cdcCompleteSize returns the size of complete lines
+func cdcCompleteSize(path string) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	size := info.Size()
+	buf := make([]byte, 64*1024)
+	for size > 0 {
+		n := int64(len(buf))
+		if n > size {
+			n = size
+		}
+		if _, err = f.ReadAt(buf[:n], size-n); err != nil {
+			return 0, err
+		}
+		if i := bytes.LastIndexByte(buf[:n], '\n'); i >= 0 {
+			return size - n + int64(i) + 1, nil
+		}
+		size -= n
+	}
+	return 0, nil
+}
+
+func (fs *cdcFileSink) Write(ctx context.Context, events []CdcEvent) error {
+	if fs.file != nil && (fs.size >= fs.cfg.MaxSize || time.Since(fs.openTime) >= fs.cfg.RotateInterval) {
+		if err := fs.Close(); err != nil {
+			return err
+		}
+	}
+	if len(events) == 0 {
+		return nil
+	}
+	if fs.file == nil {
+		name := "events-" + time.Now().UTC().Format("20060102150405.000000000") + cdcEventFileExt + cdcPartSuffix
+		file, err := os.OpenFile(filepath.Join(fs.dir, name), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return err
+		}
+		fs.file = file
+		fs.size = 0
+		fs.openTime = time.Now()
+	}
+
+	buf := bytes.Buffer{}
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	for i := range events {
+		if err := enc.Encode(&events[i]); err != nil {
+			return err
+		}
+	}
+	n, err := fs.file.Write(buf.Bytes())
+	if err == nil {
+		err = fs.file.Sync()
+	}
+	if err != nil {
+		// drop the incomplete lines
+		log.LogIfError(fs.file.Truncate(fs.size), "truncate cdc event file")
+		return err
+	}
+	fs.size += int64(n)
+	return nil
+}
+
+func (fs *cdcFileSink) Close() error {
+	if fs.file == nil {
+		return nil
+	}
+	path := fs.file.Name()
+	err := fs.file.Close()
+	fs.file = nil
+	if err != nil {
+		return err
+	}
+	return os.Rename(path, strings.TrimSuffix(path, cdcPartSuffix))
+}
+
+// cdcWebhookSink posts a batch of events as a json array
+type cdcWebhookSink struct {
+	cfg config.CdcWebhookConfig
+	cli *http.Client
+}
+
+func newCdcWebhookSink(cfg config.CdcWebhookConfig) *cdcWebhookSink {
+	return &cdcWebhookSink{
+		cfg: cfg,
+		cli: &http.Client{Timeout: cfg.Timeout},
+	}
+}
+
+func (ws *cdcWebhookSink) Write(ctx context.Context, events []CdcEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+	body, err := json.Marshal(events)
+	if err != nil {
+		return err
+	}
+	return util.RetryLinearJitter(ctx, func() error {
+		return ws.post(ctx, body)
+	}, 3, time.Second, 0.3)
+}
+
+func (ws *cdcWebhookSink) post(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ws.cfg.Url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range ws.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := ws.cli.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook response error : url(%s), status(%s)", ws.cfg.Url, resp.Status)
+	}
+	return nil
+}
+
+func (ws *cdcWebhookSink) Close() error {
+	ws.cli.CloseIdleConnections()
+	return nil
+}
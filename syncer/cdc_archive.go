@@ -0,0 +1,384 @@
+package syncer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mgtv-tech/redis-GunYu/config"
+	"github.com/mgtv-tech/redis-GunYu/pkg/log"
+	"github.com/mgtv-tech/redis-GunYu/pkg/redis/client"
+)
+
+const (
+	cdcArchiveExt      = ".resp"
+	cdcArchiveSnapshot = "snapshot"
+	cdcArchiveAof      = "aof"
+)
+
+// cdcArchiveFile is the name of an archive file : <time>-<kind>-<runId>-<first offset>-<last offset>.resp,
+// the file being written is named <time>-<kind>-<runId>-<first offset>-<last offset>-<size>.resp.part,
+// and it's renamed after every batch, so written batches are recovered after a crash
+type cdcArchiveFile struct {
+	time  string
+	kind  string
+	runId string
+	first int64
+	last  int64
+	size  int64
+	part  bool
+}
+
+func (af cdcArchiveFile) name() string {
+	name := fmt.Sprintf("%s-%s-%s-%d-%d", af.time, af.kind, af.runId, af.first, af.last)
+	if af.part {
+		return fmt.Sprintf("%s-%d%s%s", name, af.size, cdcArchiveExt, cdcPartSuffix)
+	}
+	return name + cdcArchiveExt
+}
+
+func (af cdcArchiveFile) sameSnapshot(o cdcArchiveFile) bool {
+	return af.kind == cdcArchiveSnapshot && o.kind == cdcArchiveSnapshot && af.runId == o.runId && af.first == o.first
+}
+
+func parseCdcArchiveFile(name string) (af cdcArchiveFile, ok bool) {
+	if strings.HasSuffix(name, cdcPartSuffix) {
+		af.part = true
+		name = strings.TrimSuffix(name, cdcPartSuffix)
+	}
+	if !strings.HasSuffix(name, cdcArchiveExt) {
+		return af, false
+	}
+	fields := strings.Split(strings.TrimSuffix(name, cdcArchiveExt), "-")
+	if (af.part && len(fields) != 6) || (!af.part && len(fields) != 5) {
+		return af, false
+	}
+	af.time, af.kind, af.runId = fields[0], fields[1], fields[2]
+	if af.kind != cdcArchiveSnapshot && af.kind != cdcArchiveAof {
+		return af, false
+	}
+	var err error
+	if af.first, err = strconv.ParseInt(fields[3], 10, 64); err != nil {
+		return af, false
+	}
+	if af.last, err = strconv.ParseInt(fields[4], 10, 64); err != nil {
+		return af, false
+	}
+	if af.part {
+		if af.size, err = strconv.ParseInt(fields[5], 10, 64); err != nil {
+			return af, false
+		}
+	}
+	return af, true
+}
+
+// listCdcArchiveFiles returns archive files in the order of time
+func listCdcArchiveFiles(dir string) ([]cdcArchiveFile, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	files := []cdcArchiveFile{}
+	for _, entry := range entries {
+		if af, ok := parseCdcArchiveFile(entry.Name()); ok {
+			files = append(files, af)
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].time < files[j].time })
+	return files, nil
+}
+
+// cdcArchiveSink writes commands to resp files, which can be loaded by redis-cli --pipe.
+// Snapshot files of a full sync are followed by aof files, a select command is written
+// at the beginning of each file, so files can be loaded from any snapshot.
+type cdcArchiveSink struct {
+	dir      string
+	cfg      config.CdcArchiveConfig
+	file     *os.File
+	cur      cdcArchiveFile
+	db       int // db of the last command of the current file
+	openTime time.Time
+
+	// files of a snapshot keep the part suffix until the snapshot is done
+	snapshotParts []cdcArchiveFile
+
+	// commands after the checkpoint are emitted again after a failure, skip the archived ones
+	skipRunId  string
+	skipOffset int64
+}
+
+func newCdcArchiveSink(dir string, cfg config.CdcArchiveConfig) (*cdcArchiveSink, error) {
+	as := &cdcArchiveSink{dir: dir, cfg: cfg}
+	if err := as.recover(); err != nil {
+		return nil, err
+	}
+	files, err := listCdcArchiveFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	if n := len(files); n > 0 && files[n-1].kind == cdcArchiveAof {
+		as.skipRunId, as.skipOffset = files[n-1].runId, files[n-1].last
+	}
+	as.retain()
+	return as, nil
+}
+
+// recover closes files of last run, files of an incomplete snapshot are removed
+func (as *cdcArchiveSink) recover() error {
+	files, err := listCdcArchiveFiles(as.dir)
+	if err != nil {
+		return err
+	}
+	for _, af := range files {
+		if !af.part {
+			continue
+		}
+		path := filepath.Join(as.dir, af.name())
+		if af.kind == cdcArchiveSnapshot || af.size == 0 {
+			log.Infof("remove incomplete archive file : path(%s)", path)
+			if err = os.Remove(path); err != nil {
+				return err
+			}
+			continue
+		}
+		// drop the bytes after the last batch
+		if err = os.Truncate(path, af.size); err != nil {
+			return err
+		}
+		af.part = false
+		log.Infof("recover archive file : path(%s), size(%d)", af.name(), af.size)
+		if err = os.Rename(path, filepath.Join(as.dir, af.name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// retain removes files older than retention, the latest snapshot and files after it are kept
+func (as *cdcArchiveSink) retain() {
+	files, err := listCdcArchiveFiles(as.dir)
+	if err != nil {
+		log.Errorf("list archive files error : dir(%s), error(%v)", as.dir, err)
+		return
+	}
+	keep := len(files)
+	for i := len(files) - 1; i >= 0; i-- {
+		if files[i].kind != cdcArchiveSnapshot {
+			continue
+		}
+		keep = i
+		for keep > 0 && files[keep-1].sameSnapshot(files[i]) {
+			keep--
+		}
+		break
+	}
+	for _, af := range files[:keep] {
+		if af.part {
+			continue
+		}
+		path := filepath.Join(as.dir, af.name())
+		info, err := os.Stat(path)
+		if err != nil || time.Since(info.ModTime()) < as.cfg.Retention {
+			continue
+		}
+		log.Infof("remove expired archive file : path(%s)", path)
+		log.LogIfError(os.Remove(path), "remove archive file")
+	}
+}
+
+func (as *cdcArchiveSink) Write(ctx context.Context, events []CdcEvent) error {
+	for len(events) > 0 {
+		// a file has commands of the same kind and run id
+		n := 1
+		for n < len(events) && events[n].Snapshot == events[0].Snapshot && events[n].RunId == events[0].RunId {
+			n++
+		}
+		if err := as.write(events[:n]); err != nil {
+			return err
+		}
+		events = events[n:]
+	}
+	if as.file != nil && (as.cur.size >= as.cfg.MaxSize || time.Since(as.openTime) >= as.cfg.RotateInterval) {
+		return as.closeFile()
+	}
+	return nil
+}
+
+func (as *cdcArchiveSink) write(events []CdcEvent) error {
+	kind := cdcArchiveAof
+	if events[0].Snapshot {
+		kind = cdcArchiveSnapshot
+		as.skipRunId = ""
+	} else if events[0].RunId == as.skipRunId {
+		for len(events) > 0 && events[0].Offset <= as.skipOffset {
+			events = events[1:]
+		}
+		if len(events) == 0 {
+			return nil
+		}
+	}
+	if kind == cdcArchiveAof && (len(as.snapshotParts) > 0 || (as.file != nil && as.cur.kind == cdcArchiveSnapshot)) {
+		// the snapshot is not done
+		if err := as.discardSnapshot(); err != nil {
+			return err
+		}
+	}
+	if as.file != nil && (as.cur.kind != kind || as.cur.runId != events[0].RunId) {
+		if err := as.closeFile(); err != nil {
+			return err
+		}
+	}
+	if as.file == nil {
+		if err := as.open(kind, &events[0]); err != nil {
+			return err
+		}
+	}
+
+	buf := bytes.Buffer{}
+	w := bufio.NewWriter(&buf)
+	for i := range events {
+		ev := &events[i]
+		_, args, err := ev.rawArgs()
+		if err != nil {
+			return err
+		}
+		if ev.Db != as.db {
+			if err = client.Encode(w, client.NewCommand("select", ev.Db), false); err != nil {
+				return err
+			}
+		}
+		cmdArgs := make([]interface{}, 0, len(args))
+		for _, arg := range args {
+			cmdArgs = append(cmdArgs, arg)
+		}
+		if err = client.Encode(w, client.NewCommand(ev.Command, cmdArgs...), false); err != nil {
+			return err
+		}
+		as.db = ev.Db
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	n, err := as.file.Write(buf.Bytes())
+	if err == nil {
+		err = as.file.Sync()
+	}
+	next := as.cur
+	next.size += int64(n)
+	next.last = events[len(events)-1].Offset
+	if err == nil {
+		err = os.Rename(filepath.Join(as.dir, as.cur.name()), filepath.Join(as.dir, next.name()))
+	}
+	if err != nil {
+		// drop the incomplete commands
+		log.LogIfError(as.file.Truncate(as.cur.size), "truncate archive file")
+		as.db = -1
+		return err
+	}
+	as.cur = next
+	if kind == cdcArchiveAof {
+		as.skipRunId, as.skipOffset = next.runId, next.last
+	}
+	return nil
+}
+
+func (as *cdcArchiveSink) open(kind string, ev *CdcEvent) error {
+	af := cdcArchiveFile{
+		time:  time.Now().UTC().Format("20060102150405.000000000"),
+		kind:  kind,
+		runId: ev.RunId,
+		first: ev.Offset,
+		last:  ev.Offset,
+		part:  true,
+	}
+	file, err := os.OpenFile(filepath.Join(as.dir, af.name()), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	as.file = file
+	as.cur = af
+	as.db = -1
+	as.openTime = time.Now()
+	return nil
+}
+
+// BeginSnapshot discards the previous snapshot which is not done
+func (as *cdcArchiveSink) BeginSnapshot() error {
+	if err := as.discardSnapshot(); err != nil {
+		return err
+	}
+	return as.closeFile()
+}
+
+// EndSnapshot closes files of the snapshot
+func (as *cdcArchiveSink) EndSnapshot() error {
+	if err := as.closeFile(); err != nil {
+		return err
+	}
+	for _, af := range as.snapshotParts {
+		path := filepath.Join(as.dir, af.name())
+		af.part = false
+		if err := os.Rename(path, filepath.Join(as.dir, af.name())); err != nil {
+			return err
+		}
+	}
+	as.snapshotParts = nil
+	as.retain()
+	return nil
+}
+
+func (as *cdcArchiveSink) discardSnapshot() error {
+	if as.file != nil && as.cur.kind == cdcArchiveSnapshot {
+		if err := as.closeFile(); err != nil {
+			return err
+		}
+	}
+	for _, af := range as.snapshotParts {
+		log.Infof("remove incomplete archive file : path(%s)", af.name())
+		if err := os.Remove(filepath.Join(as.dir, af.name())); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	as.snapshotParts = nil
+	return nil
+}
+
+// closeFile closes the current file, a file of snapshot is closed after the snapshot is done
+func (as *cdcArchiveSink) closeFile() error {
+	if as.file == nil {
+		return nil
+	}
+	err := as.file.Close()
+	as.file = nil
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(as.dir, as.cur.name())
+	if as.cur.size == 0 {
+		return os.Remove(path)
+	}
+	if as.cur.kind == cdcArchiveSnapshot {
+		as.snapshotParts = append(as.snapshotParts, as.cur)
+		return nil
+	}
+	closed := as.cur
+	closed.part = false
+	if err = os.Rename(path, filepath.Join(as.dir, closed.name())); err != nil {
+		return err
+	}
+	as.retain()
+	return nil
+}
+
+// Close closes the file, files of an incomplete snapshot are removed after restarting
+func (as *cdcArchiveSink) Close() error {
+	return as.closeFile()
+}
@@ -0,0 +1,123 @@
+package syncer
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/mgtv-tech/redis-GunYu/config"
+)
+
+// kafkaWriter is implemented by kafka.Writer
+type kafkaWriter interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+// cdcKafkaSink produces an event per message, messages are keyed by the first key of events,
+// so events of a key are in order within a partition
+type cdcKafkaSink struct {
+	cfg    config.CdcKafkaConfig
+	writer kafkaWriter
+}
+
+func newCdcKafkaSink(cfg config.CdcKafkaConfig, batchSize int) *cdcKafkaSink {
+	return &cdcKafkaSink{
+		cfg: cfg,
+		writer: &kafka.Writer{
+			Addr:         kafka.TCP(cfg.Brokers...),
+			Topic:        cfg.Topic,
+			Balancer:     &kafka.Hash{},
+			RequiredAcks: kafka.RequireAll,
+			MaxAttempts:  3,
+			BatchSize:    batchSize,
+			BatchTimeout: 10 * time.Millisecond, // events are written in batches by output
+			ReadTimeout:  cfg.Timeout,
+			WriteTimeout: cfg.Timeout,
+		},
+	}
+}
+
+func (ks *cdcKafkaSink) Write(ctx context.Context, events []CdcEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+	msgs := make([]kafka.Message, 0, len(events))
+	for i := range events {
+		msg, err := ks.message(&events[i])
+		if err != nil {
+			return err
+		}
+		msgs = append(msgs, msg)
+	}
+	// messages are acknowledged by all in-sync replicas before the checkpoint is saved
+	return ks.writer.WriteMessages(ctx, msgs...)
+}
+
+func (ks *cdcKafkaSink) message(ev *CdcEvent) (kafka.Message, error) {
+	keys, args, err := ev.rawArgs()
+	if err != nil {
+		return kafka.Message{}, err
+	}
+	msg := kafka.Message{}
+	if len(keys) > 0 {
+		msg.Key = keys[0]
+	}
+	if ks.cfg.Encoding == config.CdcEncodingProtobuf {
+		msg.Value = marshalCdcEventProto(ev, keys, args)
+	} else {
+		msg.Value, err = json.Marshal(ev)
+	}
+	return msg, err
+}
+
+func (ks *cdcKafkaSink) Close() error {
+	return ks.writer.Close()
+}
+
+// marshalCdcEventProto encodes the event as the protobuf message,
+// keys and args are raw bytes, so there is no base64 field
+//
+//	message CdcEvent {
+//	  string source = 1;
+//	  string run_id = 2;
+//	  int64 offset = 3;
+//	  int32 db = 4;
+//	  string command = 5;
+//	  repeated bytes keys = 6;
+//	  repeated bytes args = 7;
+//	  bool snapshot = 8;
+//	}
+func marshalCdcEventProto(ev *CdcEvent, keys [][]byte, args [][]byte) []byte {
+	var b []byte
+	appendString := func(num protowire.Number, v string) {
+		if v != "" {
+			b = protowire.AppendTag(b, num, protowire.BytesType)
+			b = protowire.AppendString(b, v)
+		}
+	}
+	appendVarint := func(num protowire.Number, v uint64) {
+		if v != 0 {
+			b = protowire.AppendTag(b, num, protowire.VarintType)
+			b = protowire.AppendVarint(b, v)
+		}
+	}
+	appendString(1, ev.Source)
+	appendString(2, ev.RunId)
+	appendVarint(3, uint64(ev.Offset))
+	appendVarint(4, uint64(int64(ev.Db)))
+	appendString(5, ev.Command)
+	for _, key := range keys {
+		b = protowire.AppendTag(b, 6, protowire.BytesType)
+		b = protowire.AppendBytes(b, key)
+	}
+	for _, arg := range args {
+		b = protowire.AppendTag(b, 7, protowire.BytesType)
+		b = protowire.AppendBytes(b, arg)
+	}
+	appendVarint(8, protowire.EncodeBool(ev.Snapshot))
+	return b
+}
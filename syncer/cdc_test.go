@@ -0,0 +1,352 @@
+package syncer
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/mgtv-tech/redis-GunYu/config"
+	usync "github.com/mgtv-tech/redis-GunYu/pkg/sync"
+)
+
+func newTestCdcOutput(t *testing.T, cdcCfg config.CdcConfig) *CdcOutput {
+	co, err := NewCdcOutput(CdcOutputConfig{
+		InputName: "127.0.0.1:6379",
+		Source:    "127.0.0.1:6379",
+		Dir:       filepath.Join(t.TempDir(), "127.0.0.1_6379"),
+		Cdc:       cdcCfg,
+		Parser: RedisOutputConfig{
+			InputName:                  "127.0.0.1:6379",
+			EnableResumeFromBreakPoint: true,
+			TargetDb:                   -1,
+			Filter: config.FilterConfig{
+				KeyFilter: &config.FilterKeyConfig{PrefixKeyBlacklist: []string{"tmp"}},
+			},
+		},
+	})
+	assert.Nil(t, err)
+	return co
+}
+
+func readCdcEvents(t *testing.T, dir string) (events []CdcEvent, files []string) {
+	entries, err := os.ReadDir(dir)
+	assert.Nil(t, err)
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), cdcEventFileExt) {
+			continue
+		}
+		files = append(files, entry.Name())
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		assert.Nil(t, err)
+		for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+			ev := CdcEvent{}
+			assert.Nil(t, json.Unmarshal([]byte(line), &ev))
+			events = append(events, ev)
+		}
+	}
+	return
+}
+
+func TestCdcOutputAof(t *testing.T) {
+	co := newTestCdcOutput(t, config.CdcConfig{
+		BatchSize:   100,
+		BatchTicker: 10 * time.Millisecond,
+		File:        &config.CdcFileConfig{MaxSize: 1024 * 1024, RotateInterval: time.Hour},
+	})
+
+	sp, err := co.StartPoint(context.Background(), []string{"id1", "id2"})
+	assert.Nil(t, err)
+	assert.True(t, sp.IsInitial())
+
+	cmds := "*2\r\n$6\r\nselect\r\n$1\r\n1\r\n" +
+		"*3\r\n$3\r\nset\r\n$2\r\nk1\r\n$2\r\nv1\r\n" +
+		"*3\r\n$3\r\nset\r\n$4\r\ntmp1\r\n$2\r\nv1\r\n" +
+		"*3\r\n$4\r\nmset\r\n$2\r\nk2\r\n$3\r\n\xff\xfe\x00\r\n"
+	rd, wr := io.Pipe()
+	defer wr.Close()
+	go wr.Write([]byte(cmds))
+
+	wait := usync.NewWaitCloser(nil)
+	sendBuf := make(chan cmdExecution, 10)
+	go co.parser.parseAofCommand(wait, bufio.NewReader(rd), 100, sendBuf)
+	done := make(chan error)
+	go func() { done <- co.emitCmds(wait, "id1", sendBuf) }()
+
+	end := int64(100 + len(cmds))
+	assert.Eventually(t, func() bool {
+		sp, err = co.StartPoint(context.Background(), []string{"id1", "id2"})
+		return err == nil && sp.Offset == end
+	}, 5*time.Second, 10*time.Millisecond)
+	wait.Close(nil)
+	assert.Nil(t, <-done)
+	assert.Equal(t, "id1", sp.RunId)
+	assert.Equal(t, 1, sp.DbId)
+
+	co.Close()
+	events, _ := readCdcEvents(t, co.cfg.Dir)
+	assert.Equal(t, 2, len(events))
+	assert.Equal(t, CdcEvent{Source: "127.0.0.1:6379", RunId: "id1", Offset: 152, Db: 1,
+		Command: "set", Keys: []string{"k1"}, Args: []string{"k1", "v1"}}, events[0])
+	assert.True(t, events[1].Base64)
+	assert.Equal(t, []string{"azI="}, events[1].Keys)
+	assert.Equal(t, []string{"azI=", "//4A"}, events[1].Args)
+
+	// checkpoint is moved to the new run id
+	assert.Nil(t, co.SetRunId(context.Background(), "id3"))
+	sp, err = co.StartPoint(context.Background(), []string{"id3"})
+	assert.Nil(t, err)
+	assert.Equal(t, end, sp.Offset)
+
+	assert.Nil(t, DelCdcCheckpoint(&config.CdcConfig{Dir: filepath.Dir(co.cfg.Dir)}, "127.0.0.1:6379"))
+	sp, err = co.StartPoint(context.Background(), []string{"id3"})
+	assert.Nil(t, err)
+	assert.True(t, sp.IsInitial())
+}
+
+func TestCdcFileSink(t *testing.T) {
+	dir := t.TempDir()
+	fs, err := newCdcFileSink(dir, config.CdcFileConfig{MaxSize: 10, RotateInterval: time.Hour})
+	assert.Nil(t, err)
+
+	ev := CdcEvent{Command: "set", Args: []string{"a", "b"}}
+	assert.Nil(t, fs.Write(context.Background(), []CdcEvent{ev}))
+	time.Sleep(time.Millisecond)
+	// rotated by size
+	assert.Nil(t, fs.Write(context.Background(), []CdcEvent{ev, ev}))
+
+	// the file being written is not closed
+	events, files := readCdcEvents(t, dir)
+	assert.Equal(t, 1, len(files))
+	assert.Equal(t, 1, len(events))
+
+	// an incomplete line is removed when the file is recovered
+	part := fs.file.Name()
+	_, err = fs.file.Write([]byte(`{"command":"se`))
+	assert.Nil(t, err)
+	fs.file.Close()
+	assert.True(t, strings.HasSuffix(part, cdcPartSuffix))
+
+	_, err = newCdcFileSink(dir, config.CdcFileConfig{MaxSize: 10, RotateInterval: time.Hour})
+	assert.Nil(t, err)
+	events, files = readCdcEvents(t, dir)
+	assert.Equal(t, 2, len(files))
+	assert.Equal(t, 3, len(events))
+	_, err = os.Stat(part)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestCdcWebhookSink(t *testing.T) {
+	var mux sync.Mutex
+	var batches [][]CdcEvent
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mux.Lock()
+		defer mux.Unlock()
+		requests++
+		if requests == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		assert.Equal(t, "token", r.Header.Get("Authorization"))
+		events := []CdcEvent{}
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(&events))
+		batches = append(batches, events)
+	}))
+	defer server.Close()
+
+	ws := newCdcWebhookSink(config.CdcWebhookConfig{
+		Url:     server.URL,
+		Timeout: time.Second,
+		Headers: map[string]string{"Authorization": "token"},
+	})
+	defer ws.Close()
+
+	// no request for empty batch
+	assert.Nil(t, ws.Write(context.Background(), nil))
+
+	// retry after a failure
+	err := ws.Write(context.Background(), []CdcEvent{{Command: "set"}, {Command: "del"}})
+	assert.Nil(t, err)
+	mux.Lock()
+	defer mux.Unlock()
+	assert.Equal(t, 2, requests)
+	assert.Equal(t, 1, len(batches))
+	assert.Equal(t, "del", batches[0][1].Command)
+}
+
+type fakeKafkaWriter struct {
+	msgs []kafka.Message
+	err  error
+}
+
+func (fw *fakeKafkaWriter) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	if fw.err != nil {
+		return fw.err
+	}
+	fw.msgs = append(fw.msgs, msgs...)
+	return nil
+}
+
+func (fw *fakeKafkaWriter) Close() error { return nil }
+
+func TestCdcKafkaSink(t *testing.T) {
+	writer := &fakeKafkaWriter{}
+	ks := &cdcKafkaSink{cfg: config.CdcKafkaConfig{Encoding: config.CdcEncodingJson}, writer: writer}
+	events := []CdcEvent{
+		{RunId: "id1", Offset: 10, Command: "set", Keys: []string{"k1"}, Args: []string{"k1", "v1"}},
+		{RunId: "id1", Offset: 20, Command: "flushall", Args: []string{}},
+		{RunId: "id1", Offset: 30, Db: 2, Command: "set", Keys: []string{"azI="}, Args: []string{"azI=", "//4A"}, Base64: true, Snapshot: true},
+	}
+	assert.Nil(t, ks.Write(context.Background(), events))
+	assert.Equal(t, 3, len(writer.msgs))
+	assert.Equal(t, []byte("k1"), writer.msgs[0].Key)
+	assert.Nil(t, writer.msgs[1].Key)
+	assert.Equal(t, []byte("k2"), writer.msgs[2].Key)
+	ev := CdcEvent{}
+	assert.Nil(t, json.Unmarshal(writer.msgs[2].Value, &ev))
+	assert.Equal(t, events[2], ev)
+
+	// protobuf
+	writer.msgs = nil
+	ks.cfg.Encoding = config.CdcEncodingProtobuf
+	assert.Nil(t, ks.Write(context.Background(), events[2:]))
+	fields := map[protowire.Number][][]byte{}
+	b := writer.msgs[0].Value
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		assert.True(t, n > 0)
+		b = b[n:]
+		switch typ {
+		case protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			assert.True(t, n > 0)
+			fields[num] = append(fields[num], []byte(fmt.Sprint(v)))
+			b = b[n:]
+		case protowire.BytesType:
+			v, n := protowire.ConsumeBytes(b)
+			assert.True(t, n > 0)
+			fields[num] = append(fields[num], v)
+			b = b[n:]
+		default:
+			t.Fatalf("unexpected wire type : %v", typ)
+		}
+	}
+	assert.Equal(t, map[protowire.Number][][]byte{
+		2: {[]byte("id1")},
+		3: {[]byte("30")},
+		4: {[]byte("2")},
+		5: {[]byte("set")},
+		6: {[]byte("k2")},
+		7: {[]byte("k2"), {0xff, 0xfe, 0}},
+		8: {[]byte("1")},
+	}, fields)
+
+	// events are emitted again after a failure
+	writer.err = errors.New("leader not available")
+	assert.NotNil(t, ks.Write(context.Background(), events))
+}
+
+func TestCdcCommandMergeable(t *testing.T) {
+	c := cdcCommand{cmd: "hset", args: [][]byte{[]byte("h"), []byte("f1"), []byte("v1")}}
+	assert.True(t, c.mergeable("hset", [][]byte{[]byte("h"), []byte("f2"), []byte("v2")}))
+	assert.False(t, c.mergeable("hset", [][]byte{[]byte("h2"), []byte("f2"), []byte("v2")}))
+	assert.False(t, c.mergeable("hpexpire", [][]byte{[]byte("h"), []byte("f1"), []byte("10")}))
+
+	c = cdcCommand{cmd: "xadd", args: [][]byte{[]byte("s"), []byte("1-0"), []byte("f"), []byte("v")}}
+	assert.False(t, c.mergeable("xadd", [][]byte{[]byte("s"), []byte("2-0"), []byte("f"), []byte("v")}))
+}
+
+func readCdcArchive(t *testing.T, dir string) (names []string, data []string) {
+	files, err := listCdcArchiveFiles(dir)
+	assert.Nil(t, err)
+	for _, af := range files {
+		names = append(names, strings.SplitN(af.name(), "-", 2)[1])
+		content, err := os.ReadFile(filepath.Join(dir, af.name()))
+		assert.Nil(t, err)
+		data = append(data, string(content))
+	}
+	return
+}
+
+func TestCdcArchiveSink(t *testing.T) {
+	dir := t.TempDir()
+	cfg := config.CdcArchiveConfig{MaxSize: 1024 * 1024, RotateInterval: time.Hour, Retention: time.Hour}
+	as, err := newCdcArchiveSink(dir, cfg)
+	assert.Nil(t, err)
+
+	set := func(runId string, offset int64, db int, key string, snapshot bool) CdcEvent {
+		return CdcEvent{RunId: runId, Offset: offset, Db: db, Command: "set", Keys: []string{key}, Args: []string{key, "v"}, Snapshot: snapshot}
+	}
+	ctx := context.Background()
+	assert.Nil(t, as.BeginSnapshot())
+	assert.Nil(t, as.Write(ctx, []CdcEvent{set("id1", 100, 0, "a", true), set("id1", 100, 1, "b", true)}))
+	assert.Nil(t, as.EndSnapshot())
+	assert.Nil(t, as.Write(ctx, []CdcEvent{set("id1", 110, 1, "c", false), set("id1", 120, 1, "d", false)}))
+
+	// crash with an incomplete command
+	_, err = as.file.Write([]byte("*3\r\n$3\r\nset"))
+	assert.Nil(t, err)
+	as.file.Close()
+
+	as, err = newCdcArchiveSink(dir, cfg)
+	assert.Nil(t, err)
+	// archived commands are skipped
+	assert.Nil(t, as.Write(ctx, []CdcEvent{set("id1", 120, 1, "d", false), set("id1", 130, 1, "e", false)}))
+	assert.Nil(t, as.Close())
+
+	names, data := readCdcArchive(t, dir)
+	assert.Equal(t, []string{"snapshot-id1-100-100.resp", "aof-id1-110-120.resp", "aof-id1-130-130.resp"}, names)
+	assert.Equal(t, []string{
+		"*2\r\n$6\r\nselect\r\n$1\r\n0\r\n*3\r\n$3\r\nset\r\n$1\r\na\r\n$1\r\nv\r\n" +
+			"*2\r\n$6\r\nselect\r\n$1\r\n1\r\n*3\r\n$3\r\nset\r\n$1\r\nb\r\n$1\r\nv\r\n",
+		"*2\r\n$6\r\nselect\r\n$1\r\n1\r\n*3\r\n$3\r\nset\r\n$1\r\nc\r\n$1\r\nv\r\n*3\r\n$3\r\nset\r\n$1\r\nd\r\n$1\r\nv\r\n",
+		"*2\r\n$6\r\nselect\r\n$1\r\n1\r\n*3\r\n$3\r\nset\r\n$1\r\ne\r\n$1\r\nv\r\n",
+	}, data)
+
+	// an incomplete snapshot is removed, including its rotated files
+	as.cfg.MaxSize = 1
+	assert.Nil(t, as.BeginSnapshot())
+	assert.Nil(t, as.Write(ctx, []CdcEvent{set("id2", 200, 0, "a", true)}))
+	assert.Nil(t, as.Write(ctx, []CdcEvent{set("id2", 200, 0, "b", true)}))
+	as.file.Close()
+	as, err = newCdcArchiveSink(dir, cfg)
+	assert.Nil(t, err)
+	names, _ = readCdcArchive(t, dir)
+	assert.Equal(t, 3, len(names))
+
+	// expired files before the latest snapshot are removed
+	assert.Nil(t, as.BeginSnapshot())
+	assert.Nil(t, as.Write(ctx, []CdcEvent{set("id2", 200, 0, "a", true)}))
+	// a snapshot which is not done is discarded by commands of aof
+	assert.Nil(t, as.Write(ctx, []CdcEvent{set("id2", 210, 0, "b", false)}))
+	names, _ = readCdcArchive(t, dir)
+	assert.Equal(t, 4, len(names))
+	assert.True(t, strings.HasPrefix(names[3], "aof-id2-210-210-"))
+	assert.Nil(t, as.BeginSnapshot())
+	assert.Nil(t, as.Write(ctx, []CdcEvent{set("id2", 200, 0, "a", true)}))
+	assert.Nil(t, as.EndSnapshot())
+	old := time.Now().Add(-2 * time.Hour)
+	files, err := listCdcArchiveFiles(dir)
+	assert.Nil(t, err)
+	for _, af := range files {
+		assert.Nil(t, os.Chtimes(filepath.Join(dir, af.name()), old, old))
+	}
+	as.retain()
+	names, _ = readCdcArchive(t, dir)
+	assert.Equal(t, []string{"snapshot-id2-200-200.resp"}, names)
+}
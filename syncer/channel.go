@@ -1,6 +1,7 @@
 package syncer
 
 import (
+	"context"
 	"fmt"
 	"io"
 
@@ -9,7 +10,22 @@ import (
 	"github.com/mgtv-tech/redis-GunYu/pkg/store"
 )
 
-var _ Channel = &StoreChannel{}
+var (
+	_ Channel = &StoreChannel{}
+	_ Channel = &MemoryChannel{}
+)
+
+// ChannelWriter ingests data from input into channel
+type ChannelWriter interface {
+	Start()
+	Wait(context.Context) error
+	Close() error
+}
+
+type ChannelAofWriter interface {
+	ChannelWriter
+	Right() int64
+}
 
 type Channel interface {
 	StartPoint([]string) (StartPoint, error)
@@ -18,9 +34,10 @@ type Channel interface {
 	RunId() string
 	IsValidOffset(Offset) bool
 	GetOffsetRange(string) (int64, int64)
+	WaitOffset(context.Context, Offset) error
 	GetRdb(string) (int64, int64)
-	NewRdbWriter(io.Reader, int64, int64) (*store.RdbWriter, error)
-	NewAofWritter(r io.Reader, offset int64) (*store.AofWriter, error)
+	NewRdbWriter(io.Reader, int64, int64) (ChannelWriter, error)
+	NewAofWritter(r io.Reader, offset int64) (ChannelAofWriter, error)
 	NewReader(Offset) (*store.Reader, error)
 	Close() error
 }
@@ -32,7 +49,17 @@ type StoreChannel struct {
 }
 
 func NewStoreChannel(cfg StorerConf) Channel {
-	storer := store.NewStorer(cfg.InputId, cfg.Dir, cfg.MaxSize, cfg.LogSize, cfg.flush)
+	storer := store.NewStorer(cfg.InputId, cfg.Dir, cfg.MaxSize, cfg.LogSize, cfg.flush, cfg.keyring, cfg.tier, cfg.retention)
+	if cfg.scrub != nil && cfg.scrub.Enable {
+		storer.StartScrub(cfg.scrub.Interval, cfg.scrub.Rate)
+	}
+	if cfg.disk != nil && cfg.disk.Enable {
+		storer.StartDiskWatch(store.DiskWatermark{
+			Pause:    cfg.disk.Pause,
+			Resume:   cfg.disk.Resume,
+			Interval: cfg.disk.Interval,
+		})
+	}
 	return &StoreChannel{
 		storer: storer,
 		logger: log.WithLogger(config.LogModuleName(fmt.Sprintf("[StoreChannel(%s)] ", cfg.InputId))),
@@ -80,6 +107,11 @@ func (sc *StoreChannel) GetOffsetRange(runId string) (int64, int64) {
 	return sc.storer.GetOffsetRange()
 }
 
+// WaitOffset blocks until channel has data at offset or run id is changed
+func (sc *StoreChannel) WaitOffset(ctx context.Context, offset Offset) error {
+	return sc.storer.WaitOffset(ctx, offset.RunId, offset.Offset)
+}
+
 func (sc *StoreChannel) GetRdb(runId string) (int64, int64) {
 	if runId != sc.storer.RunId() {
 		return -1, -1
@@ -102,20 +134,22 @@ func (sc *StoreChannel) NewReader(offset Offset) (*store.Reader, error) {
 	return r, err
 }
 
-func (sc *StoreChannel) NewRdbWriter(reader io.Reader, offset int64, size int64) (*store.RdbWriter, error) {
+func (sc *StoreChannel) NewRdbWriter(reader io.Reader, offset int64, size int64) (ChannelWriter, error) {
 	w, err := sc.storer.GetRdbWriter(reader, offset, size)
 	if err != nil {
-		sc.logger.Errorf("get rdb writer error : offset(%d), size(%d), err(%w)", offset, size, err)
+		sc.logger.Errorf("get rdb writer error : offset(%d), size(%d), err(%v)", offset, size, err)
+		return nil, err
 	}
-	return w, err
+	return w, nil
 }
 
-func (sc *StoreChannel) NewAofWritter(r io.Reader, offset int64) (*store.AofWriter, error) {
+func (sc *StoreChannel) NewAofWritter(r io.Reader, offset int64) (ChannelAofWriter, error) {
 	w, err := sc.storer.GetAofWritter(r, offset)
 	if err != nil {
-		sc.logger.Errorf("get aof writer error : offset(%d), err(%w)", offset, err)
+		sc.logger.Errorf("get aof writer error : offset(%d), err(%v)", offset, err)
+		return nil, err
 	}
-	return w, err
+	return w, nil
 }
 
 func (sc *StoreChannel) SetRunId(runId string) error {
@@ -149,3 +183,110 @@ func (sc *StoreChannel) Close() error {
 	}
 	return err
 }
+
+// MemoryChannel keeps data in a bounded memory buffer, nothing is persisted.
+// once the requested offset has been evicted, it's invalid, so input falls back to a full sync
+type MemoryChannel struct {
+	storer *store.MemStorer
+	logger log.Logger
+}
+
+func NewMemoryChannel(inputId string, maxSize int64) Channel {
+	return &MemoryChannel{
+		storer: store.NewMemStorer(inputId, maxSize),
+		logger: log.WithLogger(config.LogModuleName(fmt.Sprintf("[MemoryChannel(%s)] ", inputId))),
+	}
+}
+
+func (mc *MemoryChannel) StartPoint(ids []string) (StartPoint, error) {
+	if len(ids) == 0 {
+		return StartPoint{
+			RunId:  mc.storer.RunId(),
+			Offset: mc.storer.LatestOffset(),
+		}, nil
+	}
+	offset := mc.storer.VerifyRunId(ids)
+	if offset < 0 || len(mc.storer.RunId()) == 0 {
+		return StartPoint{
+			RunId:  "?",
+			Offset: -1,
+		}, nil
+	}
+	return StartPoint{
+		RunId:  mc.storer.RunId(),
+		Offset: offset,
+	}, nil
+}
+
+func (mc *MemoryChannel) IsValidOffset(off Offset) bool {
+	if off.RunId == "?" {
+		return !mc.storer.IsValidOffset(-1)
+	}
+	if off.RunId != mc.storer.RunId() {
+		return false
+	}
+	return mc.storer.IsValidOffset(off.Offset)
+}
+
+func (mc *MemoryChannel) GetOffsetRange(runId string) (int64, int64) {
+	if runId != mc.storer.RunId() {
+		return -1, -1
+	}
+	return mc.storer.GetOffsetRange()
+}
+
+// WaitOffset blocks until channel has data at offset or run id is changed
+func (mc *MemoryChannel) WaitOffset(ctx context.Context, offset Offset) error {
+	return mc.storer.WaitOffset(ctx, offset.RunId, offset.Offset)
+}
+
+func (mc *MemoryChannel) GetRdb(runId string) (int64, int64) {
+	if runId != mc.storer.RunId() {
+		return -1, -1
+	}
+	return mc.storer.GetRdb()
+}
+
+func (mc *MemoryChannel) NewReader(offset Offset) (*store.Reader, error) {
+	r, err := mc.storer.GetReader(offset.Offset)
+	if err != nil {
+		mc.logger.Errorf("storer.GetReader error : offset(%v), err(%v)", offset, err)
+	}
+	return r, err
+}
+
+func (mc *MemoryChannel) NewRdbWriter(reader io.Reader, offset int64, size int64) (ChannelWriter, error) {
+	w, err := mc.storer.GetRdbWriter(reader, offset, size)
+	if err != nil {
+		mc.logger.Errorf("get rdb writer error : offset(%d), size(%d), err(%v)", offset, size, err)
+		return nil, err
+	}
+	return w, nil
+}
+
+func (mc *MemoryChannel) NewAofWritter(r io.Reader, offset int64) (ChannelAofWriter, error) {
+	w, err := mc.storer.GetAofWritter(r, offset)
+	if err != nil {
+		mc.logger.Errorf("get aof writer error : offset(%d), err(%v)", offset, err)
+		return nil, err
+	}
+	return w, nil
+}
+
+func (mc *MemoryChannel) SetRunId(runId string) error {
+	mc.logger.Debugf("SetRunId : runId(%s)", runId)
+	return mc.storer.SetRunId(runId)
+}
+
+func (mc *MemoryChannel) DelRunId(runId string) error {
+	mc.logger.Infof("DelRunId : runId(%s)", runId)
+	return mc.storer.DelRunId(runId)
+}
+
+func (mc *MemoryChannel) RunId() string {
+	return mc.storer.RunId()
+}
+
+func (mc *MemoryChannel) Close() error {
+	return mc.storer.Close()
+}
@@ -0,0 +1,121 @@
+package syncer
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/mgtv-tech/redis-GunYu/pkg/redis/client"
+)
+
+// dead-letter files are shared by syncers in the process
+var deadLetterMux sync.Mutex
+
+// DeadLetter is a command rejected by the target, an entry of a dead-letter file is a RESP array :
+// offset, db, error, command and arguments of it
+type DeadLetter struct {
+	Offset int64
+	Db     int
+	Error  string
+	Cmd    string
+	Args   [][]byte
+}
+
+func (dl *DeadLetter) Resp() client.Resp {
+	args := make([]interface{}, 0, len(dl.Args)+4)
+	args = append(args, strconv.Itoa(dl.Db), dl.Error, dl.Cmd)
+	for _, arg := range dl.Args {
+		args = append(args, arg)
+	}
+	return client.NewCommand(strconv.FormatInt(dl.Offset, 10), args...)
+}
+
+// WriteDeadLetter appends dl to the dead-letter file
+func WriteDeadLetter(path string, dl *DeadLetter) error {
+	deadLetterMux.Lock()
+	defer deadLetterMux.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	// the file is opened every time, so it can be moved away to re-drive entries
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	err = client.Encode(bufio.NewWriter(file), dl.Resp(), true)
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// ReadDeadLetters calls fn with every entry of a dead-letter file until fn returns an error
+func ReadDeadLetters(reader io.Reader, fn func(*DeadLetter) error) error {
+	decoder := client.NewDecoder(bufio.NewReader(reader))
+	for {
+		resp, _, err := client.MustDecodeOpt(decoder)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		offset, args, err := client.ParseArgs(resp)
+		if err != nil {
+			return err
+		}
+		if len(args) < 3 {
+			return fmt.Errorf("invalid dead letter : %v", args)
+		}
+		dl := &DeadLetter{
+			Error: string(args[1]),
+			Cmd:   strings.ToLower(string(args[2])),
+			Args:  args[3:],
+		}
+		if dl.Offset, err = strconv.ParseInt(offset, 10, 64); err != nil {
+			return fmt.Errorf("invalid offset of dead letter : %w", err)
+		}
+		if dl.Db, err = strconv.Atoi(string(args[0])); err != nil {
+			return fmt.Errorf("invalid db of dead letter : %w", err)
+		}
+		if err = fn(dl); err != nil {
+			return err
+		}
+	}
+}
+
+// deadLetterPath returns the dead-letter file of the input, there is a file per input
+func (ro *RedisOutput) deadLetterPath() string {
+	name := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '-' {
+			return r
+		}
+		return '_'
+	}, ro.cfg.InputName)
+	return filepath.Join(ro.cfg.ReplyError.DeadLetterDir, name+".resp")
+}
+
+func (ro *RedisOutput) writeDeadLetter(ce *cmdExecution, rerr error) error {
+	dl := &DeadLetter{
+		Offset: ce.Offset,
+		Db:     ce.Db,
+		Error:  rerr.Error(),
+		Cmd:    ce.Cmd,
+		Args:   make([][]byte, 0, len(ce.Args)),
+	}
+	for _, arg := range ce.Args {
+		if b, ok := arg.([]byte); ok {
+			dl.Args = append(dl.Args, b)
+		} else {
+			dl.Args = append(dl.Args, []byte(fmt.Sprint(arg)))
+		}
+	}
+	return WriteDeadLetter(ro.deadLetterPath(), dl)
+}
@@ -0,0 +1,298 @@
+package syncer
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"time"
+
+	"golang.org/x/exp/slices"
+
+	"github.com/mgtv-tech/redis-GunYu/config"
+	"github.com/mgtv-tech/redis-GunYu/pkg/log"
+	"github.com/mgtv-tech/redis-GunYu/pkg/metric"
+	"github.com/mgtv-tech/redis-GunYu/pkg/util"
+)
+
+var (
+	downgradeCounter = metric.NewCounterVec(metric.CounterVecOpts{
+		Namespace: config.AppName,
+		Subsystem: "output",
+		Name:      "downgrade_cmd",
+		Labels:    []string{"input", "cmd", "result"},
+	})
+)
+
+const (
+	// pops ARGV[2] elements from the first existing key by ARGV[1]
+	downgradePopScript = `for _, k in ipairs(KEYS) do
+  if redis.call('exists', k) == 1 then
+    for i = 1, tonumber(ARGV[2]) do redis.call(ARGV[1], k) end
+    return 1
+  end
+end
+return 0`
+	// pops an element from KEYS[1] by ARGV[1], and pushes it to KEYS[2] by ARGV[2]
+	downgradeMoveScript = `local v = redis.call(ARGV[1], KEYS[1])
+if v then redis.call(ARGV[2], KEYS[2], v) end
+return v`
+	// copies KEYS[1] to KEYS[2] with its ttl, KEYS[2] is replaced if ARGV[1] is 1
+	downgradeCopyScript = `local v = redis.call('dump', KEYS[1])
+if not v then return 0 end
+if ARGV[1] == '1' then redis.call('del', KEYS[2]) elseif redis.call('exists', KEYS[2]) == 1 then return 0 end
+local ttl = redis.call('pttl', KEYS[1])
+if ttl < 0 then ttl = 0 end
+redis.call('restore', KEYS[2], ttl, v)
+return 1`
+)
+
+// downgradeRule rewrites a command which is added in version since, or has options added in it.
+// translate returns an empty command if the command has no effect on data,
+// and false if there is no equivalent command, a nil translate means there is no equivalent command.
+type downgradeRule struct {
+	since     string
+	translate func(cd *cmdDowngrader, cmd string, args [][]byte) (string, [][]byte, bool)
+}
+
+var downgradeRules = map[string]downgradeRule{
+	"getex":       {"6.2", downgradeGetex},
+	"getdel":      {"6.2", downgradeGetdel},
+	"set":         {"6.2", downgradeSet},
+	"lpop":        {"6.2", downgradePopCount},
+	"rpop":        {"6.2", downgradePopCount},
+	"lmove":       {"6.2", downgradeMove},
+	"blmove":      {"6.2", downgradeMove},
+	"copy":        {"6.2", downgradeCopy},
+	"zrangestore": {"6.2", nil},
+	"lmpop":       {"7.0", downgradeMpop},
+	"blmpop":      {"7.0", downgradeMpop},
+	"zmpop":       {"7.0", downgradeMpop},
+	"bzmpop":      {"7.0", downgradeMpop},
+	"sintercard":  {"7.0", downgradeReadOnly},
+	"expire":      {"7.0", downgradeExpire},
+	"pexpire":     {"7.0", downgradeExpire},
+	"expireat":    {"7.0", downgradeExpire},
+	"pexpireat":   {"7.0", downgradeExpire},
+	"function":    {"7.0", nil},
+	"fcall":       {"7.0", nil},
+	"hexpire":     {"7.4", nil},
+	"hpexpire":    {"7.4", nil},
+	"hexpireat":   {"7.4", nil},
+	"hpexpireat":  {"7.4", nil},
+	"hpersist":    {"7.4", nil},
+	"hsetex":      {"8.0", downgradeHsetex},
+	"hgetex":      {"8.0", downgradeHgetex},
+	"hgetdel":     {"8.0", downgradeHgetdel},
+}
+
+// cmdDowngrader rewrites commands of newer versions for an older target,
+// commands without equivalent commands are handled by the policy
+type cmdDowngrader struct {
+	input   string
+	version string
+	policy  string // fail|skip|log
+	logger  log.Logger
+	now     func() time.Time
+}
+
+// newCmdDowngrader returns nil if the version of the target is unknown
+func newCmdDowngrader(input string, version string, policy string, logger log.Logger) *cmdDowngrader {
+	if version == "" {
+		return nil
+	}
+	return &cmdDowngrader{input: input, version: version, policy: policy, logger: logger, now: time.Now}
+}
+
+// supports returns true if the target version is not less than version
+func (cd *cmdDowngrader) supports(version string) bool {
+	return util.VersionGE(cd.version, version, util.VersionMinor)
+}
+
+// Downgrade returns the command for the target, it returns true if the command is skipped,
+// and an error if the command is not supported by the target and the policy is fail
+func (cd *cmdDowngrader) Downgrade(cmd string, args [][]byte) (string, [][]byte, bool, error) {
+	if cd == nil {
+		return cmd, args, false, nil
+	}
+	rule, ok := downgradeRules[cmd]
+	if !ok || len(args) == 0 || cd.supports(rule.since) {
+		return cmd, args, false, nil
+	}
+	if rule.translate != nil {
+		newCmd, newArgs, ok := rule.translate(cd, cmd, args)
+		if ok {
+			if newCmd != cmd || !slices.EqualFunc(newArgs, args, bytes.Equal) {
+				downgradeCounter.Inc(cd.input, cmd, "rewrite")
+			}
+			return newCmd, newArgs, newCmd == "", nil
+		}
+	}
+
+	switch cd.policy {
+	case config.UnsupportedCmdSkip, config.UnsupportedCmdLog:
+		downgradeCounter.Inc(cd.input, cmd, "skip")
+		if cd.policy == config.UnsupportedCmdLog {
+			cd.logger.Warnf("skip command unsupported by target : cmd(%s), key(%s), version(%s)", cmd, args[0], cd.version)
+		}
+		return cmd, args, true, nil
+	}
+	downgradeCounter.Inc(cd.input, cmd, "fail")
+	return cmd, args, false, fmt.Errorf("command is not supported by target : cmd(%s), key(%s), version(%s)", cmd, args[0], cd.version)
+}
+
+// downgradeReadOnly drops a read-only command
+func downgradeReadOnly(_ *cmdDowngrader, _ string, _ [][]byte) (string, [][]byte, bool) {
+	return "", nil, true
+}
+
+// getdel key
+func downgradeGetdel(_ *cmdDowngrader, _ string, args [][]byte) (string, [][]byte, bool) {
+	return "del", args[:1], true
+}
+
+// getex key [EX seconds | PX milliseconds | EXAT unix-time-seconds | PXAT unix-time-milliseconds | PERSIST]
+func downgradeGetex(_ *cmdDowngrader, _ string, args [][]byte) (string, [][]byte, bool) {
+	if len(args) == 1 {
+		return "", nil, true
+	}
+	option := util.BytesToString(bytes.ToLower(args[1]))
+	if option == "persist" {
+		return "persist", args[:1], true
+	}
+	cmd, ok := map[string]string{"ex": "expire", "px": "pexpire", "exat": "expireat", "pxat": "pexpireat"}[option]
+	if !ok || len(args) < 3 {
+		return "", nil, false
+	}
+	return cmd, [][]byte{args[0], args[2]}, true
+}
+
+// set key value [NX | XX] [GET] [EX seconds | PX milliseconds | EXAT unix-time-seconds | PXAT unix-time-milliseconds | KEEPTTL],
+// GET is removed, and absolute times are converted to PX
+func downgradeSet(cd *cmdDowngrader, _ string, args [][]byte) (string, [][]byte, bool) {
+	if len(args) < 3 {
+		return "set", args, true
+	}
+	newArgs := append([][]byte(nil), args[:2]...)
+	for i := 2; i < len(args); i++ {
+		switch util.BytesToString(bytes.ToLower(args[i])) {
+		case "get":
+			continue
+		case "keepttl":
+			if !cd.supports("6.0") {
+				return "", nil, false
+			}
+		case "exat", "pxat":
+			if i+1 >= len(args) {
+				return "", nil, false
+			}
+			at, err := strconv.ParseInt(util.BytesToString(args[i+1]), 10, 64)
+			if err != nil {
+				return "", nil, false
+			}
+			if len(args[i]) == 4 && (args[i][0] == 'e' || args[i][0] == 'E') {
+				at *= 1000
+			}
+			ttl := at - cd.now().UnixMilli()
+			if ttl < 1 {
+				ttl = 1
+			}
+			newArgs = append(newArgs, []byte("PX"), []byte(strconv.FormatInt(ttl, 10)))
+			i++
+			continue
+		}
+		newArgs = append(newArgs, args[i])
+	}
+	return "set", newArgs, true
+}
+
+// lpop key [count], count is added in 6.2
+func downgradePopCount(_ *cmdDowngrader, cmd string, args [][]byte) (string, [][]byte, bool) {
+	if len(args) == 1 {
+		return cmd, args, true
+	}
+	return "eval", [][]byte{[]byte(downgradePopScript), []byte("1"), args[0], []byte(cmd), args[1]}, true
+}
+
+// lmove source destination LEFT|RIGHT LEFT|RIGHT, blmove source destination LEFT|RIGHT LEFT|RIGHT timeout
+func downgradeMove(_ *cmdDowngrader, _ string, args [][]byte) (string, [][]byte, bool) {
+	if len(args) < 4 {
+		return "", nil, false
+	}
+	from, to := bytes.ToLower(args[2]), bytes.ToLower(args[3])
+	if bytes.Equal(from, []byte("right")) && bytes.Equal(to, []byte("left")) {
+		return "rpoplpush", args[:2], true
+	}
+	return "eval", [][]byte{[]byte(downgradeMoveScript), []byte("2"), args[0], args[1],
+		[]byte(string(from[:1]) + "pop"), []byte(string(to[:1]) + "push")}, true
+}
+
+// lmpop numkeys key [key ...] LEFT|RIGHT [COUNT count], zmpop numkeys key [key ...] MIN|MAX [COUNT count],
+// blmpop and bzmpop have a timeout before numkeys
+func downgradeMpop(_ *cmdDowngrader, cmd string, args [][]byte) (string, [][]byte, bool) {
+	if cmd[0] == 'b' {
+		args = args[1:]
+	}
+	if len(args) < 1 {
+		return "", nil, false
+	}
+	numKeys, err := strconv.Atoi(util.BytesToString(args[0]))
+	if err != nil || numKeys <= 0 || len(args) < numKeys+2 {
+		return "", nil, false
+	}
+	pop := map[string]string{"left": "lpop", "right": "rpop", "min": "zpopmin", "max": "zpopmax"}[util.BytesToString(bytes.ToLower(args[numKeys+1]))]
+	if pop == "" {
+		return "", nil, false
+	}
+	count := []byte("1")
+	if len(args) == numKeys+4 && bytes.EqualFold(args[numKeys+2], []byte("count")) {
+		count = args[numKeys+3]
+	}
+	newArgs := [][]byte{[]byte(downgradePopScript), args[0]}
+	newArgs = append(newArgs, args[1:numKeys+1]...)
+	return "eval", append(newArgs, []byte(pop), count), true
+}
+
+// copy source destination [DB destination-db] [REPLACE]
+func downgradeCopy(_ *cmdDowngrader, _ string, args [][]byte) (string, [][]byte, bool) {
+	if len(args) < 2 {
+		return "", nil, false
+	}
+	replace := "0"
+	for _, arg := range args[2:] {
+		if !bytes.EqualFold(arg, []byte("replace")) {
+			return "", nil, false
+		}
+		replace = "1"
+	}
+	return "eval", [][]byte{[]byte(downgradeCopyScript), []byte("2"), args[0], args[1], []byte(replace)}, true
+}
+
+// expire key seconds [NX | XX | GT | LT], options are added in 7.0
+func downgradeExpire(_ *cmdDowngrader, cmd string, args [][]byte) (string, [][]byte, bool) {
+	return cmd, args, len(args) <= 2
+}
+
+// hsetex key [FNX | FXX] [EX seconds | PX milliseconds | EXAT unix-time-seconds | PXAT unix-time-milliseconds | KEEPTTL] FIELDS numfields field value [field value ...],
+// it's converted to hset if there is no option
+func downgradeHsetex(_ *cmdDowngrader, _ string, args [][]byte) (string, [][]byte, bool) {
+	if len(args) < 3 || !bytes.EqualFold(args[1], []byte("fields")) {
+		return "", nil, false
+	}
+	return "hset", append([][]byte{args[0]}, args[3:]...), true
+}
+
+// hgetex key [EX seconds | PX milliseconds | EXAT unix-time-seconds | PXAT unix-time-milliseconds | PERSIST] FIELDS numfields field [field ...]
+func downgradeHgetex(_ *cmdDowngrader, _ string, args [][]byte) (string, [][]byte, bool) {
+	if len(args) > 1 && bytes.EqualFold(args[1], []byte("fields")) {
+		return "", nil, true
+	}
+	return "", nil, false
+}
+
+// hgetdel key FIELDS numfields field [field ...]
+func downgradeHgetdel(_ *cmdDowngrader, _ string, args [][]byte) (string, [][]byte, bool) {
+	if len(args) < 4 || !bytes.EqualFold(args[1], []byte("fields")) {
+		return "", nil, false
+	}
+	return "hdel", append([][]byte{args[0]}, args[3:]...), true
+}
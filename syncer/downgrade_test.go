@@ -0,0 +1,80 @@
+package syncer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mgtv-tech/redis-GunYu/config"
+	"github.com/mgtv-tech/redis-GunYu/pkg/log"
+)
+
+func TestCmdDowngrader(t *testing.T) {
+	assert.Nil(t, newCmdDowngrader("in", "", config.UnsupportedCmdFail, nil))
+
+	type testCase struct {
+		cmd     string
+		args    []string
+		newCmd  string
+		newArgs []string
+		skip    bool
+		fail    bool
+	}
+	run := func(cd *cmdDowngrader, cases []testCase) {
+		for _, c := range cases {
+			args := [][]byte{}
+			for _, arg := range c.args {
+				args = append(args, []byte(arg))
+			}
+			cmd, newArgs, skip, err := cd.Downgrade(c.cmd, args)
+			assert.Equal(t, c.fail, err != nil, c.cmd)
+			assert.Equal(t, c.skip, skip, c.cmd)
+			if c.fail || c.skip {
+				continue
+			}
+			assert.Equal(t, c.newCmd, cmd, c.cmd)
+			expected := [][]byte{}
+			for _, arg := range c.newArgs {
+				expected = append(expected, []byte(arg))
+			}
+			assert.Equal(t, expected, newArgs, c.cmd)
+		}
+	}
+
+	cd := newCmdDowngrader("in", "5.0.7", config.UnsupportedCmdFail, log.WithLogger(""))
+	cd.now = func() time.Time { return time.UnixMilli(1000000) }
+	run(cd, []testCase{
+		{cmd: "set", args: []string{"k", "v"}, newCmd: "set", newArgs: []string{"k", "v"}},
+		{cmd: "set", args: []string{"k", "v", "NX", "GET", "PXAT", "1000100"}, newCmd: "set", newArgs: []string{"k", "v", "NX", "PX", "100"}},
+		{cmd: "set", args: []string{"k", "v", "exat", "999"}, newCmd: "set", newArgs: []string{"k", "v", "PX", "1"}},
+		{cmd: "set", args: []string{"k", "v", "KEEPTTL"}, fail: true},
+		{cmd: "getex", args: []string{"k", "EX", "10"}, newCmd: "expire", newArgs: []string{"k", "10"}},
+		{cmd: "getex", args: []string{"k", "PERSIST"}, newCmd: "persist", newArgs: []string{"k"}},
+		{cmd: "getex", args: []string{"k"}, skip: true},
+		{cmd: "getdel", args: []string{"k"}, newCmd: "del", newArgs: []string{"k"}},
+		{cmd: "lpop", args: []string{"k"}, newCmd: "lpop", newArgs: []string{"k"}},
+		{cmd: "rpop", args: []string{"k", "3"}, newCmd: "eval", newArgs: []string{downgradePopScript, "1", "k", "rpop", "3"}},
+		{cmd: "lmove", args: []string{"a", "b", "RIGHT", "LEFT"}, newCmd: "rpoplpush", newArgs: []string{"a", "b"}},
+		{cmd: "blmove", args: []string{"a", "b", "LEFT", "RIGHT", "0"}, newCmd: "eval", newArgs: []string{downgradeMoveScript, "2", "a", "b", "lpop", "rpush"}},
+		{cmd: "copy", args: []string{"a", "b", "REPLACE"}, newCmd: "eval", newArgs: []string{downgradeCopyScript, "2", "a", "b", "1"}},
+		{cmd: "copy", args: []string{"a", "b", "DB", "1"}, fail: true},
+		{cmd: "lmpop", args: []string{"2", "a", "b", "LEFT", "COUNT", "2"}, newCmd: "eval", newArgs: []string{downgradePopScript, "2", "a", "b", "lpop", "2"}},
+		{cmd: "bzmpop", args: []string{"1", "1", "z", "MAX"}, newCmd: "eval", newArgs: []string{downgradePopScript, "1", "z", "zpopmax", "1"}},
+		{cmd: "sintercard", args: []string{"1", "a"}, skip: true},
+		{cmd: "expire", args: []string{"k", "10"}, newCmd: "expire", newArgs: []string{"k", "10"}},
+		{cmd: "expire", args: []string{"k", "10", "NX"}, fail: true},
+		{cmd: "hexpire", args: []string{"h", "10", "FIELDS", "1", "f"}, fail: true},
+		{cmd: "hsetex", args: []string{"h", "FIELDS", "1", "f", "v"}, newCmd: "hset", newArgs: []string{"h", "f", "v"}},
+		{cmd: "hsetex", args: []string{"h", "EX", "10", "FIELDS", "1", "f", "v"}, fail: true},
+		{cmd: "hgetdel", args: []string{"h", "FIELDS", "2", "f1", "f2"}, newCmd: "hdel", newArgs: []string{"h", "f1", "f2"}},
+		{cmd: "hset", args: []string{"h", "f", "v"}, newCmd: "hset", newArgs: []string{"h", "f", "v"}},
+	})
+
+	cd = newCmdDowngrader("in", "7.2.4", config.UnsupportedCmdSkip, log.WithLogger(""))
+	run(cd, []testCase{
+		{cmd: "copy", args: []string{"a", "b", "DB", "1"}, newCmd: "copy", newArgs: []string{"a", "b", "DB", "1"}},
+		{cmd: "hexpire", args: []string{"h", "10", "FIELDS", "1", "f"}, skip: true},
+		{cmd: "hgetex", args: []string{"h", "FIELDS", "1", "f"}, skip: true},
+	})
+}
@@ -0,0 +1,455 @@
+package syncer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"golang.org/x/exp/slices"
+
+	"github.com/mgtv-tech/redis-GunYu/config"
+	"github.com/mgtv-tech/redis-GunYu/pkg/filter"
+	"github.com/mgtv-tech/redis-GunYu/pkg/log"
+	"github.com/mgtv-tech/redis-GunYu/pkg/metric"
+	"github.com/mgtv-tech/redis-GunYu/pkg/rdb"
+	"github.com/mgtv-tech/redis-GunYu/pkg/redis"
+	"github.com/mgtv-tech/redis-GunYu/pkg/store"
+	usync "github.com/mgtv-tech/redis-GunYu/pkg/sync"
+	"github.com/mgtv-tech/redis-GunYu/pkg/util"
+)
+
+var (
+	dryRunCmdCounter = metric.NewCounterVec(metric.CounterVecOpts{
+		Namespace: config.AppName,
+		Subsystem: "output",
+		Name:      "dry_run_cmd",
+		Labels:    []string{"input", "phase", "db", "cmd"},
+	})
+	dryRunPrefixCounter = metric.NewCounterVec(metric.CounterVecOpts{
+		Namespace: config.AppName,
+		Subsystem: "output",
+		Name:      "dry_run_prefix",
+		Labels:    []string{"input", "prefix"},
+	})
+	dryRunSizeCounter = metric.NewCounterVec(metric.CounterVecOpts{
+		Namespace: config.AppName,
+		Subsystem: "output",
+		Name:      "dry_run_size",
+		Labels:    []string{"input", "phase"},
+	})
+	dryRunErrorCounter = metric.NewCounterVec(metric.CounterVecOpts{
+		Namespace: config.AppName,
+		Subsystem: "output",
+		Name:      "dry_run_error",
+		Labels:    []string{"input", "reason"},
+	})
+)
+
+const (
+	dryRunPhaseRdb = "rdb"
+	dryRunPhaseAof = "aof"
+
+	dryRunErrOversize    = "oversize"    // a bulk is larger than maxProtoBulkLen
+	dryRunErrUnsupported = "unsupported" // the command isn't supported by the version of target
+	dryRunErrCrossSlot   = "crossslot"   // keys of the command are in different slots of the cluster
+
+	// prefix of a key is the part before the first delimiter, including the delimiter
+	dryRunPrefixDelimiter = ':'
+	dryRunNoPrefix        = "(none)"
+	// prefixes are counted up to maxDryRunPrefixes, others are counted as dryRunOtherPrefix
+	maxDryRunPrefixes = 1000
+	dryRunOtherPrefix = "(other)"
+	// the summary logs the top prefixes
+	dryRunSummaryPrefixes = 20
+)
+
+type DryRunOutputConfig struct {
+	InputName string
+	// Parser filters, rewrites and parses commands, it never connects to redis,
+	// Parser.Redis describes the target, e.g. type and version
+	Parser RedisOutputConfig
+}
+
+// DryRunOutput counts commands which would be written to the target instead of writing them,
+// results are exposed in metrics and logged as a summary
+type DryRunOutput struct {
+	cfg    DryRunOutputConfig
+	logger log.Logger
+	parser *RedisOutput
+	stats  *dryRunStats
+
+	cpGuard         sync.RWMutex
+	checkpointInMem StartPoint
+
+	ttlDropped []byte // big key skipped by the ttl policy
+}
+
+func NewDryRunOutput(cfg DryRunOutputConfig) *DryRunOutput {
+	do := &DryRunOutput{
+		cfg:    cfg,
+		logger: log.WithLogger(config.LogModuleName(fmt.Sprintf("[DryRunOutput(%s)] ", cfg.InputName))),
+		parser: NewRedisOutput(cfg.Parser),
+		stats:  newDryRunStats(cfg.InputName),
+	}
+	do.parser.dryRun = do.stats
+	do.checkpointInMem.Initialize()
+	return do
+}
+
+func (do *DryRunOutput) Close() {
+	do.stats.logSummary(do.logger)
+}
+
+func (do *DryRunOutput) StartPoint(ctx context.Context, runIds []string) (StartPoint, error) {
+	do.cpGuard.RLock()
+	defer do.cpGuard.RUnlock()
+	sp := do.checkpointInMem
+	if sp.IsInitial() || !slices.Contains(runIds, sp.RunId) {
+		sp.Initialize()
+		return sp, nil
+	}
+	do.parser.startDbId = sp.DbId
+	return sp, nil
+}
+
+// SetRunId moves the checkpoint to run id
+func (do *DryRunOutput) SetRunId(ctx context.Context, id string) error {
+	do.cpGuard.Lock()
+	defer do.cpGuard.Unlock()
+	if !do.checkpointInMem.IsInitial() {
+		do.checkpointInMem.RunId = id
+	}
+	return nil
+}
+
+func (do *DryRunOutput) setCheckpoint(runId string, offset int64, db int) {
+	do.cpGuard.Lock()
+	defer do.cpGuard.Unlock()
+	do.checkpointInMem = StartPoint{DbId: db, RunId: runId, Offset: offset}
+}
+
+func (do *DryRunOutput) Send(ctx context.Context, reader *store.Reader) error {
+	var err error
+	if reader.IsAof() {
+		err = do.sendAof(ctx, reader)
+	} else if err = do.SendRdb(ctx, reader); err == nil {
+		// the summary of the full sync, the final one is logged when the output is closed
+		do.stats.logSummary(do.logger)
+	}
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			err = errors.Join(err, ErrRestart)
+			do.logger.Infof("send done : runId(%s), offset(%d), size(%d)", reader.RunId(), reader.Left(), reader.Size())
+		} else {
+			do.logger.Errorf("send done : runId(%s), offset(%d), size(%d), error(%v)", reader.RunId(), reader.Left(), reader.Size(), err)
+		}
+	}
+	return err
+}
+
+func (do *DryRunOutput) sendAof(ctx context.Context, reader *store.Reader) error {
+	runId := reader.RunId()
+	do.logger.Infof("send aof : runId(%s), offset(%d), size(%d)", runId, reader.Left(), reader.Size())
+	do.parser.stats(ctx)
+
+	sendBuf := make(chan cmdExecution, do.cfg.Parser.BatchCmdCount*10)
+	replayQuit := usync.NewWaitCloserFromContext(ctx, nil)
+	usync.SafeGo(func() {
+		err := do.parser.parseAofCommand(replayQuit, reader.IoReader(), reader.Left(), sendBuf)
+		if err != nil {
+			replayQuit.Close(err)
+		}
+	}, func(i interface{}) { replayQuit.Close(fmt.Errorf("panic: %v", i)) })
+
+	do.countCmds(replayQuit, runId, sendBuf)
+	return replayQuit.Error()
+}
+
+// countCmds counts commands until replayQuit is closed, the checkpoint is moved after every command
+func (do *DryRunOutput) countCmds(replayQuit usync.WaitCloser, runId string, sendBuf chan cmdExecution) {
+	db := do.parser.startDbId
+	for {
+		select {
+		case <-replayQuit.Done():
+			return
+		case exec := <-sendBuf:
+			switch exec.Cmd {
+			case "ping":
+			case "select":
+				db = exec.Db
+			default:
+				do.parser.absoluteTtl(&exec)
+				args := make([][]byte, 0, len(exec.Args))
+				for _, arg := range exec.Args {
+					args = append(args, arg.([]byte))
+				}
+				do.countCmd(dryRunPhaseAof, db, exec.Cmd, args)
+				do.parser.sendCounterAdd(1)
+			}
+			do.setCheckpoint(runId, exec.Offset, db)
+		}
+	}
+}
+
+// countCmd counts a command, the first argument is the key if the command has keys
+func (do *DryRunOutput) countCmd(phase string, db int, cmd string, args [][]byte) {
+	var key []byte
+	if idx := filter.KeyIndexes(cmd, args); len(idx) > 0 {
+		key = args[idx[0]]
+		if do.cfg.Parser.Redis.IsCluster() && crossSlot(args, idx) {
+			do.stats.addError(dryRunErrCrossSlot)
+		}
+	}
+	if oversizeArgs(args, do.cfg.Parser.MaxProtoBulkLen) {
+		do.stats.addError(dryRunErrOversize)
+	}
+	do.stats.add(phase, db, cmd, key, respSize(cmd, args))
+}
+
+// SendRdb counts rdb entries by types, an entry is replayed by RESTORE or by commands
+// if it can't be restored, then its commands are checked
+func (do *DryRunOutput) SendRdb(ctx context.Context, reader *store.Reader) error {
+	runId, offset := reader.RunId(), reader.Left()
+	do.logger.Infof("send rdb : runId(%s), offset(%d), size(%d)", runId, offset, reader.Size())
+
+	version := do.cfg.Parser.Redis.Version
+	if version == "" {
+		// the version of target is unknown, commands of rdb entries are converted for the latest redis
+		version = cdcRedisVersion
+	}
+	var readBytes atomic.Int64
+	pipe := rdb.ParseRdb(reader.IoReader(), &readBytes, config.RdbPipeSize,
+		rdb.WithTargetRedisVersion(version), rdb.WithFunctionExists(do.cfg.Parser.FunctionExists))
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case e, ok := <-pipe:
+			if !ok {
+				return errors.Join(ErrCorrupted, errors.New("rdb is incomplete"))
+			}
+			if e.Err != nil {
+				return e.Err
+			}
+			if e.Done {
+				do.parser.startDbId = 0
+				do.setCheckpoint(runId, offset, 0)
+				do.logger.Infof("send rdb done : runId(%s), offset(%d), read(%d)", runId, offset, readBytes.Load())
+				return nil
+			}
+			if err := do.countRdbEntry(e); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (do *DryRunOutput) countRdbEntry(e *rdb.BinEntry) (err error) {
+	ot := e.ObjectParser.Type()
+	if ot == rdb.RdbObjectAux {
+		return nil
+	}
+	db := int(e.DB)
+	if ot != rdb.RdbObjectFunction {
+		if do.parser.filterDb(db) || do.parser.filterKey(util.BytesToString(e.Key)) || do.parser.rewriteRdbTtl(e, &do.ttlDropped) {
+			do.parser.rdbFilterCounterAdd(1)
+			return nil
+		}
+		db, _ = do.parser.selectDB(-1, db)
+		e.Key = do.parser.rewriteKey(e.Key)
+	}
+
+	var key []byte
+	if e.FirstBin() && ot != rdb.RdbObjectFunction {
+		key = e.Key
+		do.parser.rdbSendCounterAdd(1)
+	}
+	if do.cfg.Parser.ReplayRdbEnableRestore && ot != rdb.RdbObjectFunction && e.CanRestore() &&
+		!e.ObjectParser.IsSplited() && e.ObjectParser.ValueDumpSize() <= do.cfg.Parser.MaxProtoBulkLen {
+		do.stats.add(dryRunPhaseRdb, db, rdb.RdbObjectTypeToString(ot), key, int64(len(e.Key)+e.ObjectParser.ValueDumpSize()))
+		return nil
+	}
+
+	size := int64(0)
+	oversize := false
+	defer util.Xrecover(&err, ErrCorrupted)
+	e.ExecCmd(func(cmd string, args ...interface{}) error {
+		bargs := make([][]byte, 0, len(args))
+		for _, arg := range args {
+			switch v := arg.(type) {
+			case []byte:
+				bargs = append(bargs, v)
+			case string:
+				bargs = append(bargs, []byte(v))
+			default:
+				bargs = append(bargs, []byte(fmt.Sprint(v)))
+			}
+		}
+		size += respSize(cmd, bargs)
+		oversize = oversize || oversizeArgs(bargs, do.cfg.Parser.MaxProtoBulkLen)
+		return nil
+	})
+	if oversize {
+		do.stats.addError(dryRunErrOversize)
+	}
+	do.stats.add(dryRunPhaseRdb, db, rdb.RdbObjectTypeToString(ot), key, size)
+	return nil
+}
+
+// crossSlot returns true if keys of args are in different slots
+func crossSlot(args [][]byte, idx []int) bool {
+	slot := redis.KeyToSlot(util.BytesToString(args[idx[0]]))
+	for _, i := range idx[1:] {
+		if redis.KeyToSlot(util.BytesToString(args[i])) != slot {
+			return true
+		}
+	}
+	return false
+}
+
+func oversizeArgs(args [][]byte, maxLen int) bool {
+	if maxLen <= 0 {
+		return false
+	}
+	for _, arg := range args {
+		if len(arg) > maxLen {
+			return true
+		}
+	}
+	return false
+}
+
+// respSize returns the size of the command encoded in RESP
+func respSize(cmd string, args [][]byte) int64 {
+	bulk := func(n int) int64 {
+		return int64(1 + len(strconv.Itoa(n)) + 2 + n + 2) // $n\r\n...\r\n
+	}
+	size := int64(1+len(strconv.Itoa(len(args)+1))+2) + bulk(len(cmd))
+	for _, arg := range args {
+		size += bulk(len(arg))
+	}
+	return size
+}
+
+// keyPrefix returns the part of key before the first delimiter, including the delimiter
+func keyPrefix(key []byte) string {
+	i := strings.IndexByte(util.BytesToString(key), dryRunPrefixDelimiter)
+	if i < 0 {
+		return dryRunNoPrefix
+	}
+	return string(key[:i+1])
+}
+
+type dryRunCmd struct {
+	phase string
+	db    int
+	cmd   string // command, or type of an rdb entry
+}
+
+// dryRunStats counts commands which would be written
+type dryRunStats struct {
+	input    string
+	mux      sync.Mutex
+	cmds     map[dryRunCmd]int64
+	prefixes map[string]int64
+	sizes    map[string]int64 // by phase
+	errors   map[string]int64 // by reason
+}
+
+func newDryRunStats(input string) *dryRunStats {
+	return &dryRunStats{
+		input:    input,
+		cmds:     make(map[dryRunCmd]int64),
+		prefixes: make(map[string]int64),
+		sizes:    make(map[string]int64),
+		errors:   make(map[string]int64),
+	}
+}
+
+// add counts a command, key is nil if the command has no keys
+func (st *dryRunStats) add(phase string, db int, cmd string, key []byte, size int64) {
+	st.mux.Lock()
+	defer st.mux.Unlock()
+
+	st.cmds[dryRunCmd{phase: phase, db: db, cmd: cmd}]++
+	st.sizes[phase] += size
+	dryRunCmdCounter.Inc(st.input, phase, strconv.Itoa(db), cmd)
+	dryRunSizeCounter.Add(float64(size), st.input, phase)
+	if key == nil {
+		return
+	}
+	prefix := keyPrefix(key)
+	if _, ok := st.prefixes[prefix]; !ok && len(st.prefixes) >= maxDryRunPrefixes {
+		prefix = dryRunOtherPrefix
+	}
+	st.prefixes[prefix]++
+	dryRunPrefixCounter.Inc(st.input, prefix)
+}
+
+func (st *dryRunStats) addError(reason string) {
+	st.mux.Lock()
+	defer st.mux.Unlock()
+	st.errors[reason]++
+	dryRunErrorCounter.Inc(st.input, reason)
+}
+
+func (st *dryRunStats) logSummary(logger log.Logger) {
+	st.mux.Lock()
+	defer st.mux.Unlock()
+
+	for _, phase := range []string{dryRunPhaseRdb, dryRunPhaseAof} {
+		total := int64(0)
+		for c, n := range st.cmds {
+			if c.phase == phase {
+				total += n
+			}
+		}
+		logger.Infof("dry run summary : phase(%s), cmds(%d), size(%d)", phase, total, st.sizes[phase])
+	}
+
+	cmds := make([]dryRunCmd, 0, len(st.cmds))
+	for c := range st.cmds {
+		cmds = append(cmds, c)
+	}
+	sort.Slice(cmds, func(i, j int) bool {
+		if cmds[i].phase != cmds[j].phase {
+			return cmds[i].phase > cmds[j].phase // rdb first
+		}
+		if cmds[i].db != cmds[j].db {
+			return cmds[i].db < cmds[j].db
+		}
+		return cmds[i].cmd < cmds[j].cmd
+	})
+	for _, c := range cmds {
+		logger.Infof("dry run cmds : phase(%s), db(%d), cmd(%s), count(%d)", c.phase, c.db, c.cmd, st.cmds[c])
+	}
+
+	prefixes := make([]string, 0, len(st.prefixes))
+	for p := range st.prefixes {
+		prefixes = append(prefixes, p)
+	}
+	sort.Slice(prefixes, func(i, j int) bool {
+		if st.prefixes[prefixes[i]] != st.prefixes[prefixes[j]] {
+			return st.prefixes[prefixes[i]] > st.prefixes[prefixes[j]]
+		}
+		return prefixes[i] < prefixes[j]
+	})
+	if len(prefixes) > dryRunSummaryPrefixes {
+		prefixes = prefixes[:dryRunSummaryPrefixes]
+	}
+	for _, p := range prefixes {
+		logger.Infof("dry run prefixes : prefix(%s), count(%d)", p, st.prefixes[p])
+	}
+
+	for _, reason := range []string{dryRunErrOversize, dryRunErrUnsupported, dryRunErrCrossSlot} {
+		if n := st.errors[reason]; n > 0 {
+			logger.Warnf("dry run errors : reason(%s), count(%d)", reason, n)
+		}
+	}
+}
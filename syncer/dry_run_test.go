@@ -0,0 +1,96 @@
+package syncer
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mgtv-tech/redis-GunYu/config"
+	usync "github.com/mgtv-tech/redis-GunYu/pkg/sync"
+)
+
+func TestDryRunOutputAof(t *testing.T) {
+	do := NewDryRunOutput(DryRunOutputConfig{
+		InputName: "127.0.0.1:6379/dryrun",
+		Parser: RedisOutputConfig{
+			InputName:       "127.0.0.1:6379/dryrun",
+			Redis:           config.RedisConfig{Type: config.RedisTypeCluster, Version: "7.0"},
+			TargetDb:        -1,
+			MaxProtoBulkLen: 6,
+			UnsupportedCmd:  config.UnsupportedCmdFail,
+			Filter: config.FilterConfig{
+				KeyFilter: &config.FilterKeyConfig{PrefixKeyBlacklist: []string{"tmp"}},
+			},
+		},
+	})
+
+	sp, err := do.StartPoint(context.Background(), []string{"id1"})
+	assert.Nil(t, err)
+	assert.True(t, sp.IsInitial())
+
+	cmds := "*2\r\n$6\r\nselect\r\n$1\r\n1\r\n" +
+		"*3\r\n$3\r\nset\r\n$6\r\nuser:1\r\n$1\r\nv\r\n" +
+		"*3\r\n$3\r\nset\r\n$4\r\ntmp1\r\n$1\r\nv\r\n" +
+		"*5\r\n$4\r\nmset\r\n$1\r\na\r\n$1\r\nb\r\n$1\r\nc\r\n$1\r\nd\r\n" +
+		"*3\r\n$3\r\nset\r\n$6\r\nuser:2\r\n$7\r\nvvvvvvv\r\n" +
+		"*6\r\n$7\r\nhexpire\r\n$1\r\nh\r\n$2\r\n10\r\n$6\r\nFIELDS\r\n$1\r\n1\r\n$1\r\nf\r\n"
+	rd, wr := io.Pipe()
+	defer wr.Close()
+	go wr.Write([]byte(cmds))
+
+	wait := usync.NewWaitCloser(nil)
+	sendBuf := make(chan cmdExecution, 10)
+	go do.parser.parseAofCommand(wait, bufio.NewReader(rd), 100, sendBuf)
+	done := make(chan struct{})
+	go func() {
+		do.countCmds(wait, "id1", sendBuf)
+		close(done)
+	}()
+
+	// hexpire is the last command, and it's counted as an error
+	assert.Eventually(t, func() bool {
+		do.stats.mux.Lock()
+		defer do.stats.mux.Unlock()
+		return do.stats.errors[dryRunErrUnsupported] == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Eventually(t, func() bool {
+		sp, err = do.StartPoint(context.Background(), []string{"id1"})
+		return err == nil && sp.DbId == 1 && sp.Offset > 100
+	}, 5*time.Second, 10*time.Millisecond)
+	wait.Close(nil)
+	<-done
+
+	do.stats.mux.Lock()
+	defer do.stats.mux.Unlock()
+	assert.Equal(t, map[dryRunCmd]int64{
+		{phase: dryRunPhaseAof, db: 1, cmd: "set"}:  2,
+		{phase: dryRunPhaseAof, db: 1, cmd: "mset"}: 1,
+	}, do.stats.cmds)
+	assert.Equal(t, map[string]int64{"user:": 2, dryRunNoPrefix: 1}, do.stats.prefixes)
+	assert.Equal(t, map[string]int64{dryRunErrUnsupported: 1, dryRunErrCrossSlot: 1, dryRunErrOversize: 1}, do.stats.errors)
+	assert.Equal(t, respSize("set", [][]byte{[]byte("user:1"), []byte("v")})+
+		respSize("mset", [][]byte{[]byte("a"), []byte("b"), []byte("c"), []byte("d")})+
+		respSize("set", [][]byte{[]byte("user:2"), []byte("vvvvvvv")}), do.stats.sizes[dryRunPhaseAof])
+}
+
+func TestDryRunStats(t *testing.T) {
+	assert.Equal(t, int64(len("*3\r\n$3\r\nset\r\n$1\r\nk\r\n$2\r\nvv\r\n")), respSize("set", [][]byte{[]byte("k"), []byte("vv")}))
+	assert.Equal(t, "a:", keyPrefix([]byte("a:b:c")))
+	assert.Equal(t, dryRunNoPrefix, keyPrefix([]byte("abc")))
+
+	// prefixes are limited
+	st := newDryRunStats("dryrun-stats")
+	for i := 0; i < maxDryRunPrefixes+10; i++ {
+		st.add(dryRunPhaseRdb, 0, "string", []byte(fmt.Sprintf("p%d:k", i)), 1)
+	}
+	st.add(dryRunPhaseRdb, 0, "string", []byte("p0:k"), 1)
+	assert.Len(t, st.prefixes, maxDryRunPrefixes+1)
+	assert.Equal(t, int64(10), st.prefixes[dryRunOtherPrefix])
+	assert.Equal(t, int64(2), st.prefixes["p0:"])
+	assert.Equal(t, int64(maxDryRunPrefixes+11), st.sizes[dryRunPhaseRdb])
+}
@@ -5,12 +5,14 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"sync"
 	"time"
 
 	"golang.org/x/exp/slices"
 
 	"github.com/mgtv-tech/redis-GunYu/config"
+	"github.com/mgtv-tech/redis-GunYu/pkg/crypto"
 	"github.com/mgtv-tech/redis-GunYu/pkg/log"
 	"github.com/mgtv-tech/redis-GunYu/pkg/metric"
 	"github.com/mgtv-tech/redis-GunYu/pkg/redis"
@@ -60,7 +62,7 @@ type Input interface {
 	Id() string
 	Run() error
 	Stop() error
-	SetOutput(output Output) // @TODO multi outputs
+	SetOutputs(outputs ...Output) // the first one is the output, others are extra outputs
 	SetChannel(ch Channel)
 	StateNotify(SyncState) usync.WaitChannel
 	RunIds() []string
@@ -71,7 +73,7 @@ type RedisInput struct {
 	cfg       config.RedisConfig
 	wait      usync.WaitCloser
 	channel   Channel
-	output    Output
+	outputs   []Output
 	fsm       *SyncFiniteStateMachine
 	logger    log.Logger
 	runIds    []string
@@ -80,11 +82,16 @@ type RedisInput struct {
 }
 
 type StorerConf struct {
-	InputId string
-	Dir     string
-	MaxSize int64
-	LogSize int64
-	flush   config.FlushPolicy
+	InputId   string
+	Dir       string
+	MaxSize   int64
+	LogSize   int64
+	flush     config.FlushPolicy
+	keyring   *crypto.Keyring
+	tier      *store.RemoteTier
+	retention store.Retention
+	scrub     *config.StorerScrubConfig
+	disk      *config.StorerDiskConfig
 }
 
 func NewRedisInput(redisCfg config.RedisConfig) *RedisInput {
@@ -116,8 +123,8 @@ func (ri *RedisInput) Id() string {
 	return ri.cfg.Address()
 }
 
-func (ri *RedisInput) SetOutput(output Output) {
-	ri.output = output
+func (ri *RedisInput) SetOutputs(outputs ...Output) {
+	ri.outputs = outputs
 }
 
 func (ri *RedisInput) SetChannel(ch Channel) {
@@ -150,7 +157,7 @@ func (ri *RedisInput) setRunIds(ids []string) {
 	ri.runIds = ids
 }
 
-func (ri *RedisInput) fetchInput(wait usync.WaitCloser) (outSp StartPoint) {
+func (ri *RedisInput) fetchInput(wait usync.WaitCloser) (outSps []StartPoint) {
 	// RDB concurrency limit
 	if !ri.rdbLimiterAcquire(wait.Done()) {
 		return
@@ -165,12 +172,12 @@ func (ri *RedisInput) fetchInput(wait usync.WaitCloser) (outSp StartPoint) {
 	}
 
 	// meta
-	isFullSync, rdbSize, locSp, outSp, err := ri.syncMeta(wait.Context(), redisCli)
+	isFullSync, rdbSize, locSp, outSps, err := ri.syncMeta(wait.Context(), redisCli)
 	if err != nil {
 		wait.Close(err)
 		ri.rdbLimiterRelease()
 		redisCli.Close()
-		return
+		return nil
 	}
 
 	// data
@@ -178,9 +185,9 @@ func (ri *RedisInput) fetchInput(wait usync.WaitCloser) (outSp StartPoint) {
 	return
 }
 
-func (ri *RedisInput) getOutputStartPoint(ctx context.Context, ids []string) (sp StartPoint, err error) {
+func (ri *RedisInput) getOutputStartPoint(ctx context.Context, output Output, ids []string) (sp StartPoint, err error) {
 	util.RetryLinearJitter(ctx, func() error {
-		sp, err = ri.output.StartPoint(ctx, ids)
+		sp, err = output.StartPoint(ctx, ids)
 		return err
 	}, 3, time.Second*2, 0.5)
 	if err != nil {
@@ -189,8 +196,33 @@ func (ri *RedisInput) getOutputStartPoint(ctx context.Context, ids []string) (sp
 	return
 }
 
-func (ri *RedisInput) syncMeta(ctx context.Context, redisCli *redis.StandaloneRedis) (isFullSync bool, rdbSize int64, locSp StartPoint, outSp StartPoint, err error) {
-	var clearLocal bool
+// outputStartPoints returns the checkpoint of every output, the order is the same as outputs
+func (ri *RedisInput) outputStartPoints(ctx context.Context, inputIds []string) ([]StartPoint, error) {
+	outSps := make([]StartPoint, len(ri.outputs))
+	for i, output := range ri.outputs {
+		sp, err := ri.getOutputStartPoint(ctx, output, inputIds)
+		if err != nil {
+			return nil, fmt.Errorf("output start point error : runIds(%v), err(%w)", inputIds, err)
+		}
+		outSps[i] = sp
+	}
+	return outSps, nil
+}
+
+// minStartPoint returns the start point of the slowest output, input psyncs from it
+func minStartPoint(outSps []StartPoint) StartPoint {
+	minSp := outSps[0]
+	for _, outSp := range outSps[1:] {
+		if outSp.Offset < minSp.Offset {
+			minSp = outSp
+		}
+	}
+	return minSp
+}
+
+// syncMeta returns start points of outputs, the order is the same as outputs
+func (ri *RedisInput) syncMeta(ctx context.Context, redisCli *redis.StandaloneRedis) (isFullSync bool, rdbSize int64, locSp StartPoint, outSps []StartPoint, err error) {
+	var clearLocal, bootstrap bool
 	var sOffset Offset
 	var id1, id2 string
 	synSp := StartPoint{}
@@ -202,9 +234,8 @@ func (ri *RedisInput) syncMeta(ctx context.Context, redisCli *redis.StandaloneRe
 	inputIds := []string{id1, id2}
 	ri.setRunIds(inputIds)
 
-	outSp, err = ri.getOutputStartPoint(ctx, inputIds)
+	outSps, err = ri.outputStartPoints(ctx, inputIds)
 	if err != nil {
-		err = fmt.Errorf("output start point error : runIds(%v), err(%w)", inputIds, err)
 		// may cause full sync if does not return
 		// else, can not ingest input to local if output is fail
 		return
@@ -214,43 +245,50 @@ func (ri *RedisInput) syncMeta(ctx context.Context, redisCli *redis.StandaloneRe
 		ri.logger.Errorf("channel start point error : runIds(%v), err(%v)", inputIds, err)
 	}
 
-	ri.logger.Debugf("meta : runId(%s - %s), locSp(%v), outSp(%v)", id1, id2, locSp, outSp)
+	ri.logger.Debugf("meta : runId(%s - %s), locSp(%v), outSps(%v)", id1, id2, locSp, outSps)
 
-	// outSp and locSp are valid and belong to inputIds
-	if slices.Contains(inputIds, outSp.RunId) && slices.Contains(inputIds, locSp.RunId) {
+	// outputs belong to inputIds
+	outValid := true
+	// outputs are in channel, or initial
+	outInLocal, outInitial, outResumable := true, false, false
+	for _, outSp := range outSps {
+		if !slices.Contains(inputIds, outSp.RunId) {
+			outValid = false
+		}
+		if outSp.IsInitial() {
+			outInitial = true
+		} else if !slices.Contains(inputIds, outSp.RunId) ||
+			!ri.channel.IsValidOffset(Offset{RunId: locSp.RunId, Offset: outSp.Offset}) {
+			outInLocal = false
+		} else {
+			outResumable = true
+		}
+	}
+	locValid := slices.Contains(inputIds, locSp.RunId)
+
+	if outValid && locValid && outInLocal {
 		// outSp in locSp : two cases
 		// 1. channel.left <= output.offset <= channel.right :
 		// 2. output.offset < channel.left and channel.hasRdb :
+		sOffset, isFullSync, rdbSize, err = ri.pSync(redisCli, locSp.ToOffset())
+		if err != nil {
+			return
+		}
+	} else if outValid {
 		// outSp not in locSp :
 		// 3. channel.right < output.offset :
-		if ri.channel.IsValidOffset(Offset{RunId: locSp.RunId, Offset: outSp.Offset}) {
-			sOffset, isFullSync, rdbSize, err = ri.pSync(redisCli, locSp.ToOffset())
-			if err != nil {
-				return
-			}
-		} else {
-			// there is a gap between output and channel [@TODO, @OPTIMIZE : check distance of gap]
-			// channel.Clear(); locSp = outSp
-			sOffset, isFullSync, rdbSize, err = ri.pSync(redisCli, outSp.ToOffset())
-			if err != nil {
-				return
-			}
-			clearLocal = true
-			if !isFullSync {
-				locSp = StartPoint{RunId: sOffset.RunId, Offset: outSp.Offset}
-			}
-		}
-	} else if slices.Contains(inputIds, outSp.RunId) {
-		// local is stale, set locSp to outSp
-		sOffset, isFullSync, rdbSize, err = ri.pSync(redisCli, outSp.ToOffset())
+		// there is a gap between output and channel, or local is stale [@TODO, @OPTIMIZE : check distance of gap]
+		// channel.Clear(); locSp = the minimal outSp
+		minSp := minStartPoint(outSps)
+		sOffset, isFullSync, rdbSize, err = ri.pSync(redisCli, minSp.ToOffset())
 		if err != nil {
 			return
 		}
 		clearLocal = true
 		if !isFullSync {
-			locSp = StartPoint{RunId: sOffset.RunId, Offset: outSp.Offset}
+			locSp = StartPoint{RunId: sOffset.RunId, Offset: minSp.Offset}
 		}
-	} else if slices.Contains(inputIds, locSp.RunId) && outSp.IsInitial() { // outSp is ?
+	} else if locValid && outInLocal && outInitial { // some outSps are ?
 		// @TODO @OPTIMIZE : if gap is very large, it's better to send full sync
 		// channel has a RDB file, so set offset to zero
 		locRdbLeft, locRdbSize := ri.channel.GetRdb(locSp.RunId)
@@ -262,9 +300,20 @@ func (ri *RedisInput) syncMeta(ctx context.Context, redisCli *redis.StandaloneRe
 			if !isFullSync { // continue to sync with local RDB
 				_, locRight := ri.channel.GetOffsetRange(locSp.RunId)
 				locSp.Offset = locRight
-				outSp.Offset = locRdbLeft - locRdbSize
+				for i := range outSps {
+					if outSps[i].IsInitial() {
+						outSps[i].Offset = locRdbLeft - locRdbSize
+					}
+				}
 				rdbSize = locRdbSize
 			}
+		} else if outResumable {
+			// other outputs continue with channel, rdb of channel has been gc'd, so initial outputs bootstrap by their own full sync
+			sOffset, isFullSync, rdbSize, err = ri.pSync(redisCli, locSp.ToOffset())
+			if err != nil {
+				return
+			}
+			bootstrap = !isFullSync
 		} else {
 			synSp.Initialize()
 			sOffset, isFullSync, rdbSize, err = ri.pSync(redisCli, synSp.ToOffset())
@@ -280,7 +329,7 @@ func (ri *RedisInput) syncMeta(ctx context.Context, redisCli *redis.StandaloneRe
 		}
 	}
 
-	ri.logger.Infof("psync : runId(%s - %s), local(%v), output(%v), reply(%v), rdb(%d)", id1, id2, locSp, outSp, sOffset, rdbSize)
+	ri.logger.Infof("psync : runId(%s - %s), local(%v), output(%v), reply(%v), rdb(%d)", id1, id2, locSp, outSps, sOffset, rdbSize)
 
 	// correct run id
 	if isFullSync {
@@ -303,38 +352,54 @@ func (ri *RedisInput) syncMeta(ctx context.Context, redisCli *redis.StandaloneRe
 		ri.logger.Errorf("channel SetRunId error : offset(%v), err(%v)", sOffset, err)
 		return
 	}
-	err = ri.output.SetRunId(ctx, sOffset.RunId)
-	if err != nil {
-		ri.logger.Errorf("output SetRunId error : offset(%v), err(%v)", sOffset, err)
-		return
+	for _, output := range ri.outputs {
+		err = output.SetRunId(ctx, sOffset.RunId)
+		if err != nil {
+			ri.logger.Errorf("output SetRunId error : offset(%v), err(%v)", sOffset, err)
+			return
+		}
 	}
 
 	locSp.RunId = sOffset.RunId
-	outSp.RunId = sOffset.RunId
+	for i := range outSps {
+		if bootstrap && outSps[i].IsInitial() {
+			continue
+		}
+		outSps[i].RunId = sOffset.RunId
+		if isFullSync {
+			outSps[i].Offset = sOffset.Offset - rdbSize // less than rdb offset,
+			if rdbSize < 0 {
+				outSps[i].Offset = sOffset.Offset - 1
+			}
+		}
+	}
 	if isFullSync {
 		locSp.Offset = sOffset.Offset
-		outSp.Offset = sOffset.Offset - rdbSize // less than rdb offset,
 		metricSyncType.Inc(ri.inputAddr, "full")
 	} else {
 		metricSyncType.Inc(ri.inputAddr, "incr")
 	}
 
-	if outSp.Offset <= 0 {
-		ri.logger.Warnf("read offset is zero : locSp(%v), outSp(%v), rdb(%v), rdb(%d)", locSp, outSp, isFullSync, rdbSize)
-	} else {
-		ri.logger.Debugf("meta sync : locSp(%v), outSp(%v), rdb(%v), rdb(%d)", locSp, outSp, isFullSync, rdbSize)
+	for _, outSp := range outSps {
+		if bootstrap && outSp.IsInitial() {
+			ri.logger.Infof("output bootstraps : locSp(%v), outSp(%v)", locSp, outSp)
+		} else if outSp.Offset <= 0 {
+			ri.logger.Warnf("read offset is zero : locSp(%v), outSp(%v), rdb(%v), rdb(%d)", locSp, outSp, isFullSync, rdbSize)
+		} else {
+			ri.logger.Debugf("meta sync : locSp(%v), outSp(%v), rdb(%v), rdb(%d)", locSp, outSp, isFullSync, rdbSize)
+		}
 	}
 
 	return
 }
 
 func (ri *RedisInput) syncData(wait usync.WaitCloser, redisCli *redis.StandaloneRedis, isFullSync bool, rdbSize int64, offset int64) {
-	var rdbWriter *store.RdbWriter
-	var aofWriter *store.AofWriter
+	var rdbWriter ChannelWriter
+	var aofWriter ChannelAofWriter
 	var err error
 	if isFullSync { // create writers before start readers
 		inputStateGauge.Set(1, ri.inputAddr, "leader")
-		rdbWriter, err = ri.channel.NewRdbWriter(redisCli.Client().BufioReader(), offset, rdbSize)
+		rdbWriter, err = ri.channel.NewRdbWriter(redisCli.RdbReader(), offset, rdbSize)
 	} else {
 		inputStateGauge.Set(2, ri.inputAddr, "leader")
 		aofWriter, err = ri.channel.NewAofWritter(redisCli.Client().BufioReader(), offset)
@@ -386,7 +451,7 @@ func (ri *RedisInput) syncData(wait usync.WaitCloser, redisCli *redis.Standalone
 	}, func(i interface{}) { wait.Close(fmt.Errorf("panic : %v", i)) })
 }
 
-func (ri *RedisInput) syncRdb(ctx context.Context, reader *bufio.Reader, writer *store.RdbWriter) error {
+func (ri *RedisInput) syncRdb(ctx context.Context, reader *bufio.Reader, writer ChannelWriter) error {
 	ri.fsm.SetState(SyncStateFullSyncing)
 	writer.Start()
 	err := writer.Wait(ctx)
@@ -400,7 +465,7 @@ func (ri *RedisInput) syncRdb(ctx context.Context, reader *bufio.Reader, writer
 	return err
 }
 
-func (ri *RedisInput) syncIncr(ctx context.Context, reader *bufio.Reader, offset int64, writer *store.AofWriter) error {
+func (ri *RedisInput) syncIncr(ctx context.Context, reader *bufio.Reader, offset int64, writer ChannelAofWriter) error {
 	ri.fsm.SetState(SyncStateIncrSyncing)
 	writer.Start()
 	err := writer.Wait(ctx)
@@ -415,7 +480,7 @@ func (ri *RedisInput) syncIncr(ctx context.Context, reader *bufio.Reader, offset
 	return err
 }
 
-func (ri *RedisInput) startSyncAck(wait usync.WaitCloser, writer *store.AofWriter, cli *redis.StandaloneRedis) {
+func (ri *RedisInput) startSyncAck(wait usync.WaitCloser, writer ChannelAofWriter, cli *redis.StandaloneRedis) {
 	usync.SafeGo(func() {
 		ticker := time.NewTicker(1 * time.Second)
 		defer ticker.Stop()
@@ -520,39 +585,179 @@ func (ri *RedisInput) run() error {
 	// @TODO should wait for all goroutines to exit. sync/async IO,
 	runScope := usync.NewWaitCloserFromParent(ri.wait, nil)
 
-	// input -> channel -> output
-	startPoint := ri.fetchInput(runScope)
-	reader := ri.readChannel(runScope, startPoint)
-	ri.sendOutput(runScope, reader)
+	// input -> channel -> outputs
+	startPoints := ri.fetchInput(runScope)
+	for i, startPoint := range startPoints {
+		ri.sendOutput(runScope, ri.outputs[i], startPoint)
+	}
 
 	runScope.WgWait()
 	return runScope.Error()
 }
 
-func (ri *RedisInput) readChannel(wait usync.WaitCloser, readerOffset StartPoint) *store.Reader {
+func (ri *RedisInput) readChannel(wait usync.WaitCloser, readerOffset Offset) *store.Reader {
+	// outputs may be ahead of channel, wait for input
+	if err := ri.channel.WaitOffset(wait.Context(), readerOffset); err != nil {
+		wait.Close(err)
+		return nil
+	}
 	if wait.IsClosed() {
 		return nil
 	}
-	reader, err := ri.channel.NewReader(readerOffset.ToOffset())
+	reader, err := ri.channel.NewReader(readerOffset)
 	ri.logger.Debugf("channel.NewReader : offset(%v), err(%v)", readerOffset, err)
 	if err != nil {
 		wait.Close(err)
 		return nil
 	}
-	reader.Start(wait)
 	return reader
 }
 
-func (ri *RedisInput) sendOutput(wait usync.WaitCloser, reader *store.Reader) {
-	if wait.IsClosed() {
-		return
+// sendOutput replicates channel to output from startPoint, every output reads channel at its own offset,
+// so a slow output does not block others, and a failed output retries alone
+func (ri *RedisInput) sendOutput(wait usync.WaitCloser, output Output, startPoint StartPoint) {
+	wait.WgAdd(1)
+	usync.SafeGo(func() {
+		defer wait.WgDone()
+		offset := startPoint.ToOffset()
+		bootstrap := startPoint.IsInitial()
+		for !wait.IsClosed() {
+			if bootstrap {
+				off, err := ri.bootstrapOutput(wait, output)
+				if err == nil {
+					offset = off
+					bootstrap = false
+					continue
+				}
+				if wait.IsClosed() {
+					return
+				}
+				if errors.Is(err, ErrBreak) {
+					wait.Close(err)
+					return
+				}
+				ri.logger.Errorf("bootstrap output error, retry : error(%v)", err)
+				wait.Sleep(2 * time.Second)
+				continue
+			}
+
+			reader := ri.readChannel(wait, offset)
+			if reader == nil {
+				return
+			}
+
+			readerScope := usync.NewWaitCloserFromParent(wait, nil)
+			reader.Start(readerScope)
+			err := output.Send(readerScope.Context(), reader)
+			readerErr := readerScope.Error()
+			readerScope.Close(nil)
+			readerScope.WgWait()
+
+			if wait.IsClosed() {
+				return
+			}
+			if readerErr != nil {
+				wait.Close(readerErr)
+				return
+			}
+			if err == nil {
+				if reader.IsAof() {
+					wait.Close(nil)
+					return
+				}
+				// rdb is done, continue with aof once input is ingesting it
+				select {
+				case <-ri.fsm.StateNotify(SyncStateIncrSyncing):
+				case <-wait.Done():
+					return
+				}
+				offset = Offset{RunId: reader.RunId(), Offset: reader.Left()}
+				continue
+			}
+			if errors.Is(err, ErrBreak) {
+				wait.Close(err)
+				return
+			}
+
+			// retry from checkpoint of output
+			ri.logger.Errorf("send output error, retry : offset(%v), error(%v)", offset, err)
+			wait.Sleep(2 * time.Second)
+			sp, spErr := ri.getOutputStartPoint(wait.Context(), output, ri.RunIds())
+			if spErr != nil {
+				wait.Close(errors.Join(err, spErr))
+				return
+			}
+			if !sp.IsInitial() && ri.channel.IsValidOffset(sp.ToOffset()) {
+				offset = sp.ToOffset()
+			} else if !ri.channel.IsValidOffset(offset) {
+				wait.Close(err)
+				return
+			}
+		}
+	}, func(i interface{}) { wait.Close(fmt.Errorf("panic : %v", i)) })
+}
+
+// bootstrapOutput replicates a rdb snapshot to an output without checkpoint, so other outputs keep replicating from channel.
+// the rdb of channel is preferred, a separate full sync is only for the output if it has been gc'd.
+// it returns the offset of snapshot
+func (ri *RedisInput) bootstrapOutput(wait usync.WaitCloser, output Output) (Offset, error) {
+	runId := ri.channel.RunId()
+	if left, size := ri.channel.GetRdb(runId); left != -1 && size != -1 {
+		// rdb may be gc'd after it's checked
+		reader, err := ri.channel.NewReader(Offset{RunId: runId, Offset: left - size})
+		if err == nil && reader.IsAof() {
+			reader.Close()
+		} else if err == nil {
+			ri.logger.Infof("bootstrap output with rdb of channel : runId(%s), offset(%d), rdb(%d)", runId, left, size)
+			readerScope := usync.NewWaitCloserFromParent(wait, nil)
+			reader.Start(readerScope)
+			err = output.Send(readerScope.Context(), reader)
+			readerErr := readerScope.Error()
+			readerScope.Close(nil)
+			readerScope.WgWait()
+			if err == nil {
+				err = readerErr
+			}
+			if err != nil {
+				return Offset{}, err
+			}
+			return Offset{RunId: reader.RunId(), Offset: reader.Left()}, nil
+		}
+	}
+
+	ri.logger.Warnf("rdb of channel has been gc'd, bootstrap output by full sync : runId(%s)", runId)
+	if !ri.rdbLimiterAcquire(wait.Done()) {
+		return Offset{}, wait.Context().Err()
+	}
+	defer ri.rdbLimiterRelease()
+
+	cli, err := ri.newRedisConn(wait.Context())
+	if err != nil {
+		return Offset{}, err
 	}
+	defer cli.Close()
 
-	ctx, cancel := context.WithCancel(wait.Context())
-	defer cancel()
+	if err = cli.SendPSyncCapa(); err != nil {
+		ri.logger.Errorf("bootstrap psync error : err(%v)", err)
+		return Offset{}, err
+	}
+	sp := StartPoint{}
+	sp.Initialize()
+	offset, _, rdbSize, err := ri.sendPsync(cli, sp.ToOffset())
+	if err != nil {
+		return Offset{}, err
+	}
 
-	err := ri.output.Send(ctx, reader)
-	wait.Close(err)
+	rdbReader := cli.RdbReader()
+	if rdbSize > 0 {
+		rdbReader = io.LimitReader(rdbReader, rdbSize)
+	}
+	ri.logger.Infof("bootstrap output : offset(%v), rdb(%d)", offset, rdbSize)
+	err = output.Send(wait.Context(), store.NewStreamReader(rdbReader, offset.RunId, offset.Offset, rdbSize))
+	if err != nil {
+		return Offset{}, err
+	}
+	return offset, nil
 }
 
 // @TODO call stop
@@ -583,6 +788,11 @@ func (ri *RedisInput) pSync(cli *redis.StandaloneRedis, offset Offset) (
 		ri.logger.Errorf("psync error : offset(%v), err(%v)", offset, err)
 		return
 	}
+	err = cli.SendPSyncCapa()
+	if err != nil {
+		ri.logger.Errorf("psync error : offset(%v), err(%v)", offset, err)
+		return
+	}
 
 	off, fullSync, rdbSize, err = ri.sendPsync(cli, offset)
 	return
@@ -605,11 +815,16 @@ func (ri *RedisInput) sendPsync(cli *redis.StandaloneRedis, offset Offset) (Offs
 	for rdbSize == 0 {
 		select {
 		case x := <-wait:
+			if x.Err != nil {
+				ri.logger.Errorf("wait rdb dump : offset(%v), err(%v), input(%s, %d)", offset, x.Err, pRunId, pOff)
+				return Offset{}, false, 0, x.Err
+			}
 			rdbSize = x.Size
 		case <-time.After(time.Second):
 		}
 	}
 
+	// rdbSize is -1 if it's diskless replication, it's known after rdb is received
 	ri.logger.Debugf("send psync : offset(%v), input(%s, %d), rdb(%d)", offset, pRunId, pOff, rdbSize)
 	return Offset{RunId: pRunId, Offset: pOff}, true, rdbSize, nil
 }
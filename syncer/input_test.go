@@ -0,0 +1,204 @@
+package syncer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mgtv-tech/redis-GunYu/config"
+	"github.com/mgtv-tech/redis-GunYu/pkg/store"
+	usync "github.com/mgtv-tech/redis-GunYu/pkg/sync"
+)
+
+type fakeOutput struct {
+	mux  sync.Mutex
+	sp   StartPoint
+	send func(ctx context.Context, reader *store.Reader) error
+}
+
+func (fo *fakeOutput) StartPoint(ctx context.Context, runIds []string) (StartPoint, error) {
+	fo.mux.Lock()
+	defer fo.mux.Unlock()
+	return fo.sp, nil
+}
+
+func (fo *fakeOutput) setStartPoint(sp StartPoint) {
+	fo.mux.Lock()
+	defer fo.mux.Unlock()
+	fo.sp = sp
+}
+
+func (fo *fakeOutput) Send(ctx context.Context, reader *store.Reader) error {
+	return fo.send(ctx, reader)
+}
+
+func (fo *fakeOutput) SetRunId(ctx context.Context, runId string) error { return nil }
+
+func (fo *fakeOutput) Close() {}
+
+type sentData struct {
+	aof  bool
+	left int64
+	data string
+}
+
+func readData(reader *store.Reader, n int) sentData {
+	p := make([]byte, n)
+	n, _ = io.ReadFull(reader.IoReader(), p)
+	return sentData{aof: reader.IsAof(), left: reader.Left(), data: string(p[:n])}
+}
+
+func receiveData(t *testing.T, sent <-chan sentData) sentData {
+	select {
+	case data := <-sent:
+		return data
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "output doesn't receive data")
+		return sentData{}
+	}
+}
+
+// newTestInput returns an input whose channel has a rdb of "RDBDATA" at offset 100, and aof of "abcdef"
+func newTestInput(t *testing.T) *RedisInput {
+	ri := NewRedisInput(config.RedisConfig{Addresses: []string{"127.0.0.1:6379"}})
+	ri.setRunIds([]string{"run1"})
+	ch := NewMemoryChannel("127.0.0.1:6379", 1<<20)
+	t.Cleanup(func() { ch.Close() })
+	assert.Nil(t, ch.SetRunId("run1"))
+
+	rw, err := ch.NewRdbWriter(bytes.NewReader([]byte("RDBDATA")), 100, 7)
+	assert.Nil(t, err)
+	rw.Start()
+	assert.Nil(t, rw.Wait(context.Background()))
+	rw.Close()
+
+	pr, pw := io.Pipe()
+	t.Cleanup(func() { pw.Close() })
+	aw, err := ch.NewAofWritter(pr, 100)
+	assert.Nil(t, err)
+	aw.Start()
+	_, err = pw.Write([]byte("abcdef"))
+	assert.Nil(t, err)
+
+	ri.SetChannel(ch)
+	ri.fsm.SetState(SyncStateIncrSyncing)
+	return ri
+}
+
+func TestOutputStartPoints(t *testing.T) {
+	initial := StartPoint{}
+	initial.Initialize()
+	ri := newTestInput(t)
+	ri.SetOutputs(
+		&fakeOutput{sp: StartPoint{RunId: "run1", Offset: 300}},
+		&fakeOutput{sp: StartPoint{RunId: "run1", Offset: 200}},
+		&fakeOutput{sp: initial},
+	)
+
+	// every output has its own start point
+	outSps, err := ri.outputStartPoints(context.Background(), []string{"run1"})
+	assert.Nil(t, err)
+	assert.Equal(t, []StartPoint{{RunId: "run1", Offset: 300}, {RunId: "run1", Offset: 200}, initial}, outSps)
+
+	// input psyncs from the slowest output
+	assert.Equal(t, StartPoint{RunId: "run1", Offset: 200}, minStartPoint(outSps[:2]))
+	assert.Equal(t, StartPoint{RunId: "run1", Offset: 200}, minStartPoint(outSps[1:2]))
+}
+
+func TestSendOutputs(t *testing.T) {
+	ri := newTestInput(t)
+	wait := usync.NewWaitCloser(nil)
+	defer wait.WgWait()
+	defer wait.Close(nil)
+
+	// a slow output doesn't read data
+	slowCalled := make(chan struct{})
+	slow := &fakeOutput{send: func(ctx context.Context, reader *store.Reader) error {
+		close(slowCalled)
+		<-ctx.Done()
+		return nil
+	}}
+
+	// a fast output replicates aof from its start point
+	fastSent := make(chan sentData, 4)
+	fast := &fakeOutput{send: func(ctx context.Context, reader *store.Reader) error {
+		fastSent <- readData(reader, 6)
+		<-ctx.Done()
+		return nil
+	}}
+
+	// a failing output resumes from its own checkpoint
+	failSent := make(chan sentData, 4)
+	failed := false
+	failing := &fakeOutput{}
+	failing.send = func(ctx context.Context, reader *store.Reader) error {
+		if !failed {
+			failed = true
+			failSent <- readData(reader, 3)
+			failing.setStartPoint(StartPoint{RunId: "run1", Offset: 103})
+			return errors.New("failed")
+		}
+		failSent <- readData(reader, 3)
+		<-ctx.Done()
+		return nil
+	}
+
+	// an initial output is bootstrapped by rdb of channel
+	initialSent := make(chan sentData, 4)
+	initial := &fakeOutput{send: func(ctx context.Context, reader *store.Reader) error {
+		if !reader.IsAof() {
+			initialSent <- readData(reader, 7)
+			return nil
+		}
+		initialSent <- readData(reader, 6)
+		<-ctx.Done()
+		return nil
+	}}
+	initialSp := StartPoint{}
+	initialSp.Initialize()
+
+	ri.sendOutput(wait, slow, StartPoint{RunId: "run1", Offset: 100})
+	ri.sendOutput(wait, fast, StartPoint{RunId: "run1", Offset: 100})
+	ri.sendOutput(wait, failing, StartPoint{RunId: "run1", Offset: 100})
+	ri.sendOutput(wait, initial, initialSp)
+
+	<-slowCalled
+	assert.Equal(t, sentData{aof: true, left: 100, data: "abcdef"}, receiveData(t, fastSent))
+
+	assert.Equal(t, sentData{aof: true, left: 100, data: "abc"}, receiveData(t, failSent))
+	assert.Equal(t, sentData{aof: true, left: 103, data: "def"}, receiveData(t, failSent))
+
+	// only initial output is bootstrapped, then it continues with aof after rdb
+	assert.Equal(t, sentData{aof: false, left: 100, data: "RDBDATA"}, receiveData(t, initialSent))
+	assert.Equal(t, sentData{aof: true, left: 100, data: "abcdef"}, receiveData(t, initialSent))
+
+	assert.False(t, wait.IsClosed())
+	assert.Len(t, fastSent, 0)
+}
+
+func TestExtraCanTransaction(t *testing.T) {
+	standalone := config.RedisConfig{Type: config.RedisTypeStandalone}
+	cluster := config.RedisConfig{Type: config.RedisTypeCluster}
+	txn, noTxn := true, false
+	extra := func(replayTxn *bool, renames ...config.KeyRenameConfig) *config.OutputConfig {
+		return &config.OutputConfig{Replay: config.ReplayConfig{ReplayTransaction: replayTxn, KeyRename: renames}}
+	}
+
+	assert.True(t, extraCanTransaction(&config.InputConfig{}, extra(&txn), standalone))
+	assert.True(t, extraCanTransaction(nil, extra(&txn), standalone))
+	assert.False(t, extraCanTransaction(&config.InputConfig{}, extra(&noTxn), standalone))
+	assert.False(t, extraCanTransaction(&config.InputConfig{}, extra(&txn), cluster))
+
+	// keys of rewritten prefix
+	prefix := &config.InputConfig{KeyPrefix: &config.KeyPrefixConfig{From: "a:", To: "b:"}}
+	assert.False(t, extraCanTransaction(prefix, extra(&txn), standalone))
+
+	// renamed keys
+	assert.False(t, extraCanTransaction(&config.InputConfig{}, extra(&txn, config.KeyRenameConfig{Prefix: "a:", To: "b:"}), standalone))
+}
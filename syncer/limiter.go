@@ -0,0 +1,345 @@
+package syncer
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"github.com/mgtv-tech/redis-GunYu/config"
+	"github.com/mgtv-tech/redis-GunYu/pkg/filter"
+	"github.com/mgtv-tech/redis-GunYu/pkg/log"
+	"github.com/mgtv-tech/redis-GunYu/pkg/metric"
+	"github.com/mgtv-tech/redis-GunYu/pkg/redis"
+	usync "github.com/mgtv-tech/redis-GunYu/pkg/sync"
+	"github.com/mgtv-tech/redis-GunYu/pkg/util"
+)
+
+var (
+	throttleCounter = metric.NewCounterVec(metric.CounterVecOpts{
+		Namespace: config.AppName,
+		Subsystem: "output",
+		Name:      "throttled_seconds",
+		Labels:    []string{"input", "phase"},
+	})
+
+	ErrNoReplayLimiter = errors.New("no replay limiter")
+)
+
+// replay limiters of outputs are shared by syncers in the process
+var (
+	replayLimitersMux sync.Mutex
+	replayLimiters    = map[string]*ReplayLimiter{}
+)
+
+// replayLimiter returns the limiter of the output, cfg is applied if the limiter is created,
+// since limits may be changed by the api at runtime
+func replayLimiter(output string, cfg config.ReplayRateLimitConfig) *ReplayLimiter {
+	replayLimitersMux.Lock()
+	defer replayLimitersMux.Unlock()
+	rl, ok := replayLimiters[output]
+	if !ok {
+		rl = &ReplayLimiter{cfg: cfg, whole: newTokenBuckets(cfg), shards: map[string]*tokenBuckets{}}
+		replayLimiters[output] = rl
+	}
+	return rl
+}
+
+// ReplayLimits returns limits of outputs by output name, the name of the main output is empty if it's not named
+func ReplayLimits() map[string]config.ReplayRateLimitConfig {
+	replayLimitersMux.Lock()
+	defer replayLimitersMux.Unlock()
+	limits := make(map[string]config.ReplayRateLimitConfig, len(replayLimiters))
+	for name, rl := range replayLimiters {
+		limits[name] = rl.Limits()
+	}
+	return limits
+}
+
+// SetReplayLimits changes limits of the output at runtime
+func SetReplayLimits(output string, cfg config.ReplayRateLimitConfig) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	replayLimitersMux.Lock()
+	rl, ok := replayLimiters[output]
+	replayLimitersMux.Unlock()
+	if !ok {
+		return ErrNoReplayLimiter
+	}
+	rl.SetLimits(cfg)
+	return nil
+}
+
+// ReplayLimiter limits ops and bytes per second of replay traffic to an output,
+// every shard of a cluster has its own buckets if limits are per shard
+type ReplayLimiter struct {
+	mux    sync.RWMutex
+	cfg    config.ReplayRateLimitConfig
+	whole  *tokenBuckets
+	shards map[string]*tokenBuckets // address of master -> buckets
+}
+
+func (rl *ReplayLimiter) Limits() config.ReplayRateLimitConfig {
+	rl.mux.RLock()
+	defer rl.mux.RUnlock()
+	return rl.cfg
+}
+
+func (rl *ReplayLimiter) SetLimits(cfg config.ReplayRateLimitConfig) {
+	rl.mux.Lock()
+	defer rl.mux.Unlock()
+	rl.cfg = cfg
+	rl.whole.set(cfg)
+	for _, tb := range rl.shards {
+		tb.set(cfg)
+	}
+}
+
+// buckets returns nil if there is no limit, the buckets of the shard are returned if limits are per shard
+func (rl *ReplayLimiter) buckets(shard string) *tokenBuckets {
+	rl.mux.RLock()
+	cfg := rl.cfg
+	tb := rl.shards[shard]
+	rl.mux.RUnlock()
+	if cfg.OpsPerSecond == 0 && cfg.BytesPerSecond == 0 {
+		return nil
+	}
+	if !cfg.PerShard {
+		return rl.whole
+	}
+	if tb != nil {
+		return tb
+	}
+	rl.mux.Lock()
+	defer rl.mux.Unlock()
+	if tb = rl.shards[shard]; tb == nil {
+		tb = newTokenBuckets(rl.cfg)
+		rl.shards[shard] = tb
+	}
+	return tb
+}
+
+type tokenBuckets struct {
+	ops   *rate.Limiter
+	bytes *rate.Limiter
+}
+
+func newTokenBuckets(cfg config.ReplayRateLimitConfig) *tokenBuckets {
+	opsLimit, opsBurst := tokenRate(cfg.OpsPerSecond)
+	bytesLimit, bytesBurst := tokenRate(cfg.BytesPerSecond)
+	return &tokenBuckets{
+		ops:   rate.NewLimiter(opsLimit, opsBurst),
+		bytes: rate.NewLimiter(bytesLimit, bytesBurst),
+	}
+}
+
+// tokenRate returns the limit and burst of n per second, the burst is the limit of one second
+func tokenRate(n int64) (rate.Limit, int) {
+	if n <= 0 {
+		return rate.Inf, 0
+	}
+	return rate.Limit(n), int(n)
+}
+
+// set changes limits, buckets keep their tokens
+func (tb *tokenBuckets) set(cfg config.ReplayRateLimitConfig) {
+	for _, w := range []struct {
+		lim *rate.Limiter
+		n   int64
+	}{{tb.ops, cfg.OpsPerSecond}, {tb.bytes, cfg.BytesPerSecond}} {
+		limit, burst := tokenRate(w.n)
+		w.lim.SetLimit(limit)
+		w.lim.SetBurst(burst)
+	}
+}
+
+// wait returns the time spent waiting, it returns if ctx is done
+func (tb *tokenBuckets) wait(ctx context.Context, ops int, bytes int) time.Duration {
+	start := time.Now()
+	for _, w := range []struct {
+		lim *rate.Limiter
+		n   int
+	}{{tb.ops, ops}, {tb.bytes, bytes}} {
+		// a request larger than the burst waits in pieces
+		for n := w.n; n > 0; {
+			m := n
+			if burst := w.lim.Burst(); w.lim.Limit() != rate.Inf && m > burst {
+				m = burst
+			}
+			if err := w.lim.WaitN(ctx, m); err != nil {
+				return time.Since(start)
+			}
+			n -= m
+		}
+	}
+	return time.Since(start)
+}
+
+// shardRange is a slot range of a shard of the target cluster
+type shardRange struct {
+	left  int
+	right int
+	addr  string
+}
+
+// newShardRanges returns sorted slot ranges of shards of a cluster, nil if redis isn't a cluster
+func newShardRanges(cfg config.RedisConfig) []shardRange {
+	if !cfg.IsCluster() {
+		return nil
+	}
+	ranges := []shardRange{}
+	for _, shard := range cfg.GetClusterShards() {
+		for _, r := range shard.Slots.Ranges {
+			ranges = append(ranges, shardRange{left: r.Left, right: r.Right, addr: shard.Master.Address})
+		}
+	}
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].left < ranges[j].left })
+	return ranges
+}
+
+// shards are refreshed in the background, since slots may be migrated without restarting syncers
+const shardRefreshInterval = 30 * time.Second
+
+// shardRouter locates shards of keys of the target cluster
+type shardRouter struct {
+	mux        sync.RWMutex
+	cfg        config.RedisConfig
+	ranges     []shardRange
+	refreshed  time.Time
+	refreshing bool
+}
+
+// newShardRouter returns nil if redis isn't a cluster
+func newShardRouter(cfg config.RedisConfig) *shardRouter {
+	if !cfg.IsCluster() {
+		return nil
+	}
+	return &shardRouter{cfg: *cfg.Clone(), ranges: newShardRanges(cfg), refreshed: time.Now()}
+}
+
+// shardOf returns the address of the shard of key, an empty string if the shard is unknown
+func (sr *shardRouter) shardOf(key []byte) string {
+	slot := int(redis.KeyToSlot(util.BytesToString(key)))
+	sr.mux.RLock()
+	ranges := sr.ranges
+	refresh := !sr.refreshing && time.Since(sr.refreshed) > shardRefreshInterval
+	sr.mux.RUnlock()
+	if refresh {
+		sr.refresh()
+	}
+
+	i := sort.Search(len(ranges), func(i int) bool { return ranges[i].right >= slot })
+	if i < len(ranges) && ranges[i].left <= slot {
+		return ranges[i].addr
+	}
+	return ""
+}
+
+// refresh reloads slots of the cluster in the background, ranges are kept if it fails
+func (sr *shardRouter) refresh() {
+	sr.mux.Lock()
+	if sr.refreshing {
+		sr.mux.Unlock()
+		return
+	}
+	sr.refreshing = true
+	cfg := sr.cfg.Clone()
+	sr.mux.Unlock()
+
+	usync.SafeGo(func() {
+		err := redis.FixTopology(cfg)
+		sr.mux.Lock()
+		defer sr.mux.Unlock()
+		sr.refreshing = false
+		sr.refreshed = time.Now()
+		if err != nil {
+			log.Errorf("refresh shards of cluster error : redis(%v), error(%v)", cfg.Addresses, err)
+			return
+		}
+		sr.cfg = *cfg
+		sr.ranges = newShardRanges(*cfg)
+	}, func(i interface{}) {
+		sr.mux.Lock()
+		defer sr.mux.Unlock()
+		sr.refreshing = false
+		sr.refreshed = time.Now()
+	})
+}
+
+// throttle waits for tokens of an rdb entry or a batch of commands, it returns if ctx is done
+func (ro *RedisOutput) throttle(ctx context.Context, phase string, key []byte, ops int, bytes int) {
+	if ro.limiter == nil {
+		return
+	}
+	shard := ""
+	if ro.shards != nil && key != nil {
+		shard = ro.shards.shardOf(key)
+	}
+	tb := ro.limiter.buckets(shard)
+	if tb == nil {
+		return
+	}
+	if d := tb.wait(ctx, ops, bytes); d > time.Millisecond {
+		throttleCounter.Add(d.Seconds(), ro.cfg.InputName, phase)
+	}
+}
+
+// throttleCmds waits for tokens of commands, commands are grouped by shards if limits are per shard
+func (ro *RedisOutput) throttleCmds(ctx context.Context, cmds []cmdExecution) {
+	if ro.limiter == nil || len(cmds) == 0 {
+		return
+	}
+	cmdSize := func(ce *cmdExecution) int {
+		size := len(ce.Cmd)
+		for _, arg := range ce.Args {
+			if b, ok := arg.([]byte); ok {
+				size += len(b)
+			}
+		}
+		return size
+	}
+	if ro.shards == nil || !ro.limiter.Limits().PerShard {
+		bytes := 0
+		for i := range cmds {
+			bytes += cmdSize(&cmds[i])
+		}
+		ro.throttle(ctx, "aof", nil, len(cmds), bytes)
+		return
+	}
+
+	type usage struct {
+		key   []byte
+		ops   int
+		bytes int
+	}
+	shards := map[string]*usage{}
+	for i := range cmds {
+		ce := &cmds[i]
+		args := make([][]byte, 0, len(ce.Args))
+		for _, arg := range ce.Args {
+			if b, ok := arg.([]byte); ok {
+				args = append(args, b)
+			}
+		}
+		indexes := filter.KeyIndexes(ce.Cmd, args)
+		if len(indexes) == 0 {
+			continue // commands without keys aren't limited by shards
+		}
+		key := args[indexes[0]]
+		shard := ro.shards.shardOf(key)
+		u := shards[shard]
+		if u == nil {
+			u = &usage{key: key}
+			shards[shard] = u
+		}
+		u.ops++
+		u.bytes += cmdSize(ce)
+	}
+	for _, u := range shards {
+		ro.throttle(ctx, "aof", u.key, u.ops, u.bytes)
+	}
+}
@@ -0,0 +1,66 @@
+package syncer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mgtv-tech/redis-GunYu/config"
+)
+
+func TestReplayLimiter(t *testing.T) {
+	rl := replayLimiter("limiter_test", config.ReplayRateLimitConfig{OpsPerSecond: 100})
+	assert.Same(t, rl, replayLimiter("limiter_test", config.ReplayRateLimitConfig{}))
+	assert.Equal(t, int64(100), ReplayLimits()["limiter_test"].OpsPerSecond)
+
+	assert.ErrorIs(t, SetReplayLimits("limiter_test_none", config.ReplayRateLimitConfig{}), ErrNoReplayLimiter)
+	assert.NotNil(t, SetReplayLimits("limiter_test", config.ReplayRateLimitConfig{BytesPerSecond: -1}))
+	assert.Nil(t, SetReplayLimits("limiter_test", config.ReplayRateLimitConfig{BytesPerSecond: 100}))
+	assert.Equal(t, config.ReplayRateLimitConfig{BytesPerSecond: 100}, rl.Limits())
+
+	assert.Nil(t, SetReplayLimits("limiter_test", config.ReplayRateLimitConfig{}))
+	assert.Nil(t, rl.buckets(""))
+
+	// the burst is consumed at once, and the rest waits
+	tb := replayLimiter("limiter_test_bytes", config.ReplayRateLimitConfig{BytesPerSecond: 100}).buckets("")
+	assert.NotNil(t, tb)
+	assert.Less(t, tb.wait(context.Background(), 1000, 100), 50*time.Millisecond)
+	assert.Greater(t, tb.wait(context.Background(), 0, 50), 400*time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Less(t, tb.wait(ctx, 0, 1000), 50*time.Millisecond)
+
+	// every shard has its own buckets
+	assert.Nil(t, SetReplayLimits("limiter_test", config.ReplayRateLimitConfig{OpsPerSecond: 10, PerShard: true}))
+	assert.NotSame(t, rl.buckets("a"), rl.buckets("b"))
+	assert.Same(t, rl.buckets("a"), rl.buckets("a"))
+}
+
+func TestReplayLimiterShards(t *testing.T) {
+	redisCfg := config.RedisConfig{Type: config.RedisTypeCluster, ClusterOptions: &config.RedisClusterOptions{}}
+	redisCfg.SetClusterShards([]*config.RedisClusterShard{
+		{Master: config.RedisNode{Address: "b"}, Slots: config.RedisSlots{Ranges: []config.RedisSlotRange{{Left: 8192, Right: 16383}}}},
+		{Master: config.RedisNode{Address: "a"}, Slots: config.RedisSlots{Ranges: []config.RedisSlotRange{{Left: 0, Right: 8191}}}},
+	})
+	sr := newShardRouter(redisCfg)
+	assert.Equal(t, "b", sr.shardOf([]byte("foo"))) // slot 12182
+	assert.Equal(t, "a", sr.shardOf([]byte("bar"))) // slot 5061
+	assert.Equal(t, "a", sr.shardOf([]byte("{bar}x")))
+	assert.Nil(t, newShardRanges(config.RedisConfig{Type: config.RedisTypeStandalone}))
+	assert.Nil(t, newShardRouter(config.RedisConfig{Type: config.RedisTypeStandalone}))
+
+	// shards are kept if they can't be refreshed
+	sr.mux.Lock()
+	sr.refreshed = time.Now().Add(-2 * shardRefreshInterval)
+	sr.mux.Unlock()
+	assert.Equal(t, "b", sr.shardOf([]byte("foo")))
+	assert.Eventually(t, func() bool {
+		sr.mux.RLock()
+		defer sr.mux.RUnlock()
+		return !sr.refreshing && time.Since(sr.refreshed) < shardRefreshInterval
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, "a", sr.shardOf([]byte("bar")))
+}
@@ -50,6 +50,15 @@ type RedisOutput struct {
 	checkpointInMem checkpoint.CheckpointInfo
 
 	outFilter *filter.RedisKeyFilter
+	srcFilter *filter.RedisKeyFilter // filter of source, nil if source has no filter
+	renamer   *filter.KeyRenamer     // nil if there is no rename rule
+	ttl       *ttlPolicy             // nil if ttls are not changed
+	downgrade *cmdDowngrader         // nil if the version of target is unknown
+
+	limiter *ReplayLimiter // nil if traffic isn't limited
+	shards  *shardRouter   // nil if target isn't a cluster
+	dryRun  *dryRunStats   // nil if commands are written
+	scripts *scriptCache   // nil if scripts aren't preloaded
 }
 
 var (
@@ -149,28 +158,107 @@ func NewRedisOutput(cfg RedisOutputConfig) *RedisOutput {
 	}
 	ro.outFilter = &filter.RedisKeyFilter{}
 	ro.outFilter.InsertCmdBlackList(filter.NoRouteCmds, true)
-	ro.outFilter.InsertCmdBlackList(cfg.Filter.CmdBlacklist, true)
-
 	ro.outFilter.InsertPrefixKeyBlackList([]string{config.CheckpointKey, config.NamespacePrefixKey})
-	keyFilter := cfg.Filter.KeyFilter
-	if keyFilter != nil {
-		ro.outFilter.InsertPrefixKeyBlackList(keyFilter.PrefixKeyBlacklist)
-		ro.outFilter.InsertPrefixKeyWhiteList(keyFilter.PrefixKeyWhitelist)
+	insertFilter(ro.outFilter, cfg.Filter)
+	if cfg.SourceFilter != nil {
+		ro.srcFilter = &filter.RedisKeyFilter{}
+		insertFilter(ro.srcFilter, *cfg.SourceFilter)
+	}
+	if len(cfg.KeyRename) > 0 {
+		ro.renamer = &filter.KeyRenamer{}
+		for _, rule := range cfg.KeyRename {
+			if rule.Regex == "" {
+				ro.renamer.InsertPrefix(rule.Prefix, rule.To)
+			} else if err := ro.renamer.InsertRegex(rule.Regex, rule.To); err != nil {
+				ro.logger.Errorf("invalid key rename rule : rule(%v), error(%v)", rule, err)
+			}
+		}
+	}
+
+	ro.ttl = newTtlPolicy(cfg.Ttl, cfg.Redis.Version)
+	ro.downgrade = newCmdDowngrader(cfg.InputName, cfg.Redis.Version, cfg.UnsupportedCmd, ro.logger)
+	ro.scripts = newScriptCache(cfg.Scripts)
+	if cfg.RateLimit != nil {
+		ro.limiter = replayLimiter(cfg.OutputName, *cfg.RateLimit)
+		ro.shards = newShardRouter(cfg.Redis)
 	}
 
 	syncDelayGauge.Set(float64(0), ro.cfg.InputName)
 
-	slotFilter := cfg.Filter.SlotFilter
+	return ro
+}
+
+func insertFilter(flt *filter.RedisKeyFilter, cfg config.FilterConfig) {
+	flt.InsertCmdBlackList(cfg.CmdBlacklist, true)
+
+	keyFilter := cfg.KeyFilter
+	if keyFilter != nil {
+		flt.InsertPrefixKeyBlackList(keyFilter.PrefixKeyBlacklist)
+		flt.InsertPrefixKeyWhiteList(keyFilter.PrefixKeyWhitelist)
+	}
+
+	slotFilter := cfg.SlotFilter
 	if slotFilter != nil {
-		ro.outFilter.InsertSlotWhiteList(slotFilter.KeySlotWhitelist)
-		ro.outFilter.InsertSlotBlackList(slotFilter.KeySlotBlacklist)
+		flt.InsertSlotWhiteList(slotFilter.KeySlotWhitelist)
+		flt.InsertSlotBlackList(slotFilter.KeySlotBlacklist)
 	}
-	dbBlackList := cfg.Filter.DbBlacklist
+	dbBlackList := cfg.DbBlacklist
 	if len(dbBlackList) > 0 {
-		ro.outFilter.InsertDbBlackList(dbBlackList)
+		flt.InsertDbBlackList(dbBlackList)
 	}
+}
 
-	return ro
+// filterDb returns true if db is filtered out by output or source
+func (ro *RedisOutput) filterDb(db int) bool {
+	return ro.outFilter.FilterDb(db) || (ro.srcFilter != nil && ro.srcFilter.FilterDb(db))
+}
+
+func (ro *RedisOutput) filterCmd(cmd string) bool {
+	return ro.outFilter.FilterCmd(cmd) || (ro.srcFilter != nil && ro.srcFilter.FilterCmd(cmd))
+}
+
+func (ro *RedisOutput) filterKey(key string) bool {
+	if ro.outFilter.FilterKey(key) || ro.outFilter.FilterSlot(key) {
+		return true
+	}
+	return ro.srcFilter != nil && (ro.srcFilter.FilterKey(key) || ro.srcFilter.FilterSlot(key))
+}
+
+func (ro *RedisOutput) filterCmdKey(cmd string, args [][]byte) ([][]byte, bool) {
+	args, reject := ro.outFilter.FilterCmdKey(cmd, args)
+	if reject || ro.srcFilter == nil {
+		return args, reject
+	}
+	return ro.srcFilter.FilterCmdKey(cmd, args)
+}
+
+// rewriteKey replaces key prefix of source, and then renames the key by rules of output
+func (ro *RedisOutput) rewriteKey(key []byte) []byte {
+	if kp := ro.cfg.KeyPrefix; kp != nil && bytes.HasPrefix(key, []byte(kp.From)) {
+		newKey := make([]byte, 0, len(kp.To)+len(key)-len(kp.From))
+		newKey = append(newKey, kp.To...)
+		key = append(newKey, key[len(kp.From):]...)
+	}
+	return ro.renamer.Rename(key)
+}
+
+// rewriteCmdKeys rewrites keys in a copy of args, it returns an error if keys of cmd can't be located
+func (ro *RedisOutput) rewriteCmdKeys(cmd string, args [][]byte) ([][]byte, error) {
+	if ro.cfg.KeyPrefix == nil && ro.renamer.Empty() {
+		return args, nil
+	}
+	indexes := filter.KeyIndexes(cmd, args)
+	if len(indexes) == 0 {
+		if !filter.KnownKeys(cmd) {
+			return args, fmt.Errorf("keys of command can't be rewritten : cmd(%s)", cmd)
+		}
+		return args, nil
+	}
+	newArgs := append([][]byte(nil), args...)
+	for _, i := range indexes {
+		newArgs[i] = ro.rewriteKey(newArgs[i])
+	}
+	return newArgs, nil
 }
 
 type RedisOutputConfig struct {
@@ -182,7 +270,7 @@ type RedisOutputConfig struct {
 	EnableResumeFromBreakPoint bool
 
 	ReplaceHashTag         bool               `yaml:"replaceHashTag"`
-	KeyExists              string             `yaml:"keyExists"` // replace|ignore|error
+	KeyExists              string             `yaml:"keyExists"` // replace|ignore|error|merge
 	KeyExistsLog           bool               `yaml:"keyExistsLog"`
 	FunctionExists         string             `yaml:"functionExists"`
 	MaxProtoBulkLen        int                `yaml:"maxProtoBulkLen"` // proto-max-bulk-len, default value of redis is 512MiB
@@ -195,10 +283,23 @@ type RedisOutputConfig struct {
 	ReplayRdbParallel      int                `yaml:"replayRdbParallel"`
 	ReplayRdbEnableRestore bool               `yaml:"replayRdbEnableRestore" default:"true"`
 	ReplayPipeline         bool               `yaml:"replayPipeline"`
+	UnsupportedCmd         string             `yaml:"unsupportedCommand"` // fail|skip|log
 	UpdateCheckpointTicker time.Duration      `yaml:"updateCheckpointTicker"`
 	Stats                  config.OutputStats `yaml:"stats"`
 
 	Filter           config.FilterConfig
+	SourceFilter     *config.FilterConfig
+	KeyPrefix        *config.KeyPrefixConfig
+	KeyRename        []config.KeyRenameConfig
+	Ttl              *config.TtlConfig
+	OutputName       string
+	RateLimit        *config.ReplayRateLimitConfig // nil if traffic isn't limited
+	Bidirectional    bool                          // tag written commands and skip commands tagged by the peer
+	MarkerKey        string                        // key of the marker command of bidirectional sync
+	ReplyError       config.ReplyErrorConfig       // policies of commands rejected by the target
+	KeyMerge         config.KeyMergeConfig         // merge semantics of keyExists: merge
+	Scripts          config.ScriptsConfig          // lua scripts which are inlined into EVALSHA
+	ScriptSource     *config.RedisConfig           // unknown scripts are looked up on it, nil if there is no source
 	SyncDelayTestKey string
 }
 
@@ -315,14 +416,120 @@ func (ro *RedisOutput) rdbFilterCounterAdd(v uint) {
 	ro.rdbFilterCounterRt.Add(int64(v))
 }
 
+// rdbReplayer replays rdb entries to output with a connection
+type rdbReplayer struct {
+	ctx       context.Context
+	ro        *RedisOutput
+	cli       client.Redis
+	replay    *rdbrestore.RdbReplay
+	currentDB int
+
+	ttlDropped []byte // big key skipped by the ttl policy
+}
+
+func (ro *RedisOutput) newRdbReplayer(ctx context.Context) (*rdbReplayer, error) {
+	cli, err := ro.NewRedisConn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &rdbReplayer{
+		ctx: ctx,
+		ro:  ro,
+		cli: cli,
+		replay: &rdbrestore.RdbReplay{
+			Client:          cli,
+			RedisVersion:    ro.cfg.Redis.Version,
+			EnableRestore:   ro.cfg.ReplayRdbEnableRestore,
+			MaxProtoBulkLen: ro.cfg.MaxProtoBulkLen,
+			KeyExists:       ro.cfg.KeyExists,
+			KeyExistsLog:    ro.cfg.KeyExistsLog,
+			ReplaceHashTag:  ro.cfg.ReplaceHashTag,
+			MergeMaxScore:   ro.cfg.KeyMerge.ZSetScore == config.KeyMergeMax,
+			MergeKeepString: ro.cfg.KeyMerge.String == config.KeyMergeTarget,
+		},
+	}, nil
+}
+
+func (rr *rdbReplayer) Close() {
+	rr.cli.Close()
+}
+
+// filter selects db, returns true if key is filtered out
+func (rr *rdbReplayer) filter(db int, key []byte) (bool, error) {
+	ro := rr.ro
+	if ro.filterDb(db) {
+		return true, nil
+	}
+	if tdb, ok := ro.selectDB(rr.currentDB, db); ok {
+		rr.currentDB = tdb
+		err := redis.SelectDB(rr.cli, uint32(rr.currentDB))
+		if err != nil {
+			ro.logger.Errorf("select db error : db(%d), err(%v)", rr.currentDB, err)
+			return false, err
+		}
+	}
+	return ro.filterKey(util.BytesToString(key)), nil
+}
+
+// Replay returns true if entry is filtered out
+func (rr *rdbReplayer) Replay(e *rdb.BinEntry) (bool, error) {
+	if rr.ro.scripts != nil && e.ObjectParser.Type() == rdb.RdbObjectAux {
+		return false, rr.loadRdbScripts(e)
+	}
+	filterOut, err := rr.filter(int(e.DB), e.Key)
+	if err != nil {
+		return false, err
+	}
+	if filterOut || rr.ro.rewriteRdbTtl(e, &rr.ttlDropped) {
+		rr.ro.rdbFilterCounterAdd(1)
+		return true, nil
+	}
+	rr.ro.rdbSendCounterAdd(1)
+	e.Key = rr.ro.rewriteKey(e.Key)
+	rr.ro.throttle(rr.ctx, "rdb", e.Key, 1, len(e.Key)+e.ObjectParser.ValueDumpSize())
+	if rr.ro.cfg.Bidirectional {
+		err = rr.replayTagged(e)
+	} else {
+		err = rr.replay.Replay(e) // @TODO retry
+	}
+	if err != nil {
+		rr.ro.logger.Errorf("restore rdb error : entry(%v), err(%v)", e, err)
+		return false, err
+	}
+	return false, nil
+}
+
+// Del deletes key, returns true if key is filtered out
+func (rr *rdbReplayer) Del(db int, key []byte) (bool, error) {
+	filterOut, err := rr.filter(db, key)
+	if err != nil || filterOut {
+		return filterOut, err
+	}
+	key = rr.ro.rewriteKey(key)
+	if rr.replay.ReplaceHashTag {
+		key = bytes.Replace(key, []byte("{"), []byte(""), 1)
+		key = bytes.Replace(key, []byte("}"), []byte(""), 1)
+	}
+	if rr.ro.cfg.Bidirectional {
+		err = rr.delTagged(key)
+	} else {
+		_, err = rr.cli.Do("del", key)
+	}
+	if err != nil {
+		return false, fmt.Errorf("del key error : key(%s), error(%w)", key, err)
+	}
+	return false, nil
+}
+
 func (ro *RedisOutput) rdbReplay(ctx context.Context, pipe <-chan *rdb.BinEntry) error {
 	var ok bool
-	cli, err := ro.NewRedisConn(ctx)
+	replayer, err := ro.newRdbReplayer(ctx)
 	if err != nil {
 		ro.logger.Errorf("new redis error : redis(%v), err(%v)", ro.cfg.Redis.Addresses, err)
 		return err
 	}
-	defer cli.Close()
+	defer replayer.Close()
+	cli := replayer.cli
 
 	var ticker = time.Now()
 	pingC := 0
@@ -344,17 +551,6 @@ func (ro *RedisOutput) rdbReplay(ctx context.Context, pipe <-chan *rdb.BinEntry)
 		}
 	}
 
-	replay := &rdbrestore.RdbReplay{
-		Client:          cli,
-		RedisVersion:    ro.cfg.Redis.Version,
-		EnableRestore:   ro.cfg.ReplayRdbEnableRestore,
-		MaxProtoBulkLen: ro.cfg.MaxProtoBulkLen,
-		KeyExists:       ro.cfg.KeyExists,
-		KeyExistsLog:    ro.cfg.KeyExistsLog,
-		ReplaceHashTag:  ro.cfg.ReplaceHashTag,
-	}
-
-	currentDB := 0
 	var e *rdb.BinEntry
 	for {
 		select {
@@ -372,34 +568,9 @@ func (ro *RedisOutput) rdbReplay(ctx context.Context, pipe <-chan *rdb.BinEntry)
 			return nil
 		}
 
-		filterOut := false
-		if ro.outFilter.FilterDb(int(e.DB)) {
-			filterOut = true
-		} else {
-			if tdb, ok := ro.selectDB(currentDB, int(e.DB)); ok {
-				currentDB = tdb
-				err = redis.SelectDB(cli, uint32(currentDB))
-				if err != nil {
-					ro.logger.Errorf("select db error : db(%d), err(%v)", currentDB, err)
-					return err
-				}
-			}
-
-			if ro.outFilter.FilterKey(util.BytesToString(e.Key)) ||
-				ro.outFilter.FilterSlot(util.BytesToString(e.Key)) {
-				filterOut = true
-			}
-		}
-
-		if filterOut {
-			ro.rdbFilterCounterAdd(1)
-		} else {
-			ro.rdbSendCounterAdd(1)
-			err := replay.Replay(e) // @TODO retry
-			if err != nil {
-				ro.logger.Errorf("restore rdb error : entry(%v), err(%v)", e, err)
-				return err
-			}
+		filterOut, err := replayer.Replay(e)
+		if err != nil {
+			return err
 		}
 		pingFn(filterOut)
 	}
@@ -424,9 +595,13 @@ func (ro *RedisOutput) sendRdb(pctx context.Context, reader *store.Reader) error
 			case <-time.After(5 * time.Second):
 			}
 			rByte := readBytes.Load()
+			progress := int64(0) // size of a diskless rdb is unknown until it's completed
+			if nsize > 0 {
+				progress = 100 * rByte / nsize
+			}
 			ro.logger.Infof("sync rdb process : cost(%v), total(%d), read(%d), progress(%3d%%), keys(%d), filtered(%d)",
-				time.Since(startTime), nsize, rByte, 100*rByte/nsize, ro.rdbSendCounterRt.Load(), ro.rdbFilterCounterRt.Load())
-			fullSyncProgress.Set(100*float64(rByte)/float64(nsize), ro.cfg.InputName)
+				time.Since(startTime), nsize, rByte, progress, ro.rdbSendCounterRt.Load(), ro.rdbFilterCounterRt.Load())
+			fullSyncProgress.Set(float64(progress), ro.cfg.InputName)
 		}
 	}
 	defer func() {
@@ -652,6 +827,7 @@ func (ro *RedisOutput) parseAofCommand(replayQuit usync.WaitCloser, reader *bufi
 	}
 
 	syncDelayTestkey := []byte(ro.cfg.SyncDelayTestKey)
+	peers := ro.newPeerFilter()
 
 	decoder := client.NewDecoder(reader)
 
@@ -680,6 +856,12 @@ func (ro *RedisOutput) parseAofCommand(replayQuit usync.WaitCloser, reader *bufi
 		}
 		aofCmdCounter.Inc(ro.cfg.InputName)
 
+		// skip commands written by the peer syncer before filters, since marker keys are filtered out
+		if peers.Skip(sCmd, argv) {
+			ro.filterCounterAdd(1)
+			continue
+		}
+
 		// filter db, filter command, filter key
 		if sCmd != "ping" {
 			if strings.EqualFold(sCmd, "select") {
@@ -694,9 +876,9 @@ func (ro *RedisOutput) parseAofCommand(replayQuit usync.WaitCloser, reader *bufi
 					ro.logger.Errorf("%s", err.Error())
 					return err
 				}
-				bypass = ro.outFilter.FilterDb(n) // filter following commands
+				bypass = ro.filterDb(n) // filter following commands
 				selectDB = n
-			} else if ro.outFilter.FilterCmd(sCmd) {
+			} else if ro.filterCmd(sCmd) {
 				ignoreCmd = true
 			} else if strings.EqualFold(sCmd, "publish") && strings.EqualFold(string(argv[0]), "__sentinel__:hello") {
 				ignoresentinel = true
@@ -708,11 +890,46 @@ func (ro *RedisOutput) parseAofCommand(replayQuit usync.WaitCloser, reader *bufi
 			}
 		}
 
-		newArgv, reject = ro.outFilter.FilterCmdKey(sCmd, argv)
+		newArgv, reject = ro.filterCmdKey(sCmd, argv)
 		if bypass || reject {
 			ro.filterCounterAdd(1)
 			continue
 		}
+		if newArgv, err = ro.rewriteCmdKeys(sCmd, newArgv); err != nil {
+			// the command would be written to keys which aren't rewritten
+			if ro.dryRun != nil {
+				ro.dryRun.addError(dryRunErrUnsupported)
+				continue
+			}
+			switch ro.cfg.UnsupportedCmd {
+			case config.UnsupportedCmdSkip, config.UnsupportedCmdLog:
+				if ro.cfg.UnsupportedCmd == config.UnsupportedCmdLog {
+					ro.logger.Warnf("skip command : input(%s), error(%v)", ro.cfg.InputName, err)
+				}
+				ro.filterCounterAdd(1)
+				continue
+			}
+			ro.logger.Errorf("%s", err.Error())
+			return err
+		}
+		if sCmd, newArgv, reject = ro.ttl.Rewrite(sCmd, newArgv); reject {
+			ro.filterCounterAdd(1)
+			continue
+		}
+		if sCmd, newArgv, reject, err = ro.downgrade.Downgrade(sCmd, newArgv); err != nil {
+			if ro.dryRun != nil {
+				// replay would stop here
+				ro.dryRun.addError(dryRunErrUnsupported)
+				continue
+			}
+			ro.logger.Errorf("%s", err.Error())
+			return err
+		} else if reject {
+			ro.filterCounterAdd(1)
+			continue
+		}
+		ro.scripts.Track(sCmd, newArgv)
+		sCmd, newArgv = ro.inlineScript(sCmd, newArgv)
 
 		if selectDB >= 0 {
 			if sdb, ok := ro.selectDB(currentDB, selectDB); ok {
@@ -1101,21 +1318,24 @@ func (ro *RedisOutput) sendCmdsInTransaction(replayWait usync.WaitCloser, conn c
 	}
 }
 
+// checkReplies returns the first error of replies, replies of transactions are checked as well
 func (ro *RedisOutput) checkReplies(replies []interface{}) error {
 	if len(replies) == 0 {
 		return fmt.Errorf("replies is empmty")
 	}
-	// for _, rpl := range replies {
-	// 	switch tt := rpl.(type) {
-	// 	case []interface{}:
-	// 		err := ro.checkReplies(tt)
-	// 		if err != nil {
-	// 			return err
-	// 		}
-	// 	case string:
-	// 	case common.RedisError:
-	// 	}
-	// }
+	for _, rpl := range replies {
+		switch tt := rpl.(type) {
+		case []interface{}:
+			if len(tt) == 0 {
+				continue
+			}
+			if err := ro.checkReplies(tt); err != nil {
+				return err
+			}
+		case error:
+			return tt
+		}
+	}
 	return nil
 }
 
@@ -1157,6 +1377,7 @@ func (ro *RedisOutput) sendCmdsBatch(replayWait usync.WaitCloser, conn client.Re
 
 	type cmdBatcher struct {
 		bt         common.CmdBatcher
+		batch      cmdBatch
 		cmdCounter uint
 		offset     uint
 		delayNs    int64
@@ -1192,7 +1413,11 @@ func (ro *RedisOutput) sendCmdsBatch(replayWait usync.WaitCloser, conn client.Re
 					return
 				}
 
-				err = ro.checkReplies(rets)
+				// commands can't be retried, since following batches have been sent
+				rejected, aborted, err := rejectedCmds(rets, bat.batch)
+				if err == nil && len(rejected) > 0 {
+					_, err = ro.handleRejected(replayWait, conn, bat.batch.cmds, rejected, aborted, false, 0)
+				}
 				if err != nil {
 					handleError(bat, err)
 					return
@@ -1207,12 +1432,19 @@ func (ro *RedisOutput) sendCmdsBatch(replayWait usync.WaitCloser, conn client.Re
 		}, func(i interface{}) { replayWait.Close(fmt.Errorf("panic : %v", i)) })
 	}
 
+	aborts := 0 // times the transaction is aborted
 	sendFuncOnce := func(shouldInTransaction, shouldUpdateCP bool, lastOffset int64) error {
+		ro.throttleCmds(replayWait.Context(), cmdQueue)
 		batcher := conn.NewBatcher(isPipeline)
 		cmdCounter := uint(0)
+		batch := cmdBatch{txn: shouldInTransaction, cmds: cmdQueue}
 
 		if shouldInTransaction {
 			batcher.Put("multi")
+			if ro.cfg.Bidirectional {
+				PutMarker(batcher, ro.cfg.MarkerKey, runId)
+				batch.head++
+			}
 		}
 
 		delayNs := int64(0)
@@ -1270,9 +1502,12 @@ func (ro *RedisOutput) sendCmdsBatch(replayWait usync.WaitCloser, conn client.Re
 		ro.sendCounterAdd(uint(cmdCounter))
 
 		if isPipeline {
+			// cmdQueue is reused, so the receiver has a copy of it
+			batch.cmds = append([]cmdExecution(nil), cmdQueue...)
 			select {
 			case pipeline <- &cmdBatcher{
 				bt:         batcher,
+				batch:      batch,
 				cmdCounter: cmdCounter,
 				offset:     uint(lastOffset),
 				delayNs:    delayNs,
@@ -1281,12 +1516,20 @@ func (ro *RedisOutput) sendCmdsBatch(replayWait usync.WaitCloser, conn client.Re
 				return replayWait.Error()
 			}
 		} else {
-			err = ro.checkReplies(rets)
+			rejected, aborted, err := rejectedCmds(rets, batch)
+			if err == nil && len(rejected) > 0 {
+				cmdQueue, err = ro.handleRejected(replayWait, conn, cmdQueue, rejected, aborted, true, aborts)
+				if err == nil && aborted {
+					aborts++
+					err = errTxnAborted
+				}
+			}
 			if err != nil {
 				failCounter.Add(float64(cmdCounter), ro.cfg.InputName)
 				batchSendCounter.Add(1, ro.cfg.InputName, transactionLabel, "error")
 				return err
 			}
+			aborts = 0
 			if delayNs > 0 {
 				syncDelayGauge.Set(float64(time.Now().UnixNano()-delayNs), ro.cfg.InputName)
 			}
@@ -1316,6 +1559,10 @@ func (ro *RedisOutput) sendCmdsBatch(replayWait usync.WaitCloser, conn client.Re
 			if replayWait.IsClosed() {
 				return err
 			}
+			if errors.Is(err, errTxnAborted) {
+				// rejected commands are removed or retried
+				continue
+			}
 			maxRetries++
 
 			if errors.Is(err, common.ErrMove) || errors.Is(err, common.ErrAsk) || errors.Is(err, common.ErrCrossSlots) {
@@ -1351,6 +1598,7 @@ func (ro *RedisOutput) sendCmdsBatch(replayWait usync.WaitCloser, conn client.Re
 			if !ok {
 				return nil
 			}
+			ro.absoluteTtl(&item)
 			length := len(item.Cmd)
 			for i := range item.Args {
 				length += len(item.Args[i].([]byte))
@@ -1394,6 +1642,10 @@ func (ro *RedisOutput) sendCmdsBatch(replayWait usync.WaitCloser, conn client.Re
 					queuedByteSize += uint64(length)
 				}
 			}
+			if !inTransaction && isEvalsha(item.Cmd) {
+				// EVALSHA of an unknown script ends its batch, so it can be retried in order on NOSCRIPT
+				needFlush = true
+			}
 		case <-batchTicker.C:
 			if !needFlush && !inTransaction && (len(cmdQueue) > 0) {
 				needFlush = true
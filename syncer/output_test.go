@@ -0,0 +1,45 @@
+package syncer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mgtv-tech/redis-GunYu/config"
+)
+
+func TestRewriteCmdKeys(t *testing.T) {
+	args := func(s ...string) [][]byte {
+		ret := [][]byte{}
+		for _, a := range s {
+			ret = append(ret, []byte(a))
+		}
+		return ret
+	}
+
+	// keys aren't rewritten
+	ro := NewRedisOutput(RedisOutputConfig{InputName: "127.0.0.1:6379/a"})
+	newArgs, err := ro.rewriteCmdKeys("json.set", args("k", "$", "1"))
+	assert.Nil(t, err)
+	assert.Equal(t, args("k", "$", "1"), newArgs)
+
+	ro = NewRedisOutput(RedisOutputConfig{
+		InputName: "127.0.0.1:6379/a",
+		KeyPrefix: &config.KeyPrefixConfig{To: "app1:"},
+	})
+	newArgs, err = ro.rewriteCmdKeys("unlink", args("a", "b"))
+	assert.Nil(t, err)
+	assert.Equal(t, args("app1:a", "app1:b"), newArgs)
+
+	newArgs, err = ro.rewriteCmdKeys("bitop", args("and", "d", "a", "b"))
+	assert.Nil(t, err)
+	assert.Equal(t, args("and", "app1:d", "app1:a", "app1:b"), newArgs)
+
+	newArgs, err = ro.rewriteCmdKeys("flushdb", nil)
+	assert.Nil(t, err)
+	assert.Nil(t, newArgs)
+
+	// keys of unknown commands can't be located
+	_, err = ro.rewriteCmdKeys("json.set", args("k", "$", "1"))
+	assert.NotNil(t, err)
+}
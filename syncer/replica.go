@@ -180,6 +180,10 @@ func (rl *ReplicaLeader) sendData(wait usync.WaitCloser, req *pb.SyncRequest, st
 	defer wait2.Close(nil)
 
 	reader.Start(wait2)
+	if !reader.IsAof() && reader.Size() < 0 {
+		err = fmt.Errorf("size of rdb is unknown : offset(%d)", reader.Left())
+		return rl.handleError(stream, err, pb.SyncResponse_FAULT, "rdb is being written", "")
+	}
 	ioReader := reader.IoReader()
 	offset := reqSp.Offset
 
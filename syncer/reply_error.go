@@ -0,0 +1,177 @@
+package syncer
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mgtv-tech/redis-GunYu/config"
+	"github.com/mgtv-tech/redis-GunYu/pkg/metric"
+	"github.com/mgtv-tech/redis-GunYu/pkg/redis/client"
+	usync "github.com/mgtv-tech/redis-GunYu/pkg/sync"
+)
+
+var (
+	replyErrorCounter = metric.NewCounterVec(metric.CounterVecOpts{
+		Namespace: config.AppName,
+		Subsystem: "output",
+		Name:      "reply_error",
+		Labels:    []string{"input", "class", "policy"},
+	})
+
+	// the transaction is aborted, and it's sent again without commands which are skipped or dead-lettered
+	errTxnAborted = errors.New("transaction is aborted")
+)
+
+const maxReplyErrorBackoff = 30 * time.Second
+
+// replyErrorClass returns the class of an error reply, it's the first word of the error
+func replyErrorClass(msg string) string {
+	if i := strings.IndexByte(msg, ' '); i >= 0 {
+		return msg[:i]
+	}
+	return msg
+}
+
+// cmdBatch is the layout of a batch sent to the target :
+// [multi] + commands of the syncer, e.g. the marker + cmds + checkpoints + [exec]
+type cmdBatch struct {
+	txn  bool
+	head int // commands of the syncer before cmds, excluding multi
+	cmds []cmdExecution
+}
+
+// rejectedCmd is a command of a batch rejected by the target
+type rejectedCmd struct {
+	idx   int // index of cmds
+	ce    *cmdExecution
+	err   error
+	class string
+}
+
+// rejectedCmds returns rejected commands of a batch by replies, which are aligned with commands of the batch.
+// aborted is true if the transaction is aborted, i.e. commands are rejected when they are queued,
+// and nothing of the batch is applied. An error is returned if a command of the syncer is rejected.
+func rejectedCmds(replies []interface{}, bat cmdBatch) (rejected []rejectedCmd, aborted bool, err error) {
+	results := replies
+	if bat.txn {
+		if len(replies) < 2 {
+			return nil, false, fmt.Errorf("replies of transaction are incomplete : replies(%d)", len(replies))
+		}
+		if e, ok := replies[0].(error); ok {
+			return nil, false, fmt.Errorf("multi is rejected : %w", e)
+		}
+		results = replies[1 : len(replies)-1]
+		switch ret := replies[len(replies)-1].(type) {
+		case []interface{}:
+			results = ret
+		case error:
+			// EXECABORT, replies of queued commands tell which commands are rejected
+			aborted = true
+			defer func() {
+				if err == nil && len(rejected) == 0 {
+					err = fmt.Errorf("exec is rejected : %w", ret)
+				}
+			}()
+		}
+		// otherwise multi and exec aren't sent to a cluster, results are replies of commands
+	}
+	if len(results) < bat.head+len(bat.cmds) {
+		return nil, aborted, fmt.Errorf("replies are incomplete : replies(%d), commands(%d)", len(results), bat.head+len(bat.cmds))
+	}
+	for i, ret := range results {
+		e, ok := ret.(error)
+		if !ok {
+			continue
+		}
+		j := i - bat.head
+		if j < 0 || j >= len(bat.cmds) {
+			return nil, aborted, fmt.Errorf("command of syncer is rejected : %w", e)
+		}
+		rejected = append(rejected, rejectedCmd{idx: j, ce: &bat.cmds[j], err: e, class: replyErrorClass(e.Error())})
+	}
+	return rejected, aborted, nil
+}
+
+// replyErrorBackoff returns the backoff of the nth retry, it's doubled every retry
+func (ro *RedisOutput) replyErrorBackoff(n int) time.Duration {
+	backoff := ro.cfg.ReplyError.RetryBackoff
+	if backoff <= 0 {
+		backoff = time.Second
+	}
+	for ; n > 0 && backoff < maxReplyErrorBackoff; n-- {
+		backoff *= 2
+	}
+	if backoff > maxReplyErrorBackoff {
+		backoff = maxReplyErrorBackoff
+	}
+	return backoff
+}
+
+// handleRejected applies policies to rejected commands of a batch, an error is returned if replay should stop.
+//
+// If the transaction is aborted, nothing of the batch is applied, so commands which are skipped or dead-lettered
+// are removed from cmds, and the caller sends the batch again, aborts is the number of times it's been aborted.
+// Otherwise following commands of the batch have been applied, a rejected command isn't executed again,
+// since it would be applied after them, so the retry policy stops replay.
+// The batch isn't sent again if retriable is false, e.g. in pipeline mode following batches have been sent.
+// EVALSHA rejected by NOSCRIPT is executed again once its script is loaded, if it's the last command of the batch.
+func (ro *RedisOutput) handleRejected(wait usync.WaitCloser, conn client.Redis, cmds []cmdExecution,
+	rejected []rejectedCmd, aborted bool, retriable bool, aborts int) ([]cmdExecution, error) {
+
+	if aborted && !retriable {
+		rc := rejected[0]
+		replyErrorCounter.Inc(ro.cfg.InputName, rc.class, config.ReplyErrorStop)
+		return cmds, fmt.Errorf("transaction is aborted : cmd(%s), offset(%d), db(%d), error(%w)", rc.ce.Cmd, rc.ce.Offset, rc.ce.Db, rc.err)
+	}
+
+	backoff := false
+	dropped := make(map[int]struct{}, len(rejected))
+	for _, rc := range rejected {
+		if !aborted && retriable && ro.retryScript(conn, cmds, rc) {
+			continue
+		}
+		policy := ro.cfg.ReplyError.Policy(rc.class)
+		if policy == config.ReplyErrorRetry {
+			if aborted && aborts < ro.cfg.ReplyError.MaxRetries {
+				ro.logger.Warnf("command is rejected, retry transaction : cmd(%s), offset(%d), db(%d), retries(%d), error(%v)",
+					rc.ce.Cmd, rc.ce.Offset, rc.ce.Db, aborts, rc.err)
+				replyErrorCounter.Inc(ro.cfg.InputName, rc.class, config.ReplyErrorRetry)
+				backoff = true
+				continue
+			}
+			policy = config.ReplyErrorStop
+		}
+
+		replyErrorCounter.Inc(ro.cfg.InputName, rc.class, policy)
+		switch policy {
+		case config.ReplyErrorSkip:
+			ro.logger.Warnf("command is rejected, skip it : cmd(%s), offset(%d), db(%d), error(%v)", rc.ce.Cmd, rc.ce.Offset, rc.ce.Db, rc.err)
+		case config.ReplyErrorDeadLetter:
+			if err := ro.writeDeadLetter(rc.ce, rc.err); err != nil {
+				ro.logger.Errorf("write dead letter error : cmd(%s), offset(%d), db(%d), error(%v)", rc.ce.Cmd, rc.ce.Offset, rc.ce.Db, err)
+				return cmds, err
+			}
+			ro.logger.Warnf("command is rejected, write it to dead letters : cmd(%s), offset(%d), db(%d), error(%v)", rc.ce.Cmd, rc.ce.Offset, rc.ce.Db, rc.err)
+		default:
+			ro.logger.Errorf("command is rejected : cmd(%s), args(%v), offset(%d), db(%d), error(%v)", rc.ce.Cmd, rc.ce.Args, rc.ce.Offset, rc.ce.Db, rc.err)
+			return cmds, fmt.Errorf("command is rejected : cmd(%s), offset(%d), db(%d), error(%w)", rc.ce.Cmd, rc.ce.Offset, rc.ce.Db, rc.err)
+		}
+		dropped[rc.idx] = struct{}{}
+	}
+
+	if !aborted {
+		return cmds, nil
+	}
+	if backoff {
+		wait.Sleep(ro.replyErrorBackoff(aborts))
+	}
+	remained := make([]cmdExecution, 0, len(cmds))
+	for i := range cmds {
+		if _, ok := dropped[i]; !ok {
+			remained = append(remained, cmds[i])
+		}
+	}
+	return remained, nil
+}
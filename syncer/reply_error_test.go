@@ -0,0 +1,137 @@
+package syncer
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mgtv-tech/redis-GunYu/config"
+	"github.com/mgtv-tech/redis-GunYu/pkg/redis/client/common"
+	"github.com/mgtv-tech/redis-GunYu/pkg/redis/client/proto"
+	usync "github.com/mgtv-tech/redis-GunYu/pkg/sync"
+)
+
+func TestReplyErrorClass(t *testing.T) {
+	assert.Equal(t, "WRONGTYPE", replyErrorClass("WRONGTYPE Operation against a key holding the wrong kind of value"))
+	assert.Equal(t, "OOM", replyErrorClass("OOM"))
+}
+
+func TestRejectedCmds(t *testing.T) {
+	cmds := []cmdExecution{{Cmd: "set", Offset: 1}, {Cmd: "lpush", Offset: 2}, {Cmd: "set", Offset: 3}}
+	wrongType := proto.RedisError("WRONGTYPE Operation against a key holding the wrong kind of value")
+
+	// non-transaction : cmds + checkpoint
+	rejected, aborted, err := rejectedCmds([]interface{}{"OK", wrongType, "OK", int64(0)}, cmdBatch{cmds: cmds})
+	assert.Nil(t, err)
+	assert.False(t, aborted)
+	assert.Len(t, rejected, 1)
+	assert.Equal(t, 1, rejected[0].idx)
+	assert.Equal(t, "WRONGTYPE", rejected[0].class)
+
+	// transaction with the marker, a command fails on exec
+	replies := []interface{}{"OK", "QUEUED", "QUEUED", "QUEUED", "QUEUED", "QUEUED", []interface{}{"OK", "OK", wrongType, "OK", int64(0)}}
+	rejected, aborted, err = rejectedCmds(replies, cmdBatch{txn: true, head: 1, cmds: cmds})
+	assert.Nil(t, err)
+	assert.False(t, aborted)
+	assert.Len(t, rejected, 1)
+	assert.Equal(t, int64(2), rejected[0].ce.Offset)
+
+	// transaction is aborted
+	replies = []interface{}{"OK", "QUEUED", proto.RedisError("OOM command not allowed"), "QUEUED", "QUEUED", proto.RedisError("EXECABORT Transaction discarded")}
+	rejected, aborted, err = rejectedCmds(replies, cmdBatch{txn: true, cmds: cmds})
+	assert.Nil(t, err)
+	assert.True(t, aborted)
+	assert.Len(t, rejected, 1)
+	assert.Equal(t, "OOM", rejected[0].class)
+
+	// multi and exec aren't sent to a cluster
+	replies = []interface{}{"OK", "OK", "OK", common.RedisError("NOSCRIPT No matching script"), "OK"}
+	rejected, _, err = rejectedCmds(replies, cmdBatch{txn: true, cmds: cmds})
+	assert.Nil(t, err)
+	assert.Len(t, rejected, 1)
+	assert.Equal(t, 2, rejected[0].idx)
+
+	// checkpoint is rejected
+	_, _, err = rejectedCmds([]interface{}{"OK", "OK", "OK", proto.RedisError("READONLY")}, cmdBatch{cmds: cmds})
+	assert.NotNil(t, err)
+	// incomplete
+	_, _, err = rejectedCmds([]interface{}{"OK"}, cmdBatch{cmds: cmds})
+	assert.NotNil(t, err)
+}
+
+func TestHandleRejected(t *testing.T) {
+	dir := t.TempDir()
+	cfg := config.ReplyErrorConfig{
+		Policies:      map[string]string{"WRONGTYPE": "skip", "NOSCRIPT": "deadLetter", "OOM": "retry"},
+		Default:       "stop",
+		MaxRetries:    2,
+		RetryBackoff:  time.Millisecond,
+		DeadLetterDir: dir,
+	}
+	ro := NewRedisOutput(RedisOutputConfig{InputName: "127.0.0.1:6379/a", ReplyError: cfg})
+	wait := usync.NewWaitCloser(nil)
+	defer wait.Close(nil)
+
+	cmds := []cmdExecution{
+		{Cmd: "lpush", Args: []interface{}{[]byte("k"), []byte("v")}, Offset: 1, Db: 2},
+		{Cmd: "evalsha", Args: []interface{}{[]byte("sha"), []byte("0")}, Offset: 2, Db: 2},
+		{Cmd: "set", Args: []interface{}{[]byte("k"), []byte("v")}, Offset: 3, Db: 2},
+	}
+	rejected := []rejectedCmd{
+		{idx: 0, ce: &cmds[0], err: proto.RedisError("WRONGTYPE"), class: "WRONGTYPE"},
+		{idx: 1, ce: &cmds[1], err: proto.RedisError("NOSCRIPT No matching script"), class: "NOSCRIPT"},
+	}
+	remained, err := ro.handleRejected(wait, nil, cmds, rejected, false, true, 0)
+	assert.Nil(t, err)
+	assert.Len(t, remained, 3)
+
+	// commands skipped or dead-lettered are removed from the aborted transaction
+	remained, err = ro.handleRejected(wait, nil, cmds, rejected, true, true, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, []cmdExecution{cmds[2]}, remained)
+	// the aborted transaction can't be sent again
+	_, err = ro.handleRejected(wait, nil, cmds, rejected, true, false, 0)
+	assert.NotNil(t, err)
+
+	// retry
+	oom := []rejectedCmd{{idx: 2, ce: &cmds[2], err: proto.RedisError("OOM"), class: "OOM"}}
+	remained, err = ro.handleRejected(wait, nil, cmds, oom, true, true, 0)
+	assert.Nil(t, err)
+	assert.Len(t, remained, 3)
+	_, err = ro.handleRejected(wait, nil, cmds, oom, true, true, ro.cfg.ReplyError.MaxRetries)
+	assert.NotNil(t, err)
+	_, err = ro.handleRejected(wait, nil, cmds, oom, false, false, 0)
+	assert.NotNil(t, err)
+	// following commands of the batch have been applied, so the command isn't executed again
+	_, err = ro.handleRejected(wait, nil, cmds, oom, false, true, 0)
+	assert.NotNil(t, err)
+
+	// stop
+	_, err = ro.handleRejected(wait, nil, cmds, []rejectedCmd{{idx: 0, ce: &cmds[0], err: proto.RedisError("ERR"), class: "ERR"}}, false, true, 0)
+	assert.NotNil(t, err)
+
+	// dead letters
+	path := filepath.Join(dir, "127.0.0.1_6379_a.resp")
+	assert.Equal(t, path, ro.deadLetterPath())
+	data, err := os.ReadFile(path)
+	assert.Nil(t, err)
+	dls := []*DeadLetter{}
+	assert.Nil(t, ReadDeadLetters(bytes.NewReader(data), func(dl *DeadLetter) error {
+		dls = append(dls, dl)
+		return nil
+	}))
+	assert.Len(t, dls, 2)
+	assert.Equal(t, &DeadLetter{Offset: 2, Db: 2, Error: "NOSCRIPT No matching script", Cmd: "evalsha", Args: [][]byte{[]byte("sha"), []byte("0")}}, dls[0])
+}
+
+func TestReplyErrorBackoff(t *testing.T) {
+	ro := &RedisOutput{}
+	ro.cfg.ReplyError.RetryBackoff = time.Second
+	assert.Equal(t, time.Second, ro.replyErrorBackoff(0))
+	assert.Equal(t, 4*time.Second, ro.replyErrorBackoff(2))
+	assert.Equal(t, maxReplyErrorBackoff, ro.replyErrorBackoff(100))
+}
@@ -0,0 +1,719 @@
+package syncer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mgtv-tech/redis-GunYu/config"
+	"github.com/mgtv-tech/redis-GunYu/pkg/log"
+	"github.com/mgtv-tech/redis-GunYu/pkg/metric"
+	"github.com/mgtv-tech/redis-GunYu/pkg/rdb"
+	"github.com/mgtv-tech/redis-GunYu/pkg/redis"
+	"github.com/mgtv-tech/redis-GunYu/pkg/redis/client"
+	"github.com/mgtv-tech/redis-GunYu/pkg/redis/client/common"
+	usync "github.com/mgtv-tech/redis-GunYu/pkg/sync"
+	"github.com/mgtv-tech/redis-GunYu/pkg/util"
+)
+
+var (
+	rumpKeysCounter = metric.NewCounterVec(metric.CounterVecOpts{
+		Namespace: config.AppName,
+		Subsystem: "input",
+		Name:      "rump_keys",
+		Labels:    []string{"input", "phase"},
+	})
+	rumpPendingGauge = metric.NewGaugeVec(metric.GaugeVecOpts{
+		Namespace: config.AppName,
+		Subsystem: "input",
+		Name:      "rump_pending_keys",
+		Labels:    []string{"input"},
+	})
+)
+
+const (
+	rumpKeyspacePattern = "__keyspace@*__:*"
+	// input restarts if too many keys are modified before they are dumped again
+	rumpMaxPendingKeys = 1 << 20
+)
+
+// RumpInput syncs data with SCAN, DUMP and PTTL instead of PSYNC, it's for the sources which forbid SYNC and PSYNC.
+// dumped keys are restored by output in parallel, and the SCAN cursor is saved as checkpoint of output,
+// so a one-shot migration resumes from the cursor after restarting.
+// if keyspace notification is enabled, keys modified during and after scanning are dumped again,
+// and a restart scans all keys again since notifications are lost, the cursor is only saved as progress.
+type RumpInput struct {
+	inputAddr string
+	cfg       config.RedisConfig
+	rumpCfg   config.InputRumpConfig
+	wait      usync.WaitCloser
+	outputs   []Output
+	fsm       *SyncFiniteStateMachine
+	logger    log.Logger
+	runIds    []string
+	mutex     sync.RWMutex
+}
+
+func NewRumpInput(redisCfg config.RedisConfig, rumpCfg config.InputRumpConfig) *RumpInput {
+	return &RumpInput{
+		inputAddr: redisCfg.Address(),
+		cfg:       redisCfg,
+		rumpCfg:   rumpCfg,
+		wait:      usync.NewWaitCloser(nil),
+		fsm:       NewSyncFiniteStateMachine(),
+		logger:    log.WithLogger(config.LogModuleName(fmt.Sprintf("[RumpInput(%s)] ", redisCfg.Address()))),
+	}
+}
+
+func (ri *RumpInput) Id() string {
+	return ri.cfg.Address()
+}
+
+func (ri *RumpInput) SetOutputs(outputs ...Output) {
+	ri.outputs = outputs
+}
+
+// SetChannel : rump input sends data to output directly
+func (ri *RumpInput) SetChannel(ch Channel) {
+}
+
+func (ri *RumpInput) StateNotify(state SyncState) usync.WaitChannel {
+	return ri.fsm.StateNotify(state)
+}
+
+func (ri *RumpInput) RunIds() []string {
+	ri.mutex.RLock()
+	defer ri.mutex.RUnlock()
+	return ri.runIds
+}
+
+func (ri *RumpInput) setRunIds(ids []string) {
+	ri.mutex.Lock()
+	defer ri.mutex.Unlock()
+	ri.runIds = ids
+}
+
+func (ri *RumpInput) Stop() error {
+	ri.logger.Debugf("Stop")
+	ri.wait.Close(nil)
+	return nil
+}
+
+func (ri *RumpInput) Run() error {
+	ri.logger.Debugf("Run")
+
+	ri.wait.WgAdd(1)
+	usync.SafeGo(func() {
+		defer ri.wait.WgDone()
+		for !ri.wait.IsClosed() {
+			err := ri.run()
+			if err != nil {
+				ri.logger.Errorf("run error : %v", err)
+				if errors.Is(err, ErrBreak) {
+					ri.wait.Close(err)
+					break
+				}
+			}
+			ri.wait.Sleep(2 * time.Second)
+		}
+	}, func(i interface{}) {
+		ri.wait.Close(fmt.Errorf("panic : %v", i))
+	})
+
+	ri.wait.WgWait()
+	return ri.wait.Error()
+}
+
+func (ri *RumpInput) run() error {
+	ri.fsm.Reset()
+
+	// keys are dumped once, they can not be replicated to outputs at different speeds
+	if len(ri.outputs) != 1 {
+		return errors.Join(ErrQuit, fmt.Errorf("rump input doesn't support multiple outputs : %d", len(ri.outputs)))
+	}
+	ro, ok := ri.outputs[0].(*RedisOutput)
+	if !ok {
+		return errors.Join(ErrQuit, fmt.Errorf("rump input doesn't support output(%T)", ri.outputs[0]))
+	}
+
+	runScope := usync.NewWaitCloserFromParent(ri.wait, nil)
+	defer runScope.WgWait()
+	defer runScope.Close(nil)
+
+	cli, err := client.NewRedis(ri.cfg)
+	if err != nil {
+		return err
+	}
+	defer cli.Close()
+
+	id1, id2, err := redis.GetRunIds(cli)
+	if err != nil {
+		return err
+	}
+	ri.setRunIds([]string{id1, id2})
+
+	// subscribe before scanning, so modifications during scanning aren't lost
+	var notifier *keyspaceNotifier
+	if ri.rumpCfg.KeyspaceNotify {
+		notifier, err = ri.subscribe()
+		if err != nil {
+			return err
+		}
+		defer notifier.Close()
+	}
+
+	workers, err := ri.startWorkers(runScope, ro)
+	if err != nil {
+		return err
+	}
+
+	ri.fsm.SetState(SyncStateFullSyncing)
+	if err = ri.scan(runScope, cli, ro, workers, id1); err != nil {
+		runScope.Close(err)
+		return runScope.Error()
+	}
+	ri.fsm.SetState(SyncStateFullSynced)
+	fullSyncProgress.Set(100, ri.inputAddr)
+
+	if notifier == nil {
+		ri.logger.Infof("rump done")
+		<-runScope.Done()
+		return runScope.Error()
+	}
+
+	ri.fsm.SetState(SyncStateIncrSyncing)
+	runScope.Close(ri.catchUp(runScope, cli, ro, workers, notifier))
+	return runScope.Error()
+}
+
+// rumpRunId returns run id of checkpoint of db, it doesn't match the checkpoint of psync
+func rumpRunId(runId string, db int) string {
+	return fmt.Sprintf("rump-%d-%s", db, runId)
+}
+
+func (ri *RumpInput) scan(wait usync.WaitCloser, cli client.Redis, ro *RedisOutput, workers *rumpWorkers, runId string) error {
+	ret, err := common.String(cli.Do("info", "keyspace"))
+	if err != nil {
+		return err
+	}
+	keyspace, err := redis.ParseKeyspace([]byte(ret))
+	if err != nil {
+		return err
+	}
+	dbs := make([]int, 0, len(keyspace))
+	total := int64(0)
+	for db, keys := range keyspace {
+		dbs = append(dbs, int(db))
+		total += keys
+	}
+	sort.Ints(dbs)
+
+	progress := &rumpProgress{total: total, start: time.Now()}
+	for _, db := range dbs {
+		if err := ri.scanDb(wait, cli, ro, workers, rumpRunId(runId, db), db, progress); err != nil {
+			return err
+		}
+	}
+	ri.logger.Infof("rump scan done : cost(%v), keys(%d)", time.Since(progress.start), progress.scanned)
+	return nil
+}
+
+type rumpProgress struct {
+	total   int64
+	scanned int64
+	start   time.Time
+}
+
+func (ri *RumpInput) scanDb(wait usync.WaitCloser, cli client.Redis, ro *RedisOutput, workers *rumpWorkers, runId string, db int, progress *rumpProgress) error {
+	ctx := wait.Context()
+	cursor := "0"
+	// the cursor is saved as progress, but keys modified while input is stopped are unknown
+	// if keyspace notification is enabled, so db is scanned again
+	if !ri.rumpCfg.KeyspaceNotify {
+		sp, err := ro.StartPoint(ctx, []string{runId})
+		if err != nil {
+			return err
+		}
+		var done bool
+		cursor, done = rumpCursor(sp, runId)
+		if done {
+			ri.logger.Infof("rump db is done : db(%d)", db)
+			return nil
+		}
+		if cursor != "0" {
+			ri.logger.Infof("rump db resumes : db(%d), cursor(%s)", db, cursor)
+		}
+	}
+
+	if err := redis.SelectDB(cli, uint32(db)); err != nil {
+		return err
+	}
+
+	options := rumpParseOptions(ro)
+	throttle := &rumpThrottle{rate: ri.rumpCfg.KeysPerSecond, start: time.Now()}
+	lastCheckpoint := time.Now()
+	for !wait.IsClosed() {
+		reply, err := common.Values(cli.Do("scan", cursor, "count", ri.rumpCfg.ScanCount))
+		if err != nil {
+			return err
+		}
+		if len(reply) != 2 {
+			return fmt.Errorf("invalid scan reply : %v", reply)
+		}
+		cursor, err = common.String(reply[0], nil)
+		if err != nil {
+			return err
+		}
+		keys, err := common.Values(reply[1], nil)
+		if err != nil {
+			return err
+		}
+
+		tasks, err := ri.dump(cli, db, keys, options)
+		if err != nil {
+			return err
+		}
+		for _, task := range tasks {
+			if task.entries == nil { // key is deleted after scanning
+				continue
+			}
+			if err := workers.send(task); err != nil {
+				return err
+			}
+		}
+		rumpKeysCounter.Add(float64(len(keys)), ri.inputAddr, "scan")
+		progress.scanned += int64(len(keys))
+		throttle.wait(ctx, len(keys))
+
+		if cursor == "0" {
+			break
+		}
+		if time.Since(lastCheckpoint) < ri.rumpCfg.CheckpointInterval {
+			continue
+		}
+		lastCheckpoint = time.Now()
+		ri.logProgress(progress)
+		if offset, err := strconv.ParseInt(cursor, 10, 64); err == nil {
+			if err := ri.checkpoint(ctx, ro, workers, runId, offset); err != nil {
+				return err
+			}
+		}
+	}
+	if wait.IsClosed() {
+		return wait.Error()
+	}
+
+	// zero cursor means db is done
+	return ri.checkpoint(ctx, ro, workers, runId, 0)
+}
+
+// rumpCursor returns the SCAN cursor to resume from the checkpoint of db, done is true if db has been scanned
+func rumpCursor(sp StartPoint, runId string) (cursor string, done bool) {
+	if sp.RunId != runId || sp.Offset < 0 {
+		return "0", false
+	}
+	if sp.Offset == 0 {
+		return "0", true
+	}
+	return strconv.FormatInt(sp.Offset, 10), false
+}
+
+func (ri *RumpInput) logProgress(progress *rumpProgress) {
+	percent := int64(0)
+	if progress.total > 0 {
+		percent = 100 * progress.scanned / progress.total
+		if percent > 99 { // keys may be added during scanning
+			percent = 99
+		}
+	}
+	ri.logger.Infof("rump scan process : cost(%v), total(%d), scanned(%d), progress(%3d%%)",
+		time.Since(progress.start), progress.total, progress.scanned, percent)
+	fullSyncProgress.Set(float64(percent), ri.inputAddr)
+}
+
+// checkpoint saves cursor after all dumped keys are replayed
+func (ri *RumpInput) checkpoint(ctx context.Context, ro *RedisOutput, workers *rumpWorkers, runId string, cursor int64) error {
+	if err := workers.flush(); err != nil {
+		return err
+	}
+	return ro.setCheckpoint(ctx, runId, cursor, config.Version)
+}
+
+func rumpParseOptions(ro *RedisOutput) []rdb.RdbParseOption {
+	return []rdb.RdbParseOption{rdb.WithTargetRedisVersion(ro.cfg.Redis.Version), rdb.WithFunctionExists(ro.cfg.FunctionExists)}
+}
+
+// dump returns a task per key, entries of task are nil if key doesn't exist
+func (ri *RumpInput) dump(cli client.Redis, db int, keys []interface{}, options []rdb.RdbParseOption) ([]rumpTask, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	for _, key := range keys {
+		if err := cli.Send("dump", key); err != nil {
+			return nil, err
+		}
+		if err := cli.Send("pttl", key); err != nil {
+			return nil, err
+		}
+	}
+	if err := cli.Flush(); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UnixMilli()
+	tasks := make([]rumpTask, 0, len(keys))
+	var errs []error
+	for _, k := range keys {
+		key, err := common.Bytes(k, nil)
+		if err != nil {
+			return nil, err
+		}
+		payload, err := common.Bytes(cli.Receive())
+		if err != nil && !errors.Is(err, common.ErrNil) {
+			errs = append(errs, fmt.Errorf("dump error : key(%s), error(%w)", key, err))
+		}
+		pttl, err := common.Int64(cli.Receive())
+		if err != nil {
+			errs = append(errs, fmt.Errorf("pttl error : key(%s), error(%w)", key, err))
+		}
+		if len(errs) > 0 { // receive all replies
+			continue
+		}
+
+		task := rumpTask{db: db, key: key}
+		if len(payload) > 0 && pttl != -2 {
+			task.entries, err = rdb.ParseDump(db, key, payload, options...)
+			if err != nil {
+				return nil, err
+			}
+			if pttl > 0 {
+				for _, e := range task.entries {
+					e.ExpireAt = uint64(now + pttl)
+				}
+			}
+		}
+		tasks = append(tasks, task)
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return tasks, nil
+}
+
+// catchUp dumps the keys which are modified, until input is stopped
+func (ri *RumpInput) catchUp(wait usync.WaitCloser, cli client.Redis, ro *RedisOutput, workers *rumpWorkers, notifier *keyspaceNotifier) error {
+	ri.logger.Infof("rump catches up with keyspace notifications")
+	options := rumpParseOptions(ro)
+	throttle := &rumpThrottle{rate: ri.rumpCfg.KeysPerSecond, start: time.Now()}
+	currentDB := -1
+	for {
+		select {
+		case <-wait.Done():
+			return nil
+		case <-notifier.notify:
+		}
+		keys, err := notifier.take(ri.rumpCfg.ScanCount)
+		if err != nil {
+			return err
+		}
+		rumpPendingGauge.Set(float64(notifier.pending()), ri.inputAddr)
+
+		sort.Slice(keys, func(i, j int) bool { return keys[i].db < keys[j].db })
+		for len(keys) > 0 {
+			db := keys[0].db
+			n := sort.Search(len(keys), func(i int) bool { return keys[i].db > db })
+			batch := make([]interface{}, n)
+			for i := 0; i < n; i++ {
+				batch[i] = []byte(keys[i].key)
+			}
+			keys = keys[n:]
+
+			if db != currentDB {
+				if err := redis.SelectDB(cli, uint32(db)); err != nil {
+					return err
+				}
+				currentDB = db
+			}
+			tasks, err := ri.dump(cli, db, batch, options)
+			if err != nil {
+				return err
+			}
+			for _, task := range tasks {
+				if err := workers.send(task); err != nil {
+					return err
+				}
+			}
+			rumpKeysCounter.Add(float64(len(batch)), ri.inputAddr, "catchup")
+			throttle.wait(wait.Context(), len(batch))
+		}
+	}
+}
+
+// rumpThrottle limits the amount of dumped keys per second, rate <= 0 is unlimited
+type rumpThrottle struct {
+	rate  int
+	start time.Time
+	count int64
+}
+
+func (t *rumpThrottle) wait(ctx context.Context, n int) {
+	if t.rate <= 0 {
+		return
+	}
+	t.count += int64(n)
+	expected := time.Duration(float64(t.count) / float64(t.rate) * float64(time.Second))
+	if d := expected - time.Since(t.start); d > 0 {
+		select {
+		case <-time.After(d):
+		case <-ctx.Done():
+		}
+	}
+}
+
+type rumpTask struct {
+	db      int
+	key     []byte
+	entries []*rdb.BinEntry // nil if key doesn't exist
+	barrier chan<- struct{}
+}
+
+// rumpWorkers replays tasks in parallel, tasks of the same key are replayed by the same worker in order
+type rumpWorkers struct {
+	wait  usync.WaitCloser
+	pipes []chan rumpTask
+}
+
+func (ri *RumpInput) startWorkers(wait usync.WaitCloser, ro *RedisOutput) (*rumpWorkers, error) {
+	w := &rumpWorkers{wait: wait}
+	for i := 0; i < ro.cfg.ReplayRdbParallel; i++ {
+		replayer, err := ro.newRdbReplayer(wait.Context())
+		if err != nil {
+			wait.Close(err)
+			return nil, err
+		}
+		if ri.rumpCfg.KeyspaceNotify { // keys are dumped again
+			replayer.replay.KeyExists = "replace"
+		}
+		pipe := make(chan rumpTask, 16)
+		w.pipes = append(w.pipes, pipe)
+
+		wait.WgAdd(1)
+		usync.SafeGo(func() {
+			defer wait.WgDone()
+			defer replayer.Close()
+			if err := w.replay(replayer, pipe); err != nil {
+				wait.Close(err)
+			}
+		}, func(i interface{}) {
+			wait.Close(fmt.Errorf("panic : %v", i))
+		})
+	}
+	return w, nil
+}
+
+func (w *rumpWorkers) replay(replayer *rdbReplayer, pipe <-chan rumpTask) error {
+	for {
+		var task rumpTask
+		select {
+		case <-w.wait.Done():
+			return nil
+		case task = <-pipe:
+		}
+		if task.barrier != nil {
+			task.barrier <- struct{}{}
+			continue
+		}
+		if task.entries == nil {
+			if _, err := replayer.Del(task.db, task.key); err != nil {
+				return err
+			}
+			continue
+		}
+		for _, e := range task.entries {
+			if _, err := replayer.Replay(e); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (w *rumpWorkers) send(task rumpTask) error {
+	idx := util.FnvHash(task.key) % uint32(len(w.pipes))
+	return w.sendTo(idx, task)
+}
+
+func (w *rumpWorkers) sendTo(idx uint32, task rumpTask) error {
+	select {
+	case w.pipes[idx] <- task:
+		return nil
+	case <-w.wait.Done():
+		return errors.Join(ErrStopSync, w.wait.Error())
+	}
+}
+
+// flush waits for all sent tasks are replayed
+func (w *rumpWorkers) flush() error {
+	barrier := make(chan struct{}, len(w.pipes))
+	for i := range w.pipes {
+		if err := w.sendTo(uint32(i), rumpTask{barrier: barrier}); err != nil {
+			return err
+		}
+	}
+	for range w.pipes {
+		select {
+		case <-barrier:
+		case <-w.wait.Done():
+			return errors.Join(ErrStopSync, w.wait.Error())
+		}
+	}
+	return nil
+}
+
+type rumpKey struct {
+	db  int
+	key string
+}
+
+// keyspaceNotifier collects the keys from keyspace notifications
+type keyspaceNotifier struct {
+	cli    client.Redis
+	logger log.Logger
+	mux    sync.Mutex
+	keys   map[rumpKey]struct{}
+	err    error
+	notify chan struct{}
+}
+
+func (ri *RumpInput) subscribe() (*keyspaceNotifier, error) {
+	cli, err := client.NewRedis(ri.cfg)
+	if err != nil {
+		return nil, err
+	}
+	// CONFIG may be forbidden by managed redis
+	if reply, err := common.Strings(cli.Do("config", "get", "notify-keyspace-events")); err == nil && len(reply) == 2 {
+		if !strings.Contains(reply[1], "K") || !(strings.Contains(reply[1], "A") || strings.Contains(reply[1], "g")) {
+			ri.logger.Warnf("keyspace notifications may be disabled : notify-keyspace-events(%s)", reply[1])
+		}
+	}
+
+	if err = cli.SendAndFlush("psubscribe", rumpKeyspacePattern); err != nil {
+		cli.Close()
+		return nil, err
+	}
+	if _, err = cli.Receive(); err != nil {
+		cli.Close()
+		return nil, err
+	}
+
+	kn := &keyspaceNotifier{
+		cli:    cli,
+		logger: ri.logger,
+		keys:   make(map[rumpKey]struct{}),
+		notify: make(chan struct{}, 1),
+	}
+	usync.SafeGo(kn.receive, func(i interface{}) {
+		kn.setError(fmt.Errorf("panic : %v", i))
+	})
+	return kn, nil
+}
+
+func (kn *keyspaceNotifier) Close() {
+	kn.cli.Close()
+}
+
+func (kn *keyspaceNotifier) receive() {
+	for {
+		reply, err := common.Values(kn.cli.Receive())
+		if err != nil {
+			kn.setError(fmt.Errorf("keyspace notification error : %w", err))
+			return
+		}
+		// pmessage, pattern, channel, event
+		if len(reply) != 4 {
+			continue
+		}
+		channel, _ := common.String(reply[2], nil)
+		key, ok := parseKeyspaceChannel(channel)
+		if !ok {
+			kn.logger.Warnf("invalid keyspace notification : %s", channel)
+			continue
+		}
+		kn.add(key)
+	}
+}
+
+// parseKeyspaceChannel parses __keyspace@<db>__:<key>
+func parseKeyspaceChannel(channel string) (rumpKey, bool) {
+	rest, ok := strings.CutPrefix(channel, "__keyspace@")
+	if !ok {
+		return rumpKey{}, false
+	}
+	dbStr, key, ok := strings.Cut(rest, "__:")
+	if !ok {
+		return rumpKey{}, false
+	}
+	db, err := strconv.Atoi(dbStr)
+	if err != nil {
+		return rumpKey{}, false
+	}
+	return rumpKey{db: db, key: key}, true
+}
+
+func (kn *keyspaceNotifier) add(key rumpKey) {
+	kn.mux.Lock()
+	defer kn.mux.Unlock()
+	if kn.err != nil {
+		return
+	}
+	kn.keys[key] = struct{}{}
+	if len(kn.keys) > rumpMaxPendingKeys {
+		kn.err = fmt.Errorf("too many pending keys of keyspace notifications : %d", len(kn.keys))
+	}
+	kn.signal()
+}
+
+func (kn *keyspaceNotifier) setError(err error) {
+	kn.mux.Lock()
+	defer kn.mux.Unlock()
+	if kn.err == nil {
+		kn.err = err
+	}
+	kn.signal()
+}
+
+func (kn *keyspaceNotifier) signal() {
+	select {
+	case kn.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (kn *keyspaceNotifier) pending() int {
+	kn.mux.Lock()
+	defer kn.mux.Unlock()
+	return len(kn.keys)
+}
+
+// take returns at most n pending keys
+func (kn *keyspaceNotifier) take(n int) ([]rumpKey, error) {
+	kn.mux.Lock()
+	defer kn.mux.Unlock()
+	if kn.err != nil {
+		return nil, kn.err
+	}
+	keys := make([]rumpKey, 0, n)
+	for key := range kn.keys {
+		if len(keys) == n {
+			kn.signal() // remaining keys
+			break
+		}
+		keys = append(keys, key)
+		delete(kn.keys, key)
+	}
+	return keys, nil
+}
@@ -0,0 +1,171 @@
+package syncer
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	usync "github.com/mgtv-tech/redis-GunYu/pkg/sync"
+	"github.com/mgtv-tech/redis-GunYu/pkg/util"
+)
+
+func TestParseKeyspaceChannel(t *testing.T) {
+	key, ok := parseKeyspaceChannel("__keyspace@0__:k")
+	assert.True(t, ok)
+	assert.Equal(t, rumpKey{db: 0, key: "k"}, key)
+
+	// the key may contain the separator
+	key, ok = parseKeyspaceChannel("__keyspace@15__:a__:b")
+	assert.True(t, ok)
+	assert.Equal(t, rumpKey{db: 15, key: "a__:b"}, key)
+
+	key, ok = parseKeyspaceChannel("__keyspace@3__:")
+	assert.True(t, ok)
+	assert.Equal(t, rumpKey{db: 3, key: ""}, key)
+
+	for _, channel := range []string{"", "__keyevent@0__:set", "__keyspace@x__:k", "__keyspace@0:k", "__keyspace@__:k"} {
+		_, ok = parseKeyspaceChannel(channel)
+		assert.False(t, ok, channel)
+	}
+}
+
+func TestRumpThrottle(t *testing.T) {
+	ctx := context.Background()
+
+	// unlimited
+	th := &rumpThrottle{start: time.Now()}
+	start := time.Now()
+	th.wait(ctx, 1000)
+	assert.Less(t, time.Since(start), 50*time.Millisecond)
+
+	// 100 keys per second, 10 keys take 100ms
+	th = &rumpThrottle{rate: 100, start: time.Now()}
+	start = time.Now()
+	th.wait(ctx, 5)
+	th.wait(ctx, 5)
+	assert.GreaterOrEqual(t, time.Since(start), 90*time.Millisecond)
+	assert.Less(t, time.Since(start), time.Second)
+
+	// cancelled
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+	th = &rumpThrottle{rate: 1, start: time.Now()}
+	start = time.Now()
+	th.wait(ctx, 100)
+	assert.Less(t, time.Since(start), 50*time.Millisecond)
+}
+
+func TestKeyspaceNotifierTake(t *testing.T) {
+	kn := &keyspaceNotifier{keys: make(map[rumpKey]struct{}), notify: make(chan struct{}, 1)}
+	kn.add(rumpKey{db: 0, key: "a"})
+	kn.add(rumpKey{db: 0, key: "a"})
+	kn.add(rumpKey{db: 1, key: "a"})
+	kn.add(rumpKey{db: 0, key: "b"})
+	assert.Equal(t, 3, kn.pending())
+	<-kn.notify
+
+	keys, err := kn.take(2)
+	assert.Nil(t, err)
+	assert.Len(t, keys, 2)
+	assert.Equal(t, 1, kn.pending())
+	// remaining keys are signaled
+	select {
+	case <-kn.notify:
+	default:
+		assert.Fail(t, "remaining keys aren't signaled")
+	}
+
+	keys, err = kn.take(2)
+	assert.Nil(t, err)
+	assert.Len(t, keys, 1)
+	assert.Equal(t, 0, kn.pending())
+
+	// too many pending keys
+	for i := 0; i <= rumpMaxPendingKeys; i++ {
+		kn.add(rumpKey{key: fmt.Sprint(i)})
+	}
+	_, err = kn.take(10)
+	assert.NotNil(t, err)
+	kn.add(rumpKey{key: "k"})
+	_, err = kn.take(10)
+	assert.NotNil(t, err)
+}
+
+func TestRumpWorkers(t *testing.T) {
+	wait := usync.NewWaitCloser(nil)
+	defer wait.Close(nil)
+	w := &rumpWorkers{wait: wait}
+	for i := 0; i < 4; i++ {
+		w.pipes = append(w.pipes, make(chan rumpTask, 16))
+	}
+
+	// tasks of a key are sent to the same worker
+	for i := 0; i < 3; i++ {
+		for _, key := range []string{"a", "b", "c"} {
+			assert.Nil(t, w.send(rumpTask{key: []byte(key)}))
+		}
+	}
+	workers := make(map[string][]int)
+	for i, pipe := range w.pipes {
+		for len(pipe) > 0 {
+			task := <-pipe
+			workers[string(task.key)] = append(workers[string(task.key)], i)
+		}
+	}
+	for _, key := range []string{"a", "b", "c"} {
+		idx := int(util.FnvHash([]byte(key)) % uint32(len(w.pipes)))
+		assert.Equal(t, []int{idx, idx, idx}, workers[key], key)
+	}
+
+	// flush waits for all workers
+	flushed := make(chan error, 1)
+	go func() { flushed <- w.flush() }()
+	barriers := make([]rumpTask, 0, len(w.pipes))
+	for _, pipe := range w.pipes {
+		barriers = append(barriers, <-pipe)
+	}
+	for _, task := range barriers[1:] {
+		task.barrier <- struct{}{}
+	}
+	select {
+	case <-flushed:
+		assert.Fail(t, "flush doesn't wait for all workers")
+	case <-time.After(20 * time.Millisecond):
+	}
+	barriers[0].barrier <- struct{}{}
+	assert.Nil(t, <-flushed)
+
+	// stopped
+	wait.Close(nil)
+	assert.ErrorIs(t, w.flush(), ErrStopSync)
+}
+
+func TestRumpCursor(t *testing.T) {
+	runId := rumpRunId("abc", 2)
+	assert.Equal(t, "rump-2-abc", runId)
+	assert.NotEqual(t, rumpRunId("abc", 3), runId)
+
+	// no checkpoint
+	cursor, done := rumpCursor(StartPoint{RunId: "?", Offset: -1}, runId)
+	assert.Equal(t, "0", cursor)
+	assert.False(t, done)
+	// checkpoint of psync or another db
+	cursor, done = rumpCursor(StartPoint{RunId: "abc", Offset: 100}, runId)
+	assert.Equal(t, "0", cursor)
+	assert.False(t, done)
+	cursor, done = rumpCursor(StartPoint{RunId: rumpRunId("abc", 3), Offset: 100}, runId)
+	assert.Equal(t, "0", cursor)
+	assert.False(t, done)
+
+	// resume from the saved cursor
+	cursor, done = rumpCursor(StartPoint{RunId: runId, Offset: 1234}, runId)
+	assert.Equal(t, "1234", cursor)
+	assert.False(t, done)
+
+	// db is done
+	_, done = rumpCursor(StartPoint{RunId: runId, Offset: 0}, runId)
+	assert.True(t, done)
+}
@@ -0,0 +1,262 @@
+package syncer
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/mgtv-tech/redis-GunYu/config"
+	"github.com/mgtv-tech/redis-GunYu/pkg/metric"
+	"github.com/mgtv-tech/redis-GunYu/pkg/rdb"
+	"github.com/mgtv-tech/redis-GunYu/pkg/redis/client"
+	"github.com/mgtv-tech/redis-GunYu/pkg/redis/client/common"
+	"github.com/mgtv-tech/redis-GunYu/pkg/util"
+)
+
+var (
+	scriptLoadCounter = metric.NewCounterVec(metric.CounterVecOpts{
+		Namespace: config.AppName,
+		Subsystem: "output",
+		Name:      "script_load",
+		Labels:    []string{"input", "result"},
+	})
+)
+
+func scriptSha(body []byte) string {
+	sum := sha1.Sum(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// scriptCache keeps bodies of lua scripts by sha1, the oldest script is evicted if it's full
+type scriptCache struct {
+	mux     sync.Mutex
+	max     int
+	scripts map[string][]byte
+	order   []string
+	misses  map[string]struct{} // unknown scripts which have been looked up
+}
+
+// newScriptCache returns nil if scripts aren't preloaded
+func newScriptCache(cfg config.ScriptsConfig) *scriptCache {
+	if cfg.Preload == nil || !*cfg.Preload {
+		return nil
+	}
+	return &scriptCache{
+		max:     cfg.MaxScripts,
+		scripts: make(map[string][]byte),
+		misses:  make(map[string]struct{}),
+	}
+}
+
+// Track keeps scripts of SCRIPT LOAD and EVAL
+func (sc *scriptCache) Track(cmd string, args [][]byte) {
+	if sc == nil || len(args) == 0 {
+		return
+	}
+	switch cmd {
+	case "eval", "eval_ro":
+		sc.Add(args[0])
+	case "script":
+		if len(args) > 1 && strings.EqualFold(util.BytesToString(args[0]), "load") {
+			sc.Add(args[1])
+		}
+	}
+}
+
+// Add keeps the script and returns its sha1
+func (sc *scriptCache) Add(body []byte) string {
+	sha := scriptSha(body)
+	sc.mux.Lock()
+	defer sc.mux.Unlock()
+	if _, ok := sc.scripts[sha]; ok {
+		return sha
+	}
+	sc.scripts[sha] = append([]byte(nil), body...)
+	sc.order = append(sc.order, sha)
+	if sc.max > 0 && len(sc.order) > sc.max {
+		delete(sc.scripts, sc.order[0])
+		sc.order = sc.order[1:]
+	}
+	return sha
+}
+
+func (sc *scriptCache) Get(sha string) ([]byte, bool) {
+	sc.mux.Lock()
+	defer sc.mux.Unlock()
+	body, ok := sc.scripts[strings.ToLower(sha)]
+	return body, ok
+}
+
+// FirstMiss returns true if sha isn't missed before
+func (sc *scriptCache) FirstMiss(sha string) bool {
+	sc.mux.Lock()
+	defer sc.mux.Unlock()
+	if _, ok := sc.misses[sha]; ok {
+		return false
+	}
+	if sc.max > 0 && len(sc.misses) >= sc.max {
+		sc.misses = make(map[string]struct{})
+	}
+	sc.misses[sha] = struct{}{}
+	return true
+}
+
+// loadScript loads the script to all nodes of the target, since EVALSHA may be routed to any master of a cluster
+func (ro *RedisOutput) loadScript(conn client.Redis, body []byte) error {
+	if !ro.cfg.Redis.IsCluster() {
+		_, err := conn.Do("script", "load", body)
+		return err
+	}
+	var errs []error
+	conn.IterateNodes(func(addr string, _ interface{}, err error) {
+		if err != nil {
+			errs = append(errs, fmt.Errorf("load script error : node(%s), error(%w)", addr, err))
+		}
+	}, "script", "load", body)
+	return errors.Join(errs...)
+}
+
+const noScriptClass = "NOSCRIPT"
+
+func isEvalsha(cmd string) bool {
+	return cmd == "evalsha" || cmd == "evalsha_ro"
+}
+
+// retryScript loads the script of an EVALSHA rejected by NOSCRIPT to all nodes of the target,
+// and executes the command again. It's retried only if it's the last command of the batch,
+// e.g. EVALSHA which isn't inlined ends its batch, so following commands aren't applied before it.
+// It returns false if the command isn't retried or it's rejected again
+func (ro *RedisOutput) retryScript(conn client.Redis, cmds []cmdExecution, rc rejectedCmd) bool {
+	if ro.scripts == nil || rc.class != noScriptClass || rc.idx != len(cmds)-1 ||
+		!isEvalsha(rc.ce.Cmd) || len(rc.ce.Args) == 0 {
+		return false
+	}
+	sha := strings.ToLower(util.BytesToString(rc.ce.Args[0].([]byte)))
+	body, ok := ro.scripts.Get(sha)
+	if !ok {
+		// the script may be tracked after the command was parsed
+		return false
+	}
+	if err := ro.loadScript(conn, body); err != nil {
+		scriptLoadCounter.Inc(ro.cfg.InputName, "error")
+		ro.logger.Errorf("load script error : sha(%s), error(%v)", sha, err)
+		return false
+	}
+	scriptLoadCounter.Inc(ro.cfg.InputName, "ok")
+
+	// the db of the connection is the db of the last command
+	bat := cmdBatch{txn: ro.cfg.Bidirectional, cmds: cmds[rc.idx:]}
+	batcher := conn.NewBatcher(false)
+	if bat.txn {
+		batcher.Put("multi")
+		PutMarker(batcher, ro.cfg.MarkerKey, ro.cfg.RunId)
+		bat.head = 1
+	}
+	batcher.Put(rc.ce.Cmd, rc.ce.Args...)
+	if bat.txn {
+		batcher.Put("exec")
+	}
+	rets, err := batcher.Exec()
+	if err == nil {
+		var rejected []rejectedCmd
+		if rejected, _, err = rejectedCmds(rets, bat); err == nil && len(rejected) > 0 {
+			err = rejected[0].err
+		}
+	}
+	if err != nil {
+		ro.logger.Errorf("retry command error : cmd(%s), sha(%s), offset(%d), db(%d), error(%v)", rc.ce.Cmd, sha, rc.ce.Offset, rc.ce.Db, err)
+		return false
+	}
+	ro.logger.Infof("script is loaded, command is retried : cmd(%s), sha(%s), offset(%d), db(%d)", rc.ce.Cmd, sha, rc.ce.Offset, rc.ce.Db)
+	return true
+}
+
+// inlineScript replaces EVALSHA of a tracked script with EVAL, so the target loads the script by the command,
+// it's applied in order, and in the transaction of its batch.
+// EVALSHA of an unknown script is kept, and the script is looked up on the source
+func (ro *RedisOutput) inlineScript(cmd string, args [][]byte) (string, [][]byte) {
+	if ro.scripts == nil || !isEvalsha(cmd) || len(args) == 0 {
+		return cmd, args
+	}
+	sha := strings.ToLower(util.BytesToString(args[0]))
+	body, ok := ro.scripts.Get(sha)
+	if !ok {
+		if ro.scripts.FirstMiss(sha) {
+			ro.lookupScript(sha)
+		}
+		return cmd, args
+	}
+	newArgs := make([][]byte, 0, len(args))
+	newArgs = append(newArgs, body)
+	newArgs = append(newArgs, args[1:]...)
+	return strings.Replace(cmd, "sha", "", 1), newArgs
+}
+
+// lookupScript checks whether the source has an unknown script.
+// Redis can't return the body of a script by sha1, so the script is loaded to the source before the syncer started,
+// it's missing on the target unless it's loaded manually
+func (ro *RedisOutput) lookupScript(sha string) {
+	if ro.cfg.ScriptSource == nil {
+		scriptLoadCounter.Inc(ro.cfg.InputName, "unknown")
+		ro.logger.Warnf("script is unknown : sha(%s)", sha)
+		return
+	}
+	exists, err := func() (bool, error) {
+		cli, err := client.NewRedis(*ro.cfg.ScriptSource)
+		if err != nil {
+			return false, err
+		}
+		defer cli.Close()
+		rets, err := common.Values(cli.Do("script", "exists", sha))
+		if err != nil {
+			return false, err
+		}
+		if len(rets) != 1 {
+			return false, fmt.Errorf("unexpected replies : %v", rets)
+		}
+		n, err := common.Int64(rets[0], nil)
+		return n == 1, err
+	}()
+	if err != nil {
+		scriptLoadCounter.Inc(ro.cfg.InputName, "unknown")
+		ro.logger.Errorf("script is unknown, look it up on source error : sha(%s), source(%v), error(%v)", sha, ro.cfg.ScriptSource.Addresses, err)
+	} else if exists {
+		scriptLoadCounter.Inc(ro.cfg.InputName, "unknown")
+		ro.logger.Errorf("script is unknown, it's loaded to source before sync, load it to target : sha(%s), source(%v)", sha, ro.cfg.ScriptSource.Addresses)
+	} else {
+		scriptLoadCounter.Inc(ro.cfg.InputName, "missing")
+		ro.logger.Errorf("script is unknown, and it's missing on source : sha(%s), source(%v)", sha, ro.cfg.ScriptSource.Addresses)
+	}
+}
+
+// loadRdbScripts tracks lua scripts of an aux entry of rdb, and preloads them to all nodes of the target
+func (rr *rdbReplayer) loadRdbScripts(e *rdb.BinEntry) (err error) {
+	defer util.Xrecover(&err)
+	e.ExecCmd(func(cmd string, args ...interface{}) error {
+		if !strings.EqualFold(cmd, "script") || len(args) != 2 {
+			return nil
+		}
+		var body []byte
+		switch v := args[1].(type) {
+		case []byte:
+			body = v
+		case string:
+			body = []byte(v)
+		default:
+			return nil
+		}
+		sha := rr.ro.scripts.Add(body)
+		if err := rr.ro.loadScript(rr.cli, body); err != nil {
+			// EVALSHA of the script is inlined, so replay goes on
+			scriptLoadCounter.Inc(rr.ro.cfg.InputName, "error")
+			rr.ro.logger.Errorf("load script error : sha(%s), error(%v)", sha, err)
+			return nil
+		}
+		scriptLoadCounter.Inc(rr.ro.cfg.InputName, "ok")
+		return nil
+	})
+	return nil
+}
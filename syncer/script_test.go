@@ -0,0 +1,158 @@
+package syncer
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mgtv-tech/redis-GunYu/config"
+	"github.com/mgtv-tech/redis-GunYu/pkg/redis/client"
+	"github.com/mgtv-tech/redis-GunYu/pkg/redis/client/common"
+	"github.com/mgtv-tech/redis-GunYu/pkg/redis/client/proto"
+)
+
+func TestScriptCache(t *testing.T) {
+	preload := false
+	assert.Nil(t, newScriptCache(config.ScriptsConfig{Preload: &preload}))
+	var nilCache *scriptCache
+	nilCache.Track("eval", [][]byte{[]byte("return 1"), []byte("0")})
+
+	preload = true
+	sc := newScriptCache(config.ScriptsConfig{Preload: &preload, MaxScripts: 2})
+	sc.Track("eval", [][]byte{[]byte("return 1"), []byte("0")})
+	sc.Track("script", [][]byte{[]byte("LOAD"), []byte("return 2")})
+	sc.Track("script", [][]byte{[]byte("flush")})
+	sc.Track("evalsha", [][]byte{[]byte("e0e1f9fabfc9d4800c877a703b823ac0578ff8db"), []byte("0")})
+
+	// sha1 of "return 1"
+	body, ok := sc.Get("E0E1F9FABFC9D4800C877A703B823AC0578FF8DB")
+	assert.True(t, ok)
+	assert.Equal(t, "return 1", string(body))
+	body, ok = sc.Get(scriptSha([]byte("return 2")))
+	assert.True(t, ok)
+	assert.Equal(t, "return 2", string(body))
+
+	// the oldest script is evicted
+	sc.Add([]byte("return 3"))
+	_, ok = sc.Get("e0e1f9fabfc9d4800c877a703b823ac0578ff8db")
+	assert.False(t, ok)
+	assert.Len(t, sc.scripts, 2)
+}
+
+func TestInlineScript(t *testing.T) {
+	preload := true
+	ro := NewRedisOutput(RedisOutputConfig{
+		InputName: "127.0.0.1:6379",
+		Scripts:   config.ScriptsConfig{Preload: &preload, MaxScripts: 10},
+	})
+	sha := ro.scripts.Add([]byte("return KEYS[1]"))
+
+	// EVALSHA of a tracked script is replaced with EVAL
+	cmd, args := ro.inlineScript("evalsha", [][]byte{[]byte(strings.ToUpper(sha)), []byte("1"), []byte("k")})
+	assert.Equal(t, "eval", cmd)
+	assert.Equal(t, [][]byte{[]byte("return KEYS[1]"), []byte("1"), []byte("k")}, args)
+	cmd, _ = ro.inlineScript("evalsha_ro", [][]byte{[]byte(sha), []byte("0")})
+	assert.Equal(t, "eval_ro", cmd)
+
+	// the script is unknown, it's looked up once
+	unknown := strings.Repeat("a", 40)
+	cmd, args = ro.inlineScript("evalsha", [][]byte{[]byte(unknown), []byte("0")})
+	assert.Equal(t, "evalsha", cmd)
+	assert.Equal(t, [][]byte{[]byte(unknown), []byte("0")}, args)
+	assert.False(t, ro.scripts.FirstMiss(unknown))
+
+	// other commands aren't changed
+	cmd, _ = ro.inlineScript("fcall", [][]byte{[]byte("f"), []byte("0")})
+	assert.Equal(t, "fcall", cmd)
+	ro.scripts = nil
+	cmd, _ = ro.inlineScript("evalsha", [][]byte{[]byte(sha), []byte("0")})
+	assert.Equal(t, "evalsha", cmd)
+}
+
+type fakeScriptRedis struct {
+	client.Redis
+	loaded  map[string]bool
+	batches [][]interface{}
+}
+
+func (fr *fakeScriptRedis) Do(cmd string, args ...interface{}) (interface{}, error) {
+	if cmd == "script" && len(args) == 2 {
+		fr.loaded[scriptSha(args[1].([]byte))] = true
+		return "OK", nil
+	}
+	return nil, fmt.Errorf("unexpected command : %s", cmd)
+}
+
+func (fr *fakeScriptRedis) NewBatcher(pipeline bool) common.CmdBatcher {
+	return &fakeScriptBatcher{fr: fr}
+}
+
+type fakeScriptBatcher struct {
+	fr   *fakeScriptRedis
+	cmds []interface{}
+}
+
+func (fb *fakeScriptBatcher) Put(cmd string, args ...interface{}) error {
+	fb.cmds = append(fb.cmds, cmd)
+	return nil
+}
+
+func (fb *fakeScriptBatcher) Exec() ([]interface{}, error) {
+	fb.fr.batches = append(fb.fr.batches, fb.cmds)
+	rets := make([]interface{}, 0, len(fb.cmds))
+	for range fb.cmds {
+		rets = append(rets, "OK")
+	}
+	return rets, nil
+}
+
+func (fb *fakeScriptBatcher) Len() int                        { return len(fb.cmds) }
+func (fb *fakeScriptBatcher) Dispatch() error                 { return nil }
+func (fb *fakeScriptBatcher) Receive() ([]interface{}, error) { return nil, nil }
+
+func TestRetryScript(t *testing.T) {
+	preload := true
+	ro := NewRedisOutput(RedisOutputConfig{
+		InputName: "127.0.0.1:6379",
+		Scripts:   config.ScriptsConfig{Preload: &preload, MaxScripts: 10},
+	})
+	sha := ro.scripts.Add([]byte("return 1"))
+	conn := &fakeScriptRedis{loaded: map[string]bool{}}
+
+	cmds := []cmdExecution{
+		{Cmd: "set", Args: []interface{}{[]byte("k"), []byte("v")}, Offset: 1},
+		{Cmd: "evalsha", Args: []interface{}{[]byte(sha), []byte("0")}, Offset: 2},
+	}
+	noScript := func(idx int) rejectedCmd {
+		return rejectedCmd{idx: idx, ce: &cmds[idx], err: proto.RedisError("NOSCRIPT No matching script"), class: noScriptClass}
+	}
+
+	// the script is loaded and the last command is executed again
+	assert.True(t, ro.retryScript(conn, cmds, noScript(1)))
+	assert.True(t, conn.loaded[sha])
+	assert.Equal(t, [][]interface{}{{"evalsha"}}, conn.batches)
+
+	// the command isn't the last one of the batch
+	assert.False(t, ro.retryScript(conn, cmds[:1], noScript(0)))
+	cmds = append(cmds, cmdExecution{Cmd: "set", Args: []interface{}{[]byte("k"), []byte("v")}, Offset: 3})
+	assert.False(t, ro.retryScript(conn, cmds, noScript(1)))
+
+	// the script is unknown
+	unknown := strings.Repeat("a", 40)
+	cmds = []cmdExecution{{Cmd: "evalsha", Args: []interface{}{[]byte(unknown), []byte("0")}}}
+	assert.False(t, ro.retryScript(conn, cmds, noScript(0)))
+
+	// other errors
+	cmds = []cmdExecution{{Cmd: "evalsha", Args: []interface{}{[]byte(sha), []byte("0")}}}
+	assert.False(t, ro.retryScript(conn, cmds, rejectedCmd{idx: 0, ce: &cmds[0], err: proto.RedisError("ERR"), class: "ERR"}))
+
+	// in bidirectional mode, the command is retried in a transaction with the marker
+	ro.cfg.Bidirectional = true
+	ro.cfg.MarkerKey = BidirectionalMarkerKey
+	conn.batches = nil
+	assert.True(t, ro.retryScript(conn, cmds, noScript(0)))
+	assert.Equal(t, [][]interface{}{{"multi", "set", "evalsha", "exec"}}, conn.batches)
+	assert.Equal(t, 1, len(conn.loaded))
+}
@@ -17,6 +17,7 @@ import (
 	"github.com/mgtv-tech/redis-GunYu/pkg/redis"
 	"github.com/mgtv-tech/redis-GunYu/pkg/redis/checkpoint"
 	"github.com/mgtv-tech/redis-GunYu/pkg/redis/client"
+	"github.com/mgtv-tech/redis-GunYu/pkg/store"
 	usync "github.com/mgtv-tech/redis-GunYu/pkg/sync"
 	"github.com/mgtv-tech/redis-GunYu/pkg/util"
 )
@@ -52,8 +53,10 @@ var (
 
 type SyncerConfig struct {
 	Id             int
+	Source         *config.InputConfig // input or one of sources, Input is a node of it
 	Input          config.RedisConfig
 	Output         config.RedisConfig
+	Outputs        []config.RedisConfig // extra outputs, the same order as config.SyncConfig.Outputs
 	Channel        config.ChannelConfig
 	CanTransaction bool
 }
@@ -71,6 +74,7 @@ type Syncer interface {
 	State() SyncerState
 	Role() SyncerRole
 	TransactionMode() bool
+	Storer() *store.Storer
 }
 
 var (
@@ -87,15 +91,41 @@ func NewSyncer(cfg SyncerConfig) Syncer {
 		cfg:    cfg,
 		logger: log.WithLogger(config.LogModuleName(fmt.Sprintf("[syncer(%s)] ", cfg.Input.Address()))),
 	}
-	sy.channel = NewStoreChannel(StorerConf{
+	if cfg.Channel.Memory.Enabled() {
+		sy.channel = NewMemoryChannel(cfg.Input.Address(), cfg.Channel.Memory.MaxSize)
+	} else {
+		sy.channel = sy.newStoreChannel()
+	}
+	sy.wait = usync.NewWaitCloser(nil)
+	return sy
+}
+
+func (sy *syncer) newStoreChannel() Channel {
+	cfg := sy.cfg
+	var tier *store.RemoteTier
+	if remote := cfg.Channel.Storer.Remote; remote.Enabled() {
+		backend, err := store.NewBackend(remote)
+		if err != nil {
+			sy.logger.Errorf("new storer backend, remote tier is disabled : %v", err)
+		} else {
+			tier = &store.RemoteTier{Backend: backend, MaxSize: remote.MaxSize}
+		}
+	}
+	return NewStoreChannel(StorerConf{
 		InputId: cfg.Input.Address(),
 		Dir:     cfg.Channel.Storer.DirPath,
 		MaxSize: cfg.Channel.Storer.MaxSize,
 		LogSize: cfg.Channel.Storer.LogSize,
 		flush:   cfg.Channel.Storer.Flush,
+		keyring: cfg.Channel.Storer.Keyring(),
+		tier:    tier,
+		retention: store.Retention{
+			MaxAge: cfg.Channel.Storer.MaxAge,
+			Loose:  cfg.Channel.Storer.Retention == config.StorerRetentionLoose,
+		},
+		scrub: cfg.Channel.Storer.Scrub,
+		disk:  cfg.Channel.Storer.Disk,
 	})
-	sy.wait = usync.NewWaitCloser(nil)
-	return sy
 }
 
 type syncer struct {
@@ -259,6 +289,17 @@ func (s *syncer) Resume() {
 	s.pauseWait = nil
 }
 
+// Storer returns nil if channel isn't backed by storer
+func (s *syncer) Storer() *store.Storer {
+	s.guard.RLock()
+	channel := s.channel
+	s.guard.RUnlock()
+	if sc, ok := channel.(*StoreChannel); ok {
+		return sc.storer
+	}
+	return nil
+}
+
 func (s *syncer) DelRunId() {
 	s.guard.RLock()
 	input := s.input
@@ -341,14 +382,19 @@ func (s *syncer) run() error {
 func (s *syncer) runLeader() error {
 	s.logger.Debugf("runLeader")
 
-	output, err := s.newOutput()
+	outputs, err := s.newOutputs()
 	if err != nil {
 		return err
 	}
 
 	s.guard.Lock()
-	input := NewRedisInput(s.cfg.Input)
-	input.SetOutput(output)
+	var input Input
+	if rump := s.cfg.Source.Rump; rump.Enabled() {
+		input = NewRumpInput(s.cfg.Input, *rump)
+	} else {
+		input = NewRedisInput(s.cfg.Input)
+	}
+	input.SetOutputs(outputs...)
 	input.SetChannel(s.channel)
 	leader := NewReplicaLeader(input, s.channel)
 	s.input = input
@@ -376,7 +422,9 @@ func (s *syncer) runLeader() error {
 
 	leader.Stop()
 	input.Stop()
-	output.Close()
+	for _, output := range outputs {
+		output.Close()
+	}
 
 	wait.WgWait()
 	return wait.Error()
@@ -420,7 +468,8 @@ func (s *syncer) IsLeader() bool {
 	return s.leader != nil
 }
 
-func (s *syncer) newOutput() (*RedisOutput, error) {
+// newOutputs returns the output and extra outputs, the first one is the output
+func (s *syncer) newOutputs() ([]Output, error) {
 	s.guard.RLock()
 	wait := s.wait
 	s.guard.RUnlock()
@@ -431,17 +480,50 @@ func (s *syncer) newOutput() (*RedisOutput, error) {
 		return nil, errors.Join(ErrRestart, err)
 	}
 
-	cfg := config.GetSyncerConfig().Output
+	output, err := s.newOutput(wait, []string{id1, id2}, config.GetSyncerConfig().Output, s.cfg.Output, s.cfg.CanTransaction)
+	if err != nil {
+		return nil, err
+	}
+	outputs := []Output{output}
+	for i, extra := range config.GetSyncerConfig().Outputs {
+		canTransaction := extraCanTransaction(s.cfg.Source, extra, s.cfg.Outputs[i])
+		output, err = s.newOutput(wait, []string{id1, id2}, extra, s.cfg.Outputs[i], canTransaction)
+		if err != nil {
+			return nil, err
+		}
+		outputs = append(outputs, output)
+	}
+	return outputs, nil
+}
+
+// extraCanTransaction : a standalone extra output receives all keys of the input, so commands are replayed in transactions like output,
+// keys of a rewritten prefix or renamed keys are replayed without transaction
+func extraCanTransaction(source *config.InputConfig, extra *config.OutputConfig, redisCfg config.RedisConfig) bool {
+	return redisCfg.IsStanalone() && *extra.Replay.ReplayTransaction &&
+		(source == nil || source.KeyPrefix == nil) && len(extra.Replay.KeyRename) == 0
+}
+
+func (s *syncer) newOutput(wait usync.WaitCloser, ids []string, cfg *config.OutputConfig, redisCfg config.RedisConfig, canTransaction bool) (Output, error) {
+	inputName := s.cfg.Input.Address()
+	if cfg.Name != "" {
+		inputName = inputName + "/" + cfg.Name
+	}
+
+	keyExists := cfg.Replay.KeyExists
+	if s.cfg.Source.KeyExists != "" {
+		keyExists = s.cfg.Source.KeyExists
+	}
 
 	outputCfg := RedisOutputConfig{
-		InputName:                  s.cfg.Input.Address(),
-		RunId:                      id1,
-		CanTransaction:             s.cfg.CanTransaction,
-		Redis:                      s.cfg.Output,
-		EnableResumeFromBreakPoint: *config.GetSyncerConfig().Output.Replay.ResumeFromBreakPoint,
+		InputName:                  inputName,
+		RunId:                      ids[0],
+		CanTransaction:             canTransaction,
+		Redis:                      redisCfg,
+		EnableResumeFromBreakPoint: *cfg.Replay.ResumeFromBreakPoint,
 		ReplaceHashTag:             cfg.Replay.ReplaceHashTag,
-		KeyExists:                  cfg.Replay.KeyExists,
+		KeyExists:                  keyExists,
 		KeyExistsLog:               cfg.Replay.KeyExistsLog,
+		KeyMerge:                   cfg.Replay.KeyMerge,
 		FunctionExists:             cfg.Replay.FunctionExists,
 		MaxProtoBulkLen:            cfg.Replay.MaxProtoBulkLen,
 		TargetDb:                   cfg.Replay.TargetDb,
@@ -454,39 +536,96 @@ func (s *syncer) newOutput() (*RedisOutput, error) {
 		ReplayRdbEnableRestore:     *cfg.Replay.ReplayRdbEnableRestore,
 		UpdateCheckpointTicker:     cfg.Replay.UpdateCheckpointTicker,
 		ReplayPipeline:             cfg.Replay.AofPipelineMode,
+		UnsupportedCmd:             cfg.Replay.UnsupportedCmd,
 		Stats:                      cfg.Replay.Stats,
-		Filter:                     config.GetSyncerConfig().Output.Filter,
+		Filter:                     cfg.Filter,
+		KeyRename:                  cfg.Replay.KeyRename,
+		Ttl:                        cfg.Ttl,
+		SourceFilter:               s.cfg.Source.Filter,
+		KeyPrefix:                  s.cfg.Source.KeyPrefix,
 		SyncDelayTestKey:           config.GetSyncerConfig().Input.SyncDelayTestKey,
 	}
 
-	if *config.GetSyncerConfig().Output.Replay.ResumeFromBreakPoint {
+	if cfg.DryRun {
+		if cfg.Redis != nil {
+			// the target isn't connected, it's described by the configuration
+			outputCfg.Redis = *cfg.Redis
+		}
+		return NewDryRunOutput(DryRunOutputConfig{InputName: inputName, Parser: outputCfg}), nil
+	}
+	if !cfg.IsRedis() {
+		return s.newCdcOutput(cfg, outputCfg)
+	}
+	outputCfg.OutputName = cfg.Name
+	outputCfg.RateLimit = &cfg.Replay.RateLimit
+	outputCfg.Bidirectional = cfg.Replay.Bidirectional
+	outputCfg.ReplyError = cfg.Replay.ReplyError
+	outputCfg.Scripts = cfg.Replay.Scripts
+	outputCfg.ScriptSource = &s.cfg.Input
+	if outputCfg.Bidirectional && !canTransaction {
+		// commands are tagged by transactions
+		err := fmt.Errorf("bidirectional sync requires transactions : input(%s), output(%s)", s.cfg.Input.Address(), redisCfg.Address())
+		s.logger.Errorf("%s", err.Error())
+		return nil, errors.Join(ErrQuit, err)
+	}
+	if outputCfg.Bidirectional {
+		outputCfg.MarkerKey = bidirectionalMarkerKey(redisCfg)
+		if len(outputCfg.MarkerKey) == 0 {
+			err := fmt.Errorf("bidirectional marker key is empty : redis(%s)", redisCfg.Address())
+			s.logger.Errorf("%s", err.Error())
+			return nil, errors.Join(ErrQuit, err)
+		}
+	}
+
+	if *cfg.Replay.ResumeFromBreakPoint {
+		// every source has its own checkpoints
+		cpPrefix := config.CheckpointKey
+		if s.cfg.Source.Name != "" {
+			cpPrefix = cpPrefix + "-" + s.cfg.Source.Name
+		}
 		var localCheckpoint string
-		if s.cfg.CanTransaction && s.cfg.Output.IsCluster() {
-			localCheckpoint = choseKeyInSlots(config.CheckpointKey, s.cfg.Output.GetAllSlots())
+		if canTransaction && redisCfg.IsCluster() {
+			localCheckpoint = choseKeyInSlots(cpPrefix, redisCfg.GetAllSlots())
 		} else {
-			localCheckpoint = config.CheckpointKey
+			localCheckpoint = cpPrefix
 		}
 		if len(localCheckpoint) == 0 {
-			err = fmt.Errorf("checkpoint name is empty : prefix(%s), redis(%s)", config.CheckpointKey, s.cfg.Output.Address())
+			err := fmt.Errorf("checkpoint name is empty : prefix(%s), redis(%s)", cpPrefix, redisCfg.Address())
 			s.logger.Errorf("%s", err.Error())
 			return nil, errors.Join(ErrQuit, err)
 		}
 		// update checkpoint name and run id,
-		err = s.updateCheckpoint(wait, localCheckpoint, []string{id1, id2})
+		err := s.updateCheckpoint(wait, redisCfg, localCheckpoint, ids)
 		if err != nil {
 			return nil, errors.Join(ErrRestart, err)
 		}
 		outputCfg.CheckpointName = localCheckpoint
-		s.logger.Debugf("resume from checkpoint : runid(%s), cpName(%s), redis(%v)", id1, localCheckpoint, s.cfg.Input.Addresses)
+		s.logger.Debugf("resume from checkpoint : runid(%s), cpName(%s), redis(%v)", ids[0], localCheckpoint, s.cfg.Input.Addresses)
 	}
 
 	output := NewRedisOutput(outputCfg)
 	return output, nil
 }
 
-func (s *syncer) updateCheckpoint(wait usync.WaitCloser, localCheckpoint string, ids []string) error {
+// newCdcOutput : every syncer has its own directory of checkpoint and event files
+func (s *syncer) newCdcOutput(cfg *config.OutputConfig, parserCfg RedisOutputConfig) (Output, error) {
+	output, err := NewCdcOutput(CdcOutputConfig{
+		InputName: parserCfg.InputName,
+		Source:    s.cfg.Input.Address(),
+		Dir:       CdcDir(cfg.Cdc, parserCfg.InputName),
+		Cdc:       *cfg.Cdc,
+		Parser:    parserCfg,
+	})
+	if err != nil {
+		s.logger.Errorf("new cdc output error : output(%s), err(%v)", parserCfg.InputName, err)
+		return nil, errors.Join(ErrQuit, err)
+	}
+	return output, nil
+}
+
+func (s *syncer) updateCheckpoint(wait usync.WaitCloser, redisCfg config.RedisConfig, localCheckpoint string, ids []string) error {
 	return util.RetryLinearJitter(wait.Context(), func() error {
-		cli, err := client.NewRedis(s.cfg.Output)
+		cli, err := client.NewRedis(redisCfg)
 		if err != nil {
 			return err
 		}
@@ -494,7 +633,7 @@ func (s *syncer) updateCheckpoint(wait usync.WaitCloser, localCheckpoint string,
 
 		err = checkpoint.UpdateCheckpoint(cli, localCheckpoint, ids)
 		if err != nil {
-			s.logger.Errorf("update checkpoint : redis(%s), local(%s), ids(%v), error(%v)", s.cfg.Output.Address(), localCheckpoint, ids, err)
+			s.logger.Errorf("update checkpoint : redis(%s), local(%s), ids(%v), error(%v)", redisCfg.Address(), localCheckpoint, ids, err)
 		}
 		return err
 	}, 5, time.Second*1, 0.3)
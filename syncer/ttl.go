@@ -0,0 +1,304 @@
+package syncer
+
+import (
+	"bytes"
+	"math/rand"
+	"strconv"
+	"time"
+
+	"github.com/mgtv-tech/redis-GunYu/config"
+	"github.com/mgtv-tech/redis-GunYu/pkg/rdb"
+	"github.com/mgtv-tech/redis-GunYu/pkg/util"
+)
+
+// ttlPolicy rewrites ttls of rdb entries and aof commands, a nil policy changes nothing
+type ttlPolicy struct {
+	cfg     config.TtlConfig
+	version string // version of target, empty if it's unknown
+	now     func() time.Time
+	jitter  func(n int64) int64
+}
+
+// newTtlPolicy returns nil if cfg changes nothing
+func newTtlPolicy(cfg *config.TtlConfig, version string) *ttlPolicy {
+	if cfg == nil || *cfg == (config.TtlConfig{}) {
+		return nil
+	}
+	return &ttlPolicy{cfg: *cfg, version: version, now: time.Now, jitter: rand.Int63n}
+}
+
+// rewrites returns true if ttls of commands are changed when they are parsed
+func (tp *ttlPolicy) rewrites() bool {
+	return tp.cfg.Max > 0 || tp.cfg.Jitter > 0
+}
+
+// supports returns true if the target version is not less than version
+func (tp *ttlPolicy) supports(version string) bool {
+	return tp.version == "" || util.VersionGE(tp.version, version, util.VersionMinor)
+}
+
+// deadline caps and jitters the unix time in milliseconds, an expired deadline is not changed
+func (tp *ttlPolicy) deadline(at int64, now int64) int64 {
+	if at <= now {
+		return at
+	}
+	if maxMs := tp.cfg.Max.Milliseconds(); maxMs > 0 && at-now > maxMs {
+		at = now + maxMs
+	}
+	if jitter := tp.cfg.Jitter.Milliseconds(); jitter > 0 {
+		at += tp.jitter(jitter)
+	}
+	return at
+}
+
+// ExpireAt returns the new expiration of an rdb key, and false if the key should be skipped
+func (tp *ttlPolicy) ExpireAt(expireAt uint64) (uint64, bool) {
+	if tp == nil || expireAt == 0 {
+		return expireAt, true
+	}
+	now := tp.now().UnixMilli()
+	if tp.cfg.DropExpired && int64(expireAt) <= now+tp.cfg.ExpiringWithin.Milliseconds() {
+		return 0, false
+	}
+	if tp.cfg.Strip {
+		return 0, true
+	}
+	return uint64(tp.deadline(int64(expireAt), now)), true
+}
+
+// ttlArg is a ttl argument of a command
+type ttlArg struct {
+	index    int // index of the value, the option name is at index-1 for set and getex
+	ms       bool
+	absolute bool
+}
+
+// parseTtlArg returns false if cmd has no ttl argument
+func parseTtlArg(cmd string, args [][]byte) (ta ttlArg, ok bool) {
+	switch cmd {
+	case "expire", "hexpire":
+		return ttlArg{index: 1}, len(args) > 1
+	case "pexpire", "hpexpire":
+		return ttlArg{index: 1, ms: true}, len(args) > 1
+	case "expireat", "hexpireat":
+		return ttlArg{index: 1, absolute: true}, len(args) > 1
+	case "pexpireat", "hpexpireat":
+		return ttlArg{index: 1, ms: true, absolute: true}, len(args) > 1
+	case "setex":
+		return ttlArg{index: 1}, len(args) > 2
+	case "psetex":
+		return ttlArg{index: 1, ms: true}, len(args) > 2
+	case "restore":
+		// restore key ttl value [REPLACE] [ABSTTL] [IDLETIME seconds] [FREQ frequency]
+		if len(args) < 3 || bytes.Equal(args[1], []byte("0")) {
+			return ta, false
+		}
+		return ttlArg{index: 1, ms: true, absolute: indexOfArg(args, 3, "absttl") > 0}, true
+	case "set", "getex":
+		// set key value [NX | XX] [GET] [EX seconds | PX milliseconds | EXAT unix-time-seconds | PXAT unix-time-milliseconds | KEEPTTL]
+		// getex key [EX seconds | PX milliseconds | EXAT unix-time-seconds | PXAT unix-time-milliseconds | PERSIST]
+		from := 2
+		if cmd == "getex" {
+			from = 1
+		}
+		for i := from; i < len(args)-1; i++ {
+			switch util.BytesToString(bytes.ToLower(args[i])) {
+			case "ex":
+				return ttlArg{index: i + 1}, true
+			case "px":
+				return ttlArg{index: i + 1, ms: true}, true
+			case "exat":
+				return ttlArg{index: i + 1, absolute: true}, true
+			case "pxat":
+				return ttlArg{index: i + 1, ms: true, absolute: true}, true
+			}
+		}
+	}
+	return ta, false
+}
+
+// indexOfArg returns the index of the case-insensitive option in args[from:], or -1
+func indexOfArg(args [][]byte, from int, option string) int {
+	for i := from; i < len(args); i++ {
+		if bytes.EqualFold(args[i], []byte(option)) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Rewrite rewrites the ttl of an aof command, it returns true if the command should be dropped.
+// Relative ttls are capped at the time the command is parsed from the local cache, and they are
+// converted to absolute times by Absolute when the command is sent.
+func (tp *ttlPolicy) Rewrite(cmd string, args [][]byte) (string, [][]byte, bool) {
+	if tp == nil || (!tp.cfg.Strip && !tp.rewrites()) {
+		return cmd, args, false
+	}
+	ta, ok := parseTtlArg(cmd, args)
+	if !ok {
+		return cmd, args, false
+	}
+	val, err := strconv.ParseInt(util.BytesToString(args[ta.index]), 10, 64)
+	if err != nil {
+		return cmd, args, false
+	}
+	if !ta.ms {
+		val *= 1000
+	}
+	now := tp.now().UnixMilli()
+	at := val
+	if !ta.absolute {
+		at += now
+	}
+
+	if tp.cfg.Strip {
+		return tp.strip(cmd, args, ta, at <= now)
+	}
+	if at <= now {
+		// the key or fields are deleted by the command
+		return cmd, args, false
+	}
+
+	at = tp.deadline(at, now)
+	absolute := ta.absolute
+	val = at
+	if !absolute {
+		val = at - now
+	}
+	newArgs := append([][]byte(nil), args...)
+	newArgs[ta.index] = []byte(strconv.FormatInt(val, 10))
+
+	switch cmd {
+	case "expire", "pexpire", "expireat", "pexpireat":
+		cmd = "pexpire"
+		if absolute {
+			cmd = "pexpireat"
+		}
+	case "hexpire", "hpexpire", "hexpireat", "hpexpireat":
+		cmd = "hpexpire"
+		if absolute {
+			cmd = "hpexpireat"
+		}
+	case "setex", "psetex":
+		cmd = "psetex"
+	case "set", "getex":
+		newArgs[ta.index-1] = []byte("PX")
+		if absolute {
+			newArgs[ta.index-1] = []byte("PXAT")
+		}
+	}
+	return cmd, newArgs, false
+}
+
+// Absolute converts the relative ttl of an aof command to PEXPIREAT or PXAT if AbsoluteExpire is enabled,
+// it's called when the command is sent, so the time the command waits in output doesn't stretch the ttl.
+// Commands are not changed if the target doesn't support the absolute form
+func (tp *ttlPolicy) Absolute(cmd string, args [][]byte) (string, [][]byte) {
+	if tp == nil || !tp.cfg.AbsoluteExpire {
+		return cmd, args
+	}
+	ta, ok := parseTtlArg(cmd, args)
+	if !ok || ta.absolute {
+		return cmd, args
+	}
+	val, err := strconv.ParseInt(util.BytesToString(args[ta.index]), 10, 64)
+	if err != nil || val <= 0 {
+		// the key or fields are deleted by the command
+		return cmd, args
+	}
+	if !ta.ms {
+		val *= 1000
+	}
+	at := []byte(strconv.FormatInt(tp.now().UnixMilli()+val, 10))
+	newArgs := append([][]byte(nil), args...)
+	newArgs[ta.index] = at
+
+	switch cmd {
+	case "expire", "pexpire":
+		return "pexpireat", newArgs
+	case "hexpire", "hpexpire":
+		return "hpexpireat", newArgs
+	case "setex", "psetex":
+		if tp.supports("6.2") {
+			return "set", [][]byte{args[0], args[2], []byte("PXAT"), at}
+		}
+	case "set", "getex":
+		if tp.supports("6.2") {
+			newArgs[ta.index-1] = []byte("PXAT")
+			return cmd, newArgs
+		}
+	case "restore":
+		if tp.supports("5.0") {
+			return cmd, append(newArgs, []byte("ABSTTL"))
+		}
+	}
+	return cmd, args
+}
+
+// strip removes the ttl of the command, commands that delete keys or fields are converted to deletions
+func (tp *ttlPolicy) strip(cmd string, args [][]byte, ta ttlArg, expired bool) (string, [][]byte, bool) {
+	switch cmd {
+	case "expire", "pexpire", "expireat", "pexpireat":
+		if expired {
+			return "del", args[:1], false
+		}
+		return cmd, args, true
+	case "hexpire", "hpexpire", "hexpireat", "hpexpireat":
+		// hexpire key seconds [NX | XX | GT | LT] FIELDS numfields field [field ...]
+		if i := indexOfArg(args, 2, "fields"); expired && i > 0 && i+2 < len(args) {
+			return "hdel", append([][]byte{args[0]}, args[i+2:]...), false
+		}
+		return cmd, args, true
+	case "setex", "psetex":
+		return "set", [][]byte{args[0], args[2]}, false
+	case "getex":
+		return cmd, args, true
+	case "set":
+		newArgs := append([][]byte(nil), args[:ta.index-1]...)
+		return cmd, append(newArgs, args[ta.index+1:]...), false
+	case "restore":
+		newArgs := append([][]byte(nil), args...)
+		newArgs[1] = []byte("0")
+		if i := indexOfArg(newArgs, 3, "absttl"); i > 0 {
+			newArgs = append(newArgs[:i], newArgs[i+1:]...)
+		}
+		return cmd, newArgs, false
+	}
+	return cmd, args, false
+}
+
+// rewriteRdbTtl rewrites the expiration of e, it returns true if e is skipped.
+// Following bins of a skipped big key are skipped too, dropped keeps the key.
+func (ro *RedisOutput) rewriteRdbTtl(e *rdb.BinEntry, dropped *[]byte) bool {
+	if ro.ttl == nil {
+		return false
+	}
+	if !e.FirstBin() {
+		return *dropped != nil && bytes.Equal(*dropped, e.Key)
+	}
+	*dropped = nil
+	expireAt, ok := ro.ttl.ExpireAt(e.ExpireAt)
+	if !ok {
+		*dropped = append([]byte(nil), e.Key...)
+		return true
+	}
+	e.ExpireAt = expireAt
+	return false
+}
+
+// absoluteTtl converts the relative ttl of ce to an absolute time before ce is sent
+func (ro *RedisOutput) absoluteTtl(ce *cmdExecution) {
+	if ro.ttl == nil || !ro.ttl.cfg.AbsoluteExpire {
+		return
+	}
+	args := make([][]byte, 0, len(ce.Args))
+	for _, arg := range ce.Args {
+		args = append(args, arg.([]byte))
+	}
+	cmd, newArgs := ro.ttl.Absolute(ce.Cmd, args)
+	ce.Cmd = cmd
+	ce.Args = ce.Args[:0]
+	for _, arg := range newArgs {
+		ce.Args = append(ce.Args, arg)
+	}
+}
@@ -0,0 +1,169 @@
+package syncer
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mgtv-tech/redis-GunYu/config"
+)
+
+func newTestTtlPolicy(cfg config.TtlConfig) *ttlPolicy {
+	tp := newTtlPolicy(&cfg, "")
+	tp.now = func() time.Time { return time.UnixMilli(1000000) }
+	tp.jitter = func(n int64) int64 { return n - 1 }
+	return tp
+}
+
+func splitArgs(s string) [][]byte {
+	args := [][]byte{}
+	for _, arg := range strings.Fields(s) {
+		args = append(args, []byte(arg))
+	}
+	return args
+}
+
+func TestTtlPolicyExpireAt(t *testing.T) {
+	assert.Nil(t, newTtlPolicy(nil, ""))
+	assert.Nil(t, newTtlPolicy(&config.TtlConfig{}, ""))
+	var tp *ttlPolicy
+	at, ok := tp.ExpireAt(10)
+	assert.True(t, ok)
+	assert.Equal(t, uint64(10), at)
+
+	tp = newTestTtlPolicy(config.TtlConfig{DropExpired: true, ExpiringWithin: time.Second, Max: time.Minute, Jitter: time.Second})
+	_, ok = tp.ExpireAt(1000000)
+	assert.False(t, ok)
+	_, ok = tp.ExpireAt(1001000)
+	assert.False(t, ok)
+	at, ok = tp.ExpireAt(1002000)
+	assert.True(t, ok)
+	assert.Equal(t, uint64(1002999), at)
+	at, ok = tp.ExpireAt(9000000)
+	assert.True(t, ok)
+	assert.Equal(t, uint64(1060999), at)
+	at, ok = tp.ExpireAt(0)
+	assert.True(t, ok)
+	assert.Equal(t, uint64(0), at)
+
+	tp = newTestTtlPolicy(config.TtlConfig{Strip: true})
+	at, ok = tp.ExpireAt(1)
+	assert.True(t, ok)
+	assert.Equal(t, uint64(0), at)
+}
+
+func TestTtlPolicyRewrite(t *testing.T) {
+	type testCase struct {
+		cmd     string
+		args    string
+		newCmd  string
+		newArgs string
+		drop    bool
+	}
+	run := func(tp *ttlPolicy, cases []testCase) {
+		for _, c := range cases {
+			cmd, args, drop := tp.Rewrite(c.cmd, splitArgs(c.args))
+			assert.Equal(t, c.drop, drop, c.cmd+" "+c.args)
+			if !drop {
+				assert.Equal(t, c.newCmd, cmd, c.cmd+" "+c.args)
+				assert.Equal(t, splitArgs(c.newArgs), args, c.cmd+" "+c.args)
+			}
+		}
+	}
+
+	var tp *ttlPolicy
+	run(tp, []testCase{{cmd: "expire", args: "k 10", newCmd: "expire", newArgs: "k 10"}})
+
+	tp = newTestTtlPolicy(config.TtlConfig{Max: time.Minute})
+	run(tp, []testCase{
+		{cmd: "expire", args: "k 10", newCmd: "pexpire", newArgs: "k 10000"},
+		{cmd: "expire", args: "k 100 NX", newCmd: "pexpire", newArgs: "k 60000 NX"},
+		{cmd: "expire", args: "k 0", newCmd: "expire", newArgs: "k 0"},
+		{cmd: "pexpireat", args: "k 9000000", newCmd: "pexpireat", newArgs: "k 1060000"},
+		{cmd: "expireat", args: "k 9000", newCmd: "pexpireat", newArgs: "k 1060000"},
+		{cmd: "setex", args: "k 100 v", newCmd: "psetex", newArgs: "k 60000 v"},
+		{cmd: "set", args: "k v NX ex 100", newCmd: "set", newArgs: "k v NX PX 60000"},
+		{cmd: "set", args: "k v KEEPTTL", newCmd: "set", newArgs: "k v KEEPTTL"},
+		{cmd: "getex", args: "k EXAT 9000", newCmd: "getex", newArgs: "k PXAT 1060000"},
+		{cmd: "restore", args: "k 0 v", newCmd: "restore", newArgs: "k 0 v"},
+		{cmd: "restore", args: "k 100000 v REPLACE", newCmd: "restore", newArgs: "k 60000 v REPLACE"},
+		{cmd: "hexpire", args: "h 100 FIELDS 1 f", newCmd: "hpexpire", newArgs: "h 60000 FIELDS 1 f"},
+		{cmd: "persist", args: "k", newCmd: "persist", newArgs: "k"},
+	})
+
+	// relative ttls are converted to absolute times when commands are sent
+	tp = newTestTtlPolicy(config.TtlConfig{AbsoluteExpire: true, Jitter: time.Second})
+	run(tp, []testCase{
+		{cmd: "expire", args: "k 10", newCmd: "pexpire", newArgs: "k 10999"},
+		{cmd: "setex", args: "k 10 v", newCmd: "psetex", newArgs: "k 10999 v"},
+		{cmd: "expireat", args: "k 1010", newCmd: "pexpireat", newArgs: "k 1010999"},
+	})
+
+	tp = newTestTtlPolicy(config.TtlConfig{Strip: true})
+	run(tp, []testCase{
+		{cmd: "expire", args: "k 10", drop: true},
+		{cmd: "pexpireat", args: "k 10", newCmd: "del", newArgs: "k"},
+		{cmd: "hexpire", args: "h 10 FIELDS 2 f1 f2", drop: true},
+		{cmd: "hexpire", args: "h 0 FIELDS 2 f1 f2", newCmd: "hdel", newArgs: "h f1 f2"},
+		{cmd: "setex", args: "k 10 v", newCmd: "set", newArgs: "k v"},
+		{cmd: "set", args: "k v PXAT 9000000 GET", newCmd: "set", newArgs: "k v GET"},
+		{cmd: "getex", args: "k EX 10", drop: true},
+		{cmd: "restore", args: "k 9000000 v ABSTTL REPLACE", newCmd: "restore", newArgs: "k 0 v REPLACE"},
+	})
+}
+
+func TestTtlPolicyAbsolute(t *testing.T) {
+	type testCase struct {
+		cmd     string
+		args    string
+		newCmd  string
+		newArgs string
+	}
+	run := func(tp *ttlPolicy, cases []testCase) {
+		for _, c := range cases {
+			cmd, args := tp.Absolute(c.cmd, splitArgs(c.args))
+			assert.Equal(t, c.newCmd, cmd, c.cmd+" "+c.args)
+			assert.Equal(t, splitArgs(c.newArgs), args, c.cmd+" "+c.args)
+		}
+	}
+
+	var tp *ttlPolicy
+	run(tp, []testCase{{cmd: "expire", args: "k 10", newCmd: "expire", newArgs: "k 10"}})
+	tp = newTestTtlPolicy(config.TtlConfig{Max: time.Minute})
+	run(tp, []testCase{{cmd: "expire", args: "k 10", newCmd: "expire", newArgs: "k 10"}})
+
+	tp = newTestTtlPolicy(config.TtlConfig{AbsoluteExpire: true})
+	run(tp, []testCase{
+		{cmd: "expire", args: "k 10", newCmd: "pexpireat", newArgs: "k 1010000"},
+		{cmd: "pexpire", args: "k 10 NX", newCmd: "pexpireat", newArgs: "k 1000010 NX"},
+		{cmd: "expire", args: "k 0", newCmd: "expire", newArgs: "k 0"},
+		{cmd: "pexpireat", args: "k 9000000", newCmd: "pexpireat", newArgs: "k 9000000"},
+		{cmd: "setex", args: "k 10 v", newCmd: "set", newArgs: "k v PXAT 1010000"},
+		{cmd: "set", args: "k v PX 10", newCmd: "set", newArgs: "k v PXAT 1000010"},
+		{cmd: "getex", args: "k EX 10", newCmd: "getex", newArgs: "k PXAT 1010000"},
+		{cmd: "restore", args: "k 10 v", newCmd: "restore", newArgs: "k 1000010 v ABSTTL"},
+		{cmd: "restore", args: "k 10 v ABSTTL", newCmd: "restore", newArgs: "k 10 v ABSTTL"},
+		{cmd: "hpexpire", args: "h 10 FIELDS 1 f", newCmd: "hpexpireat", newArgs: "h 1000010 FIELDS 1 f"},
+		{cmd: "set", args: "k v", newCmd: "set", newArgs: "k v"},
+	})
+
+	// PXAT isn't supported by target
+	tp = newTestTtlPolicy(config.TtlConfig{AbsoluteExpire: true})
+	tp.version = "6.0"
+	run(tp, []testCase{
+		{cmd: "expire", args: "k 10", newCmd: "pexpireat", newArgs: "k 1010000"},
+		{cmd: "setex", args: "k 10 v", newCmd: "setex", newArgs: "k 10 v"},
+		{cmd: "set", args: "k v EX 10", newCmd: "set", newArgs: "k v EX 10"},
+		{cmd: "restore", args: "k 10 v", newCmd: "restore", newArgs: "k 1000010 v ABSTTL"},
+	})
+
+	// the ttl is counted from the time the command is sent
+	ro := &RedisOutput{ttl: newTestTtlPolicy(config.TtlConfig{AbsoluteExpire: true})}
+	ce := cmdExecution{Cmd: "setex", Args: []interface{}{[]byte("k"), []byte("10"), []byte("v")}}
+	ro.ttl.now = func() time.Time { return time.UnixMilli(2000000) }
+	ro.absoluteTtl(&ce)
+	assert.Equal(t, "set", ce.Cmd)
+	assert.Equal(t, []interface{}{[]byte("k"), []byte("v"), []byte("PXAT"), []byte("2010000")}, ce.Args)
+}